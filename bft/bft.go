@@ -0,0 +1,749 @@
+package bft
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// signatureDomain prefixes the signed payloads, so that a vote can never be
+// replayed as the signature of a rumor
+const signatureDomain = "orbitalswarm-bft"
+
+// maxFuture is the number of sequence numbers ahead whose messages are kept
+// until the node catches up
+const maxFuture = 16
+
+// ReplicaName returns the identifier of the vote key of a replica in the
+// keyring
+func ReplicaName(nodeIndex int) string {
+	return fmt.Sprintf("bft-replica%d", nodeIndex)
+}
+
+// voteKey identifies the votes of a phase about a sequence number
+type voteKey struct {
+	phase int
+	view  int
+	seq   int
+}
+
+// BFT replicates a chain of blocks with a PBFT-like protocol, over the rumors
+// of the gossiper. Out of the numParticipant replicas, it tolerates f
+// Byzantine ones as long as numParticipant >= 3f+1. Every vote is signed with
+// the Ed25519 key of its replica, whose public key is in the keyring under
+// ReplicaName, and a vote counts once per replica.
+//
+// The sequence number of a block is its block number. The primary of a view
+// pre-prepares the next block, the replicas prepare it and commit it once a
+// quorum prepared it, and a quorum of commits decides it. The replicas which
+// wait too long for a decision vote to move to the next view, whose primary
+// re-proposes the block a quorum may have prepared. The readers only check
+// the votes to learn the blocks.
+type BFT struct {
+	mutex sync.Mutex
+
+	// base config
+	nodeIndex      int
+	numParticipant int
+	faulty         int
+	replica        bool
+	key            ed25519.PrivateKey
+	keyring        *gossip.Keyring
+	timeout        time.Duration
+	blockFactory   blk.BlockFactory
+
+	// view
+	view       int
+	changingTo int
+	// the pre-prepares of the view need no new view proof
+	justified bool
+	// the view changes electing us, sent with our first pre-prepare
+	newView      []*extramessage.BFTMessage
+	newViewBlock *blk.BlockContainer
+	viewChanges  map[int]map[int]*extramessage.BFTMessage
+	deadline     time.Time
+
+	// sequence number following the tail
+	prePrepare    *extramessage.BFTMessage
+	votes         map[voteKey]map[int]*extramessage.BFTMessage
+	candidates    map[string]*blk.BlockContainer
+	committed     bool
+	preparedBlock *blk.BlockContainer
+	preparedProof []*extramessage.BFTMessage
+	future        []*extramessage.BFTMessage
+
+	// proposals waiting for a block of the same type
+	pending []blk.BlockContent
+	// refuses the blocks we must not prepare
+	check blk.ContentCheck
+
+	// chain of the decided blocks
+	tail    *blk.BlockContainer
+	blocks  map[string]*blk.BlockContainer
+	decided *blk.BlockContainer
+
+	gossiper *gossip.Gossiper
+	// messages sent once the mutex is released
+	outbox []*extramessage.ExtraMessage
+}
+
+// NewBFT creates a replica signing its votes with the given key. The view
+// change timeout is the retry period.
+func NewBFT(numParticipant int, nodeIndex int, retry int, blockFactory blk.BlockFactory, keyring *gossip.Keyring, key ed25519.PrivateKey) *BFT {
+	return &BFT{
+		nodeIndex:      nodeIndex,
+		numParticipant: numParticipant,
+		faulty:         (numParticipant - 1) / 3,
+		replica:        key != nil && nodeIndex < numParticipant,
+		key:            key,
+		keyring:        keyring,
+		timeout:        time.Duration(retry) * time.Second,
+		blockFactory:   blockFactory,
+
+		justified:   true,
+		viewChanges: make(map[int]map[int]*extramessage.BFTMessage),
+
+		votes:      make(map[voteKey]map[int]*extramessage.BFTMessage),
+		candidates: make(map[string]*blk.BlockContainer),
+
+		pending: make([]blk.BlockContent, 0),
+
+		blocks: make(map[string]*blk.BlockContainer),
+	}
+}
+
+// NewBFTReader creates a node which only learns the blocks
+func NewBFTReader(numParticipant int, nodeIndex int, retry int, blockFactory blk.BlockFactory, keyring *gossip.Keyring) *BFT {
+	return NewBFT(numParticipant, nodeIndex, retry, blockFactory, keyring, nil)
+}
+
+// SetContentCheck makes the replicas keep the requests and prepare the
+// blocks only when their contents pass the check
+func (b *BFT) SetContentCheck(check blk.ContentCheck) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.check = check
+}
+
+// IsPrimary tells whether the node is the primary of its view
+func (b *BFT) IsPrimary() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.replica && b.primary(b.view) == b.nodeIndex
+}
+
+// View returns the current view
+func (b *BFT) View() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.view
+}
+
+// Propose a block content. The primary pre-prepares it, the other replicas
+// send it to the primary and vote for a new view if no block of the same type
+// is decided in time.
+func (b *BFT) Propose(g *gossip.Gossiper, blockContent blk.BlockContent) {
+	b.mutex.Lock()
+	defer b.unlock()
+	b.start(g)
+
+	if !b.replica {
+		return
+	}
+	if err := b.check.Content(blockContent); err != nil {
+		log.Printf("BFT node %d refuses its own proposal: %s", b.nodeIndex, err)
+		return
+	}
+	log.Printf("Block type of propose : %s", blockContent.BlockType())
+	b.addPendingLocked(blockContent)
+	if b.deadline.IsZero() {
+		b.resetDeadlineLocked()
+	}
+	if b.primary(b.view) == b.nodeIndex {
+		b.prePrepareLocked()
+		return
+	}
+	b.send(&extramessage.BFTMessage{
+		Phase:  extramessage.BFTRequest,
+		View:   b.view,
+		Seq:    b.next(),
+		Signer: b.nodeIndex,
+		Block:  b.blockFactory.NewGenesisBlock(blockContent.BlockType(), 0, blockContent),
+	})
+}
+
+// GetBlocks returns all the decided blocks. Key is the hexadecimal
+// representation of the block's hash. The first return is the hexadecimal
+// hash of the last block.
+func (b *BFT) GetBlocks() (string, map[string]*blk.BlockContainer) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	blocks := make(map[string]*blk.BlockContainer, len(b.blocks))
+	for hash, block := range b.blocks {
+		blocks[hash] = block
+	}
+	if b.tail == nil {
+		return hex.EncodeToString(make([]byte, 32)), blocks
+	}
+	return hex.EncodeToString(b.tail.Hash()), blocks
+}
+
+// HandleExtraMessage handles the BFT messages. It returns the last block it
+// decided, if any.
+func (b *BFT) HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
+	if msg.BFT == nil {
+		return nil
+	}
+
+	b.mutex.Lock()
+	defer b.unlock()
+	b.start(g)
+
+	b.handleLocked(msg.BFT)
+	decided := b.decided
+	b.decided = nil
+	return decided
+}
+
+// start the timer of the node, once the gossiper is known
+func (b *BFT) start(g *gossip.Gossiper) {
+	if b.gossiper != nil {
+		b.gossiper = g
+		return
+	}
+	b.gossiper = g
+	if b.replica {
+		go b.run()
+	}
+}
+
+func (b *BFT) run() {
+	ticker := time.NewTicker(b.timeout / 4)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		b.tick(now)
+	}
+}
+
+// tick votes for the next view when the current one makes no progress
+func (b *BFT) tick(now time.Time) {
+	b.mutex.Lock()
+	defer b.unlock()
+
+	if b.deadline.IsZero() || now.Before(b.deadline) {
+		return
+	}
+	if len(b.pending) == 0 && b.prePrepare == nil && b.changingTo == b.view {
+		b.deadline = time.Time{}
+		return
+	}
+	b.startViewChangeLocked(b.changingTo + 1)
+}
+
+// send queues a message, it is sent by unlock
+func (b *BFT) send(msg *extramessage.BFTMessage) {
+	b.outbox = append(b.outbox, &extramessage.ExtraMessage{BFT: msg})
+}
+
+// unlock releases the mutex and sends the queued messages, so that the
+// handler of the gossiper never waits for the mutex while we wait for it
+func (b *BFT) unlock() {
+	outbox := b.outbox
+	g := b.gossiper
+	b.outbox = nil
+	b.mutex.Unlock()
+
+	for _, msg := range outbox {
+		if g != nil {
+			g.AddExtraMessage(msg)
+		}
+	}
+}
+
+func (b *BFT) resetDeadlineLocked() {
+	b.deadline = time.Now().Add(b.timeout)
+}
+
+func (b *BFT) primary(view int) int {
+	return view % b.numParticipant
+}
+
+// quorum is the number of votes two sets of which share a correct replica
+func (b *BFT) quorum() int {
+	return (b.numParticipant+b.faulty)/2 + 1
+}
+
+func (b *BFT) next() int {
+	if b.tail == nil {
+		return 0
+	}
+	return b.tail.BlockNumber() + 1
+}
+
+func (b *BFT) tailHash() []byte {
+	if b.tail == nil {
+		return make([]byte, 32)
+	}
+	return b.tail.Hash()
+}
+
+func (b *BFT) addPendingLocked(content blk.BlockContent) {
+	for _, p := range b.pending {
+		if bytes.Equal(p.Hash(), content.Hash()) {
+			return
+		}
+	}
+	b.pending = append(b.pending, content)
+}
+
+// --- Signatures ---
+
+func payload(msg *extramessage.BFTMessage) []byte {
+	buf := bytes.NewBufferString(signatureDomain)
+	varint := make([]byte, binary.MaxVarintLen64)
+	for _, v := range []int{msg.Phase, msg.View, msg.Seq} {
+		buf.Write(varint[:binary.PutVarint(varint, int64(v))])
+	}
+	buf.Write(msg.Digest)
+	return buf.Bytes()
+}
+
+// signAndHandle signs the message with our key, handles it as if we had
+// received it and sends it
+func (b *BFT) signAndHandle(msg *extramessage.BFTMessage) {
+	msg.Signer = b.nodeIndex
+	msg.Signature = ed25519.Sign(b.key, payload(msg))
+	b.send(msg)
+	b.handleLocked(msg)
+}
+
+// verify checks that the message is signed by its replica
+func (b *BFT) verify(msg *extramessage.BFTMessage) bool {
+	if msg.Signer < 0 || msg.Signer >= b.numParticipant {
+		return false
+	}
+	key, ok := b.keyring.PublicKey(ReplicaName(msg.Signer))
+	return ok && len(msg.Signature) == ed25519.SignatureSize && ed25519.Verify(key, payload(msg), msg.Signature)
+}
+
+// validBlock tells whether the block follows the tail at the given sequence
+// number and has the given digest
+func (b *BFT) validBlock(block *blk.BlockContainer, seq int, digest []byte) bool {
+	return block != nil && block.Block != nil && block.GetContent() != nil && !block.IsContentNil() &&
+		block.BlockNumber() == seq && bytes.Equal(block.PreviousHash(), b.tailHash()) &&
+		bytes.Equal(block.Hash(), digest)
+}
+
+// --- Messages ---
+
+func (b *BFT) handleLocked(msg *extramessage.BFTMessage) {
+	if msg.Phase == extramessage.BFTRequest {
+		b.uponRequest(msg)
+		return
+	}
+	if !b.verify(msg) {
+		log.Printf("BFT node %d drops a message with a bad signature from %d", b.nodeIndex, msg.Signer)
+		return
+	}
+
+	next := b.next()
+	if msg.Seq < next {
+		return
+	}
+	if msg.Seq > next {
+		// We missed some blocks, keep it until we catch up
+		if msg.Seq <= next+maxFuture {
+			b.future = append(b.future, msg)
+		}
+		return
+	}
+
+	switch msg.Phase {
+	case extramessage.BFTPrePrepare:
+		b.uponPrePrepare(msg)
+	case extramessage.BFTPrepare, extramessage.BFTCommit:
+		b.uponVote(msg)
+	case extramessage.BFTViewChange:
+		b.uponViewChange(msg)
+	}
+}
+
+// uponRequest keeps the proposal of a replica, so that the primary of any
+// view proposes it
+func (b *BFT) uponRequest(msg *extramessage.BFTMessage) {
+	if !b.replica || msg.Block == nil || msg.Block.Block == nil || msg.Block.GetContent() == nil || msg.Block.IsContentNil() {
+		return
+	}
+	if err := b.check.Block(msg.Block); err != nil {
+		log.Printf("BFT node %d refuses a request: %s", b.nodeIndex, err)
+		return
+	}
+	b.addPendingLocked(msg.Block.GetContent())
+	if b.deadline.IsZero() {
+		b.resetDeadlineLocked()
+	}
+	if b.primary(b.view) == b.nodeIndex {
+		b.prePrepareLocked()
+	}
+}
+
+// prePrepareLocked proposes the next block, if we are the primary
+func (b *BFT) prePrepareLocked() {
+	if b.primary(b.view) != b.nodeIndex || b.changingTo > b.view || b.prePrepare != nil {
+		return
+	}
+	if !b.justified && b.newView == nil {
+		return
+	}
+
+	block := b.newViewBlock
+	if block == nil {
+		if len(b.pending) == 0 {
+			return
+		}
+		content := b.pending[0]
+		block = b.blockFactory.NewBlock(content.BlockType(), b.next(), b.tailHash(), content)
+	}
+
+	msg := &extramessage.BFTMessage{
+		Phase:  extramessage.BFTPrePrepare,
+		View:   b.view,
+		Seq:    b.next(),
+		Digest: block.Hash(),
+		Block:  block,
+	}
+	if !b.justified {
+		msg.Proof = b.newView
+	}
+	b.signAndHandle(msg)
+}
+
+func (b *BFT) uponPrePrepare(msg *extramessage.BFTMessage) {
+	if msg.Signer != b.primary(msg.View) || !b.validBlock(msg.Block, msg.Seq, msg.Digest) {
+		return
+	}
+	b.candidates[hex.EncodeToString(msg.Digest)] = msg.Block
+	if msg.View < b.view || (msg.View == b.view && b.changingTo > b.view) {
+		return
+	}
+
+	if msg.View > b.view || !b.justified {
+		if !b.validNewView(msg) {
+			log.Printf("BFT node %d drops the unjustified pre-prepare of view %d", b.nodeIndex, msg.View)
+			return
+		}
+		if msg.View > b.view {
+			b.enterViewLocked(msg.View)
+		}
+		b.justified = true
+		b.newView = nil
+		b.newViewBlock = nil
+	}
+
+	if b.prePrepare != nil {
+		if !bytes.Equal(b.prePrepare.Digest, msg.Digest) {
+			log.Printf("BFT primary %d proposed two blocks for %d in view %d", msg.Signer, msg.Seq, msg.View)
+		}
+		return
+	}
+	if err := b.check.Block(msg.Block); b.replica && err != nil {
+		log.Printf("BFT node %d refuses block %d of view %d: %s", b.nodeIndex, msg.Seq, msg.View, err)
+		return
+	}
+	b.prePrepare = msg
+	if b.replica {
+		b.resetDeadlineLocked()
+		b.signAndHandle(&extramessage.BFTMessage{
+			Phase:  extramessage.BFTPrepare,
+			View:   msg.View,
+			Seq:    msg.Seq,
+			Digest: msg.Digest,
+		})
+		return
+	}
+	b.checkLocked()
+}
+
+func (b *BFT) uponVote(msg *extramessage.BFTMessage) {
+	if len(msg.Digest) == 0 {
+		return
+	}
+	key := voteKey{phase: msg.Phase, view: msg.View, seq: msg.Seq}
+	votes, ok := b.votes[key]
+	if !ok {
+		votes = make(map[int]*extramessage.BFTMessage)
+		b.votes[key] = votes
+	}
+	if _, ok := votes[msg.Signer]; ok {
+		// A replica votes once
+		return
+	}
+	votes[msg.Signer] = msg
+	b.checkLocked()
+}
+
+// matching returns the votes of the phase for the digest
+func (b *BFT) matching(phase, view, seq int, digest []byte) []*extramessage.BFTMessage {
+	matching := make([]*extramessage.BFTMessage, 0)
+	for _, vote := range b.votes[voteKey{phase: phase, view: view, seq: seq}] {
+		if bytes.Equal(vote.Digest, digest) {
+			matching = append(matching, vote)
+		}
+	}
+	return matching
+}
+
+// checkLocked commits the pre-prepared block once a quorum prepared it, and
+// decides a block once a quorum committed it
+func (b *BFT) checkLocked() {
+	seq := b.next()
+	if b.prePrepare != nil && !b.committed {
+		prepares := b.matching(extramessage.BFTPrepare, b.prePrepare.View, seq, b.prePrepare.Digest)
+		if len(prepares) >= b.quorum() {
+			b.committed = true
+			b.preparedBlock = b.prePrepare.Block
+			b.preparedProof = prepares
+			if b.replica {
+				b.signAndHandle(&extramessage.BFTMessage{
+					Phase:  extramessage.BFTCommit,
+					View:   b.prePrepare.View,
+					Seq:    seq,
+					Digest: b.prePrepare.Digest,
+				})
+				return
+			}
+		}
+	}
+
+	for key, votes := range b.votes {
+		if key.phase != extramessage.BFTCommit || key.seq != seq {
+			continue
+		}
+		for _, vote := range votes {
+			block, ok := b.candidates[hex.EncodeToString(vote.Digest)]
+			if !ok || len(b.matching(key.phase, key.view, seq, vote.Digest)) < b.quorum() {
+				continue
+			}
+			if key.view > b.view {
+				// A quorum moved to that view
+				b.enterViewLocked(key.view)
+				b.justified = true
+			}
+			b.decideLocked(block)
+			return
+		}
+	}
+}
+
+// decideLocked appends the block to the chain and moves to the next sequence
+// number
+func (b *BFT) decideLocked(block *blk.BlockContainer) {
+	log.Printf("BFT node %d decided block %d in view %d", b.nodeIndex, block.BlockNumber(), b.view)
+	b.blocks[hex.EncodeToString(block.Hash())] = block
+	b.tail = block
+	b.decided = block
+
+	// The proposals of the same type are dropped, as in Paxos
+	pending := make([]blk.BlockContent, 0, len(b.pending))
+	for _, p := range b.pending {
+		if p.BlockType() != block.Type {
+			pending = append(pending, p)
+		}
+	}
+	b.pending = pending
+
+	b.prePrepare = nil
+	b.votes = make(map[voteKey]map[int]*extramessage.BFTMessage)
+	b.candidates = make(map[string]*blk.BlockContainer)
+	b.committed = false
+	b.preparedBlock = nil
+	b.preparedProof = nil
+	b.viewChanges = make(map[int]map[int]*extramessage.BFTMessage)
+	b.newViewBlock = nil
+	// The view makes progress
+	b.changingTo = b.view
+	b.deadline = time.Time{}
+	if len(b.pending) > 0 {
+		b.resetDeadlineLocked()
+	}
+
+	future := b.future
+	b.future = nil
+	for _, msg := range future {
+		if msg.Seq >= b.next() {
+			b.handleLocked(msg)
+		}
+	}
+
+	if b.replica {
+		b.prePrepareLocked()
+	}
+}
+
+// --- View change ---
+
+// startViewChangeLocked votes for the given view, reporting the block we
+// prepared if any
+func (b *BFT) startViewChangeLocked(view int) {
+	if view <= b.changingTo || !b.replica {
+		return
+	}
+	log.Printf("BFT node %d votes for view %d", b.nodeIndex, view)
+	b.changingTo = view
+	b.resetDeadlineLocked()
+
+	msg := &extramessage.BFTMessage{
+		Phase: extramessage.BFTViewChange,
+		View:  view,
+		Seq:   b.next(),
+	}
+	if b.preparedBlock != nil {
+		msg.Digest = b.preparedBlock.Hash()
+		msg.Block = b.preparedBlock
+		msg.Proof = b.preparedProof
+	}
+	b.signAndHandle(msg)
+}
+
+// validViewChange checks the prepared block reported by a view change
+func (b *BFT) validViewChange(msg *extramessage.BFTMessage) bool {
+	if msg.Block == nil {
+		return len(msg.Digest) == 0
+	}
+	if !b.validBlock(msg.Block, msg.Seq, msg.Digest) || len(msg.Proof) == 0 {
+		return false
+	}
+	view := msg.Proof[0].View
+	if view >= msg.View {
+		return false
+	}
+	signers := make(map[int]bool)
+	for _, prepare := range msg.Proof {
+		if prepare.Phase != extramessage.BFTPrepare || prepare.View != view || prepare.Seq != msg.Seq ||
+			!bytes.Equal(prepare.Digest, msg.Digest) || !b.verify(prepare) {
+			return false
+		}
+		signers[prepare.Signer] = true
+	}
+	return len(signers) >= b.quorum()
+}
+
+func (b *BFT) uponViewChange(msg *extramessage.BFTMessage) {
+	if msg.View <= b.view || !b.validViewChange(msg) {
+		return
+	}
+	changes, ok := b.viewChanges[msg.View]
+	if !ok {
+		changes = make(map[int]*extramessage.BFTMessage)
+		b.viewChanges[msg.View] = changes
+	}
+	if _, ok := changes[msg.Signer]; ok {
+		return
+	}
+	changes[msg.Signer] = msg
+	if msg.Block != nil {
+		b.candidates[hex.EncodeToString(msg.Digest)] = msg.Block
+	}
+
+	// Follow f+1 replicas, one of them at least is correct
+	if b.replica {
+		target := -1
+		signers := make(map[int]bool)
+		for view, changes := range b.viewChanges {
+			if view <= b.changingTo {
+				continue
+			}
+			for signer := range changes {
+				signers[signer] = true
+			}
+			if target < 0 || view < target {
+				target = view
+			}
+		}
+		if len(signers) >= b.faulty+1 {
+			b.startViewChangeLocked(target)
+		}
+	}
+
+	if len(changes) < b.quorum() || msg.View <= b.view {
+		return
+	}
+	b.enterViewLocked(msg.View)
+	if b.replica && b.primary(msg.View) == b.nodeIndex {
+		proof := make([]*extramessage.BFTMessage, 0, len(changes))
+		for _, change := range changes {
+			proof = append(proof, change)
+		}
+		b.newView = proof
+		b.newViewBlock = highestPrepared(proof)
+		b.prePrepareLocked()
+	}
+}
+
+// enterViewLocked moves to the given view, its pre-prepares need a new view
+// proof until one is accepted
+func (b *BFT) enterViewLocked(view int) {
+	log.Printf("BFT node %d enters view %d", b.nodeIndex, view)
+	b.view = view
+	if b.changingTo < view {
+		b.changingTo = view
+	}
+	b.justified = false
+	b.newView = nil
+	b.newViewBlock = nil
+	b.prePrepare = nil
+	b.committed = false
+	for v := range b.viewChanges {
+		if v <= view {
+			delete(b.viewChanges, v)
+		}
+	}
+	if len(b.pending) > 0 {
+		b.resetDeadlineLocked()
+	}
+}
+
+// highestPrepared returns the block prepared in the highest view by the view
+// changes, if any
+func highestPrepared(changes []*extramessage.BFTMessage) *blk.BlockContainer {
+	var block *blk.BlockContainer
+	view := -1
+	for _, change := range changes {
+		if change.Block != nil && change.Proof[0].View > view {
+			block = change.Block
+			view = change.Proof[0].View
+		}
+	}
+	return block
+}
+
+// validNewView checks that the pre-prepare carries a quorum of view changes
+// for its view, and that it proposes the block they prepared in the highest
+// view if any
+func (b *BFT) validNewView(msg *extramessage.BFTMessage) bool {
+	signers := make(map[int]bool)
+	changes := make([]*extramessage.BFTMessage, 0, len(msg.Proof))
+	for _, change := range msg.Proof {
+		if change.Phase != extramessage.BFTViewChange || change.View != msg.View || change.Seq != msg.Seq ||
+			signers[change.Signer] || !b.verify(change) || !b.validViewChange(change) {
+			return false
+		}
+		signers[change.Signer] = true
+		changes = append(changes, change)
+	}
+	if len(signers) < b.quorum() {
+		return false
+	}
+	prepared := highestPrepared(changes)
+	return prepared == nil || bytes.Equal(prepared.Hash(), msg.Digest)
+}
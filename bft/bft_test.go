@@ -0,0 +1,221 @@
+package bft
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"golang.org/x/xerrors"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+type testNode struct {
+	sync.Mutex
+	gossiper *gossip.Gossiper
+	bft      *BFT
+	decided  chan *blk.BlockContainer
+	// ignores the messages and sends none, as a crashed replica
+	deaf bool
+}
+
+// createKeys generates the vote keys of the replicas
+func createKeys(t *testing.T, numParticipant int) (*gossip.Keyring, []ed25519.PrivateKey) {
+	keyring := gossip.NewKeyring()
+	keys := make([]ed25519.PrivateKey, numParticipant)
+	for i := range keys {
+		key, err := keyring.GenerateKey(ReplicaName(i))
+		require.NoError(t, err)
+		keys[i] = key
+	}
+	return keyring, keys
+}
+
+// createNodes creates numParticipant replicas followed by the given number of
+// readers
+func createNodes(t *testing.T, numParticipant, numReader int) []*testNode {
+	keyring, keys := createKeys(t, numParticipant)
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	nodes := make([]*testNode, numParticipant+numReader)
+	addresses := make([]string, len(nodes))
+	for i := range nodes {
+		g, err := fac.New("", fmt.Sprintf("node%d", i), 10, 0, len(nodes))
+		require.NoError(t, err)
+
+		node := &testNode{
+			gossiper: g,
+			decided:  make(chan *blk.BlockContainer, 10),
+		}
+		if i < numParticipant {
+			node.bft = NewBFT(numParticipant, i, 1, blk.NewGenericBlockFactory(), keyring, keys[i])
+		} else {
+			node.bft = NewBFTReader(numParticipant, i, 1, blk.NewGenericBlockFactory(), keyring)
+		}
+		g.RegisterCallback(func(origin string, msg gossip.GossipPacket) {
+			if msg.Rumor == nil || msg.Rumor.Extra == nil {
+				return
+			}
+			node.Lock()
+			deaf := node.deaf
+			node.Unlock()
+			if deaf {
+				return
+			}
+			block := node.bft.HandleExtraMessage(node.gossiper, msg.Rumor.Extra)
+			if block != nil {
+				node.decided <- block
+			}
+		})
+		nodes[i] = node
+		addresses[i] = g.GetLocalAddr()
+	}
+
+	for i, node := range nodes {
+		for j, address := range addresses {
+			if i != j {
+				node.gossiper.AddAddresses(address)
+			}
+		}
+		ready := make(chan struct{})
+		go node.gossiper.Run(ready)
+		<-ready
+	}
+	return nodes
+}
+
+func waitBlock(t *testing.T, nodes []*testNode, patternID string) {
+	for _, node := range nodes {
+		select {
+		case block := <-node.decided:
+			require.Equal(t, patternID, block.GetContent().(*blk.PathBlockContent).PatternID)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s not decided", patternID)
+		}
+	}
+}
+
+func pathContent(patternID string) *blk.PathBlockContent {
+	return &blk.PathBlockContent{PatternID: patternID, Paths: [][]r3.Vec{{{X: 1}}}}
+}
+
+func TestBFT_Agreement(t *testing.T) {
+	nodes := createNodes(t, 4, 1)
+	defer func() {
+		for _, node := range nodes {
+			node.gossiper.Stop()
+		}
+	}()
+
+	// The primary and the backups get their proposals decided
+	nodes[0].bft.Propose(nodes[0].gossiper, pathContent("first"))
+	waitBlock(t, nodes, "first")
+	nodes[2].bft.Propose(nodes[2].gossiper, pathContent("second"))
+	waitBlock(t, nodes, "second")
+
+	require.True(t, nodes[0].bft.IsPrimary())
+	tail, blocks := nodes[0].bft.GetBlocks()
+	require.Len(t, blocks, 2)
+	for _, node := range nodes[1:] {
+		otherTail, _ := node.bft.GetBlocks()
+		require.Equal(t, tail, otherTail)
+	}
+}
+
+func TestBFT_ViewChange(t *testing.T) {
+	nodes := createNodes(t, 4, 0)
+	defer func() {
+		for _, node := range nodes {
+			node.gossiper.Stop()
+		}
+	}()
+
+	// The primary of view 0 crashed, the others replace it
+	nodes[0].Lock()
+	nodes[0].deaf = true
+	nodes[0].Unlock()
+	nodes[1].bft.Propose(nodes[1].gossiper, pathContent("pattern"))
+	waitBlock(t, nodes[1:], "pattern")
+
+	require.True(t, nodes[1].bft.IsPrimary())
+	for _, node := range nodes[1:] {
+		require.Equal(t, 1, node.bft.View())
+	}
+}
+
+func TestBFT_Votes(t *testing.T) {
+	keyring, keys := createKeys(t, 4)
+	factory := blk.NewGenericBlockFactory()
+	reader := NewBFTReader(4, 4, 1, factory, keyring)
+
+	sign := func(key ed25519.PrivateKey, signer int, msg *extramessage.BFTMessage) *extramessage.ExtraMessage {
+		msg.Signer = signer
+		msg.Signature = ed25519.Sign(key, payload(msg))
+		return &extramessage.ExtraMessage{BFT: msg}
+	}
+	block := factory.NewGenesisBlock(blk.BlockPathStr, 0, pathContent("pattern"))
+	forged := factory.NewGenesisBlock(blk.BlockPathStr, 0, pathContent("forged"))
+	commit := func() *extramessage.BFTMessage {
+		return &extramessage.BFTMessage{Phase: extramessage.BFTCommit, View: 0, Seq: 0, Digest: block.Hash()}
+	}
+
+	// Only the primary pre-prepares
+	require.Nil(t, reader.HandleExtraMessage(nil, sign(keys[1], 1, &extramessage.BFTMessage{
+		Phase: extramessage.BFTPrePrepare, Digest: forged.Hash(), Block: forged,
+	})))
+	require.Nil(t, reader.HandleExtraMessage(nil, sign(keys[0], 0, &extramessage.BFTMessage{
+		Phase: extramessage.BFTPrePrepare, Digest: block.Hash(), Block: block,
+	})))
+
+	// A vote signed with the key of another replica, or sent twice, counts
+	// for nothing
+	require.Nil(t, reader.HandleExtraMessage(nil, sign(keys[0], 0, commit())))
+	require.Nil(t, reader.HandleExtraMessage(nil, sign(keys[3], 1, commit())))
+	require.Nil(t, reader.HandleExtraMessage(nil, sign(keys[0], 0, commit())))
+	require.Nil(t, reader.HandleExtraMessage(nil, sign(keys[2], 2, &extramessage.BFTMessage{
+		Phase: extramessage.BFTCommit, Digest: forged.Hash(),
+	})))
+	require.Nil(t, reader.HandleExtraMessage(nil, sign(keys[1], 1, commit())))
+
+	// The block is decided with a quorum of 3 replicas out of 4
+	decided := reader.HandleExtraMessage(nil, sign(keys[3], 3, commit()))
+	require.NotNil(t, decided)
+	require.Equal(t, block.Hash(), decided.Hash())
+}
+
+func TestBFT_ContentCheck(t *testing.T) {
+	nodes := createNodes(t, 4, 0)
+	defer func() {
+		for _, node := range nodes {
+			node.gossiper.Stop()
+		}
+	}()
+	for _, node := range nodes[1:] {
+		node.bft.SetContentCheck(func(content blk.BlockContent) error {
+			if content.(*blk.PathBlockContent).PatternID == "bad" {
+				return xerrors.New("bad paths")
+			}
+			return nil
+		})
+	}
+
+	// The replicas do not prepare the content they refuse
+	nodes[0].bft.Propose(nodes[0].gossiper, pathContent("bad"))
+	time.Sleep(2 * time.Second)
+	for i, node := range nodes {
+		select {
+		case <-node.decided:
+			t.Fatalf("node %d decided refused content", i)
+		default:
+		}
+	}
+
+	// and replace the primary which does not pre-prepare anything else
+	nodes[1].bft.Propose(nodes[1].gossiper, pathContent("good"))
+	waitBlock(t, nodes, "good")
+	require.True(t, nodes[1].bft.IsPrimary())
+}
@@ -1,18 +1,53 @@
 package consensus
 
 import (
+	"context"
+
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
 	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"golang.org/x/xerrors"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
+var (
+	// ErrNoQuorum is returned when nothing was agreed on before the deadline
+	// of the context, as when a majority of the nodes is unreachable
+	ErrNoQuorum = xerrors.New("no quorum reached in time")
+	// ErrSuperseded is returned when the context is canceled, as when the
+	// ground station aborts the pattern
+	ErrSuperseded = xerrors.New("proposition superseded")
+	// ErrShutdown is returned once the client is closed
+	ErrShutdown = xerrors.New("consensus shut down")
+	// ErrNotProposer is returned by the nodes which only learn the blocks
+	ErrNotProposer = xerrors.New("not a proposer of the consensus")
+	// ErrInvalidPaths is returned when the paths proposed are in conflict
+	ErrInvalidPaths = xerrors.New("paths in conflict")
+)
+
+// ConsensusClient agrees with the other drones on the blocks of the chain.
+// The propositions wait for the agreement until the context is done, and
+// fail with one of the errors above.
 type ConsensusClient interface {
-	ProposeTargets(g *gossip.Gossiper, patternID string, targets []r3.Vec) []r3.Vec
-	ProposePaths(g *gossip.Gossiper, patternID string, paths [][]r3.Vec) [][]r3.Vec
+	ProposeTargets(ctx context.Context, g *gossip.Gossiper, patternID string, targets []r3.Vec) ([]r3.Vec, error)
+	// ProposePaths rejects the paths from the given positions which are in
+	// conflict, with ErrInvalidPaths
+	ProposePaths(ctx context.Context, g *gossip.Gossiper, patternID string, from []r3.Vec, paths [][]r3.Vec) ([][]r3.Vec, error)
+	// ExpectPattern makes the node vote only for the paths of the pattern
+	// which follow its swarm init, see CheckSwarmPaths
+	ExpectPattern(init *extramessage.SwarmInit)
+	// CheckPaths returns the error of CheckSwarmPaths for the paths of the
+	// pattern, or ErrInvalidPaths if the pattern was not expected
+	CheckPaths(patternID string, paths [][]r3.Vec) error
+	// ProposeMembership changes the nodes taking part in the consensus
+	ProposeMembership(ctx context.Context, g *gossip.Gossiper, members []int) ([]int, error)
+	// Close makes the waiting and future propositions fail with ErrShutdown
+	Close()
 
 	GetBlocks() (string, map[string]*blk.BlockContainer)
 	HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer
+	// Verify checks the integrity of the chain, see paxos.VerifyBlocks
+	Verify() error
 
 	IsProposer() bool
 }
@@ -1,13 +1,17 @@
 package consensus
 
 import (
+	"context"
+	"encoding/hex"
 	"log"
 	"sync"
 
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
 	"go.dedis.ch/cs438/orbitalswarm/paxos"
 	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"golang.org/x/xerrors"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
@@ -23,153 +27,493 @@ type pathProposition struct {
 	done      chan [][]r3.Vec
 }
 
+type membershipProposition struct {
+	members []int
+	done    chan []int
+}
+
+// chain is a blockchain the participants agree on
+type chain interface {
+	Propose(g *gossip.Gossiper, blockContent blk.BlockContent)
+	GetBlocks() (string, map[string]*blk.BlockContainer)
+	HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer
+	// SetContentCheck makes the node vote only for the contents passing the
+	// check
+	SetContentCheck(check blk.ContentCheck)
+}
+
+// membershipChain is a chain whose members change with the membership blocks
+type membershipChain interface {
+	chain
+	IsMember() bool
+}
+
+// stoppableChain is a chain running timers until it is stopped
+type stoppableChain interface {
+	chain
+	Stop()
+}
+
 type ConsensusParticipant struct {
-	blockChain *paxos.BlockChain
+	blockChain chain
 
 	// PatternID -> targets
 	patterns map[string][]r3.Vec
 	// PatternID -> path
 	paths map[string][][]r3.Vec
 
-	mutex       sync.Mutex
-	proposed    bool
-	pending     []*targetProposition
-	pendingPath []*pathProposition
+	// number of the last block handled
+	lastBlock int
+
+	mutex             sync.Mutex
+	proposed          bool
+	pending           []*targetProposition
+	pendingPath       []*pathProposition
+	pendingMembership []*membershipProposition
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// PatternID -> swarm init. It has its own mutex, as the chain checks the
+	// proposals with it while we wait for the chain.
+	inits      map[string]*extramessage.SwarmInit
+	mutexInits sync.Mutex
+}
+
+// NewConsensusParticipant returns a participant agreeing with Paxos, which
+// resumes from the state kept in the store
+func NewConsensusParticipant(numDrones, nodeIndex, paxosRetry int, mode paxos.Mode, store paxos.Store) *ConsensusParticipant {
+	return newConsensusParticipant(paxos.NewBlockchain(numDrones, nodeIndex, paxosRetry, blk.NewGenericBlockFactory(), mode, store))
 }
 
-func NewConsensusParticipant(numDrones, nodeIndex, paxosRetry int) *ConsensusParticipant {
-	return &ConsensusParticipant{
-		blockChain: paxos.NewBlockchain(numDrones, nodeIndex, paxosRetry, blk.NewGenericBlockFactory()),
+func newConsensusParticipant(blockChain chain) *ConsensusParticipant {
+	c := &ConsensusParticipant{
+		blockChain: blockChain,
 
 		patterns: make(map[string][]r3.Vec),
 		paths:    make(map[string][][]r3.Vec),
 
-		proposed:    false,
-		pending:     make([]*targetProposition, 0),
-		pendingPath: make([]*pathProposition, 0),
+		lastBlock: -1,
+
+		proposed:          false,
+		pending:           make([]*targetProposition, 0),
+		pendingPath:       make([]*pathProposition, 0),
+		pendingMembership: make([]*membershipProposition, 0),
+
+		closed: make(chan struct{}),
+
+		inits: make(map[string]*extramessage.SwarmInit),
 	}
+	blockChain.SetContentCheck(c.checkContent)
+
+	// Remember the agreements of a reloaded chain, in the order of the chain
+	_, blocks := blockChain.GetBlocks()
+	it := paxos.NewBlockIterator(blocks, false)
+	for it.Next() {
+		block := it.Block()
+		for _, content := range blk.Contents(block) {
+			c.learnLocked(content)
+		}
+		c.lastBlock = block.BlockNumber()
+	}
+	return c
 }
 
-func (c *ConsensusParticipant) ProposeTargets(g *gossip.Gossiper, patternID string, targets []r3.Vec) []r3.Vec {
+func (c *ConsensusParticipant) ProposeTargets(ctx context.Context, g *gossip.Gossiper, patternID string, targets []r3.Vec) ([]r3.Vec, error) {
+	c.mutex.Lock()
 	//PatternID already mapped
-	if ConsensusParticipant, found := c.patterns[patternID]; found {
-		return ConsensusParticipant
+	if agreement, found := c.patterns[patternID]; found {
+		c.mutex.Unlock()
+		return agreement, nil
+	}
+	if c.isClosed() {
+		c.mutex.Unlock()
+		return nil, ErrShutdown
 	}
 
 	// Add the propostion to the pending list
 	prop := &targetProposition{
 		patternID: patternID,
 		targets:   targets,
-		done:      make(chan []r3.Vec),
+		done:      make(chan []r3.Vec, 1),
 	}
-
-	c.mutex.Lock()
 	c.pending = append(c.pending, prop)
-	if !c.proposed {
-		log.Printf("Propose mapping")
-		c.proposed = true
-		c.blockChain.Propose(g, &blk.MappingBlockContent{
-			PatternID: prop.patternID,
-			Targets:   prop.targets,
-		})
-	}
+	c.proposeLocked(g)
 	c.mutex.Unlock()
 
-	return <-prop.done
+	select {
+	case agreement := <-prop.done:
+		return agreement, nil
+	case <-ctx.Done():
+	case <-c.closed:
+	}
+
+	// Withdraw the proposition, unless it was agreed on meanwhile
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, p := range c.pending {
+		if p == prop {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return nil, c.failure(ctx)
+		}
+	}
+	return <-prop.done, nil
 }
 
-func (c *ConsensusParticipant) ProposePaths(g *gossip.Gossiper, patternID string, paths [][]r3.Vec) [][]r3.Vec {
+func (c *ConsensusParticipant) ProposePaths(ctx context.Context, g *gossip.Gossiper, patternID string, from []r3.Vec, paths [][]r3.Vec) ([][]r3.Vec, error) {
+	c.mutex.Lock()
 	//PatternID already mapped
 	if agreement, found := c.paths[patternID]; found {
-		return agreement
+		c.mutex.Unlock()
+		return agreement, nil
+	}
+	if err := c.checkProposal(patternID, from, paths); err != nil {
+		c.mutex.Unlock()
+		log.Printf("Rejecting the paths of pattern %s: %s", patternID, err)
+		return nil, ErrInvalidPaths
+	}
+	if c.isClosed() {
+		c.mutex.Unlock()
+		return nil, ErrShutdown
 	}
 
 	// Add the propostion to the pending list
 	prop := &pathProposition{
 		patternID: patternID,
 		paths:     paths,
-		done:      make(chan [][]r3.Vec),
+		done:      make(chan [][]r3.Vec, 1),
+	}
+	c.pendingPath = append(c.pendingPath, prop)
+	c.proposeLocked(g)
+	c.mutex.Unlock()
+
+	select {
+	case agreement := <-prop.done:
+		return agreement, nil
+	case <-ctx.Done():
+	case <-c.closed:
 	}
 
+	// Withdraw the proposition, unless it was agreed on meanwhile
 	c.mutex.Lock()
-	c.pendingPath = append(c.pendingPath, prop)
-	if !c.proposed {
-		log.Printf("Propose paths")
-		c.proposed = true
-		c.blockChain.Propose(g, &blk.PathBlockContent{
-			PatternID: prop.patternID,
-			Paths:     prop.paths,
-		})
+	defer c.mutex.Unlock()
+	for i, p := range c.pendingPath {
+		if p == prop {
+			c.pendingPath = append(c.pendingPath[:i], c.pendingPath[i+1:]...)
+			return nil, c.failure(ctx)
+		}
+	}
+	return <-prop.done, nil
+}
+
+// ExpectPattern implements consensus.ConsensusClient
+func (c *ConsensusParticipant) ExpectPattern(init *extramessage.SwarmInit) {
+	c.mutexInits.Lock()
+	defer c.mutexInits.Unlock()
+	c.inits[init.PatternID] = init
+}
+
+// CheckPaths implements consensus.ConsensusClient
+func (c *ConsensusParticipant) CheckPaths(patternID string, paths [][]r3.Vec) error {
+	c.mutexInits.Lock()
+	init, ok := c.inits[patternID]
+	c.mutexInits.Unlock()
+	if !ok {
+		return xerrors.Errorf("pattern %s not expected: %w", patternID, ErrInvalidPaths)
+	}
+	return CheckSwarmPaths(init, paths)
+}
+
+// checkProposal checks our own paths, only from the given positions when we
+// do not know the swarm init
+func (c *ConsensusParticipant) checkProposal(patternID string, from []r3.Vec, paths [][]r3.Vec) error {
+	c.mutexInits.Lock()
+	_, ok := c.inits[patternID]
+	c.mutexInits.Unlock()
+	if ok {
+		return c.CheckPaths(patternID, paths)
+	}
+	if conflicts := pathgenerator.NewValidator(nil, 0).Validate(from, nil, paths); len(conflicts) > 0 {
+		return xerrors.Errorf("%s: %w", conflicts[0], ErrInvalidPaths)
+	}
+	return nil
+}
+
+// checkContent refuses the paths which do not follow the swarm init of their
+// pattern, the chain does not vote for them
+func (c *ConsensusParticipant) checkContent(content blk.BlockContent) error {
+	paths, ok := content.(*blk.PathBlockContent)
+	if !ok {
+		return nil
+	}
+	return c.CheckPaths(paths.PatternID, paths.Paths)
+}
+
+// CheckSwarmPaths returns an error wrapping ErrInvalidPaths unless the paths
+// start at the initial positions of the swarm init, avoid each other and the
+// obstacles of its world, and end on its targets. The grounded drones stay
+// where they are.
+func CheckSwarmPaths(init *extramessage.SwarmInit, paths [][]r3.Vec) error {
+	if len(paths) != len(init.InitialPos) {
+		return xerrors.Errorf("%d paths for %d drones: %w", len(paths), len(init.InitialPos), ErrInvalidPaths)
+	}
+	if conflicts := pathgenerator.NewValidator(init.World, 0).Validate(init.InitialPos, nil, paths); len(conflicts) > 0 {
+		return xerrors.Errorf("%s: %w", conflicts[0], ErrInvalidPaths)
+	}
+
+	targets := make(map[r3.Vec]bool, len(init.TargetPos))
+	for _, target := range init.TargetPos {
+		targets[target] = true
+	}
+	for i, path := range paths {
+		end := init.InitialPos[i]
+		for _, move := range path {
+			end = end.Add(move)
+		}
+		if init.IsGrounded(uint32(i)) {
+			if end != init.InitialPos[i] {
+				return xerrors.Errorf("grounded drone %d moves to %v: %w", i, end, ErrInvalidPaths)
+			}
+		} else if !targets[end] {
+			return xerrors.Errorf("drone %d ends at %v, on no target: %w", i, end, ErrInvalidPaths)
+		}
+	}
+	return nil
+}
+
+// ProposeMembership proposes that the given nodes agree on the blocks
+// following the membership block. It returns the members decided, or an error
+// if the consensus does not support membership changes.
+func (c *ConsensusParticipant) ProposeMembership(ctx context.Context, g *gossip.Gossiper, members []int) ([]int, error) {
+	if _, ok := c.blockChain.(membershipChain); !ok {
+		return nil, xerrors.New("the consensus does not support membership changes")
 	}
+
+	// Add the propostion to the pending list
+	prop := &membershipProposition{
+		members: members,
+		done:    make(chan []int, 1),
+	}
+
+	c.mutex.Lock()
+	if c.isClosed() {
+		c.mutex.Unlock()
+		return nil, ErrShutdown
+	}
+	c.pendingMembership = append(c.pendingMembership, prop)
+	c.proposeLocked(g)
 	c.mutex.Unlock()
 
-	return <-prop.done
+	select {
+	case agreement := <-prop.done:
+		return agreement, nil
+	case <-ctx.Done():
+	case <-c.closed:
+	}
+
+	// Withdraw the proposition, unless it was agreed on meanwhile
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for i, p := range c.pendingMembership {
+		if p == prop {
+			c.pendingMembership = append(c.pendingMembership[:i], c.pendingMembership[i+1:]...)
+			return nil, c.failure(ctx)
+		}
+	}
+	return <-prop.done, nil
+}
+
+// failure returns the error of a proposition given up before its agreement
+func (c *ConsensusParticipant) failure(ctx context.Context) error {
+	switch {
+	case c.isClosed():
+		return ErrShutdown
+	case ctx.Err() == context.DeadlineExceeded:
+		return ErrNoQuorum
+	default:
+		return ErrSuperseded
+	}
+}
+
+func (c *ConsensusParticipant) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close makes the waiting and future propositions fail with ErrShutdown, and
+// stops the timers of the chain. The blocks are still learned.
+func (c *ConsensusParticipant) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		if s, ok := c.blockChain.(stoppableChain); ok {
+			s.Stop()
+		}
+	})
+}
+
+// proposeLocked proposes the pending propositions, unless one of our
+// proposals is still being agreed on. The propositions which piled up in the
+// meantime are batched in a single block. A membership change is agreed on
+// alone, as it changes who agrees on the next blocks.
+func (c *ConsensusParticipant) proposeLocked(g *gossip.Gossiper) {
+	if c.proposed {
+		return
+	}
+
+	var content blk.BlockContent
+	if len(c.pendingMembership) > 0 {
+		log.Printf("Propose members")
+		content = &blk.MembershipBlockContent{
+			Members: c.pendingMembership[0].members,
+		}
+	} else {
+		content = c.batchLocked()
+	}
+	if content == nil {
+		return
+	}
+
+	c.proposed = true
+	c.blockChain.Propose(g, content)
+}
+
+// batchLocked returns the content of the pending mappings and paths, one per
+// pattern. A single one keeps its own block type.
+func (c *ConsensusParticipant) batchLocked() blk.BlockContent {
+	batch := &blk.BatchBlockContent{}
+	mapped := make(map[string]bool)
+	for _, p := range c.pending {
+		if !mapped[p.patternID] {
+			mapped[p.patternID] = true
+			batch.Mappings = append(batch.Mappings, &blk.MappingBlockContent{
+				PatternID: p.patternID,
+				Targets:   p.targets,
+			})
+		}
+	}
+	pathed := make(map[string]bool)
+	for _, p := range c.pendingPath {
+		if !pathed[p.patternID] {
+			pathed[p.patternID] = true
+			batch.Paths = append(batch.Paths, &blk.PathBlockContent{
+				PatternID: p.patternID,
+				Paths:     p.paths,
+			})
+		}
+	}
+
+	switch {
+	case len(batch.Mappings)+len(batch.Paths) > 1:
+		log.Printf("Propose a batch of %d mappings and %d paths", len(batch.Mappings), len(batch.Paths))
+		return batch
+	case len(batch.Mappings) == 1:
+		log.Printf("Propose mapping")
+		return batch.Mappings[0]
+	case len(batch.Paths) == 1:
+		log.Printf("Propose paths")
+		return batch.Paths[0]
+	default:
+		return nil
+	}
 }
 
 func (c *ConsensusParticipant) GetBlocks() (string, map[string]*blk.BlockContainer) {
 	return c.blockChain.GetBlocks()
 }
 
+func (c *ConsensusParticipant) Verify() error {
+	return paxos.VerifyBlocks(c.blockChain.GetBlocks())
+}
+
 func (c *ConsensusParticipant) HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
 	blockContainer := c.blockChain.HandleExtraMessage(g, msg)
 	if blockContainer == nil {
 		return nil
 	}
 
-	switch blockContainer.Type {
-	case blk.BlockMappingStr:
-		log.Printf("Received a mapping block")
-		c.handleMappingBlock(blockContainer)
-	case blk.BlockPathStr:
-		log.Printf("Received a path block")
-		c.handlePathBlock(blockContainer)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	newBlocks := c.newBlocksLocked(blockContainer)
+	for _, block := range newBlocks {
+		log.Printf("Received a %s", block.Type)
+		for _, content := range blk.Contents(block) {
+			c.learnLocked(content)
+		}
+	}
+
+	// Our proposal, if any, was either decided or lost its round
+	if len(newBlocks) > 0 {
+		c.proposed = false
+		c.proposeLocked(g)
 	}
 	return blockContainer
 }
 
-func (c *ConsensusParticipant) handleMappingBlock(blockContainer *blk.BlockContainer) {
-	block := blockContainer.Block.(*blk.MappingBlock)
-	if block != nil {
-		blockContent := block.GetContent().(*blk.MappingBlockContent)
-
-		c.patterns[blockContent.PatternID] = blockContent.Targets
+// newBlocksLocked returns the blocks up to the given one which were not
+// handled yet, as several blocks are added at once when catching up
+func (c *ConsensusParticipant) newBlocksLocked(last *blk.BlockContainer) []*blk.BlockContainer {
+	_, blocks := c.blockChain.GetBlocks()
+	newBlocks := make([]*blk.BlockContainer, 0, 1)
+	for block := last; block != nil && block.BlockNumber() > c.lastBlock; block = blocks[hex.EncodeToString(block.PreviousHash())] {
+		newBlocks = append(newBlocks, block)
+	}
+	for i, j := 0, len(newBlocks)-1; i < j; i, j = i+1, j-1 {
+		newBlocks[i], newBlocks[j] = newBlocks[j], newBlocks[i]
+	}
+	if last.BlockNumber() > c.lastBlock {
+		c.lastBlock = last.BlockNumber()
+	}
+	return newBlocks
+}
 
-		// Handle pending propositions
-		c.mutex.Lock()
-		defer c.mutex.Unlock()
-		c.proposed = false
+// learnLocked remembers an agreed content and hands it to the propositions
+// waiting for it
+func (c *ConsensusParticipant) learnLocked(content blk.BlockContent) {
+	switch content := content.(type) {
+	case *blk.MappingBlockContent:
+		c.patterns[content.PatternID] = content.Targets
 
+		pending := make([]*targetProposition, 0)
 		for _, p := range c.pending {
-			p.done <- blockContent.Targets
+			if p.patternID != content.PatternID {
+				pending = append(pending, p)
+				continue
+			}
+			p.done <- content.Targets
 			close(p.done)
 		}
+		c.pending = pending
+	case *blk.PathBlockContent:
+		c.paths[content.PatternID] = content.Paths
 
-		c.pending = make([]*targetProposition, 0)
-	}
-}
-
-func (c *ConsensusParticipant) handlePathBlock(blockContainer *blk.BlockContainer) {
-	block := blockContainer.Block.(*blk.PathBlock)
-	if block != nil {
-		blockContent := block.GetContent().(*blk.PathBlockContent)
-
-		c.paths[blockContent.PatternID] = blockContent.Paths
-
-		// Handle pending propositions
-		c.mutex.Lock()
-		defer c.mutex.Unlock()
-		c.proposed = false
-
+		pending := make([]*pathProposition, 0)
 		for _, p := range c.pendingPath {
-			p.done <- blockContent.Paths
+			if p.patternID != content.PatternID {
+				pending = append(pending, p)
+				continue
+			}
+			p.done <- content.Paths
 			close(p.done)
 		}
-
-		c.pendingPath = make([]*pathProposition, 0)
-		log.Printf("Quit path handle")
+		c.pendingPath = pending
+	case *blk.MembershipBlockContent:
+		for _, p := range c.pendingMembership {
+			p.done <- content.Members
+			close(p.done)
+		}
+		c.pendingMembership = make([]*membershipProposition, 0)
 	}
 }
 
+// IsProposer tells whether the node is a member of the consensus, a removed
+// member only learns the blocks
 func (c *ConsensusParticipant) IsProposer() bool {
+	if m, ok := c.blockChain.(membershipChain); ok {
+		return m.IsMember()
+	}
 	return true
 }
@@ -0,0 +1,236 @@
+package consensus
+
+import (
+	"context"
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"golang.org/x/xerrors"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// testChain decides the blocks appended by the test
+type testChain struct {
+	sync.Mutex
+	factory  blk.BlockFactory
+	proposed []blk.BlockContent
+	blocks   map[string]*blk.BlockContainer
+	tail     *blk.BlockContainer
+	stopped  bool
+}
+
+func (c *testChain) Propose(g *gossip.Gossiper, blockContent blk.BlockContent) {
+	c.Lock()
+	defer c.Unlock()
+	c.proposed = append(c.proposed, blockContent)
+}
+
+func (c *testChain) GetBlocks() (string, map[string]*blk.BlockContainer) {
+	c.Lock()
+	defer c.Unlock()
+	blocks := make(map[string]*blk.BlockContainer)
+	for hash, block := range c.blocks {
+		blocks[hash] = block
+	}
+	if c.tail == nil {
+		return "", blocks
+	}
+	return hex.EncodeToString(c.tail.Hash()), blocks
+}
+
+func (c *testChain) HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
+	c.Lock()
+	defer c.Unlock()
+	return c.tail
+}
+
+func (c *testChain) SetContentCheck(check blk.ContentCheck) {}
+
+func (c *testChain) Stop() {
+	c.Lock()
+	defer c.Unlock()
+	c.stopped = true
+}
+
+// lastProposed returns the last content proposed, once there are n of them
+func (c *testChain) lastProposed(t *testing.T, n int) blk.BlockContent {
+	require.Eventually(t, func() bool {
+		c.Lock()
+		defer c.Unlock()
+		return len(c.proposed) >= n
+	}, time.Second, time.Millisecond)
+	c.Lock()
+	defer c.Unlock()
+	require.Len(t, c.proposed, n)
+	return c.proposed[n-1]
+}
+
+// decide appends the given content to the chain and lets the participant
+// learn it
+func (c *testChain) decide(p *ConsensusParticipant, content blk.BlockContent) {
+	c.Lock()
+	number := 0
+	var block *blk.BlockContainer
+	if c.tail == nil {
+		block = c.factory.NewGenesisBlock(content.BlockType(), number, content)
+	} else {
+		number = c.tail.BlockNumber() + 1
+		block = c.factory.NewBlock(content.BlockType(), number, c.tail.Hash(), content)
+	}
+	c.blocks[hex.EncodeToString(block.Hash())] = block
+	c.tail = block
+	c.Unlock()
+
+	p.HandleExtraMessage(nil, &extramessage.ExtraMessage{})
+}
+
+func TestConsensusParticipant_Batch(t *testing.T) {
+	chain := &testChain{factory: blk.NewGenericBlockFactory(), blocks: make(map[string]*blk.BlockContainer)}
+	participant := newConsensusParticipant(chain)
+
+	targetsA := []r3.Vec{{X: 1}}
+	targetsB := []r3.Vec{{Y: 2}}
+	pathsA := [][]r3.Vec{{{X: 1}}}
+	doneA := make(chan []r3.Vec)
+	go func() {
+		targets, err := participant.ProposeTargets(context.Background(), nil, "a", targetsA)
+		require.NoError(t, err)
+		doneA <- targets
+	}()
+
+	// A single proposition keeps its block type
+	require.Equal(t, &blk.MappingBlockContent{PatternID: "a", Targets: targetsA}, chain.lastProposed(t, 1))
+
+	// The propositions made during the round wait for it
+	doneB := make(chan []r3.Vec)
+	donePaths := make(chan [][]r3.Vec)
+	go func() {
+		targets, err := participant.ProposeTargets(context.Background(), nil, "b", targetsB)
+		require.NoError(t, err)
+		doneB <- targets
+	}()
+	go func() {
+		paths, err := participant.ProposePaths(context.Background(), nil, "a", []r3.Vec{{}}, pathsA)
+		require.NoError(t, err)
+		donePaths <- paths
+	}()
+	require.Eventually(t, func() bool {
+		participant.mutex.Lock()
+		defer participant.mutex.Unlock()
+		return len(participant.pending) == 2 && len(participant.pendingPath) == 1
+	}, time.Second, time.Millisecond)
+
+	chain.decide(participant, chain.lastProposed(t, 1))
+	require.Equal(t, targetsA, <-doneA)
+
+	// Then they are committed at once, each getting its own part
+	batch, ok := chain.lastProposed(t, 2).(*blk.BatchBlockContent)
+	require.True(t, ok)
+	require.Len(t, batch.Mappings, 1)
+	require.Equal(t, "b", batch.Mappings[0].PatternID)
+	require.Len(t, batch.Paths, 1)
+	require.Equal(t, "a", batch.Paths[0].PatternID)
+
+	chain.decide(participant, batch)
+	require.Equal(t, targetsB, <-doneB)
+	require.Equal(t, pathsA, <-donePaths)
+
+	// The agreements are kept, a restarted participant learns them too
+	targets, err := participant.ProposeTargets(context.Background(), nil, "b", nil)
+	require.NoError(t, err)
+	require.Equal(t, targetsB, targets)
+	restarted := newConsensusParticipant(chain)
+	paths, err := restarted.ProposePaths(context.Background(), nil, "a", nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, pathsA, paths)
+	require.NoError(t, restarted.Verify())
+}
+
+func TestConsensusParticipant_Errors(t *testing.T) {
+	chain := &testChain{factory: blk.NewGenericBlockFactory(), blocks: make(map[string]*blk.BlockContainer)}
+	participant := newConsensusParticipant(chain)
+
+	// Nothing is ever decided
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := participant.ProposePaths(ctx, nil, "a", nil, nil)
+	require.Equal(t, ErrNoQuorum, err)
+
+	// Two drones swapping are never proposed
+	_, err = participant.ProposePaths(context.Background(), nil, "a", []r3.Vec{{X: 0}, {X: 1}}, [][]r3.Vec{{{X: 1}}, {{X: -1}}})
+	require.Equal(t, ErrInvalidPaths, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	go cancel()
+	_, err = participant.ProposeTargets(ctx, nil, "a", nil)
+	require.Equal(t, ErrSuperseded, err)
+
+	// The propositions given up are not proposed again
+	participant.mutex.Lock()
+	require.Empty(t, participant.pending)
+	require.Empty(t, participant.pendingPath)
+	participant.mutex.Unlock()
+	chain.decide(participant, &blk.NamingBlockContent{Filename: "file"})
+	chain.lastProposed(t, 1)
+
+	errs := make(chan error)
+	go func() {
+		_, err := participant.ProposeTargets(context.Background(), nil, "b", nil)
+		errs <- err
+	}()
+	chain.lastProposed(t, 2)
+	participant.Close()
+	require.Equal(t, ErrShutdown, <-errs)
+	chain.Lock()
+	require.True(t, chain.stopped)
+	chain.Unlock()
+	_, err = participant.ProposePaths(context.Background(), nil, "b", nil, nil)
+	require.Equal(t, ErrShutdown, err)
+
+	_, err = newConsensusReader(chain).ProposePaths(context.Background(), nil, "b", nil, nil)
+	require.Equal(t, ErrNotProposer, err)
+}
+
+func TestConsensusParticipant_CheckPaths(t *testing.T) {
+	init := &extramessage.SwarmInit{
+		PatternID:  "a",
+		InitialPos: []r3.Vec{{X: 0}, {X: 2}, {X: 4}},
+		TargetPos:  []r3.Vec{{X: 0, Y: 2}, {X: 2, Y: 2}, {X: 4, Y: 2}},
+		Grounded:   []uint32{2},
+	}
+	valid := [][]r3.Vec{{{Y: 2}}, {{Y: 2}}, {{}}}
+
+	require.NoError(t, CheckSwarmPaths(init, valid))
+	for name, paths := range map[string][][]r3.Vec{
+		"off target":     {{{Y: 1}}, {{Y: 2}}, {{}}},
+		"grounded moves": {{{Y: 2}}, {{Y: 2}}, {{Y: 2}}},
+		"missing path":   {{{Y: 2}}, {{Y: 2}}},
+	} {
+		err := CheckSwarmPaths(init, paths)
+		require.True(t, xerrors.Is(err, ErrInvalidPaths), name)
+	}
+
+	obstructed := *init
+	obstructed.World = &world.World{Obstacles: []world.Box{{Min: r3.Vec{X: -1, Y: 0.5, Z: -1}, Max: r3.Vec{X: 1, Y: 1, Z: 1}}}}
+	require.True(t, xerrors.Is(CheckSwarmPaths(&obstructed, valid), ErrInvalidPaths))
+
+	// The chain only votes for the paths of an expected pattern
+	chain := &testChain{factory: blk.NewGenericBlockFactory(), blocks: make(map[string]*blk.BlockContainer)}
+	participant := newConsensusParticipant(chain)
+	require.True(t, xerrors.Is(participant.checkContent(&blk.PathBlockContent{PatternID: "a", Paths: valid}), ErrInvalidPaths))
+	require.NoError(t, participant.checkContent(&blk.MappingBlockContent{PatternID: "a"}))
+	participant.ExpectPattern(init)
+	require.NoError(t, participant.checkContent(&blk.PathBlockContent{PatternID: "a", Paths: valid}))
+
+	// Paths ending off target are never proposed
+	_, err := participant.ProposePaths(context.Background(), nil, "a", init.InitialPos, [][]r3.Vec{{{Y: 1}}, {{Y: 2}}, {{}}})
+	require.Equal(t, ErrInvalidPaths, err)
+	require.Empty(t, chain.proposed)
+}
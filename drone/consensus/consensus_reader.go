@@ -1,6 +1,8 @@
 package consensus
 
 import (
+	"context"
+
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
 	"go.dedis.ch/cs438/orbitalswarm/paxos"
@@ -8,35 +10,85 @@ import (
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
+// ConsensusReader learns the blocks without taking part in the consensus. It
+// is promoted to a participant once a membership block adds it to the
+// members.
 type ConsensusReader struct {
-	blockChain *paxos.BlockChain
+	participant *ConsensusParticipant
+}
+
+func NewConsensusReader(numDrones, nodeIndex, paxosRetry int, mode paxos.Mode) *ConsensusReader {
+	return newConsensusReader(paxos.NewBlockchain(numDrones, nodeIndex, paxosRetry, blk.NewGenericBlockFactory(), mode, paxos.NewMemoryStore()))
 }
 
-func NewConsensusReader(numDrones, nodeIndex, paxosRetry int) *ConsensusReader {
+func newConsensusReader(blockChain chain) *ConsensusReader {
 	return &ConsensusReader{
-		blockChain: paxos.NewBlockchain(numDrones, nodeIndex, paxosRetry, blk.NewGenericBlockFactory()),
+		participant: newConsensusParticipant(blockChain),
 	}
 }
 
-func (c *ConsensusReader) ProposeTargets(g *gossip.Gossiper, patternID string, targets []r3.Vec) []r3.Vec {
-	return nil
+// promoted tells whether the node became a member of the consensus
+func (c *ConsensusReader) promoted() bool {
+	m, ok := c.participant.blockChain.(membershipChain)
+	return ok && m.IsMember()
+}
+
+func (c *ConsensusReader) ProposeTargets(ctx context.Context, g *gossip.Gossiper, patternID string, targets []r3.Vec) ([]r3.Vec, error) {
+	if c.promoted() {
+		return c.participant.ProposeTargets(ctx, g, patternID, targets)
+	}
+	return nil, ErrNotProposer
 
 }
-func (c *ConsensusReader) ProposePaths(g *gossip.Gossiper, patternID string, paths [][]r3.Vec) [][]r3.Vec {
-	return nil
+func (c *ConsensusReader) ProposePaths(ctx context.Context, g *gossip.Gossiper, patternID string, from []r3.Vec, paths [][]r3.Vec) ([][]r3.Vec, error) {
+	if c.promoted() {
+		return c.participant.ProposePaths(ctx, g, patternID, from, paths)
+	}
+	return nil, ErrNotProposer
+}
+
+// ExpectPattern implements consensus.ConsensusClient. The paths are only
+// checked once the reader is promoted.
+func (c *ConsensusReader) ExpectPattern(init *extramessage.SwarmInit) {
+	c.participant.ExpectPattern(init)
+}
+
+// CheckPaths implements consensus.ConsensusClient
+func (c *ConsensusReader) CheckPaths(patternID string, paths [][]r3.Vec) error {
+	return c.participant.CheckPaths(patternID, paths)
+}
+
+func (c *ConsensusReader) ProposeMembership(ctx context.Context, g *gossip.Gossiper, members []int) ([]int, error) {
+	if c.promoted() {
+		return c.participant.ProposeMembership(ctx, g, members)
+	}
+	return nil, ErrNotProposer
+}
+
+func (c *ConsensusReader) Close() {
+	c.participant.Close()
 }
 
 func (c *ConsensusReader) GetBlocks() (string, map[string]*blk.BlockContainer) {
-	return c.blockChain.GetBlocks()
+	return c.participant.GetBlocks()
+}
+
+func (c *ConsensusReader) Verify() error {
+	return c.participant.Verify()
 }
 
 func (c *ConsensusReader) HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
-	if msg.PaxosTLC != nil {
-		return c.blockChain.HandleExtraMessage(g, msg)
+	// Readers learn the blocks from TLC with Paxos, from the entries of the
+	// leader and the responses of the followers with Raft, and from the
+	// signed votes with BFT. They catch up, and help the others to, with the
+	// sync messages.
+	if c.promoted() || msg.PaxosTLC != nil || msg.RaftAppendEntries != nil || msg.RaftAppendResponse != nil ||
+		msg.SyncRequest != nil || msg.SyncResponse != nil || msg.BFT != nil {
+		return c.participant.HandleExtraMessage(g, msg)
 	}
 	return nil
 }
 
 func (c *ConsensusReader) IsProposer() bool {
-	return false
+	return c.promoted()
 }
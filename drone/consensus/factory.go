@@ -0,0 +1,135 @@
+package consensus
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"go.dedis.ch/cs438/orbitalswarm/bft"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/cs438/orbitalswarm/raft"
+)
+
+// Factory creates the consensus clients of the nodes of a swarm
+type Factory interface {
+	// NewParticipant returns the client of a node taking part in the
+	// consensus, nodeIndex is lower than numParticipant
+	NewParticipant(numParticipant, nodeIndex, retry int) ConsensusClient
+	// NewReader returns the client of a node which only learns the blocks
+	NewReader(numParticipant, nodeIndex, retry int) ConsensusClient
+}
+
+// FactoryByName returns the factory of the given consensus: paxos,
+// multipaxos, raft or bft. The Paxos participants keep their state in dataDir,
+// or in memory if it is empty.
+func FactoryByName(name string, dataDir string) (Factory, error) {
+	switch name {
+	case "raft":
+		return NewRaftFactory(), nil
+	case "bft":
+		return NewBFTFactory(gossip.NewKeyring()), nil
+	}
+	mode, err := paxos.ModeByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return NewPaxosFactory(mode, dataDir), nil
+}
+
+// PaxosFactory creates clients agreeing with Paxos and TLC
+//
+// - implements consensus.Factory
+type PaxosFactory struct {
+	mode    paxos.Mode
+	dataDir string
+}
+
+// NewPaxosFactory returns a factory of Paxos clients in the given mode. The
+// participants keep their state in a log per node in dataDir, or in memory if
+// it is empty.
+func NewPaxosFactory(mode paxos.Mode, dataDir string) PaxosFactory {
+	return PaxosFactory{mode: mode, dataDir: dataDir}
+}
+
+// NewParticipant implements consensus.Factory. It panics if the log of the
+// node cannot be opened.
+func (f PaxosFactory) NewParticipant(numParticipant, nodeIndex, retry int) ConsensusClient {
+	var store paxos.Store = paxos.NewMemoryStore()
+	if f.dataDir != "" {
+		err := os.MkdirAll(f.dataDir, 0700)
+		if err != nil {
+			panic(err)
+		}
+		store, err = paxos.NewFileStore(filepath.Join(f.dataDir, fmt.Sprintf("node%d.wal", nodeIndex)))
+		if err != nil {
+			panic(err)
+		}
+	}
+	return NewConsensusParticipant(numParticipant, nodeIndex, retry, f.mode, store)
+}
+
+// NewReader implements consensus.Factory
+func (f PaxosFactory) NewReader(numParticipant, nodeIndex, retry int) ConsensusClient {
+	return NewConsensusReader(numParticipant, nodeIndex, retry, f.mode)
+}
+
+// RaftFactory creates clients agreeing with Raft
+//
+// - implements consensus.Factory
+type RaftFactory struct{}
+
+// NewRaftFactory returns a factory of Raft clients
+func NewRaftFactory() RaftFactory {
+	return RaftFactory{}
+}
+
+// NewParticipant implements consensus.Factory
+func (f RaftFactory) NewParticipant(numParticipant, nodeIndex, retry int) ConsensusClient {
+	return NewRaftParticipant(numParticipant, nodeIndex, retry)
+}
+
+// NewReader implements consensus.Factory
+func (f RaftFactory) NewReader(numParticipant, nodeIndex, retry int) ConsensusClient {
+	return NewRaftReader(numParticipant, nodeIndex, retry)
+}
+
+// NewRaftParticipant returns a participant replicating the chain with Raft
+func NewRaftParticipant(numDrones, nodeIndex, retry int) *ConsensusParticipant {
+	return newConsensusParticipant(raft.NewRaft(numDrones, nodeIndex, retry, blk.NewGenericBlockFactory()))
+}
+
+// NewRaftReader returns a reader following the chain replicated with Raft
+func NewRaftReader(numDrones, nodeIndex, retry int) *ConsensusReader {
+	return newConsensusReader(raft.NewRaftReader(numDrones, nodeIndex, retry, blk.NewGenericBlockFactory()))
+}
+
+// BFTFactory creates clients agreeing with the Byzantine fault tolerant
+// consensus. The vote keys of the participants are generated in the keyring,
+// where the other nodes find them.
+//
+// - implements consensus.Factory
+type BFTFactory struct {
+	keyring *gossip.Keyring
+}
+
+// NewBFTFactory returns a factory of BFT clients sharing the given keyring
+func NewBFTFactory(keyring *gossip.Keyring) BFTFactory {
+	return BFTFactory{keyring: keyring}
+}
+
+// NewParticipant implements consensus.Factory. It panics if the vote key of
+// the node cannot be generated.
+func (f BFTFactory) NewParticipant(numParticipant, nodeIndex, retry int) ConsensusClient {
+	key, err := f.keyring.GenerateKey(bft.ReplicaName(nodeIndex))
+	if err != nil {
+		panic(err)
+	}
+	return newConsensusParticipant(bft.NewBFT(numParticipant, nodeIndex, retry, blk.NewGenericBlockFactory(), f.keyring, key))
+}
+
+// NewReader implements consensus.Factory
+func (f BFTFactory) NewReader(numParticipant, nodeIndex, retry int) ConsensusClient {
+	return newConsensusReader(bft.NewBFTReader(numParticipant, nodeIndex, retry, blk.NewGenericBlockFactory(), f.keyring))
+}
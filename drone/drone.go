@@ -3,19 +3,25 @@
 package drone
 
 import (
+	"context"
+	"math"
 	"strconv"
 	"sync"
+	"time"
 
 	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
 
 	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
 	"go.dedis.ch/cs438/orbitalswarm/drone/mapping"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
+	"go.dedis.ch/cs438/orbitalswarm/world"
 	"gonum.org/v1/gonum/spatial/r3"
 
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
 
 	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
 )
 
 type state int
@@ -26,8 +32,44 @@ const (
 	MAPPING
 	GENERATING_PATH
 	MOVING
+	RETURNING
+	LANDING
+	GROUNDED
 )
 
+// groundStation is the identifier of the ground station in the gossip network
+const groundStation = "GS"
+
+// heartbeatPeriod is the longest time a drone stays without sending its
+// telemetry to the ground station
+const heartbeatPeriod = time.Second
+
+// defaultProposeTimeout is the longest time a drone waits for the swarm to
+// agree on the paths of a pattern
+const defaultProposeTimeout = time.Minute
+
+// errGivenUp is returned by the steps of a pattern which was given up
+var errGivenUp = xerrors.New("pattern given up")
+
+var stateNames = map[state]string{
+	IDLE:            "IDLE",
+	READY:           "READY",
+	MAPPING:         "MAPPING",
+	GENERATING_PATH: "GENERATING_PATH",
+	MOVING:          "MOVING",
+	RETURNING:       "RETURNING",
+	LANDING:         "LANDING",
+	GROUNDED:        "GROUNDED",
+}
+
+func (s state) String() string {
+	name, ok := stateNames[s]
+	if !ok {
+		return "UNKNOWN"
+	}
+	return name
+}
+
 type Drone struct {
 	droneID uint32
 	status  state
@@ -35,23 +77,68 @@ type Drone struct {
 	position r3.Vec
 	target   r3.Vec
 	path     []r3.Vec
-
+	home     r3.Vec
+
+	patternID string
+	// number of the current pattern, so that the late steps of a pattern
+	// given up do not act on the next one
+	patternSeq int
+	start      time.Time
+
+	// cancels the agreement on the current pattern
+	cancelPattern  context.CancelFunc
+	proposeTimeout time.Duration
+	muxPattern     sync.Mutex
+
+	energy     EnergyModel
+	energyLeft float64
+	lastUpdate time.Time
+	muxEnergy  sync.Mutex
+
+	// positions of the drones at the beginning of the last pattern or
+	// maneuver, and at its end
+	swarmStart     []r3.Vec
+	swarmPositions []r3.Vec
+	// obstacles of the last pattern
+	swarmWorld     *world.World
+	lastContact    time.Time
+	contactTimeout time.Duration
+	muxRecovery    sync.Mutex
+	stop           chan struct{}
+
+	lastTelemetry time.Time
+	muxTelemetry  sync.Mutex
+
+	// replaced when the drone restarts after a crash, see getGossiper
 	gossiper        *gossip.Gossiper
+	muxGossiper     sync.RWMutex
 	consensusClient consensus.ConsensusClient
 	targetsMapper   mapping.TargetsMapper
 	pathGenerator   pathgenerator.PathGenerator
 	simulator       *simulator
 
+	// guards the status, the position, the path and the pattern of the drone
 	muxFly sync.Mutex
+	// held during a flight, so that the drone follows a single path at a time
+	muxFlight sync.Mutex
 }
 
-func NewDrone(droneID uint32, g *gossip.Gossiper, addresses []string, position r3.Vec, targetsMapper mapping.TargetsMapper, consensusClient consensus.ConsensusClient, pathGenerator pathgenerator.PathGenerator) *Drone {
+func NewDrone(droneID uint32, g *gossip.Gossiper, addresses []string, position r3.Vec, targetsMapper mapping.TargetsMapper, consensusClient consensus.ConsensusClient, pathGenerator pathgenerator.PathGenerator, energy EnergyModel) *Drone {
 
 	d := &Drone{
 		droneID: droneID,
 		status:  IDLE,
 
 		position: position,
+		home:     position,
+
+		start:          time.Now(),
+		proposeTimeout: defaultProposeTimeout,
+		lastContact:    time.Now(),
+		stop:           make(chan struct{}),
+
+		energy:     energy,
+		energyLeft: energy.Capacity,
 
 		gossiper:        g,
 		consensusClient: consensusClient,
@@ -64,50 +151,264 @@ func NewDrone(droneID uint32, g *gossip.Gossiper, addresses []string, position r
 	return d
 }
 
+// replaceGossiper makes the drone use a new gossiper, after its previous one
+// crashed
+func (d *Drone) replaceGossiper(g *gossip.Gossiper, addresses []string) {
+	g.AddAddresses(addresses...)
+	g.RegisterCallback(d.HandleGossipMessage)
+	d.muxGossiper.Lock()
+	d.gossiper = g
+	d.muxGossiper.Unlock()
+}
+
+// getGossiper returns the gossiper the drone currently uses
+func (d *Drone) getGossiper() *gossip.Gossiper {
+	d.muxGossiper.RLock()
+	defer d.muxGossiper.RUnlock()
+	return d.gossiper
+}
+
 // Run ...
 func (d *Drone) Run() {
 	d.simulator = NewSimulator(d)
+	go d.watch()
 }
 
-// UpdateLocation of the drone
-func (d *Drone) UpdateLocation(location r3.Vec) {
-	d.gossiper.AddPrivateMessage(gossip.PrivateMessageData{
-		Location: location,
-		DroneID:  d.droneID,
-	}, "GS", d.gossiper.GetIdentifier(), 10)
+// Stop the monitoring of the drone, and give up the agreement on the
+// current pattern
+func (d *Drone) Stop() {
+	close(d.stop)
+	d.consensusClient.Close()
+}
+
+// SetProposeTimeout sets the longest time the drone waits for the swarm to
+// agree on the paths of a pattern before giving it up
+func (d *Drone) SetProposeTimeout(timeout time.Duration) {
+	d.muxPattern.Lock()
+	defer d.muxPattern.Unlock()
+	d.proposeTimeout = timeout
+}
+
+// patternContext returns the context of the agreement on the given pattern,
+// canceled when the pattern is given up
+func (d *Drone) patternContext(seq int) (context.Context, context.CancelFunc) {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	d.muxPattern.Lock()
+	defer d.muxPattern.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), d.proposeTimeout)
+	if seq == d.patternSeq {
+		d.cancelPattern = cancel
+	} else {
+		cancel()
+	}
+	return ctx, cancel
+}
+
+// startPattern makes an idle drone join the pattern of the swarm init, and
+// returns the number of the pattern. It returns false when the drone is busy
+// or grounded by the ground station.
+func (d *Drone) startPattern(init *extramessage.SwarmInit) (int, bool) {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	if d.status != IDLE {
+		return 0, false
+	}
+	// The ground station grounds the drones low on battery, so that the swarm
+	// plans around them
+	if init.IsGrounded(d.droneID) {
+		log.Printf("%s Battery too low, pattern %s refused", d.getGossiper().GetIdentifier(), init.PatternID)
+		return 0, false
+	}
+	if d.lowBattery() {
+		log.Printf("%s Battery low but not grounded, joining pattern %s", d.getGossiper().GetIdentifier(), init.PatternID)
+	}
+	d.status = READY
+	d.patternID = init.PatternID
+	d.patternSeq++
+	return d.patternSeq, true
+}
+
+// currentPattern returns the number of the current pattern
+func (d *Drone) currentPattern() int {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	return d.patternSeq
+}
+
+// preparingLocked tells whether the given pattern is the current one and the
+// drone did not take off yet. muxFly must be held.
+func (d *Drone) preparingLocked(seq int) bool {
+	if seq != d.patternSeq {
+		return false
+	}
+	return d.status == READY || d.status == MAPPING || d.status == GENERATING_PATH
+}
+
+// advance moves the given pattern to the next step, and returns false if it
+// was given up
+func (d *Drone) advance(seq int, status state) bool {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	if !d.preparingLocked(seq) {
+		return false
+	}
+	d.status = status
+	return true
+}
+
+// abort gives up the given pattern if it is still the current one and the
+// drone did not take off yet
+func (d *Drone) abort(seq int, reason string) {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	if seq != d.patternSeq {
+		return
+	}
+
+	d.muxPattern.Lock()
+	if d.cancelPattern != nil {
+		d.cancelPattern()
+	}
+	d.muxPattern.Unlock()
+
+	if d.preparingLocked(seq) {
+		log.Printf("%s Pattern %s given up: %s", d.getGossiper().GetIdentifier(), d.patternID, reason)
+		d.status = IDLE
+	}
+}
+
+// getPosition returns the current position of the drone
+func (d *Drone) getPosition() r3.Vec {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	return d.position
+}
+
+// UpdateLocation of the drone, and send its telemetry to the ground station.
+// The velocity is in units per second and pathStep is the index of the move of
+// the path being done.
+func (d *Drone) UpdateLocation(location, velocity r3.Vec, pathStep int) {
+	battery := d.drain(location, time.Now())
+	d.sendTelemetry(location, velocity, pathStep, battery)
+	d.muxFly.Lock()
 	d.position = location
+	d.muxFly.Unlock()
+}
+
+// heartbeat sends the telemetry of the drone when it sent none during the last
+// heartbeat period, so that the ground station knows it is alive
+func (d *Drone) heartbeat(now time.Time) {
+	d.muxTelemetry.Lock()
+	last := d.lastTelemetry
+	d.muxTelemetry.Unlock()
+
+	if now.Sub(last) >= heartbeatPeriod {
+		d.sendTelemetry(d.getPosition(), r3.Vec{}, 0, d.Battery())
+	}
+}
+
+func (d *Drone) sendTelemetry(location, velocity r3.Vec, pathStep int, battery float64) {
+	d.muxTelemetry.Lock()
+	d.lastTelemetry = time.Now()
+	d.muxTelemetry.Unlock()
+
+	d.muxFly.Lock()
+	status, patternID := d.status, d.patternID
+	d.muxFly.Unlock()
+
+	d.getGossiper().AddPrivateMessage(gossip.PrivateMessageData{
+		Version:   gossip.TelemetryV1,
+		Location:  location,
+		DroneID:   d.droneID,
+		Velocity:  velocity,
+		Heading:   heading(velocity),
+		Battery:   battery,
+		State:     status.String(),
+		PatternID: patternID,
+		PathStep:  pathStep,
+		Timestamp: time.Since(d.start).Milliseconds(),
+	}, groundStation, d.getGossiper().GetIdentifier(), 10)
+}
+
+// heading returns the direction of the velocity in the horizontal plane, in
+// degrees clockwise from the Z axis
+func heading(velocity r3.Vec) float64 {
+	if velocity.X == 0 && velocity.Z == 0 {
+		return 0
+	}
+	degrees := math.Atan2(velocity.X, velocity.Z) * 180 / math.Pi
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
 }
 
 // HandleGossipMessage handle specific messages concerning the drone
 func (d *Drone) HandleGossipMessage(origin string, msg gossip.GossipPacket) {
+	if origin == groundStation {
+		d.contact()
+	}
 
 	if msg.Rumor != nil {
 		if msg.Rumor.Extra != nil {
-			if msg.Rumor.Extra.SwarmInit != nil && d.status == IDLE {
-				d.status = READY
+			if msg.Rumor.Extra.DroneCommand != nil {
+				d.handleCommand(msg.Rumor.Extra.DroneCommand)
+			} else if msg.Rumor.Extra.SwarmInit != nil {
+				// Every drone checks the paths it votes for, even if it does
+				// not fly them
+				d.consensusClient.ExpectPattern(msg.Rumor.Extra.SwarmInit)
+				seq, ok := d.startPattern(msg.Rumor.Extra.SwarmInit)
+				if !ok {
+					return
+				}
+				d.setSwarmStart(msg.Rumor.Extra.SwarmInit.World, msg.Rumor.Extra.SwarmInit.InitialPos)
 
 				if d.consensusClient.IsProposer() {
+					ctx, cancel := d.patternContext(seq)
 					go func() {
+						defer cancel()
 						patternID := msg.Rumor.Extra.SwarmInit.PatternID
 						dronePos := msg.Rumor.Extra.SwarmInit.InitialPos
+						swarmWorld := msg.Rumor.Extra.SwarmInit.World
+
+						grounded := msg.Rumor.Extra.SwarmInit.Grounded
 
-						targets := d.mapTarget(patternID, dronePos, msg.Rumor.Extra.SwarmInit.TargetPos)
+						targets, err := d.mapTarget(seq, swarmWorld, dronePos, msg.Rumor.Extra.SwarmInit.TargetPos, msg.Rumor.Extra.SwarmInit.Energy, grounded)
+						if err != nil {
+							d.abort(seq, err.Error())
+							return
+						}
 
-						d.generatePaths(patternID, dronePos, targets)
+						err = d.generatePaths(ctx, seq, patternID, swarmWorld, dronePos, targets, grounded)
+						if err != nil {
+							d.abort(seq, err.Error())
+							return
+						}
 
-						d.fly()
+						d.fly(seq)
 					}()
 				}
 			} else {
 				// log.Printf("Handle")
-				blockContainer := d.consensusClient.HandleExtraMessage(d.gossiper, msg.Rumor.Extra)
+				blockContainer := d.consensusClient.HandleExtraMessage(d.getGossiper(), msg.Rumor.Extra)
 
 				if blockContainer != nil {
-					if blockContainer.Type == blk.BlockPathStr {
-						blockContent := blockContainer.GetContent().(*blk.PathBlockContent)
-
-						d.path = blockContent.Paths[d.droneID]
-						go d.fly()
+					if blockContent := blk.PathContent(blockContainer); blockContent != nil {
+						seq, ok := d.patternOf(blockContent.PatternID)
+						if !ok {
+							return
+						}
+						// The paths decided may come from a faulty drone, never fly
+						// into a conflict
+						if err := d.consensusClient.CheckPaths(blockContent.PatternID, blockContent.Paths); err != nil {
+							d.abort(seq, err.Error())
+							return
+						}
+						if d.setPath(seq, blockContent.Paths[d.droneID]) {
+							d.setSwarmPaths(blockContent.Paths)
+							go d.fly(seq)
+						}
 					}
 				}
 			}
@@ -116,48 +417,168 @@ func (d *Drone) HandleGossipMessage(origin string, msg gossip.GossipPacket) {
 }
 
 func (d *Drone) GetTarget() r3.Vec {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
 	return d.target
 }
 
+// patternOf returns the number of the current pattern if it has the given ID
+func (d *Drone) patternOf(patternID string) (int, bool) {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	return d.patternSeq, d.patternID == patternID
+}
+
+// setPath sets the path of the drone for the given pattern, and returns false
+// if it was given up
+func (d *Drone) setPath(seq int, path []r3.Vec) bool {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	if !d.preparingLocked(seq) {
+		return false
+	}
+	d.path = path
+	return true
+}
+
 func (d *Drone) GetDroneID() uint32 {
 	return d.droneID
 }
 
-func (d *Drone) mapTarget(patternID string, initialPos, targetsPos []r3.Vec) []r3.Vec {
-	log.Printf("%s Swarm init received", d.gossiper.GetIdentifier())
+// mapTarget assigns a target to every drone. When the battery levels of the
+// drones are known, the mapper may take their range into account. The grounded
+// drones keep their position as target, leaving theirs empty. It returns an
+// error when a target cannot be reached in the world or the pattern was given
+// up.
+func (d *Drone) mapTarget(seq int, w *world.World, initialPos, targetsPos []r3.Vec, batteries []float64, grounded []uint32) ([]r3.Vec, error) {
+	log.Printf("%s Swarm init received", d.getGossiper().GetIdentifier())
 	//Begin mapping phase
-	d.status = MAPPING
-	log.Printf("%s Start mapping", d.gossiper.GetIdentifier())
-	target := d.targetsMapper.MapTargets(initialPos, targetsPos)
+	if !d.advance(seq, MAPPING) {
+		return nil, errGivenUp
+	}
+	log.Printf("%s Start mapping", d.getGossiper().GetIdentifier())
+	if err := mapping.CheckTargets(w, initialPos, targetsPos); err != nil {
+		return nil, err
+	}
+	var target []r3.Vec
+	energyMapper, ok := d.targetsMapper.(mapping.EnergyAwareMapper)
+	if ok && len(batteries) == len(initialPos) {
+		ranges := make([]float64, len(batteries))
+		for i, battery := range batteries {
+			ranges[i] = d.energy.Range(battery)
+		}
+		target = energyMapper.MapTargetsWithRange(initialPos, targetsPos, ranges)
+	} else {
+		target = d.targetsMapper.MapTargets(initialPos, targetsPos)
+	}
 	targets := target
-	// targets := d.consensusClient.ProposeTargets(d.gossiper, patternID, target)
+	for _, id := range grounded {
+		if int(id) < len(targets) {
+			targets[id] = initialPos[id]
+		}
+	}
+	// targets := d.consensusClient.ProposeTargets(d.getGossiper(), patternID, target)
+	d.muxFly.Lock()
 	d.target = targets[d.droneID]
-	return targets
+	d.muxFly.Unlock()
+	return targets, nil
 }
 
-func (d *Drone) generatePaths(patternID string, dronePos, targets []r3.Vec) {
-	d.status = GENERATING_PATH
-	log.Printf("%s Generate path", d.gossiper.GetIdentifier())
-	chanPath := d.pathGenerator.GeneratePath(dronePos, targets)
-	pathsGenerated := <-chanPath
-	log.Printf("%s Propose path", d.gossiper.GetIdentifier())
-	paths := d.consensusClient.ProposePaths(d.gossiper, patternID, pathsGenerated)
-	d.path = paths[d.droneID]
+// generatePaths agrees with the swarm on the paths to the targets, around the
+// obstacles of the world and the grounded drones, which stay still. It returns
+// the error of the consensus when the drones did not agree.
+func (d *Drone) generatePaths(ctx context.Context, seq int, patternID string, w *world.World, dronePos, targets []r3.Vec, grounded []uint32) error {
+	if !d.advance(seq, GENERATING_PATH) {
+		return errGivenUp
+	}
+	log.Printf("%s Generate path", d.getGossiper().GetIdentifier())
+
+	isGrounded := make(map[int]bool, len(grounded))
+	still := make([]r3.Vec, 0, len(grounded))
+	for _, id := range grounded {
+		if int(id) < len(dronePos) && !isGrounded[int(id)] {
+			isGrounded[int(id)] = true
+			still = append(still, dronePos[id])
+		}
+	}
+	flying := make([]int, 0, len(dronePos))
+	from := make([]r3.Vec, 0, len(dronePos))
+	dest := make([]r3.Vec, 0, len(dronePos))
+	for i := range dronePos {
+		if !isGrounded[i] {
+			flying = append(flying, i)
+			from = append(from, dronePos[i])
+			dest = append(dest, targets[i])
+		}
+	}
+	around := pathgenerator.AroundStill(w, still)
+
+	var chanPath <-chan [][]r3.Vec
+	if generator, ok := d.pathGenerator.(pathgenerator.WorldAwareGenerator); ok {
+		chanPath = generator.GeneratePathIn(around, from, dest)
+	} else {
+		chanPath = d.pathGenerator.GeneratePath(from, dest)
+	}
+	flyingPaths := <-chanPath
+	if flyingPaths == nil {
+		return xerrors.New("no collision-free paths")
+	}
+	if conflicts := pathgenerator.NewValidator(around, 0).Validate(from, dest, flyingPaths); len(conflicts) > 0 {
+		return xerrors.Errorf("invalid paths: %s", conflicts[0])
+	}
+
+	// The grounded drones do null moves
+	steps := 0
+	if len(flyingPaths) > 0 {
+		steps = len(flyingPaths[0])
+	}
+	pathsGenerated := make([][]r3.Vec, len(dronePos))
+	for i := range pathsGenerated {
+		pathsGenerated[i] = make([]r3.Vec, steps)
+	}
+	for k, i := range flying {
+		pathsGenerated[i] = flyingPaths[k]
+	}
+
+	log.Printf("%s Propose path", d.getGossiper().GetIdentifier())
+	paths, err := d.consensusClient.ProposePaths(ctx, d.getGossiper(), patternID, dronePos, pathsGenerated)
+	if err != nil {
+		return err
+	}
+	// The paths decided may come from another drone, never fly into a conflict
+	if conflicts := pathgenerator.NewValidator(w, 0).Validate(dronePos, nil, paths); len(conflicts) > 0 {
+		return xerrors.Errorf("%s: %w", conflicts[0], consensus.ErrInvalidPaths)
+	}
+	if !d.setPath(seq, paths[d.droneID]) {
+		return errGivenUp
+	}
+	d.setSwarmPaths(paths)
+	return nil
 }
 
-func (d *Drone) fly() {
+// fly follows the path of the given pattern, unless it was given up
+func (d *Drone) fly(seq int) {
+	d.muxFlight.Lock()
+	defer d.muxFlight.Unlock()
+
 	d.muxFly.Lock()
-	defer d.muxFly.Unlock()
+	if !d.preparingLocked(seq) {
+		d.muxFly.Unlock()
+		return
+	}
+	d.status = MOVING
+	position, path := d.position, d.path
+	d.muxFly.Unlock()
 
-	if d.status != IDLE && d.status != MOVING {
-		log.Printf(d.gossiper.GetIdentifier() + "Start simulation")
-		d.status = MOVING
-		done := d.simulator.launchSimulation(1, 4, d.position, d.path)
-		<-done
+	log.Printf(d.getGossiper().GetIdentifier() + "Start simulation")
+	d.takeOff()
+	done := d.simulator.launchSimulation(1, 4, position, path)
+	<-done
 
-		log.Printf("Simulation ended")
-		d.gossiper.AddMessage(strconv.FormatUint(uint64(d.GetDroneID()), 10))
+	log.Printf("Simulation ended")
+	d.getGossiper().AddMessage(strconv.FormatUint(uint64(d.GetDroneID()), 10))
 
-		d.status = IDLE
-	}
+	d.muxFly.Lock()
+	d.status = IDLE
+	d.muxFly.Unlock()
 }
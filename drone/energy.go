@@ -0,0 +1,118 @@
+package drone
+
+import (
+	"math"
+	"time"
+
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// EnergyModel describes the battery of a drone and what flying costs
+type EnergyModel struct {
+	// Energy of a full battery
+	Capacity float64
+	// Energy spent per unit of distance flown
+	DistanceCost float64
+	// Energy spent per second in the air, even without moving
+	HoverCost float64
+	// Extra energy spent per unit of distance climbed, along +Y
+	ClimbPenalty float64
+	// Battery level, in percent, below which a drone refuses new patterns
+	Threshold float64
+	// Battery level, in percent, below which a hovering drone returns home
+	Reserve float64
+}
+
+// DefaultEnergyModel returns the energy model of the simulated drones. A full
+// battery flies a few hundred units of distance.
+func DefaultEnergyModel() EnergyModel {
+	return EnergyModel{
+		Capacity:     1000,
+		DistanceCost: 2,
+		HoverCost:    0.5,
+		ClimbPenalty: 3,
+		Threshold:    20,
+		Reserve:      10,
+	}
+}
+
+// MoveCost returns the energy spent to move from one location to another in
+// the given time
+func (m EnergyModel) MoveCost(from, to r3.Vec, elapsed time.Duration) float64 {
+	cost := m.DistanceCost*r3.Norm(to.Sub(from)) + m.HoverCost*elapsed.Seconds()
+	if climb := to.Y - from.Y; climb > 0 {
+		cost += m.ClimbPenalty * climb
+	}
+	return cost
+}
+
+// PathCost returns the energy spent to follow a path starting at from, each
+// move lasting moveTime seconds
+func (m EnergyModel) PathCost(from r3.Vec, path []r3.Vec, moveTime int) float64 {
+	cost := 0.0
+	for _, move := range path {
+		to := from.Add(move)
+		cost += m.MoveCost(from, to, time.Duration(moveTime)*time.Second)
+		from = to
+	}
+	return cost
+}
+
+// Range returns the distance that can be flown with the given battery level,
+// in percent, ignoring the hover cost and the climbs
+func (m EnergyModel) Range(battery float64) float64 {
+	if m.DistanceCost <= 0 {
+		return math.Inf(1)
+	}
+	return math.Max(0, battery) / 100 * m.Capacity / m.DistanceCost
+}
+
+// drain removes the cost of a move from the energy left in the battery and
+// returns the new battery level, in percent
+func (d *Drone) drain(location r3.Vec, now time.Time) float64 {
+	position := d.getPosition()
+	d.muxEnergy.Lock()
+	defer d.muxEnergy.Unlock()
+
+	elapsed := time.Duration(0)
+	if !d.lastUpdate.IsZero() {
+		elapsed = now.Sub(d.lastUpdate)
+	}
+	d.lastUpdate = now
+
+	d.energyLeft = math.Max(0, d.energyLeft-d.energy.MoveCost(position, location, elapsed))
+	return d.batteryLocked()
+}
+
+// Battery returns the battery level of the drone, in percent
+func (d *Drone) Battery() float64 {
+	d.muxEnergy.Lock()
+	defer d.muxEnergy.Unlock()
+	return d.batteryLocked()
+}
+
+// SetBattery sets the battery level of the drone, in percent
+func (d *Drone) SetBattery(battery float64) {
+	d.muxEnergy.Lock()
+	defer d.muxEnergy.Unlock()
+	d.energyLeft = math.Max(0, math.Min(100, battery)) / 100 * d.energy.Capacity
+}
+
+func (d *Drone) batteryLocked() float64 {
+	if d.energy.Capacity <= 0 {
+		return 0
+	}
+	return d.energyLeft / d.energy.Capacity * 100
+}
+
+// lowBattery tells whether the drone must refuse new patterns
+func (d *Drone) lowBattery() bool {
+	return d.Battery() < d.energy.Threshold
+}
+
+// takeOff starts counting the hover cost from now
+func (d *Drone) takeOff() {
+	d.muxEnergy.Lock()
+	defer d.muxEnergy.Unlock()
+	d.lastUpdate = time.Now()
+}
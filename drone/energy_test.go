@@ -0,0 +1,103 @@
+package drone
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
+	"go.dedis.ch/cs438/orbitalswarm/drone/mapping"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
+	"go.dedis.ch/cs438/orbitalswarm/paxos"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestEnergy_Cost(t *testing.T) {
+	model := EnergyModel{Capacity: 100, DistanceCost: 2, HoverCost: 1, ClimbPenalty: 3}
+
+	require.Equal(t, 2.0, model.MoveCost(r3.Vec{}, r3.Vec{X: 1}, 0))
+	require.Equal(t, 3.0, model.MoveCost(r3.Vec{}, r3.Vec{Z: 1}, time.Second))
+	require.Equal(t, 5.0, model.MoveCost(r3.Vec{}, r3.Vec{Y: 1}, 0))
+	require.Equal(t, 2.0, model.MoveCost(r3.Vec{Y: 1}, r3.Vec{}, 0))
+
+	path := []r3.Vec{{X: 1}, {Y: 1}, {Y: -1}}
+	require.Equal(t, 2+5+2+3*1.0, model.PathCost(r3.Vec{}, path, 1))
+
+	require.Equal(t, 25.0, model.Range(50))
+}
+
+func TestEnergy_RefuseSwarmInit(t *testing.T) {
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	g, err := fac.New("", "drone0", 10, 0, 1)
+	require.NoError(t, err)
+
+	d := NewDrone(0, g, nil, r3.Vec{}, mapping.NewHungarianMapper(), consensus.NewConsensusReader(1, 0, 1, paxos.ModePaxos),
+		pathgenerator.NewSimplePathGenerator(), DefaultEnergyModel())
+	require.Equal(t, 100.0, d.Battery())
+
+	// Flying drains the battery
+	d.takeOff()
+	battery := d.drain(r3.Vec{Y: 10}, time.Now().Add(time.Second))
+	require.Less(t, battery, 100.0)
+	require.Equal(t, battery, d.Battery())
+
+	// The ground station grounds the drones low on battery
+	d.SetBattery(DefaultEnergyModel().Threshold - 1)
+	init := &extramessage.SwarmInit{
+		PatternID:  "pattern",
+		InitialPos: []r3.Vec{{}},
+		TargetPos:  []r3.Vec{{Y: 1}},
+		Grounded:   []uint32{0},
+	}
+	d.HandleGossipMessage("GS", gossip.GossipPacket{Rumor: &gossip.RumorMessage{
+		Origin: "GS",
+		ID:     1,
+		Extra:  &extramessage.ExtraMessage{SwarmInit: init},
+	}})
+	require.Equal(t, IDLE, statusOf(d))
+
+	// Otherwise the swarm plans a path for it, which it must follow
+	init.Grounded = nil
+	d.HandleGossipMessage("GS", gossip.GossipPacket{Rumor: &gossip.RumorMessage{
+		Origin: "GS",
+		ID:     2,
+		Extra:  &extramessage.ExtraMessage{SwarmInit: init},
+	}})
+	require.Equal(t, READY, statusOf(d))
+}
+
+// decidingClient decides the paths proposed
+type decidingClient struct {
+	consensus.ConsensusClient
+	decided [][]r3.Vec
+}
+
+func (c *decidingClient) ProposePaths(ctx context.Context, g *gossip.Gossiper, patternID string, from []r3.Vec, paths [][]r3.Vec) ([][]r3.Vec, error) {
+	c.decided = paths
+	return paths, nil
+}
+
+func TestEnergy_GroundedObstacle(t *testing.T) {
+	// Drones 0 and 2 swap over the grounded drone 1, which stays still
+	d := newTestDrone(t, r3.Vec{})
+	client := &decidingClient{}
+	d.consensusClient = client
+	d.pathGenerator = pathgenerator.NewCBSPathGenerator()
+
+	seq, ok := d.startPattern(&extramessage.SwarmInit{PatternID: "pattern"})
+	require.True(t, ok)
+	from := []r3.Vec{{X: 0}, {X: 1}, {X: 2}}
+	mapped, err := d.mapTarget(seq, nil, from, []r3.Vec{{X: 2}, {X: 5}, {X: 0}}, nil, []uint32{1})
+	require.NoError(t, err)
+	require.Equal(t, from[1], mapped[1])
+
+	targets := []r3.Vec{{X: 2}, {X: 1}, {X: 0}}
+	require.NoError(t, d.generatePaths(context.Background(), seq, "pattern", nil, from, targets, []uint32{1}))
+	require.Empty(t, pathgenerator.NewValidator(nil, 0).Validate(from, targets, client.decided))
+	for _, move := range client.decided[1] {
+		require.Equal(t, r3.Vec{}, move)
+	}
+}
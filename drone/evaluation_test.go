@@ -1,27 +1,34 @@
 package drone
 
 import (
+	"flag"
 	"fmt"
-	"os"
+	"io/ioutil"
+	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
 
 	"go.dedis.ch/cs438/orbitalswarm/drone/mapping"
 
+	"github.com/stretchr/testify/require"
 	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos"
 	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
-func createSwarmTest(i, numDrones, numParticipants, antiEntropy, routeTimer, paxosRetry int) (*Swarm, []r3.Vec, *gossip.Gossiper, consensus.ConsensusClient) {
-	swarm, pos := NewSwarm(numDrones, numParticipants, 2222+i, 5000+i, antiEntropy, routeTimer, paxosRetry, "127.0.0.1", "127.0.0.1")
+// The evaluations take minutes, they only run with go test -args -evaluation
+var evaluation = flag.Bool("evaluation", false, "run the consensus evaluations")
+
+func createSwarmTest(i, numDrones, numParticipants, antiEntropy, routeTimer, paxosRetry int, consensusFac consensus.Factory) (*Swarm, []r3.Vec, *gossip.Gossiper, consensus.ConsensusClient) {
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(int64(i)), gossip.NewJSONCodec())
+	swarm, pos := NewSwarm(fac, nil, numDrones, numParticipants, 2222+i, 5000+i, antiEntropy, routeTimer, paxosRetry, consensusFac, "127.0.0.1", "127.0.0.1")
 
 	go swarm.Run()
 
-	fac := gossip.GetFactory()
 	g, err := fac.New("127.0.0.1:33000", "GS", antiEntropy, routeTimer, numDrones)
 	if err != nil {
 		panic(err)
@@ -34,14 +41,14 @@ func createSwarmTest(i, numDrones, numParticipants, antiEntropy, routeTimer, pax
 	go g.Run(ready)
 	<-ready
 
-	consensus := consensus.NewConsensusReader(numDrones, numDrones+1, paxosRetry)
+	consensus := consensusFac.NewReader(numDrones, numDrones+1, paxosRetry)
 
 	return swarm, pos, g, consensus
 }
 
 func TestAllDronesPaxosProposer(t *testing.T) {
-	if testing.Short() {
-		t.Skip("skipping testing in short mode")
+	if !*evaluation {
+		t.Skip("skipping the evaluation, enable it with -evaluation")
 	}
 
 	trials := 10
@@ -58,7 +65,7 @@ func TestAllDronesPaxosProposer(t *testing.T) {
 			antiEntropy := 10
 			//numDrones := 5
 
-			swarm, pos, g, consensus := createSwarmTest(startingPort, numDrones, numDrones, antiEntropy, routeTimer, paxosRetry)
+			swarm, pos, g, consensus := createSwarmTest(startingPort, numDrones, numDrones, antiEntropy, routeTimer, paxosRetry, consensus.NewPaxosFactory(paxos.ModePaxos, ""))
 
 			targets := targetsPos[:numDrones]
 
@@ -88,34 +95,93 @@ func TestAllDronesPaxosProposer(t *testing.T) {
 			startingPort += numDrones
 		}
 	}
-	fmt.Println(timings)
-	f, err := os.Create("test.txt")
-	if err != nil {
-		fmt.Println(err)
-		return
-	}
-	var header string
+	var result string
 	for _, drone := range drones {
-		header += fmt.Sprintf("%d;", drone)
+		result += fmt.Sprintf("%d;", drone)
 	}
-	f.WriteString(header + "finish\n")
+	result += "finish\n"
 	for trial := 0; trial < trials; trial++ {
-		var resultLine string
 		for config := 0; config < len(drones); config++ {
-			resultLine += fmt.Sprintf("%d;", timings[config][trial])
+			result += fmt.Sprintf("%d;", timings[config][trial])
 		}
+		result += "\n"
+	}
+
+	// The timings outlive the test, to be plotted
+	dir, err := ioutil.TempDir("", "evaluation")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "timings.csv")
+	require.NoError(t, ioutil.WriteFile(path, []byte(result), 0644))
+	t.Logf("timings written to %s", path)
+}
+
+func TestConsensusComparison(t *testing.T) {
+	if !*evaluation {
+		t.Skip("skipping the evaluation, enable it with -evaluation")
+	}
+
+	trials := 3
+	numDrones := 5
+	targets := targetsPos(numDrones)
+
+	startingPort := 0
+	for _, name := range []string{"paxos", "multipaxos", "raft", "bft"} {
+		consensusFac, err := consensus.FactoryByName(name, "")
+		require.NoError(t, err)
+
+		for j := 0; j < trials; j++ {
+			swarm, pos, g, reader := createSwarmTest(startingPort, numDrones, numDrones, 10, 0, 3, consensusFac)
+
+			// Every consensus rumor reaches the ground station once
+			messages := 0
+			consensusReached := make(chan struct{})
+			g.RegisterCallback(func(origin string, msg gossip.GossipPacket) {
+				if msg.Rumor == nil || msg.Rumor.Extra == nil {
+					return
+				}
+				if isConsensusMessage(msg.Rumor.Extra) {
+					messages++
+				}
+				blockContainer := reader.HandleExtraMessage(g, msg.Rumor.Extra)
+				if blockContainer != nil && blockContainer.Type == blk.BlockPathStr {
+					close(consensusReached)
+				}
+			})
+			start := time.Now()
+			g.AddExtraMessage(&extramessage.ExtraMessage{
+				SwarmInit: &extramessage.SwarmInit{
+					PatternID:  strconv.Itoa(j),
+					InitialPos: pos,
+					TargetPos:  targets,
+				},
+			})
 
-		f.WriteString(resultLine + "\n")
+			select {
+			case <-consensusReached:
+			case <-time.After(time.Minute):
+				t.Fatalf("%s: no path decided", name)
+			}
+			t.Logf("%s: %v, %d messages", name, time.Since(start), messages)
+
+			swarm.Stop()
+			g.Stop()
+			startingPort += numDrones
+		}
 	}
-	f.Close()
+}
 
+func isConsensusMessage(extra *extramessage.ExtraMessage) bool {
+	return extra.PaxosPrepare != nil || extra.PaxosPromise != nil ||
+		extra.PaxosPropose != nil || extra.PaxosAccept != nil || extra.PaxosTLC != nil ||
+		extra.RaftRequestVote != nil || extra.RaftVote != nil || extra.RaftAppendEntries != nil ||
+		extra.RaftAppendResponse != nil || extra.RaftForward != nil || extra.BFT != nil
 }
 
 func initialPos(num int) []r3.Vec {
 	pos := make([]r3.Vec, num)
 
 	for i := 0; i < num; i++ {
-		pos[i] = r3.Vec{float64(i), float64(i), float64(i)}
+		pos[i] = r3.Vec{X: float64(i), Y: float64(i), Z: float64(i)}
 	}
 
 	return pos
@@ -125,7 +191,7 @@ func targetsPos(num int) []r3.Vec {
 	pos := make([]r3.Vec, num)
 
 	for i := 0; i < num; i++ {
-		pos[i] = r3.Vec{float64(i), float64(i + 10), float64(i)}
+		pos[i] = r3.Vec{X: float64(i), Y: float64(i + 10), Z: float64(i)}
 	}
 
 	return pos
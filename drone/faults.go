@@ -0,0 +1,238 @@
+package drone
+
+import (
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// ErrNoFaultInjection is returned when faults are injected in a swarm whose
+// drones do not run on an in-memory network
+var ErrNoFaultInjection = xerrors.New("fault injection requires an in-memory network")
+
+// ErrSwarmNotRunning is returned when a drone is crashed or restarted before
+// the swarm runs
+var ErrSwarmNotRunning = xerrors.New("swarm is not running")
+
+// Actions of a fault scenario step
+const (
+	FaultPartition = "partition"
+	FaultHeal      = "heal"
+	FaultDrop      = "drop"
+	FaultCrash     = "crash"
+	FaultRestart   = "restart"
+	FaultWait      = "wait"
+)
+
+// FaultStep is a single step of a fault scenario. Nodes are designated by
+// their gossip identifier, like "drone3" or "GS".
+type FaultStep struct {
+	Action string `json:"action"`
+
+	// partition
+	Groups [][]string `json:"groups,omitempty"`
+	// drop, the traffic between From and To is dropped with the given percentage
+	From    string  `json:"from,omitempty"`
+	To      string  `json:"to,omitempty"`
+	Percent float64 `json:"percent,omitempty"`
+	// crash and restart
+	Drone string `json:"drone,omitempty"`
+	// wait, in milliseconds
+	Duration int `json:"duration,omitempty"`
+}
+
+// AddNode makes a node that is not part of the swarm, like the ground
+// station, usable in the fault scenarios
+func (s *Swarm) AddNode(name, address string) {
+	s.mutexFault.Lock()
+	defer s.mutexFault.Unlock()
+	s.nodes[name] = address
+}
+
+// Partition splits the network in the given groups of nodes. Nodes that are
+// not listed form one more group.
+func (s *Swarm) Partition(groups ...[]string) error {
+	if s.network == nil {
+		return ErrNoFaultInjection
+	}
+
+	addressGroups := make([][]string, len(groups))
+	for i, group := range groups {
+		addressGroups[i] = make([]string, len(group))
+		for j, name := range group {
+			address, err := s.nodeAddress(name)
+			if err != nil {
+				return err
+			}
+			addressGroups[i][j] = address
+		}
+	}
+
+	log.Printf("Partition swarm in %v", groups)
+	s.network.Partition(addressGroups...)
+	return nil
+}
+
+// Heal removes the partitions and the dropped links
+func (s *Swarm) Heal() error {
+	if s.network == nil {
+		return ErrNoFaultInjection
+	}
+	log.Printf("Heal swarm network")
+	s.network.Heal()
+	return nil
+}
+
+// DropTraffic drops the given percentage of the packets exchanged by the two
+// nodes
+func (s *Swarm) DropTraffic(from, to string, percent float64) error {
+	if s.network == nil {
+		return ErrNoFaultInjection
+	}
+	if percent < 0 || percent > 100 {
+		return xerrors.Errorf("invalid percentage %f", percent)
+	}
+
+	fromAddress, err := s.nodeAddress(from)
+	if err != nil {
+		return err
+	}
+	toAddress, err := s.nodeAddress(to)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Drop %.0f%% of traffic between %s and %s", percent, from, to)
+	s.network.SetLinkLoss(fromAddress, toAddress, percent/100)
+	return nil
+}
+
+// CrashDrone stops the gossiper of the given drone. The drone neither sends
+// nor receives packets until it is restarted.
+func (s *Swarm) CrashDrone(name string) error {
+	if s.network == nil {
+		return ErrNoFaultInjection
+	}
+	select {
+	case <-s.started:
+	default:
+		return ErrSwarmNotRunning
+	}
+
+	s.mutexFault.Lock()
+	defer s.mutexFault.Unlock()
+
+	i, err := s.droneIndex(name)
+	if err != nil {
+		return err
+	}
+	if s.crashed[i] {
+		return xerrors.Errorf("%s already crashed", name)
+	}
+
+	log.Printf("Crash %s", name)
+	s.crashed[i] = true
+	s.drones[i].getGossiper().Stop()
+	return nil
+}
+
+// RestartDrone starts a new gossiper for a crashed drone, at the same address
+// and with the rumor state of the crashed one
+func (s *Swarm) RestartDrone(name string) error {
+	if s.network == nil {
+		return ErrNoFaultInjection
+	}
+	select {
+	case <-s.started:
+	default:
+		return ErrSwarmNotRunning
+	}
+
+	s.mutexFault.Lock()
+	defer s.mutexFault.Unlock()
+
+	i, err := s.droneIndex(name)
+	if err != nil {
+		return err
+	}
+	if !s.crashed[i] {
+		return xerrors.Errorf("%s is not crashed", name)
+	}
+
+	g, err := s.fac.New(s.addresses[i], name, s.antiEntropy, s.routeTimer, len(s.drones))
+	if err != nil {
+		return err
+	}
+	g.ResumeFrom(s.drones[i].getGossiper())
+
+	peers := make([]string, 0, len(s.addresses)+len(s.nodes))
+	for j, address := range s.addresses {
+		if j != i {
+			peers = append(peers, address)
+		}
+	}
+	for _, address := range s.nodes {
+		peers = append(peers, address)
+	}
+	s.drones[i].replaceGossiper(g, peers)
+
+	ready := make(chan struct{})
+	go g.Run(ready)
+	<-ready
+
+	log.Printf("Restart %s", name)
+	delete(s.crashed, i)
+	return nil
+}
+
+// RunScenario executes the given steps in order. It stops at the first step
+// that fails.
+func (s *Swarm) RunScenario(steps []FaultStep) error {
+	for i, step := range steps {
+		var err error
+		switch step.Action {
+		case FaultPartition:
+			err = s.Partition(step.Groups...)
+		case FaultHeal:
+			err = s.Heal()
+		case FaultDrop:
+			err = s.DropTraffic(step.From, step.To, step.Percent)
+		case FaultCrash:
+			err = s.CrashDrone(step.Drone)
+		case FaultRestart:
+			err = s.RestartDrone(step.Drone)
+		case FaultWait:
+			time.Sleep(time.Duration(step.Duration) * time.Millisecond)
+		default:
+			err = xerrors.Errorf("unknown action %s", step.Action)
+		}
+		if err != nil {
+			return xerrors.Errorf("step %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (s *Swarm) droneIndex(name string) (int, error) {
+	for i, n := range s.names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return -1, xerrors.Errorf("unknown drone %s", name)
+}
+
+func (s *Swarm) nodeAddress(name string) (string, error) {
+	if i, err := s.droneIndex(name); err == nil {
+		return s.addresses[i], nil
+	}
+
+	s.mutexFault.Lock()
+	defer s.mutexFault.Unlock()
+	address, ok := s.nodes[name]
+	if !ok {
+		return "", xerrors.Errorf("unknown node %s", name)
+	}
+	return address, nil
+}
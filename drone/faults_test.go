@@ -0,0 +1,59 @@
+package drone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos"
+)
+
+func containsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFaults_CrashRestart(t *testing.T) {
+	network := gossip.NewMemoryNetwork(1)
+	fac := gossip.NewMemoryGossipFactory(network, gossip.NewJSONCodec())
+	swarm, _ := NewSwarm(fac, nil, 3, 3, 2222, 5000, 10, 0, 1, consensus.NewPaxosFactory(paxos.ModePaxos, ""), "127.0.0.1", "127.0.0.1")
+	require.Equal(t, ErrSwarmNotRunning, swarm.CrashDrone("drone1"))
+	go swarm.Run()
+	defer swarm.Stop()
+	<-swarm.Started()
+
+	address := swarm.DronesAddresses()[1]
+
+	require.NoError(t, swarm.CrashDrone("drone1"))
+	require.False(t, containsAddress(network.Addresses(), address))
+	require.Error(t, swarm.CrashDrone("drone1"))
+
+	require.NoError(t, swarm.RestartDrone("drone1"))
+	require.True(t, containsAddress(network.Addresses(), address))
+	require.Equal(t, address, swarm.DronesAddresses()[1])
+	require.Error(t, swarm.RestartDrone("drone1"))
+}
+
+func TestFaults_Scenario(t *testing.T) {
+	network := gossip.NewMemoryNetwork(1)
+	fac := gossip.NewMemoryGossipFactory(network, gossip.NewJSONCodec())
+	swarm, _ := NewSwarm(fac, nil, 3, 3, 2222, 5000, 10, 0, 1, consensus.NewPaxosFactory(paxos.ModePaxos, ""), "127.0.0.1", "127.0.0.1")
+	swarm.AddNode("GS", "127.0.0.1:33000")
+
+	err := swarm.RunScenario([]FaultStep{
+		{Action: FaultPartition, Groups: [][]string{{"drone0", "GS"}, {"drone1"}}},
+		{Action: FaultDrop, From: "drone0", To: "drone2", Percent: 50},
+		{Action: FaultWait, Duration: 10},
+		{Action: FaultHeal},
+	})
+	require.NoError(t, err)
+
+	require.Error(t, swarm.RunScenario([]FaultStep{{Action: FaultPartition, Groups: [][]string{{"drone7"}}}}))
+	require.Error(t, swarm.RunScenario([]FaultStep{{Action: FaultDrop, From: "drone0", To: "GS", Percent: 150}}))
+	require.Error(t, swarm.RunScenario([]FaultStep{{Action: "explode"}}))
+}
@@ -0,0 +1,139 @@
+package drone
+
+import (
+	"math"
+
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// PlanManeuvers plans the moves of the drones from their positions to their
+// targets. The drones move one after the other while the others stay still.
+// Each of them climbs above the swarm, flies horizontally and descends to its
+// target, or only moves vertically when its target is right below or above it.
+// Every step of the plan is checked against the other drones and the obstacles
+// of the world; a drone whose maneuver would collide is retried once the others
+// moved, and is not moved at all when it still collides. The paths have the
+// same length, and the final position of every drone is returned.
+func PlanManeuvers(w *world.World, positions, targets []r3.Vec) ([][]r3.Vec, []r3.Vec) {
+	validator := pathgenerator.NewValidator(w, 0)
+	current := append([]r3.Vec{}, positions...)
+	paths := make([][]r3.Vec, len(positions))
+	for i := range paths {
+		paths[i] = []r3.Vec{}
+	}
+
+	for moved := true; moved; {
+		moved = false
+		for i := range positions {
+			if current[i] == targets[i] {
+				continue
+			}
+
+			path := maneuverPath(current[i], targets[i], cruiseAltitude(current, targets))
+			candidate := make([][]r3.Vec, len(paths))
+			dest := append([]r3.Vec{}, current...)
+			dest[i] = targets[i]
+			for j := range paths {
+				if j == i {
+					candidate[j] = append(append([]r3.Vec{}, paths[j]...), path...)
+				} else {
+					candidate[j] = append(append([]r3.Vec{}, paths[j]...), make([]r3.Vec, len(path))...)
+				}
+			}
+
+			if len(validator.Validate(positions, dest, candidate)) == 0 {
+				paths = candidate
+				current = dest
+				moved = true
+			}
+		}
+	}
+	return paths, current
+}
+
+// PlanRecovery plans a return or land command for the concerned drones.
+// Returning drones fly to their home; the ones that cannot do it without
+// collision land where they are instead, and the ones that cannot land either
+// stay still.
+func PlanRecovery(w *world.World, command string, positions, homes []r3.Vec, concerned []bool) ([][]r3.Vec, []r3.Vec) {
+	targets := append([]r3.Vec{}, positions...)
+	for i := range targets {
+		if !concerned[i] {
+			continue
+		}
+		if command == extramessage.CommandReturn {
+			targets[i] = homes[i]
+		} else {
+			targets[i] = landingSpot(positions[i])
+		}
+	}
+
+	paths, final := PlanManeuvers(w, positions, targets)
+	if command != extramessage.CommandReturn {
+		return paths, final
+	}
+
+	// Land the drones which could not return
+	fallback := false
+	for i := range targets {
+		if concerned[i] && final[i] != homes[i] {
+			targets[i] = landingSpot(positions[i])
+			fallback = true
+		}
+	}
+	if !fallback {
+		return paths, final
+	}
+	return PlanManeuvers(w, positions, targets)
+}
+
+// landingSpot returns the position on the ground below a location
+func landingSpot(location r3.Vec) r3.Vec {
+	return r3.Vec{X: location.X, Y: 0, Z: location.Z}
+}
+
+// cruiseAltitude returns an altitude above every drone and target
+func cruiseAltitude(positions, targets []r3.Vec) float64 {
+	altitude := 0.0
+	for _, p := range positions {
+		altitude = math.Max(altitude, p.Y)
+	}
+	for _, t := range targets {
+		altitude = math.Max(altitude, t.Y)
+	}
+	return math.Floor(altitude) + 1
+}
+
+// maneuverPath returns the moves from a location to a target, flying at the
+// given altitude when the target is not on the same vertical
+func maneuverPath(from, to r3.Vec, cruise float64) []r3.Vec {
+	if from.X == to.X && from.Z == to.Z {
+		return axisMoves(from.Y, to.Y, r3.Vec{Y: 1})
+	}
+
+	path := axisMoves(from.Y, cruise, r3.Vec{Y: 1})
+	path = append(path, axisMoves(from.X, to.X, r3.Vec{X: 1})...)
+	path = append(path, axisMoves(from.Z, to.Z, r3.Vec{Z: 1})...)
+	return append(path, axisMoves(cruise, to.Y, r3.Vec{Y: 1})...)
+}
+
+// axisMoves returns the moves along an axis going through every integer
+// coordinate between from and to. The moves are the differences between
+// consecutive coordinates, so that adding them to from gives exactly to.
+func axisMoves(from, to float64, axis r3.Vec) []r3.Vec {
+	moves := make([]r3.Vec, 0)
+	for from != to {
+		var next float64
+		if to > from {
+			next = math.Min(math.Floor(from)+1, to)
+		} else {
+			next = math.Max(math.Ceil(from)-1, to)
+		}
+		moves = append(moves, axis.Scale(next-from))
+		from = next
+	}
+	return moves
+}
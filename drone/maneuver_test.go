@@ -0,0 +1,238 @@
+package drone
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
+	"go.dedis.ch/cs438/orbitalswarm/drone/mapping"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
+	"go.dedis.ch/cs438/orbitalswarm/paxos"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestManeuver_AxisMoves(t *testing.T) {
+	from := r3.Vec{X: 0.3, Y: 0.1, Z: -2.75}
+	to := r3.Vec{X: -1.6, Y: 11, Z: 0}
+
+	location := from
+	for _, move := range maneuverPath(from, to, 12) {
+		require.LessOrEqual(t, r3.Norm(move), 1.0)
+		location = location.Add(move)
+	}
+	require.Equal(t, to, location)
+}
+
+func TestManeuver_Return(t *testing.T) {
+	positions := []r3.Vec{{X: 0, Y: 10, Z: 0}, {X: 2, Y: 10, Z: 0}, {X: 0, Y: 10, Z: 2}}
+	homes := []r3.Vec{{X: 4, Y: 0, Z: 0}, {X: -2, Y: 0, Z: 0}, {X: 0, Y: 0, Z: 2}}
+
+	paths, final := PlanRecovery(nil, extramessage.CommandReturn, positions, homes, []bool{true, true, false})
+	require.Equal(t, []r3.Vec{homes[0], homes[1], positions[2]}, final)
+	require.True(t, pathgenerator.ValidatePaths(positions, final, paths))
+}
+
+func TestManeuver_Blocked(t *testing.T) {
+	// drone1 hovers right below drone0, which can neither return nor land
+	positions := []r3.Vec{{X: 0, Y: 5, Z: 0}, {X: 0, Y: 2, Z: 0}}
+	homes := []r3.Vec{{X: 0, Y: 0, Z: 0}, {X: 2, Y: 0, Z: 0}}
+
+	_, final := PlanRecovery(nil, extramessage.CommandReturn, positions, homes, []bool{true, false})
+	require.Equal(t, positions, final)
+}
+
+func TestManeuver_Fallback(t *testing.T) {
+	// drone1 hovers above the home of drone0
+	positions := []r3.Vec{{X: 0, Y: 5, Z: 0}, {X: 2, Y: 3, Z: 0}}
+	homes := []r3.Vec{{X: 2, Y: 0, Z: 0}, {X: 4, Y: 0, Z: 0}}
+
+	// drone0 lands where it is instead
+	paths, final := PlanRecovery(nil, extramessage.CommandReturn, positions, homes, []bool{true, false})
+	require.Equal(t, []r3.Vec{{X: 0, Y: 0, Z: 0}, positions[1]}, final)
+	require.True(t, pathgenerator.ValidatePaths(positions, final, paths))
+
+	// Once drone1 is home, drone0 can return
+	paths, final = PlanRecovery(nil, extramessage.CommandReturn, positions, homes, []bool{true, true})
+	require.Equal(t, homes, final)
+	require.True(t, pathgenerator.ValidatePaths(positions, final, paths))
+}
+
+func TestManeuver_Obstacle(t *testing.T) {
+	// A wall stands between drone0 and its home
+	w := &world.World{Obstacles: []world.Box{{Min: r3.Vec{X: 1.5, Y: 0, Z: -1}, Max: r3.Vec{X: 2.5, Y: 10, Z: 1}}}}
+	positions := []r3.Vec{{X: 0, Y: 5, Z: 0}}
+	homes := []r3.Vec{{X: 4, Y: 0, Z: 0}}
+
+	_, final := PlanRecovery(nil, extramessage.CommandReturn, positions, homes, []bool{true})
+	require.Equal(t, homes, final)
+
+	// drone0 lands where it is instead
+	paths, final := PlanRecovery(w, extramessage.CommandReturn, positions, homes, []bool{true})
+	require.Equal(t, []r3.Vec{{X: 0, Y: 0, Z: 0}}, final)
+	require.Empty(t, pathgenerator.NewValidator(w, 0).Validate(positions, final, paths))
+}
+
+func newTestDrone(t *testing.T, position r3.Vec) *Drone {
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	g, err := fac.New("", "drone0", 10, 0, 1)
+	require.NoError(t, err)
+
+	d := NewDrone(0, g, nil, r3.Vec{}, mapping.NewHungarianMapper(), consensus.NewConsensusReader(1, 0, 1, paxos.ModePaxos),
+		pathgenerator.NewSimplePathGenerator(), DefaultEnergyModel())
+	d.simulator = NewSimulator(d)
+	d.position = position
+	return d
+}
+
+func TestRecovery_LowBattery(t *testing.T) {
+	d := newTestDrone(t, r3.Vec{X: 1, Y: 1, Z: 0})
+	d.SetBattery(DefaultEnergyModel().Reserve - 1)
+
+	d.check(time.Now())
+	require.Equal(t, GROUNDED, d.status)
+	require.Equal(t, d.home, d.position)
+
+	// A grounded drone refuses patterns until it is resumed with enough battery
+	d.SetBattery(100)
+	d.HandleGossipMessage("GS", gossip.GossipPacket{Rumor: &gossip.RumorMessage{
+		Extra: &extramessage.ExtraMessage{DroneCommand: &extramessage.DroneCommand{
+			Command: extramessage.CommandResume,
+			Drones:  []uint32{0},
+		}},
+	}})
+	require.Equal(t, IDLE, d.status)
+}
+
+func TestRecovery_LostContact(t *testing.T) {
+	d := newTestDrone(t, r3.Vec{X: 0, Y: 1, Z: 0})
+
+	d.check(time.Now())
+	require.Equal(t, IDLE, d.status)
+
+	d.SetContactTimeout(time.Millisecond)
+	d.check(time.Now().Add(time.Second))
+	require.Equal(t, GROUNDED, d.status)
+	require.Equal(t, d.home, d.position)
+}
+
+func TestRecovery_Moving(t *testing.T) {
+	// The battery runs low during the pattern, the drone returns home at the
+	// end of its current move
+	d := newTestDrone(t, r3.Vec{})
+	d.path = []r3.Vec{{Y: 1}, {Y: 1}, {Y: 1}, {Y: 1}}
+	d.status = READY
+	go d.fly(d.patternSeq)
+	require.Eventually(t, func() bool {
+		return d.Battery() < 100
+	}, 5*time.Second, 10*time.Millisecond)
+
+	d.SetBattery(DefaultEnergyModel().Reserve - 1)
+	d.check(time.Now())
+	require.Eventually(t, func() bool {
+		d.muxFly.Lock()
+		defer d.muxFly.Unlock()
+		return d.status == GROUNDED
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, d.home, d.position)
+}
+
+func swarmInit(patternID string) gossip.GossipPacket {
+	return gossip.GossipPacket{Rumor: &gossip.RumorMessage{
+		Extra: &extramessage.ExtraMessage{SwarmInit: &extramessage.SwarmInit{
+			PatternID:  patternID,
+			InitialPos: []r3.Vec{{}},
+			TargetPos:  []r3.Vec{{Y: 10}},
+		}},
+	}}
+}
+
+// statusOf returns the status of the drone
+func statusOf(d *Drone) state {
+	d.muxFly.Lock()
+	defer d.muxFly.Unlock()
+	return d.status
+}
+
+func TestPattern_NoQuorum(t *testing.T) {
+	// Alone, the drone never gets a quorum of promises
+	d := newTestDrone(t, r3.Vec{})
+	d.SetProposeTimeout(50 * time.Millisecond)
+
+	d.HandleGossipMessage("GS", swarmInit("pattern"))
+	require.NotEqual(t, IDLE, statusOf(d))
+	require.Eventually(t, func() bool {
+		return statusOf(d) == IDLE
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, r3.Vec{}, d.getPosition())
+}
+
+func TestPattern_Abort(t *testing.T) {
+	d := newTestDrone(t, r3.Vec{})
+	d.HandleGossipMessage("GS", swarmInit("pattern"))
+	require.NotEqual(t, IDLE, statusOf(d))
+	first := d.currentPattern()
+
+	d.HandleGossipMessage("GS", gossip.GossipPacket{Rumor: &gossip.RumorMessage{
+		Extra: &extramessage.ExtraMessage{DroneCommand: &extramessage.DroneCommand{
+			Command: extramessage.CommandAbort,
+		}},
+	}})
+	require.Equal(t, IDLE, statusOf(d))
+
+	// It accepts the next pattern, until it stops
+	d.HandleGossipMessage("GS", swarmInit("next"))
+	require.NotEqual(t, IDLE, statusOf(d))
+	// A late error of the pattern given up does not abort the next one
+	d.abort(first, "late error")
+	require.NotEqual(t, IDLE, statusOf(d))
+	d.Stop()
+	require.Eventually(t, func() bool {
+		return statusOf(d) == IDLE
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// decidedClient hands the given block to the drone, as if the swarm decided it
+type decidedClient struct {
+	consensus.ConsensusClient
+	block *blk.BlockContainer
+}
+
+func (c *decidedClient) HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
+	return c.block
+}
+
+func (c *decidedClient) IsProposer() bool {
+	return false
+}
+
+func TestPattern_InvalidDecision(t *testing.T) {
+	d := newTestDrone(t, r3.Vec{})
+	client := &decidedClient{ConsensusClient: d.consensusClient}
+	d.consensusClient = client
+	d.HandleGossipMessage("GS", swarmInit("pattern"))
+
+	decide := func(paths [][]r3.Vec) {
+		content := &blk.PathBlockContent{PatternID: "pattern", Paths: paths}
+		client.block = blk.NewGenericBlockFactory().NewGenesisBlock(content.BlockType(), 0, content)
+		d.HandleGossipMessage("drone1", gossip.GossipPacket{Rumor: &gossip.RumorMessage{
+			Extra: &extramessage.ExtraMessage{PaxosTLC: &extramessage.PaxosTLC{}},
+		}})
+	}
+
+	// Paths ending off target are never flown
+	decide([][]r3.Vec{{{Y: 5}}})
+	require.Equal(t, IDLE, statusOf(d))
+	require.Nil(t, d.path)
+
+	d.HandleGossipMessage("GS", swarmInit("pattern"))
+	decide([][]r3.Vec{{{Y: 10}}})
+	require.Eventually(t, func() bool {
+		return statusOf(d) == IDLE
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Equal(t, r3.Vec{Y: 10}, d.getPosition())
+}
@@ -26,6 +26,31 @@ func (m *hungarianMapper) MapTargets(initials []r3.Vec, targets []r3.Vec) []r3.V
 	return m.decodeAssignement(targets, mask)
 }
 
+// outOfRangeCost is added to the cost of the targets out of the range of a
+// drone, so that they are only assigned when there is no other choice
+const outOfRangeCost = 1e9
+
+// MapTargetsWithRange maps the targets like MapTargets, but only assigns a
+// target out of the range of a drone when no assignment keeps every drone in
+// range
+func (m *hungarianMapper) MapTargetsWithRange(initials []r3.Vec, targets []r3.Vec, ranges []float64) []r3.Vec {
+	if len(initials) != len(targets) || len(initials) != len(ranges) {
+		panic("Number of drones not equal to number of targets")
+	}
+
+	matrix := m.initMatrix(initials, targets)
+	for i, drone := range initials {
+		for j, target := range targets {
+			if r3.Norm(drone.Sub(target)) > ranges[i] {
+				matrix.Set(i, j, matrix.At(i, j)+outOfRangeCost)
+			}
+		}
+	}
+	mask := m.computeAssignment(matrix)
+
+	return m.decodeAssignement(targets, mask)
+}
+
 // iniMatrix creates the nxn cost matrix
 func (m *hungarianMapper) initMatrix(initials []r3.Vec, targets []r3.Vec) *mat.Dense {
 	n := len(initials)
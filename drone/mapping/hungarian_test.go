@@ -505,3 +505,27 @@ func TestStep06(t *testing.T) {
 		34, 0, 8,
 	})))
 }
+
+func TestMapTargetsWithRange(t *testing.T) {
+	mapper := NewHungarianMapper()
+
+	initialPos := []r3.Vec{
+		r3.Vec{X: 0, Y: 0, Z: 0},
+		r3.Vec{X: 3, Y: 0, Z: 0},
+	}
+	targetPos := []r3.Vec{
+		r3.Vec{X: 1, Y: 0, Z: 0},
+		r3.Vec{X: -5, Y: 0, Z: 0},
+	}
+
+	// Without energy constraint, the first drone takes the far target
+	expected := []r3.Vec{targetPos[1], targetPos[0]}
+	require.Equal(t, expected, mapper.MapTargets(initialPos, targetPos))
+	require.Equal(t, expected, mapper.MapTargetsWithRange(initialPos, targetPos, []float64{100, 100}))
+
+	// The first drone can only reach the close target
+	require.Equal(t, targetPos, mapper.MapTargetsWithRange(initialPos, targetPos, []float64{2, 100}))
+
+	// No assignment keeps every drone in range, the cheapest one is used
+	require.Equal(t, expected, mapper.MapTargetsWithRange(initialPos, targetPos, []float64{0, 0}))
+}
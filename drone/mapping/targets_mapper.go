@@ -1,6 +1,9 @@
 package mapping
 
 import (
+	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"golang.org/x/xerrors"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
@@ -16,3 +19,24 @@ const (
 type TargetsMapper interface {
 	MapTargets(initials []r3.Vec, targets []r3.Vec) []r3.Vec
 }
+
+// CheckTargets returns an error when there is not a target per drone, or when
+// a target is in an obstacle or cannot be reached from the drones
+func CheckTargets(w *world.World, initials []r3.Vec, targets []r3.Vec) error {
+	if len(initials) != len(targets) {
+		return xerrors.Errorf("%d targets for %d drones", len(targets), len(initials))
+	}
+	for i, reachable := range pathgenerator.Reachable(w, initials, targets) {
+		if !reachable {
+			return xerrors.Errorf("target %d at %v is unreachable", i, targets[i])
+		}
+	}
+	return nil
+}
+
+// EnergyAwareMapper is a TargetsMapper that avoids giving a drone a target out
+// of its range. ranges[i] is the distance drone i can still fly.
+type EnergyAwareMapper interface {
+	TargetsMapper
+	MapTargetsWithRange(initials []r3.Vec, targets []r3.Vec, ranges []float64) []r3.Vec
+}
@@ -0,0 +1,23 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestCheckTargets(t *testing.T) {
+	w := &world.World{
+		NoFly:   []world.Box{{Min: r3.Vec{X: 2, Y: 0, Z: -1}, Max: r3.Vec{X: 4, Y: 3, Z: 1}}},
+		Ceiling: 5,
+	}
+	initials := []r3.Vec{{X: 0}, {X: 1}}
+
+	require.NoError(t, CheckTargets(w, initials, []r3.Vec{{X: 5}, {X: 1, Y: 5}}))
+	require.NoError(t, CheckTargets(nil, initials, []r3.Vec{{X: 3}, {X: 1, Y: 8}}))
+	require.Error(t, CheckTargets(w, initials, []r3.Vec{{X: 3}, {X: 1}}))
+	require.Error(t, CheckTargets(w, initials, []r3.Vec{{X: 5}, {X: 1, Y: 8}}))
+	require.Error(t, CheckTargets(w, initials, []r3.Vec{{X: 5}}))
+}
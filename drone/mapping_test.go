@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
@@ -17,15 +19,20 @@ func TestMapping(t *testing.T) {
 	antiEntropy := 10
 	numDrones := 5
 
-	swarm, pos := NewSwarm(numDrones, numDrones, 2222, 5000, antiEntropy, routeTimer, paxosRetry, "127.0.0.1", "127.0.0.1")
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	keyring := gossip.NewKeyring()
+	swarm, pos := NewSwarm(fac, keyring, numDrones, numDrones, 2222, 5000, antiEntropy, routeTimer, paxosRetry, consensus.NewPaxosFactory(paxos.ModePaxos, ""), "127.0.0.1", "127.0.0.1")
 
 	go swarm.Run()
 
-	fac := gossip.GetFactory()
 	g, err := fac.New("127.0.0.1:33000", "GS", antiEntropy, routeTimer, numDrones)
 	if err != nil {
 		panic(err)
 	}
+	key, err := keyring.GenerateKey("GS")
+	require.NoError(t, err)
+	keyring.Trust("GS")
+	g.SetSigningKey(keyring, key)
 	time.Sleep(time.Second * 2)
 
 	addresses := swarm.DronesAddresses()
@@ -0,0 +1,251 @@
+package drone
+
+import (
+	"time"
+
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"go.dedis.ch/onet/v3/log"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// watchPeriod is the period at which a drone checks its battery, its contact
+// with the ground station and whether it must send a heartbeat
+const watchPeriod = 250 * time.Millisecond
+
+// SetContactTimeout makes the drone return home when it hears nothing from
+// the ground station for the given duration while it is in the air. A null
+// duration disables it.
+func (d *Drone) SetContactTimeout(timeout time.Duration) {
+	d.muxRecovery.Lock()
+	defer d.muxRecovery.Unlock()
+	d.contactTimeout = timeout
+}
+
+// contact records that the ground station was heard
+func (d *Drone) contact() {
+	d.muxRecovery.Lock()
+	defer d.muxRecovery.Unlock()
+	d.lastContact = time.Now()
+}
+
+// setSwarmStart records the positions of the drones and the obstacles at the
+// beginning of a pattern
+func (d *Drone) setSwarmStart(w *world.World, positions []r3.Vec) {
+	d.muxRecovery.Lock()
+	defer d.muxRecovery.Unlock()
+	d.swarmWorld = w
+	d.swarmStart = append([]r3.Vec{}, positions...)
+	d.swarmPositions = append([]r3.Vec{}, positions...)
+}
+
+// setSwarmPaths records where the drones are once they followed the given
+// paths from the beginning of the pattern
+func (d *Drone) setSwarmPaths(paths [][]r3.Vec) {
+	d.muxRecovery.Lock()
+	defer d.muxRecovery.Unlock()
+	if len(paths) != len(d.swarmStart) {
+		return
+	}
+	for i, path := range paths {
+		d.swarmPositions[i] = d.swarmStart[i]
+		for _, move := range path {
+			d.swarmPositions[i] = d.swarmPositions[i].Add(move)
+		}
+	}
+}
+
+// handleCommand executes a command of the ground station
+func (d *Drone) handleCommand(command *extramessage.DroneCommand) {
+	if command.Paths != nil {
+		// Every drone follows the maneuver to know where the others are
+		d.muxRecovery.Lock()
+		d.swarmStart = append([]r3.Vec{}, d.swarmPositions...)
+		d.muxRecovery.Unlock()
+		d.setSwarmPaths(command.Paths)
+	}
+
+	if !command.Concerns(d.droneID) {
+		return
+	}
+
+	switch command.Command {
+	case extramessage.CommandReturn, extramessage.CommandLand:
+		status := RETURNING
+		if command.Command == extramessage.CommandLand {
+			status = LANDING
+		}
+		if int(d.droneID) < len(command.Paths) {
+			go d.maneuver(status, command.Paths[d.droneID])
+		} else {
+			go d.recover(command.Command, "ground station command")
+		}
+	case extramessage.CommandAbort:
+		d.abort(d.currentPattern(), "ground station command")
+	case extramessage.CommandResume:
+		d.muxFly.Lock()
+		if d.status == GROUNDED && !d.lowBattery() {
+			log.Printf("%s Resume", d.getGossiper().GetIdentifier())
+			d.status = IDLE
+		}
+		d.muxFly.Unlock()
+	}
+}
+
+// watch sends the heartbeats of the drone and checks its battery and its
+// contact with the ground station until the drone stops
+func (d *Drone) watch() {
+	ticker := time.NewTicker(watchPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case now := <-ticker.C:
+			d.heartbeat(now)
+			d.check(now)
+		}
+	}
+}
+
+// check drains the battery of a hovering drone, and makes it return home
+// when its battery is low or when it lost contact with the ground station. A
+// drone flying a pattern stops at the end of its current move first.
+func (d *Drone) check(now time.Time) {
+	d.muxFly.Lock()
+	status, position := d.status, d.position
+	d.muxFly.Unlock()
+
+	var battery float64
+	if status == IDLE && position.Y > 0 {
+		battery = d.drain(position, now)
+	} else {
+		// Flying drones drain their battery in UpdateLocation
+		d.muxEnergy.Lock()
+		d.lastUpdate = now
+		d.muxEnergy.Unlock()
+		battery = d.Battery()
+	}
+
+	d.muxRecovery.Lock()
+	lostContact := d.contactTimeout > 0 && now.Sub(d.lastContact) > d.contactTimeout
+	d.muxRecovery.Unlock()
+
+	reason := ""
+	if battery < d.energy.Reserve {
+		reason = "low battery"
+	} else if lostContact {
+		reason = "lost contact with ground station"
+	}
+	if reason == "" {
+		return
+	}
+
+	switch status {
+	case IDLE:
+		if position.Y > 0 {
+			d.recover(extramessage.CommandReturn, reason)
+		}
+	case MOVING:
+		if d.simulator.stop() {
+			log.Printf("%s Pattern interrupted after %s", d.getGossiper().GetIdentifier(), reason)
+			// Returns once fly is over
+			go d.recover(extramessage.CommandReturn, reason)
+		}
+	}
+}
+
+// recover plans a maneuver of the drone alone, assuming the other drones stay
+// where they are, and performs it. The drone lands instead of returning when
+// it cannot reach home.
+func (d *Drone) recover(command, reason string) {
+	d.muxFlight.Lock()
+	defer d.muxFlight.Unlock()
+
+	d.muxFly.Lock()
+	status, position := d.status, d.position
+	d.muxFly.Unlock()
+	if status == RETURNING || status == LANDING || status == GROUNDED {
+		return
+	}
+
+	d.muxRecovery.Lock()
+	positions := append([]r3.Vec{}, d.swarmPositions...)
+	w := d.swarmWorld
+	d.muxRecovery.Unlock()
+	self := int(d.droneID)
+	if self >= len(positions) {
+		positions = []r3.Vec{position}
+		self = 0
+	}
+	positions[self] = position
+
+	homes := append([]r3.Vec{}, positions...)
+	homes[self] = d.home
+	concerned := make([]bool, len(positions))
+	concerned[self] = true
+
+	paths, final := PlanRecovery(w, command, positions, homes, concerned)
+	if command == extramessage.CommandReturn && final[self] == d.home &&
+		d.energy.PathCost(position, paths[self], 1) > d.energyLeftNow() {
+		log.Printf("%s Not enough energy to return home", d.getGossiper().GetIdentifier())
+		paths, final = PlanRecovery(w, extramessage.CommandLand, positions, homes, concerned)
+	}
+	if final[self] == position && position.Y > 0 {
+		log.Printf("%s No safe maneuver after %s, hovering", d.getGossiper().GetIdentifier(), reason)
+		return
+	}
+
+	status = RETURNING
+	if final[self] != d.home {
+		status = LANDING
+	}
+	log.Printf("%s %s after %s", d.getGossiper().GetIdentifier(), status, reason)
+	d.flyRecovery(status, position, paths[self])
+}
+
+// maneuver performs a maneuver planned by the ground station
+func (d *Drone) maneuver(status state, path []r3.Vec) {
+	d.muxFlight.Lock()
+	defer d.muxFlight.Unlock()
+
+	d.muxFly.Lock()
+	grounded, position := d.status == GROUNDED, d.position
+	d.muxFly.Unlock()
+	if grounded {
+		return
+	}
+	end := position
+	for _, move := range path {
+		end = end.Add(move)
+	}
+	if end == position && position.Y > 0 {
+		log.Printf("%s No safe maneuver on command, hovering", d.getGossiper().GetIdentifier())
+		return
+	}
+	log.Printf("%s %s on command", d.getGossiper().GetIdentifier(), status)
+	d.flyRecovery(status, position, path)
+}
+
+// flyRecovery follows a recovery path from the position and grounds the
+// drone. muxFlight must be held.
+func (d *Drone) flyRecovery(status state, position r3.Vec, path []r3.Vec) {
+	d.muxFly.Lock()
+	d.status = status
+	d.muxFly.Unlock()
+	d.takeOff()
+	if len(path) > 0 {
+		<-d.simulator.launchSimulation(1, 4, position, path)
+	}
+	d.muxFly.Lock()
+	d.status = GROUNDED
+	d.muxFly.Unlock()
+	log.Printf("%s Grounded", d.getGossiper().GetIdentifier())
+}
+
+func (d *Drone) energyLeftNow() float64 {
+	d.muxEnergy.Lock()
+	defer d.muxEnergy.Unlock()
+	return d.energyLeft
+}
@@ -1,18 +1,25 @@
 package drone
 
 import (
+	"math"
+	"sync"
 	"time"
 
+	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
 type interface_drone interface {
-	UpdateLocation(r3.Vec)
+	UpdateLocation(location, velocity r3.Vec, pathStep int)
 }
 
 type simulator struct {
 	drone interface_drone
 	done  chan struct{}
+
+	// closed to stop the running simulation at the end of its current move
+	interrupt chan struct{}
+	mutex     sync.Mutex
 }
 
 func NewSimulator(drone interface_drone) *simulator {
@@ -23,16 +30,69 @@ func NewSimulator(drone interface_drone) *simulator {
 
 func (s *simulator) launchSimulation(singleMoveTime int, refreshFrequency int, location r3.Vec, path []r3.Vec) <-chan struct{} {
 	s.done = make(chan struct{})
+	interrupt := make(chan struct{})
+	s.mutex.Lock()
+	s.interrupt = interrupt
+	s.mutex.Unlock()
 	go func() {
+		defer s.finish(interrupt)
 		sleepDuration := time.Duration(1000/refreshFrequency) * time.Millisecond
-		for _, move := range path {
+		for i, move := range path {
 			stepMove := move.Scale(float64(singleMoveTime) / float64(refreshFrequency))
+			velocity := move.Scale(1 / float64(singleMoveTime))
 			for step := 1; step <= singleMoveTime*refreshFrequency; step++ {
 				time.Sleep(sleepDuration)
 				tempLocation := location.Add(stepMove.Scale(float64(step)))
-				s.drone.UpdateLocation(tempLocation)
+				s.drone.UpdateLocation(tempLocation, velocity, i)
 			}
 			location = location.Add(move)
+
+			select {
+			case <-interrupt:
+				close(s.done)
+				return
+			default:
+			}
+		}
+		close(s.done)
+	}()
+	return s.done
+}
+
+// stop interrupts the running simulation at the end of its current move. It
+// returns false when no simulation is running.
+func (s *simulator) stop() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.interrupt == nil {
+		return false
+	}
+	close(s.interrupt)
+	s.interrupt = nil
+	return true
+}
+
+// finish forgets the interruption of a simulation once it is over
+func (s *simulator) finish(interrupt chan struct{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.interrupt == interrupt {
+		s.interrupt = nil
+	}
+}
+
+// launchTrajectory replays a trajectory, updating the location of the drone
+// refreshFrequency times per second
+func (s *simulator) launchTrajectory(refreshFrequency int, trajectory pathgenerator.Trajectory) <-chan struct{} {
+	s.done = make(chan struct{})
+	go func() {
+		sleepDuration := time.Duration(1000/refreshFrequency) * time.Millisecond
+		duration := trajectory.Duration()
+		ticks := int(math.Ceil(duration * float64(refreshFrequency)))
+		for tick := 1; tick <= ticks; tick++ {
+			time.Sleep(sleepDuration)
+			location, velocity, segment := trajectory.At(math.Min(float64(tick)/float64(refreshFrequency), duration))
+			s.drone.UpdateLocation(location, velocity, segment)
 		}
 		close(s.done)
 	}()
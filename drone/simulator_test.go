@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/pathgenerator"
 
 	"gonum.org/v1/gonum/spatial/r3"
 )
@@ -18,7 +19,7 @@ func newMockDrone() *mockDrone {
 	return &mockDrone{}
 }
 
-func (d *mockDrone) UpdateLocation(location r3.Vec) {
+func (d *mockDrone) UpdateLocation(location, velocity r3.Vec, pathStep int) {
 	d.res = append(d.res, location)
 }
 
@@ -34,7 +35,7 @@ func TestSimulator(t *testing.T) {
 		r3.Vec{X: 0, Y: 0, Z: 1},
 		r3.Vec{X: -1, Y: 0, Z: 0},
 	}
-	simulator.launchSimulation(timeOneStep, 4, starting, path)
+	done := simulator.launchSimulation(timeOneStep, 4, starting, path)
 
 	expected := []r3.Vec{
 		r3.Vec{X: 0.25, Y: 0, Z: 0},
@@ -55,7 +56,11 @@ func TestSimulator(t *testing.T) {
 		r3.Vec{X: 0, Y: 1, Z: 1},
 	}
 
-	time.Sleep(time.Second * time.Duration(len(path)+1))
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("simulation not over")
+	}
 
 	log.Println(expected)
 	log.Println(drone.res)
@@ -65,3 +70,19 @@ func TestSimulator(t *testing.T) {
 		require.Equal(t, expected[i], drone.res[i])
 	}
 }
+
+func TestSimulator_Trajectory(t *testing.T) {
+	drone := newMockDrone()
+	simulator := NewSimulator(drone)
+
+	trajectories, err := pathgenerator.Parameterize([]r3.Vec{{}}, [][]r3.Vec{{{X: 1}, {Y: 1}}},
+		[]pathgenerator.Limits{{MaxSpeed: 2, MaxAcceleration: 4}}, 0)
+	require.NoError(t, err)
+	<-simulator.launchTrajectory(4, trajectories[0])
+
+	// Accelerating then braking along each unit move, one second each
+	require.Len(t, drone.res, 8)
+	require.Equal(t, r3.Vec{X: 0.125}, drone.res[0])
+	require.Equal(t, r3.Vec{X: 1}, drone.res[3])
+	require.Equal(t, r3.Vec{X: 1, Y: 1}, drone.res[7])
+}
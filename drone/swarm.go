@@ -3,6 +3,8 @@ package drone
 import (
 	"fmt"
 	"math"
+	"sync"
+	"time"
 
 	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
 	"go.dedis.ch/cs438/orbitalswarm/drone/mapping"
@@ -13,15 +15,46 @@ import (
 
 // Swarm represents a collections of drones that runs together
 type Swarm struct {
-	drones []*Drone
-	stop   chan struct{}
+	drones  []*Drone
+	stop    chan struct{}
+	started chan struct{}
+
+	// Needed to restart crashed gossipers
+	fac         gossip.GossipFactory
+	names       []string
+	addresses   []string
+	antiEntropy int
+	routeTimer  int
+
+	// Fault injection, only available on an in-memory network
+	network    *gossip.MemoryNetwork
+	mutexFault sync.Mutex
+	nodes      map[string]string // name -> address of the nodes outside the swarm
+	crashed    map[int]bool
 }
 
-// NewSwarm creates and returns an new Swarm, but do not start the drones
-func NewSwarm(numDrones, numPaxosDrone, firstUIPort, firstGossipPort, antiEntropy, routeTimer, paxosRetry int, baseUIAddress, baseGossipAddress string) (*Swarm, []r3.Vec) {
+// NewSwarm creates and returns an new Swarm, but do not start the drones. The
+// gossipers of the drones are created by the given factory. When a keyring is
+// given, a signing key and an encryption key are generated for every drone and
+// stored in it. The consensus clients of the drones are created by the given
+// consensus factory.
+func NewSwarm(fac gossip.GossipFactory, keyring *gossip.Keyring, numDrones, numPaxosDrone, firstUIPort, firstGossipPort, antiEntropy, routeTimer, paxosRetry int, consensusFac consensus.Factory, baseUIAddress, baseGossipAddress string) (*Swarm, []r3.Vec) {
 	swarm := Swarm{
-		drones: make([]*Drone, numDrones),
-		stop:   make(chan struct{}),
+		drones:  make([]*Drone, numDrones),
+		stop:    make(chan struct{}),
+		started: make(chan struct{}),
+
+		fac:         fac,
+		names:       make([]string, numDrones),
+		addresses:   make([]string, numDrones),
+		antiEntropy: antiEntropy,
+		routeTimer:  routeTimer,
+
+		nodes:   make(map[string]string),
+		crashed: make(map[int]bool),
+	}
+	if memoryFac, ok := fac.(gossip.MemoryGossipFactory); ok {
+		swarm.network = memoryFac.Network()
 	}
 
 	// Drone parameters initialisation
@@ -46,7 +79,6 @@ func NewSwarm(numDrones, numPaxosDrone, firstUIPort, firstGossipPort, antiEntrop
 	}
 
 	// Drone creation
-	fac := gossip.GetFactory()
 	for i := 0; i < numDrones; i++ {
 		name := fmt.Sprintf("drone%d", i)
 		g, err := fac.New(gossipAddresses[i], name, antiEntropy, routeTimer, numDrones)
@@ -54,6 +86,21 @@ func NewSwarm(numDrones, numPaxosDrone, firstUIPort, firstGossipPort, antiEntrop
 		if err != nil {
 			panic(err)
 		}
+		if keyring != nil {
+			key, err := keyring.GenerateKey(name)
+			if err != nil {
+				panic(err)
+			}
+			g.SetSigningKey(keyring, key)
+
+			encryptionKey, err := keyring.GenerateEncryptionKey(name)
+			if err != nil {
+				panic(err)
+			}
+			g.SetEncryptionKey(encryptionKey)
+		}
+		swarm.names[i] = name
+		swarm.addresses[i] = g.GetLocalAddr()
 		peers := make([]string, numDrones)
 		copy(peers, gossipAddresses)
 		peers = append(peers[:i], peers[i+1:]...)
@@ -61,12 +108,12 @@ func NewSwarm(numDrones, numPaxosDrone, firstUIPort, firstGossipPort, antiEntrop
 		var consensusCli consensus.ConsensusClient
 
 		if i < numPaxosDrone {
-			consensusCli = consensus.NewConsensusParticipant(numPaxosDrone, i, paxosRetry)
+			consensusCli = consensusFac.NewParticipant(numPaxosDrone, i, paxosRetry)
 		} else {
-			consensusCli = consensus.NewConsensusReader(numPaxosDrone, i, paxosRetry)
+			consensusCli = consensusFac.NewReader(numPaxosDrone, i, paxosRetry)
 		}
 
-		swarm.drones[i] = NewDrone(uint32(i), g, peers, positions[i], mapping.NewHungarianMapper(), consensusCli, pathgenerator.NewSimplePathGenerator())
+		swarm.drones[i] = NewDrone(uint32(i), g, peers, positions[i], mapping.NewHungarianMapper(), consensusCli, pathgenerator.NewSimplePathGenerator(), DefaultEnergyModel())
 	}
 
 	return &swarm, positions
@@ -76,13 +123,48 @@ func NewSwarm(numDrones, numPaxosDrone, firstUIPort, firstGossipPort, antiEntrop
 func (s *Swarm) Run() {
 	for _, drone := range s.drones {
 		ready := make(chan struct{})
-		go drone.gossiper.Run(ready)
-		defer drone.gossiper.Stop()
+		go drone.getGossiper().Run(ready)
 		<-ready
 
 		go drone.Run()
 	}
+	close(s.started)
 	<-s.stop
+
+	s.mutexFault.Lock()
+	defer s.mutexFault.Unlock()
+	for i, drone := range s.drones {
+		drone.Stop()
+		if !s.crashed[i] {
+			drone.getGossiper().Stop()
+		}
+	}
+}
+
+// SetContactTimeout makes every drone return home when it hears nothing from
+// the ground station for the given duration. It must be called before Run.
+func (s *Swarm) SetContactTimeout(timeout time.Duration) {
+	for _, drone := range s.drones {
+		drone.SetContactTimeout(timeout)
+	}
+}
+
+// SetPathGenerator makes every drone plan its paths with a new generator of
+// the given name, see pathgenerator.NewByName
+func (s *Swarm) SetPathGenerator(name string) error {
+	for _, drone := range s.drones {
+		generator, err := pathgenerator.NewByName(name)
+		if err != nil {
+			return err
+		}
+		drone.pathGenerator = generator
+	}
+	return nil
+}
+
+// Started returns a channel closed once every drone runs
+func (s *Swarm) Started() <-chan struct{} {
+	return s.started
 }
 
 // Stop every drone composing the Swarm
@@ -94,7 +176,7 @@ func (s *Swarm) Stop() {
 func (s *Swarm) DronesAddresses() []string {
 	addresses := make([]string, len(s.drones))
 	for i, d := range s.drones {
-		addresses[i] = d.gossiper.GetLocalAddr()
+		addresses[i] = d.getGossiper().GetLocalAddr()
 	}
 	return addresses
 }
@@ -0,0 +1,56 @@
+package extramessage
+
+import "go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+
+// Phases of the BFT messages
+const (
+	// BFTRequest carries the proposal of a replica to the primary
+	BFTRequest = iota
+	// BFTPrePrepare is the proposal of the primary for a sequence number
+	BFTPrePrepare
+	// BFTPrepare is the vote of a replica for the proposal of the primary
+	BFTPrepare
+	// BFTCommit is the vote of a replica which saw a quorum of prepares
+	BFTCommit
+	// BFTViewChange is the vote of a replica to replace the primary
+	BFTViewChange
+)
+
+// BFTMessage is a message of the Byzantine fault tolerant consensus. Apart
+// from the requests, the messages are signed by their replica over the phase,
+// the view, the sequence number and the digest.
+type BFTMessage struct {
+	Phase     int
+	View      int
+	Seq       int
+	Digest    []byte
+	Signer    int
+	Signature []byte
+
+	// Block is the proposal of a request or of a pre-prepare, or the block a
+	// view change reports as prepared
+	Block *blk.BlockContainer
+	// Proof holds the prepares of the prepared block of a view change, or
+	// the view changes justifying the first pre-prepare of a view
+	Proof []*BFTMessage
+}
+
+// Copy performs a deep copy of the message
+func (m *BFTMessage) Copy() *BFTMessage {
+	c := new(BFTMessage)
+	*c = *m
+	if m.Digest != nil {
+		c.Digest = append([]byte{}, m.Digest...)
+	}
+	if m.Signature != nil {
+		c.Signature = append([]byte{}, m.Signature...)
+	}
+	if m.Block != nil {
+		c.Block = m.Block.Copy()
+	}
+	c.Proof = nil
+	for _, proof := range m.Proof {
+		c.Proof = append(c.Proof, proof.Copy())
+	}
+	return c
+}
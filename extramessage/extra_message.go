@@ -1,5 +1,7 @@
 package extramessage
 
+import "gonum.org/v1/gonum/spatial/r3"
+
 // Paxos messages. Feel free to move that in a separate file and/or package.
 
 // ExtraMessage is carried by a rumor message.
@@ -10,6 +12,18 @@ type ExtraMessage struct {
 	PaxosAccept  *PaxosAccept
 	PaxosTLC     *PaxosTLC
 	SwarmInit    *SwarmInit
+	DroneCommand *DroneCommand
+
+	RaftRequestVote    *RaftRequestVote
+	RaftVote           *RaftVote
+	RaftAppendEntries  *RaftAppendEntries
+	RaftAppendResponse *RaftAppendResponse
+	RaftForward        *RaftForward
+
+	SyncRequest  *SyncRequest
+	SyncResponse *SyncResponse
+
+	BFT *BFTMessage
 }
 
 // Copy performs a deep copy of extra message
@@ -20,6 +34,15 @@ func (e *ExtraMessage) Copy() *ExtraMessage {
 	var paxosAccept *PaxosAccept
 	var paxosTLC *PaxosTLC
 	var swarmInit *SwarmInit
+	var droneCommand *DroneCommand
+	var raftRequestVote *RaftRequestVote
+	var raftVote *RaftVote
+	var raftAppendEntries *RaftAppendEntries
+	var raftAppendResponse *RaftAppendResponse
+	var raftForward *RaftForward
+	var syncRequest *SyncRequest
+	var syncResponse *SyncResponse
+	var bft *BFTMessage
 
 	if e.PaxosPrepare != nil {
 		paxosPrepare = new(PaxosPrepare)
@@ -32,6 +55,7 @@ func (e *ExtraMessage) Copy() *ExtraMessage {
 		paxosPromise.PaxosSeqID = e.PaxosPromise.PaxosSeqID
 		paxosPromise.IDp = e.PaxosPromise.IDp
 		paxosPromise.IDa = e.PaxosPromise.IDa
+		paxosPromise.AcceptorID = e.PaxosPromise.AcceptorID
 		paxosPromise.Value = (e.PaxosPromise.Value.Copy())
 	}
 
@@ -46,11 +70,13 @@ func (e *ExtraMessage) Copy() *ExtraMessage {
 		paxosAccept = new(PaxosAccept)
 		paxosAccept.PaxosSeqID = e.PaxosAccept.PaxosSeqID
 		paxosAccept.ID = e.PaxosAccept.ID
+		paxosAccept.AcceptorID = e.PaxosAccept.AcceptorID
 		paxosAccept.Value = (e.PaxosAccept.Value.Copy())
 	}
 
 	if e.PaxosTLC != nil {
 		paxosTLC = new(PaxosTLC)
+		paxosTLC.AcceptorID = e.PaxosTLC.AcceptorID
 		paxosTLC.Value = e.PaxosTLC.Value.Copy()
 	}
 
@@ -59,6 +85,70 @@ func (e *ExtraMessage) Copy() *ExtraMessage {
 		swarmInit.PatternID = e.SwarmInit.PatternID
 		swarmInit.InitialPos = append(swarmInit.InitialPos, e.SwarmInit.InitialPos...)
 		swarmInit.TargetPos = append(swarmInit.TargetPos, e.SwarmInit.TargetPos...)
+		swarmInit.Energy = append(swarmInit.Energy, e.SwarmInit.Energy...)
+		swarmInit.World = e.SwarmInit.World.Copy()
+		swarmInit.Grounded = append(swarmInit.Grounded, e.SwarmInit.Grounded...)
+	}
+
+	if e.DroneCommand != nil {
+		droneCommand = new(DroneCommand)
+		droneCommand.Command = e.DroneCommand.Command
+		droneCommand.Drones = append(droneCommand.Drones, e.DroneCommand.Drones...)
+		for _, path := range e.DroneCommand.Paths {
+			droneCommand.Paths = append(droneCommand.Paths, append([]r3.Vec{}, path...))
+		}
+	}
+
+	if e.RaftRequestVote != nil {
+		raftRequestVote = new(RaftRequestVote)
+		*raftRequestVote = *e.RaftRequestVote
+	}
+
+	if e.RaftVote != nil {
+		raftVote = new(RaftVote)
+		*raftVote = *e.RaftVote
+	}
+
+	if e.RaftAppendEntries != nil {
+		raftAppendEntries = new(RaftAppendEntries)
+		*raftAppendEntries = *e.RaftAppendEntries
+		raftAppendEntries.Entries = nil
+		for _, entry := range e.RaftAppendEntries.Entries {
+			raftAppendEntries.Entries = append(raftAppendEntries.Entries, RaftEntry{
+				Term:  entry.Term,
+				Value: entry.Value.Copy(),
+			})
+		}
+	}
+
+	if e.RaftAppendResponse != nil {
+		raftAppendResponse = new(RaftAppendResponse)
+		*raftAppendResponse = *e.RaftAppendResponse
+	}
+
+	if e.RaftForward != nil {
+		raftForward = new(RaftForward)
+		*raftForward = *e.RaftForward
+		raftForward.Value = e.RaftForward.Value.Copy()
+	}
+
+	if e.SyncRequest != nil {
+		syncRequest = new(SyncRequest)
+		*syncRequest = *e.SyncRequest
+		if e.SyncRequest.TailHash != nil {
+			syncRequest.TailHash = append([]byte{}, e.SyncRequest.TailHash...)
+		}
+	}
+
+	if e.SyncResponse != nil {
+		syncResponse = &SyncResponse{NodeIndex: e.SyncResponse.NodeIndex}
+		for _, block := range e.SyncResponse.Blocks {
+			syncResponse.Blocks = append(syncResponse.Blocks, block.Copy())
+		}
+	}
+
+	if e.BFT != nil {
+		bft = e.BFT.Copy()
 	}
 
 	return &ExtraMessage{
@@ -68,5 +158,17 @@ func (e *ExtraMessage) Copy() *ExtraMessage {
 		PaxosAccept:  paxosAccept,
 		PaxosTLC:     paxosTLC,
 		SwarmInit:    swarmInit,
+		DroneCommand: droneCommand,
+
+		RaftRequestVote:    raftRequestVote,
+		RaftVote:           raftVote,
+		RaftAppendEntries:  raftAppendEntries,
+		RaftAppendResponse: raftAppendResponse,
+		RaftForward:        raftForward,
+
+		SyncRequest:  syncRequest,
+		SyncResponse: syncResponse,
+
+		BFT: bft,
 	}
 }
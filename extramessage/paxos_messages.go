@@ -10,11 +10,13 @@ type PaxosPrepare struct {
 
 // PaxosPromise describes a PROMISE request made by an acceptor to a proposer.
 // IDp is the ID the proposer sent. IDa is the highest ID the acceptor saw and
-// Value is the value it commits to, if any.
+// Value is the value it commits to, if any. AcceptorID is the index of the
+// acceptor.
 // Value/ID
 type PaxosPromise struct {
 	PaxosSeqID int
 	IDp        int
+	AcceptorID int
 
 	IDa   int
 	Value *blk.BlockContainer
@@ -30,16 +32,36 @@ type PaxosPropose struct {
 }
 
 // PaxosAccept describes an ACCEPT request that is sent by an acceptor to its
-// proposer and all the learners.
+// proposer and all the learners. AcceptorID is the index of the acceptor.
 type PaxosAccept struct {
 	PaxosSeqID int
 	ID         int
+	AcceptorID int
 
 	Value *blk.BlockContainer
 }
 
 // PaxosTLC is the message sent by a node when it knows consensus has been reached
-// for that block.
+// for that block. AcceptorID is the index of the node.
 type PaxosTLC struct {
+	AcceptorID int
+
 	Value *blk.BlockContainer
 }
+
+// SyncRequest is sent by a node which missed some blocks. It advertises the
+// number of the first block it lacks and the hash of its tail, the nodes which
+// know the following blocks answer with a SyncResponse.
+type SyncRequest struct {
+	BlockNumber int
+	TailHash    []byte
+}
+
+// SyncResponse carries consecutive blocks of the chain, starting at the
+// BlockNumber of the request it answers. NodeIndex is the index of the node
+// which answers.
+type SyncResponse struct {
+	NodeIndex int
+
+	Blocks []*blk.BlockContainer
+}
@@ -0,0 +1,59 @@
+package extramessage
+
+import "go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+
+// Raft messages. They are broadcast as rumors, the ones meant for a single
+// node carry its index.
+
+// RaftRequestVote is sent by a candidate to be elected leader of a term.
+type RaftRequestVote struct {
+	Term         int
+	CandidateID  int
+	LastLogIndex int
+	LastLogTerm  int
+}
+
+// RaftVote answers a RaftRequestVote.
+type RaftVote struct {
+	Term        int
+	VoterID     int
+	CandidateID int
+	Granted     bool
+}
+
+// RaftEntry is an entry of the replicated log, holding a block.
+type RaftEntry struct {
+	Term  int
+	Value *blk.BlockContainer
+}
+
+// RaftAppendEntries is sent by the leader to replicate its log from
+// PrevLogIndex+1 on. Without entries, it is a heartbeat.
+type RaftAppendEntries struct {
+	Term         int
+	LeaderID     int
+	PrevLogIndex int
+	PrevLogTerm  int
+	Entries      []RaftEntry
+	LeaderCommit int
+}
+
+// RaftAppendResponse answers a RaftAppendEntries. MatchIndex is the index of
+// the last entry the follower has in common with the leader, as far as it
+// knows.
+type RaftAppendResponse struct {
+	Term       int
+	FollowerID int
+	LeaderID   int
+	Success    bool
+	MatchIndex int
+}
+
+// RaftForward carries the proposal of a follower to the leader. CommitIndex
+// is the commit index of the follower when it proposed.
+type RaftForward struct {
+	Term        int
+	LeaderID    int
+	CommitIndex int
+	Value       *blk.BlockContainer
+}
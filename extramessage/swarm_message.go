@@ -1,6 +1,7 @@
 package extramessage
 
 import (
+	"go.dedis.ch/cs438/orbitalswarm/world"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
@@ -9,4 +10,59 @@ type SwarmInit struct {
 	PatternID  string
 	InitialPos []r3.Vec
 	TargetPos  []r3.Vec
+	// Battery level of each drone in percent, optional
+	Energy []float64 `json:",omitempty"`
+	// Obstacles to fly around, optional
+	World *world.World `json:",omitempty"`
+	// IDs of the drones kept on the ground as their battery is too low. They
+	// stay still and the others fly around them.
+	Grounded []uint32 `json:",omitempty"`
+}
+
+// IsGrounded tells whether the given drone is kept on the ground
+func (s *SwarmInit) IsGrounded(droneID uint32) bool {
+	for _, id := range s.Grounded {
+		if id == droneID {
+			return true
+		}
+	}
+	return false
+}
+
+// Commands of a DroneCommand
+const (
+	// CommandBeacon only tells the drones that the ground station is alive
+	CommandBeacon = "beacon"
+	// CommandReturn makes the drones fly back to their home position
+	CommandReturn = "return"
+	// CommandLand makes the drones land where they are
+	CommandLand = "land"
+	// CommandResume makes the grounded drones accept patterns again
+	CommandResume = "resume"
+	// CommandAbort makes the drones give up the pattern they are agreeing on
+	CommandAbort = "abort"
+)
+
+// DroneCommand is sent by the ground station to some drones of the swarm. The
+// paths, when present, hold the moves of every drone of the swarm to perform
+// the maneuver without collision, the drones which are not commanded stay
+// still. Without paths, each commanded drone plans its own maneuver.
+type DroneCommand struct {
+	Command string
+	// IDs of the commanded drones, every drone when empty
+	Drones []uint32
+	Paths  [][]r3.Vec
+}
+
+// Concerns tells whether the command is addressed to the given drone
+func (c *DroneCommand) Concerns(droneID uint32) bool {
+	if len(c.Drones) == 0 {
+		return true
+	}
+	for _, id := range c.Drones {
+		if id == droneID {
+			return true
+		}
+	}
+	return false
 }
@@ -9,7 +9,9 @@ require (
 	github.com/stretchr/stew v0.0.0-20130812190256-80ef0842b48b
 	github.com/stretchr/testify v1.5.1
 	go.dedis.ch/onet/v3 v3.2.5
+	golang.org/x/crypto v0.0.0-20211117183948-ae814b36b871
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1
 	gonum.org/v1/gonum v0.8.2
 	gopkg.in/dedis/onet.v2 v2.0.0-20181115163211-c8f3724038a7
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,53 @@
+package gossip
+
+import (
+	"encoding/json"
+)
+
+// Codec describes how a GossipPacket is turned into bytes before being sent
+// on the network and back once received. Every node of a swarm must use the
+// same codec.
+type Codec interface {
+	Encode(packet GossipPacket) ([]byte, error)
+	Decode(data []byte, packet *GossipPacket) error
+	Name() string
+}
+
+// JSONCodec encodes the packets with encoding/json. This is the default
+// codec.
+//
+// - implements gossip.Codec
+type JSONCodec struct{}
+
+// NewJSONCodec returns the JSON codec
+func NewJSONCodec() JSONCodec {
+	return JSONCodec{}
+}
+
+// Encode implements gossip.Codec
+func (c JSONCodec) Encode(packet GossipPacket) ([]byte, error) {
+	return json.Marshal(packet)
+}
+
+// Decode implements gossip.Codec
+func (c JSONCodec) Decode(data []byte, packet *GossipPacket) error {
+	return json.Unmarshal(data, packet)
+}
+
+// Name implements gossip.Codec
+func (c JSONCodec) Name() string {
+	return "json"
+}
+
+// CodecByName returns the codec registered under the given name, nil if the
+// name is unknown.
+func CodecByName(name string) Codec {
+	switch name {
+	case NewJSONCodec().Name():
+		return NewJSONCodec()
+	case NewBinaryCodec().Name():
+		return NewBinaryCodec()
+	default:
+		return nil
+	}
+}
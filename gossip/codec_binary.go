@@ -0,0 +1,1051 @@
+package gossip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"golang.org/x/xerrors"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// binaryCodecVersion is the first byte of every packet encoded by the binary
+// codec. It must be increased whenever the format changes.
+const binaryCodecVersion = 16
+
+// Flags telling which part of a GossipPacket is present
+const (
+	packetHasRumor = 1 << iota
+	packetHasStatus
+	packetHasPrivate
+)
+
+// Flags telling which variant of an ExtraMessage is present
+const (
+	extraHasPaxosPrepare = 1 << iota
+	extraHasPaxosPromise
+	extraHasPaxosPropose
+	extraHasPaxosAccept
+	extraHasPaxosTLC
+	extraHasSwarmInit
+	extraHasDroneCommand
+	extraHasRaftRequestVote
+	extraHasRaftVote
+	extraHasRaftAppendEntries
+	extraHasRaftAppendResponse
+	extraHasRaftForward
+	extraHasSyncRequest
+	extraHasSyncResponse
+	extraHasBFT
+)
+
+// Encoding kinds of a single vector coordinate, stored on 2 bits
+const (
+	coordInteger = 0
+	coordFloat32 = 1
+	coordFloat64 = 2
+)
+
+// BinaryCodec is a compact hand-rolled encoding of the GossipPacket. Integers
+// are written as varints and coordinates are written as varints or float32
+// whenever this is lossless, so that hashes computed on decoded blocks match
+// the ones computed by the sender.
+//
+// - implements gossip.Codec
+type BinaryCodec struct{}
+
+// NewBinaryCodec returns the binary codec
+func NewBinaryCodec() BinaryCodec {
+	return BinaryCodec{}
+}
+
+// Name implements gossip.Codec
+func (c BinaryCodec) Name() string {
+	return "binary"
+}
+
+// Encode implements gossip.Codec
+func (c BinaryCodec) Encode(packet GossipPacket) ([]byte, error) {
+	w := newBinaryWriter()
+	w.byte(binaryCodecVersion)
+
+	flags := byte(0)
+	if packet.Rumor != nil {
+		flags |= packetHasRumor
+	}
+	if packet.Status != nil {
+		flags |= packetHasStatus
+	}
+	if packet.Private != nil {
+		flags |= packetHasPrivate
+	}
+	w.byte(flags)
+
+	if packet.Rumor != nil {
+		w.rumor(packet.Rumor)
+	}
+	if packet.Status != nil {
+		w.status(packet.Status)
+	}
+	if packet.Private != nil {
+		w.private(packet.Private)
+	}
+
+	if w.err != nil {
+		return make([]byte, 0), w.err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// Decode implements gossip.Codec
+func (c BinaryCodec) Decode(data []byte, packet *GossipPacket) error {
+	r := newBinaryReader(data)
+	if version := r.byte(); r.err == nil && version != binaryCodecVersion {
+		return xerrors.Errorf("unsupported binary codec version %d", version)
+	}
+
+	flags := r.byte()
+	decoded := GossipPacket{}
+	if flags&packetHasRumor != 0 {
+		decoded.Rumor = r.rumor()
+	}
+	if flags&packetHasStatus != 0 {
+		decoded.Status = r.status()
+	}
+	if flags&packetHasPrivate != 0 {
+		decoded.Private = r.private()
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	if r.pos != len(r.data) {
+		return xerrors.Errorf("%d trailing bytes after packet", len(r.data)-r.pos)
+	}
+
+	*packet = decoded
+	return nil
+}
+
+// --- Writer ---
+
+type binaryWriter struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+	err     error
+}
+
+func newBinaryWriter() *binaryWriter {
+	return &binaryWriter{}
+}
+
+func (w *binaryWriter) byte(b byte) {
+	w.buf.WriteByte(b)
+}
+
+func (w *binaryWriter) bool(b bool) {
+	if b {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+}
+
+func (w *binaryWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(w.scratch[:], v)
+	w.buf.Write(w.scratch[:n])
+}
+
+func (w *binaryWriter) varint(v int64) {
+	n := binary.PutVarint(w.scratch[:], v)
+	w.buf.Write(w.scratch[:n])
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uvarint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// bytes writes a byte slice, keeping the difference between a nil and an
+// empty slice.
+func (w *binaryWriter) bytes(b []byte) {
+	if b == nil {
+		w.uvarint(0)
+		return
+	}
+	w.uvarint(uint64(len(b)) + 1)
+	w.buf.Write(b)
+}
+
+func (w *binaryWriter) float32(f float64) {
+	binary.LittleEndian.PutUint32(w.scratch[:4], math.Float32bits(float32(f)))
+	w.buf.Write(w.scratch[:4])
+}
+
+func (w *binaryWriter) float64(f float64) {
+	binary.LittleEndian.PutUint64(w.scratch[:8], math.Float64bits(f))
+	w.buf.Write(w.scratch[:8])
+}
+
+func coordKind(f float64) byte {
+	if math.Signbit(f) && f == 0 {
+		// -0 must survive the round trip as it is printed differently
+		return coordFloat32
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return coordInteger
+	}
+	if float64(float32(f)) == f {
+		return coordFloat32
+	}
+	return coordFloat64
+}
+
+func (w *binaryWriter) coord(kind byte, f float64) {
+	switch kind {
+	case coordInteger:
+		w.varint(int64(f))
+	case coordFloat32:
+		w.float32(f)
+	default:
+		w.float64(f)
+	}
+}
+
+// number writes a single coordinate with its kind
+func (w *binaryWriter) number(f float64) {
+	kind := coordKind(f)
+	w.byte(kind)
+	w.coord(kind, f)
+}
+
+func (w *binaryWriter) numbers(fs []float64) {
+	if fs == nil {
+		w.uvarint(0)
+		return
+	}
+	w.uvarint(uint64(len(fs)) + 1)
+	for _, f := range fs {
+		w.number(f)
+	}
+}
+
+func (w *binaryWriter) vec(v r3.Vec) {
+	kx, ky, kz := coordKind(v.X), coordKind(v.Y), coordKind(v.Z)
+	w.byte(kx | ky<<2 | kz<<4)
+	w.coord(kx, v.X)
+	w.coord(ky, v.Y)
+	w.coord(kz, v.Z)
+}
+
+func (w *binaryWriter) vecs(vs []r3.Vec) {
+	if vs == nil {
+		w.uvarint(0)
+		return
+	}
+	w.uvarint(uint64(len(vs)) + 1)
+	for _, v := range vs {
+		w.vec(v)
+	}
+}
+
+func (w *binaryWriter) paths(paths [][]r3.Vec) {
+	if paths == nil {
+		w.uvarint(0)
+		return
+	}
+	w.uvarint(uint64(len(paths)) + 1)
+	for _, path := range paths {
+		w.vecs(path)
+	}
+}
+
+func (w *binaryWriter) boxes(boxes []world.Box) {
+	if boxes == nil {
+		w.uvarint(0)
+		return
+	}
+	w.uvarint(uint64(len(boxes)) + 1)
+	for _, b := range boxes {
+		w.vec(b.Min)
+		w.vec(b.Max)
+	}
+}
+
+func (w *binaryWriter) world(m *world.World) {
+	w.bool(m != nil)
+	if m != nil {
+		w.boxes(m.Obstacles)
+		w.boxes(m.NoFly)
+		w.number(m.Ceiling)
+	}
+}
+
+func (w *binaryWriter) rumor(msg *RumorMessage) {
+	w.rumorContent(msg)
+	w.bytes(msg.Signature)
+}
+
+// rumorContent writes the part of the rumor covered by its signature
+func (w *binaryWriter) rumorContent(msg *RumorMessage) {
+	w.string(msg.Origin)
+	w.uvarint(uint64(msg.ID))
+	w.string(msg.Text)
+	w.bool(msg.Extra != nil)
+	if msg.Extra != nil {
+		w.extra(msg.Extra)
+	}
+}
+
+func (w *binaryWriter) status(msg *StatusPacket) {
+	w.uvarint(uint64(len(msg.Want)))
+	for _, peer := range msg.Want {
+		w.string(peer.Identifier)
+		w.uvarint(uint64(peer.NextID))
+	}
+}
+
+func (w *binaryWriter) private(msg *PrivateMessage) {
+	w.privateContent(msg)
+	w.varint(int64(msg.HopLimit))
+	w.bytes(msg.Signature)
+}
+
+// privateContent writes the part of the private message covered by its
+// signature. The hop limit is left out as relays decrement it.
+func (w *binaryWriter) privateContent(msg *PrivateMessage) {
+	w.string(msg.Origin)
+	w.uvarint(uint64(msg.ID))
+	w.privateData(msg.Data)
+	w.bytes(msg.Sealed)
+	w.string(msg.Destination)
+}
+
+func (w *binaryWriter) privateData(data PrivateMessageData) {
+	w.uvarint(uint64(data.Version))
+	w.vec(data.Location)
+	w.uvarint(uint64(data.DroneID))
+	if data.Version < TelemetryV1 {
+		return
+	}
+	w.vec(data.Velocity)
+	w.number(data.Heading)
+	w.number(data.Battery)
+	w.string(data.State)
+	w.string(data.PatternID)
+	w.varint(int64(data.PathStep))
+	w.varint(data.Timestamp)
+}
+
+func (w *binaryWriter) extra(msg *extramessage.ExtraMessage) {
+	flags := uint64(0)
+	if msg.PaxosPrepare != nil {
+		flags |= extraHasPaxosPrepare
+	}
+	if msg.PaxosPromise != nil {
+		flags |= extraHasPaxosPromise
+	}
+	if msg.PaxosPropose != nil {
+		flags |= extraHasPaxosPropose
+	}
+	if msg.PaxosAccept != nil {
+		flags |= extraHasPaxosAccept
+	}
+	if msg.PaxosTLC != nil {
+		flags |= extraHasPaxosTLC
+	}
+	if msg.SwarmInit != nil {
+		flags |= extraHasSwarmInit
+	}
+	if msg.DroneCommand != nil {
+		flags |= extraHasDroneCommand
+	}
+	if msg.RaftRequestVote != nil {
+		flags |= extraHasRaftRequestVote
+	}
+	if msg.RaftVote != nil {
+		flags |= extraHasRaftVote
+	}
+	if msg.RaftAppendEntries != nil {
+		flags |= extraHasRaftAppendEntries
+	}
+	if msg.RaftAppendResponse != nil {
+		flags |= extraHasRaftAppendResponse
+	}
+	if msg.RaftForward != nil {
+		flags |= extraHasRaftForward
+	}
+	if msg.SyncRequest != nil {
+		flags |= extraHasSyncRequest
+	}
+	if msg.SyncResponse != nil {
+		flags |= extraHasSyncResponse
+	}
+	if msg.BFT != nil {
+		flags |= extraHasBFT
+	}
+	w.uvarint(flags)
+
+	if msg.PaxosPrepare != nil {
+		w.varint(int64(msg.PaxosPrepare.PaxosSeqID))
+		w.varint(int64(msg.PaxosPrepare.ID))
+	}
+	if msg.PaxosPromise != nil {
+		w.varint(int64(msg.PaxosPromise.PaxosSeqID))
+		w.varint(int64(msg.PaxosPromise.IDp))
+		w.varint(int64(msg.PaxosPromise.IDa))
+		w.varint(int64(msg.PaxosPromise.AcceptorID))
+		w.blockContainer(msg.PaxosPromise.Value)
+	}
+	if msg.PaxosPropose != nil {
+		w.varint(int64(msg.PaxosPropose.PaxosSeqID))
+		w.varint(int64(msg.PaxosPropose.ID))
+		w.blockContainer(msg.PaxosPropose.Value)
+	}
+	if msg.PaxosAccept != nil {
+		w.varint(int64(msg.PaxosAccept.PaxosSeqID))
+		w.varint(int64(msg.PaxosAccept.ID))
+		w.varint(int64(msg.PaxosAccept.AcceptorID))
+		w.blockContainer(msg.PaxosAccept.Value)
+	}
+	if msg.PaxosTLC != nil {
+		w.varint(int64(msg.PaxosTLC.AcceptorID))
+		w.blockContainer(msg.PaxosTLC.Value)
+	}
+	if msg.SwarmInit != nil {
+		w.string(msg.SwarmInit.PatternID)
+		w.vecs(msg.SwarmInit.InitialPos)
+		w.vecs(msg.SwarmInit.TargetPos)
+		w.numbers(msg.SwarmInit.Energy)
+		w.world(msg.SwarmInit.World)
+		w.uvarint(uint64(len(msg.SwarmInit.Grounded)))
+		for _, id := range msg.SwarmInit.Grounded {
+			w.uvarint(uint64(id))
+		}
+	}
+	if msg.DroneCommand != nil {
+		w.string(msg.DroneCommand.Command)
+		w.uvarint(uint64(len(msg.DroneCommand.Drones)))
+		for _, id := range msg.DroneCommand.Drones {
+			w.uvarint(uint64(id))
+		}
+		w.paths(msg.DroneCommand.Paths)
+	}
+	if msg.RaftRequestVote != nil {
+		w.varint(int64(msg.RaftRequestVote.Term))
+		w.varint(int64(msg.RaftRequestVote.CandidateID))
+		w.varint(int64(msg.RaftRequestVote.LastLogIndex))
+		w.varint(int64(msg.RaftRequestVote.LastLogTerm))
+	}
+	if msg.RaftVote != nil {
+		w.varint(int64(msg.RaftVote.Term))
+		w.varint(int64(msg.RaftVote.VoterID))
+		w.varint(int64(msg.RaftVote.CandidateID))
+		w.bool(msg.RaftVote.Granted)
+	}
+	if msg.RaftAppendEntries != nil {
+		w.varint(int64(msg.RaftAppendEntries.Term))
+		w.varint(int64(msg.RaftAppendEntries.LeaderID))
+		w.varint(int64(msg.RaftAppendEntries.PrevLogIndex))
+		w.varint(int64(msg.RaftAppendEntries.PrevLogTerm))
+		w.uvarint(uint64(len(msg.RaftAppendEntries.Entries)))
+		for _, entry := range msg.RaftAppendEntries.Entries {
+			w.varint(int64(entry.Term))
+			w.blockContainer(entry.Value)
+		}
+		w.varint(int64(msg.RaftAppendEntries.LeaderCommit))
+	}
+	if msg.RaftAppendResponse != nil {
+		w.varint(int64(msg.RaftAppendResponse.Term))
+		w.varint(int64(msg.RaftAppendResponse.FollowerID))
+		w.varint(int64(msg.RaftAppendResponse.LeaderID))
+		w.bool(msg.RaftAppendResponse.Success)
+		w.varint(int64(msg.RaftAppendResponse.MatchIndex))
+	}
+	if msg.RaftForward != nil {
+		w.varint(int64(msg.RaftForward.Term))
+		w.varint(int64(msg.RaftForward.LeaderID))
+		w.varint(int64(msg.RaftForward.CommitIndex))
+		w.blockContainer(msg.RaftForward.Value)
+	}
+	if msg.SyncRequest != nil {
+		w.varint(int64(msg.SyncRequest.BlockNumber))
+		w.bytes(msg.SyncRequest.TailHash)
+	}
+	if msg.SyncResponse != nil {
+		w.varint(int64(msg.SyncResponse.NodeIndex))
+		w.uvarint(uint64(len(msg.SyncResponse.Blocks)))
+		for _, block := range msg.SyncResponse.Blocks {
+			w.blockContainer(block)
+		}
+	}
+	if msg.BFT != nil {
+		w.bft(msg.BFT)
+	}
+}
+
+func (w *binaryWriter) bft(msg *extramessage.BFTMessage) {
+	w.varint(int64(msg.Phase))
+	w.varint(int64(msg.View))
+	w.varint(int64(msg.Seq))
+	w.bytes(msg.Digest)
+	w.varint(int64(msg.Signer))
+	w.bytes(msg.Signature)
+	w.blockContainer(msg.Block)
+	w.uvarint(uint64(len(msg.Proof)))
+	for _, proof := range msg.Proof {
+		w.bft(proof)
+	}
+}
+
+func (w *binaryWriter) blockContainer(b *blk.BlockContainer) {
+	w.bool(b != nil)
+	if b == nil {
+		return
+	}
+	w.string(b.Type)
+	w.bool(b.Block != nil)
+	if b.Block == nil {
+		return
+	}
+	w.varint(int64(b.BlockNumber()))
+	w.bytes(b.PreviousHash())
+
+	content := b.GetContent()
+	w.bool(content != nil)
+	if content != nil {
+		w.blockContent(content)
+	}
+}
+
+func (w *binaryWriter) blockContent(content blk.BlockContent) {
+	switch c := content.(type) {
+	case *blk.NamingBlockContent:
+		w.bytes(c.Metahash)
+		w.string(c.Filename)
+	case *blk.MappingBlockContent:
+		w.string(c.PatternID)
+		w.vecs(c.Targets)
+	case *blk.PathBlockContent:
+		w.string(c.PatternID)
+		w.paths(c.Paths)
+	case *blk.MembershipBlockContent:
+		w.uvarint(uint64(len(c.Members)))
+		for _, member := range c.Members {
+			w.varint(int64(member))
+		}
+		w.varint(int64(c.Activation))
+	case *blk.BatchBlockContent:
+		w.uvarint(uint64(len(c.Mappings)))
+		for _, mapping := range c.Mappings {
+			w.blockContent(mapping)
+		}
+		w.uvarint(uint64(len(c.Paths)))
+		for _, path := range c.Paths {
+			w.blockContent(path)
+		}
+	default:
+		w.err = xerrors.Errorf("unsupported block content %T", content)
+	}
+}
+
+// --- Reader ---
+
+type binaryReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func newBinaryReader(data []byte) *binaryReader {
+	return &binaryReader{data: data}
+}
+
+func (r *binaryReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+func (r *binaryReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.data)-r.pos < n {
+		r.fail(xerrors.New("unexpected end of packet"))
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *binaryReader) byte() byte {
+	b := r.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *binaryReader) bool() bool {
+	return r.byte() != 0
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail(xerrors.New("invalid varint"))
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data[r.pos:])
+	if n <= 0 {
+		r.fail(xerrors.New("invalid varint"))
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// length reads a length and checks that it fits in the remaining bytes, each
+// element taking at least minSize bytes.
+func (r *binaryReader) length(minSize int) int {
+	l := r.uvarint()
+	if r.err == nil && l > uint64((len(r.data)-r.pos)/minSize) {
+		r.fail(xerrors.Errorf("invalid length %d", l))
+		return 0
+	}
+	return int(l)
+}
+
+// optionalLength reads a length written with a +1 offset, returning -1 for a
+// nil slice.
+func (r *binaryReader) optionalLength(minSize int) int {
+	l := r.uvarint()
+	if l == 0 {
+		return -1
+	}
+	if r.err == nil && l-1 > uint64((len(r.data)-r.pos)/minSize) {
+		r.fail(xerrors.Errorf("invalid length %d", l-1))
+		return -1
+	}
+	return int(l - 1)
+}
+
+func (r *binaryReader) string() string {
+	return string(r.next(r.length(1)))
+}
+
+func (r *binaryReader) bytes() []byte {
+	l := r.optionalLength(1)
+	if l < 0 {
+		return nil
+	}
+	return append([]byte{}, r.next(l)...)
+}
+
+func (r *binaryReader) coord(kind byte) float64 {
+	switch kind {
+	case coordInteger:
+		return float64(r.varint())
+	case coordFloat32:
+		b := r.next(4)
+		if b == nil {
+			return 0
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case coordFloat64:
+		b := r.next(8)
+		if b == nil {
+			return 0
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	default:
+		r.fail(xerrors.Errorf("invalid coordinate kind %d", kind))
+		return 0
+	}
+}
+
+func (r *binaryReader) number() float64 {
+	return r.coord(r.byte())
+}
+
+func (r *binaryReader) numbers() []float64 {
+	n := r.optionalLength(2)
+	if n < 0 {
+		return nil
+	}
+	fs := make([]float64, n)
+	for i := range fs {
+		fs[i] = r.number()
+	}
+	return fs
+}
+
+func (r *binaryReader) vec() r3.Vec {
+	kinds := r.byte()
+	return r3.Vec{
+		X: r.coord(kinds & 3),
+		Y: r.coord(kinds >> 2 & 3),
+		Z: r.coord(kinds >> 4 & 3),
+	}
+}
+
+func (r *binaryReader) vecs() []r3.Vec {
+	l := r.optionalLength(4)
+	if l < 0 {
+		return nil
+	}
+	vs := make([]r3.Vec, l)
+	for i := range vs {
+		vs[i] = r.vec()
+	}
+	return vs
+}
+
+func (r *binaryReader) paths() [][]r3.Vec {
+	l := r.optionalLength(1)
+	if l < 0 {
+		return nil
+	}
+	paths := make([][]r3.Vec, l)
+	for i := range paths {
+		paths[i] = r.vecs()
+	}
+	return paths
+}
+
+func (r *binaryReader) boxes() []world.Box {
+	l := r.optionalLength(8)
+	if l < 0 {
+		return nil
+	}
+	boxes := make([]world.Box, l)
+	for i := range boxes {
+		boxes[i] = world.Box{Min: r.vec(), Max: r.vec()}
+	}
+	return boxes
+}
+
+func (r *binaryReader) world() *world.World {
+	if !r.bool() {
+		return nil
+	}
+	return &world.World{
+		Obstacles: r.boxes(),
+		NoFly:     r.boxes(),
+		Ceiling:   r.number(),
+	}
+}
+
+func (r *binaryReader) rumor() *RumorMessage {
+	msg := &RumorMessage{
+		Origin: r.string(),
+		ID:     uint32(r.uvarint()),
+		Text:   r.string(),
+	}
+	if r.bool() {
+		msg.Extra = r.extra()
+	}
+	msg.Signature = r.bytes()
+	return msg
+}
+
+func (r *binaryReader) status() *StatusPacket {
+	msg := &StatusPacket{
+		Want: make([]PeerStatus, r.length(2)),
+	}
+	for i := range msg.Want {
+		msg.Want[i].Identifier = r.string()
+		msg.Want[i].NextID = uint32(r.uvarint())
+	}
+	return msg
+}
+
+func (r *binaryReader) private() *PrivateMessage {
+	msg := &PrivateMessage{}
+	msg.Origin = r.string()
+	msg.ID = uint32(r.uvarint())
+	msg.Data = r.privateData()
+	msg.Sealed = r.bytes()
+	msg.Destination = r.string()
+	msg.HopLimit = int(r.varint())
+	msg.Signature = r.bytes()
+	return msg
+}
+
+func (r *binaryReader) privateData() PrivateMessageData {
+	data := PrivateMessageData{}
+	data.Version = uint32(r.uvarint())
+	data.Location = r.vec()
+	data.DroneID = uint32(r.uvarint())
+	if data.Version < TelemetryV1 {
+		return data
+	}
+	data.Velocity = r.vec()
+	data.Heading = r.number()
+	data.Battery = r.number()
+	data.State = r.string()
+	data.PatternID = r.string()
+	data.PathStep = int(r.varint())
+	data.Timestamp = r.varint()
+	return data
+}
+
+func (r *binaryReader) extra() *extramessage.ExtraMessage {
+	flags := r.uvarint()
+	msg := &extramessage.ExtraMessage{}
+
+	if flags&extraHasPaxosPrepare != 0 {
+		msg.PaxosPrepare = &extramessage.PaxosPrepare{
+			PaxosSeqID: int(r.varint()),
+			ID:         int(r.varint()),
+		}
+	}
+	if flags&extraHasPaxosPromise != 0 {
+		msg.PaxosPromise = &extramessage.PaxosPromise{
+			PaxosSeqID: int(r.varint()),
+			IDp:        int(r.varint()),
+			IDa:        int(r.varint()),
+			AcceptorID: int(r.varint()),
+		}
+		msg.PaxosPromise.Value = r.blockContainer()
+	}
+	if flags&extraHasPaxosPropose != 0 {
+		msg.PaxosPropose = &extramessage.PaxosPropose{
+			PaxosSeqID: int(r.varint()),
+			ID:         int(r.varint()),
+		}
+		msg.PaxosPropose.Value = r.blockContainer()
+	}
+	if flags&extraHasPaxosAccept != 0 {
+		msg.PaxosAccept = &extramessage.PaxosAccept{
+			PaxosSeqID: int(r.varint()),
+			ID:         int(r.varint()),
+			AcceptorID: int(r.varint()),
+		}
+		msg.PaxosAccept.Value = r.blockContainer()
+	}
+	if flags&extraHasPaxosTLC != 0 {
+		msg.PaxosTLC = &extramessage.PaxosTLC{
+			AcceptorID: int(r.varint()),
+		}
+		msg.PaxosTLC.Value = r.blockContainer()
+	}
+	if flags&extraHasSwarmInit != 0 {
+		msg.SwarmInit = &extramessage.SwarmInit{
+			PatternID: r.string(),
+		}
+		msg.SwarmInit.InitialPos = r.vecs()
+		msg.SwarmInit.TargetPos = r.vecs()
+		msg.SwarmInit.Energy = r.numbers()
+		msg.SwarmInit.World = r.world()
+		if n := r.length(1); n > 0 {
+			msg.SwarmInit.Grounded = make([]uint32, n)
+			for i := range msg.SwarmInit.Grounded {
+				msg.SwarmInit.Grounded[i] = uint32(r.uvarint())
+			}
+		}
+	}
+	if flags&extraHasDroneCommand != 0 {
+		msg.DroneCommand = &extramessage.DroneCommand{
+			Command: r.string(),
+		}
+		if n := r.length(1); n > 0 {
+			msg.DroneCommand.Drones = make([]uint32, n)
+			for i := range msg.DroneCommand.Drones {
+				msg.DroneCommand.Drones[i] = uint32(r.uvarint())
+			}
+		}
+		msg.DroneCommand.Paths = r.paths()
+	}
+	if flags&extraHasRaftRequestVote != 0 {
+		msg.RaftRequestVote = &extramessage.RaftRequestVote{
+			Term:         int(r.varint()),
+			CandidateID:  int(r.varint()),
+			LastLogIndex: int(r.varint()),
+			LastLogTerm:  int(r.varint()),
+		}
+	}
+	if flags&extraHasRaftVote != 0 {
+		msg.RaftVote = &extramessage.RaftVote{
+			Term:        int(r.varint()),
+			VoterID:     int(r.varint()),
+			CandidateID: int(r.varint()),
+			Granted:     r.bool(),
+		}
+	}
+	if flags&extraHasRaftAppendEntries != 0 {
+		msg.RaftAppendEntries = &extramessage.RaftAppendEntries{
+			Term:         int(r.varint()),
+			LeaderID:     int(r.varint()),
+			PrevLogIndex: int(r.varint()),
+			PrevLogTerm:  int(r.varint()),
+		}
+		if n := r.length(2); n > 0 {
+			msg.RaftAppendEntries.Entries = make([]extramessage.RaftEntry, n)
+			for i := range msg.RaftAppendEntries.Entries {
+				msg.RaftAppendEntries.Entries[i].Term = int(r.varint())
+				msg.RaftAppendEntries.Entries[i].Value = r.blockContainer()
+			}
+		}
+		msg.RaftAppendEntries.LeaderCommit = int(r.varint())
+	}
+	if flags&extraHasRaftAppendResponse != 0 {
+		msg.RaftAppendResponse = &extramessage.RaftAppendResponse{
+			Term:       int(r.varint()),
+			FollowerID: int(r.varint()),
+			LeaderID:   int(r.varint()),
+			Success:    r.bool(),
+			MatchIndex: int(r.varint()),
+		}
+	}
+	if flags&extraHasRaftForward != 0 {
+		msg.RaftForward = &extramessage.RaftForward{
+			Term:        int(r.varint()),
+			LeaderID:    int(r.varint()),
+			CommitIndex: int(r.varint()),
+		}
+		msg.RaftForward.Value = r.blockContainer()
+	}
+	if flags&extraHasSyncRequest != 0 {
+		msg.SyncRequest = &extramessage.SyncRequest{
+			BlockNumber: int(r.varint()),
+			TailHash:    r.bytes(),
+		}
+	}
+	if flags&extraHasSyncResponse != 0 {
+		msg.SyncResponse = &extramessage.SyncResponse{NodeIndex: int(r.varint())}
+		if n := r.length(1); n > 0 {
+			msg.SyncResponse.Blocks = make([]*blk.BlockContainer, n)
+			for i := range msg.SyncResponse.Blocks {
+				msg.SyncResponse.Blocks[i] = r.blockContainer()
+			}
+		}
+	}
+	if flags&extraHasBFT != 0 {
+		msg.BFT = r.bft()
+	}
+	return msg
+}
+
+func (r *binaryReader) bft() *extramessage.BFTMessage {
+	msg := &extramessage.BFTMessage{
+		Phase:     int(r.varint()),
+		View:      int(r.varint()),
+		Seq:       int(r.varint()),
+		Digest:    r.bytes(),
+		Signer:    int(r.varint()),
+		Signature: r.bytes(),
+		Block:     r.blockContainer(),
+	}
+	if n := r.length(8); n > 0 {
+		msg.Proof = make([]*extramessage.BFTMessage, n)
+		for i := range msg.Proof {
+			msg.Proof[i] = r.bft()
+		}
+	}
+	return msg
+}
+
+func (r *binaryReader) blockContainer() *blk.BlockContainer {
+	if !r.bool() {
+		return nil
+	}
+	b := &blk.BlockContainer{
+		Type: r.string(),
+	}
+	if !r.bool() {
+		return b
+	}
+
+	blockNumber := int(r.varint())
+	previousHash := r.bytes()
+	var content blk.BlockContent
+	if r.bool() {
+		content = r.blockContent(b.Type)
+	}
+	if r.err != nil {
+		return nil
+	}
+
+	switch b.Type {
+	case blk.BlockNamingStr:
+		b.Block = &blk.NamingBlock{BlockNum: blockNumber, PrevHash: previousHash, Content: content}
+	case blk.BlockMappingStr:
+		b.Block = &blk.MappingBlock{BlockNum: blockNumber, PrevHash: previousHash, Content: content}
+	case blk.BlockPathStr:
+		b.Block = &blk.PathBlock{BlockNum: blockNumber, PrevHash: previousHash, Content: content}
+	case blk.BlockMembershipStr:
+		b.Block = &blk.MembershipBlock{BlockNum: blockNumber, PrevHash: previousHash, Content: content}
+	case blk.BlockBatchStr:
+		b.Block = &blk.BatchBlock{BlockNum: blockNumber, PrevHash: previousHash, Content: content}
+	default:
+		r.fail(xerrors.Errorf("unsupported block type %s", b.Type))
+		return nil
+	}
+	return b
+}
+
+func (r *binaryReader) blockContent(blockType string) blk.BlockContent {
+	switch blockType {
+	case blk.BlockNamingStr:
+		return &blk.NamingBlockContent{
+			Metahash: r.bytes(),
+			Filename: r.string(),
+		}
+	case blk.BlockMappingStr:
+		c := &blk.MappingBlockContent{
+			PatternID: r.string(),
+		}
+		c.Targets = r.vecs()
+		return c
+	case blk.BlockPathStr:
+		c := &blk.PathBlockContent{
+			PatternID: r.string(),
+		}
+		c.Paths = r.paths()
+		return c
+	case blk.BlockMembershipStr:
+		c := &blk.MembershipBlockContent{
+			Members: make([]int, r.length(1)),
+		}
+		for i := range c.Members {
+			c.Members[i] = int(r.varint())
+		}
+		c.Activation = int(r.varint())
+		return c
+	case blk.BlockBatchStr:
+		c := &blk.BatchBlockContent{}
+		if n := r.length(1); n > 0 {
+			c.Mappings = make([]*blk.MappingBlockContent, n)
+			for i := range c.Mappings {
+				c.Mappings[i], _ = r.blockContent(blk.BlockMappingStr).(*blk.MappingBlockContent)
+			}
+		}
+		if n := r.length(1); n > 0 {
+			c.Paths = make([]*blk.PathBlockContent, n)
+			for i := range c.Paths {
+				c.Paths[i], _ = r.blockContent(blk.BlockPathStr).(*blk.PathBlockContent)
+			}
+		}
+		return c
+	default:
+		r.fail(xerrors.Errorf("unsupported block type %s", blockType))
+		return nil
+	}
+}
@@ -0,0 +1,245 @@
+package gossip
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func testPackets() []GossipPacket {
+	factory := blk.NewGenericBlockFactory()
+	pathBlock := factory.NewGenesisBlock(blk.BlockPathStr, 0, &blk.PathBlockContent{
+		PatternID: "pattern",
+		Paths: [][]r3.Vec{
+			{{X: 1, Y: 0, Z: 0}, {X: 0, Y: -1, Z: 0}, {X: 0.5, Y: 0.1, Z: -0.0}},
+			{{X: 0.25, Y: 1e20, Z: 3.14159}},
+		},
+	})
+	mappingBlock := factory.NewBlock(blk.BlockMappingStr, 1, pathBlock.Hash(), &blk.MappingBlockContent{
+		PatternID: "pattern",
+		Targets:   []r3.Vec{{X: 0, Y: 10, Z: 0}, {X: -2, Y: 10, Z: 2}},
+	})
+	namingBlock := factory.NewBlock(blk.BlockNamingStr, 2, mappingBlock.Hash(), &blk.NamingBlockContent{
+		Metahash: []byte{1, 2, 3},
+		Filename: "file",
+	})
+	membershipBlock := factory.NewBlock(blk.BlockMembershipStr, 3, namingBlock.Hash(), &blk.MembershipBlockContent{
+		Members:    []int{0, 2, 5},
+		Activation: 5,
+	})
+	batchBlock := factory.NewBlock(blk.BlockBatchStr, 4, membershipBlock.Hash(), &blk.BatchBlockContent{
+		Mappings: []*blk.MappingBlockContent{mappingBlock.GetContent().(*blk.MappingBlockContent)},
+		Paths:    []*blk.PathBlockContent{pathBlock.GetContent().(*blk.PathBlockContent), {PatternID: "other", Paths: [][]r3.Vec{{}}}},
+	})
+
+	return []GossipPacket{
+		{Rumor: &RumorMessage{Origin: "drone0", ID: 1, Text: "hello"}},
+		{Status: &StatusPacket{Want: []PeerStatus{{Identifier: "drone0", NextID: 3}, {Identifier: "GS", NextID: 300}}}},
+		{Private: &PrivateMessage{
+			Origin:      "drone1",
+			ID:          0,
+			Data:        PrivateMessageData{Location: r3.Vec{X: 0.25, Y: 1, Z: -3}, DroneID: 1},
+			Destination: "GS",
+			HopLimit:    10,
+		}},
+		{Private: &PrivateMessage{
+			Origin: "drone1",
+			ID:     0,
+			Data: PrivateMessageData{
+				Version:   TelemetryV1,
+				Location:  r3.Vec{X: 0.25, Y: 1, Z: -3},
+				DroneID:   1,
+				Velocity:  r3.Vec{X: 1, Y: 0, Z: -0.5},
+				Heading:   116.56505117707799,
+				Battery:   87.5,
+				State:     "MOVING",
+				PatternID: "pattern1",
+				PathStep:  4,
+				Timestamp: 12345,
+			},
+			Destination: "GS",
+			HopLimit:    9,
+		}},
+		{Rumor: &RumorMessage{Origin: "drone2", ID: 2, Extra: &extramessage.ExtraMessage{
+			PaxosPrepare: &extramessage.PaxosPrepare{PaxosSeqID: 3, ID: 7},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone2", ID: 3, Extra: &extramessage.ExtraMessage{
+			PaxosPromise: &extramessage.PaxosPromise{PaxosSeqID: 3, IDp: 7, AcceptorID: 2, IDa: -1, Value: factory.NewEmptyBlock()},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone2", ID: 4, Extra: &extramessage.ExtraMessage{
+			PaxosPropose: &extramessage.PaxosPropose{PaxosSeqID: 3, ID: 7, Value: pathBlock},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone2", ID: 5, Extra: &extramessage.ExtraMessage{
+			PaxosAccept: &extramessage.PaxosAccept{PaxosSeqID: 3, ID: 7, AcceptorID: 4, Value: mappingBlock},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone2", ID: 6, Extra: &extramessage.ExtraMessage{
+			PaxosTLC: &extramessage.PaxosTLC{AcceptorID: 2, Value: namingBlock},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone2", ID: 6, Extra: &extramessage.ExtraMessage{
+			PaxosTLC: &extramessage.PaxosTLC{Value: batchBlock},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone3", ID: 1, Extra: &extramessage.ExtraMessage{
+			RaftRequestVote: &extramessage.RaftRequestVote{Term: 2, CandidateID: 3, LastLogIndex: -1, LastLogTerm: -1},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone1", ID: 1, Extra: &extramessage.ExtraMessage{
+			RaftVote: &extramessage.RaftVote{Term: 2, VoterID: 1, CandidateID: 3, Granted: true},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone3", ID: 2, Extra: &extramessage.ExtraMessage{
+			RaftAppendEntries: &extramessage.RaftAppendEntries{
+				Term:         2,
+				LeaderID:     3,
+				PrevLogIndex: -1,
+				PrevLogTerm:  -1,
+				Entries:      []extramessage.RaftEntry{{Term: 2, Value: pathBlock}},
+				LeaderCommit: -1,
+			},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone1", ID: 2, Extra: &extramessage.ExtraMessage{
+			RaftAppendResponse: &extramessage.RaftAppendResponse{Term: 2, FollowerID: 1, LeaderID: 3, Success: true, MatchIndex: 0},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone2", ID: 7, Extra: &extramessage.ExtraMessage{
+			RaftForward: &extramessage.RaftForward{Term: 2, LeaderID: 3, CommitIndex: 0, Value: mappingBlock},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone4", ID: 1, Extra: &extramessage.ExtraMessage{
+			SyncRequest: &extramessage.SyncRequest{BlockNumber: 1, TailHash: pathBlock.Hash()},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone4", ID: 2, Extra: &extramessage.ExtraMessage{
+			SyncRequest: &extramessage.SyncRequest{BlockNumber: 0},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone1", ID: 3, Extra: &extramessage.ExtraMessage{
+			SyncResponse: &extramessage.SyncResponse{NodeIndex: 3, Blocks: []*blk.BlockContainer{mappingBlock, namingBlock, membershipBlock}},
+		}}},
+		{Rumor: &RumorMessage{Origin: "drone3", ID: 11, Extra: &extramessage.ExtraMessage{
+			BFT: &extramessage.BFTMessage{
+				Phase:     extramessage.BFTViewChange,
+				View:      2,
+				Seq:       1,
+				Digest:    mappingBlock.Hash(),
+				Signer:    3,
+				Signature: []byte{4, 5, 6},
+				Block:     mappingBlock,
+				Proof: []*extramessage.BFTMessage{
+					{Phase: extramessage.BFTPrepare, View: 1, Seq: 1, Digest: mappingBlock.Hash(), Signer: 0, Signature: []byte{7}},
+				},
+			},
+		}}},
+		{Rumor: &RumorMessage{Origin: "GS", ID: 1, Extra: &extramessage.ExtraMessage{
+			SwarmInit: &extramessage.SwarmInit{
+				PatternID:  "1",
+				InitialPos: []r3.Vec{{X: 0, Y: 0, Z: 0}, {X: 2, Y: 0, Z: 0}},
+				TargetPos:  []r3.Vec{{X: 0, Y: 10, Z: 0}, {X: 2, Y: 10.5, Z: 0}},
+				Energy:     []float64{100, 42.5},
+				Grounded:   []uint32{1},
+			},
+		}}},
+		{Rumor: &RumorMessage{Origin: "GS", ID: 4, Extra: &extramessage.ExtraMessage{
+			SwarmInit: &extramessage.SwarmInit{
+				PatternID:  "2",
+				InitialPos: []r3.Vec{{X: 0, Y: 0, Z: 0}},
+				TargetPos:  []r3.Vec{{X: 4, Y: 2, Z: 0}},
+				World: &world.World{
+					Obstacles: []world.Box{{Min: r3.Vec{X: 1, Y: 0, Z: -1}, Max: r3.Vec{X: 2, Y: 5, Z: 1}}},
+					NoFly:     []world.Box{{Min: r3.Vec{X: -3.5, Y: 2, Z: -3.5}, Max: r3.Vec{X: -1, Y: 4, Z: -1}}},
+					Ceiling:   12.5,
+				},
+			},
+		}}},
+		{Rumor: &RumorMessage{Origin: "GS", ID: 2, Extra: &extramessage.ExtraMessage{
+			DroneCommand: &extramessage.DroneCommand{
+				Command: extramessage.CommandReturn,
+				Drones:  []uint32{1},
+				Paths:   [][]r3.Vec{{{}, {}}, {{X: -1}, {Y: -0.5}}},
+			},
+		}}},
+		{Rumor: &RumorMessage{Origin: "GS", ID: 3, Extra: &extramessage.ExtraMessage{
+			DroneCommand: &extramessage.DroneCommand{Command: extramessage.CommandBeacon},
+		}}},
+	}
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for _, codec := range []Codec{NewJSONCodec(), NewBinaryCodec()} {
+		for _, packet := range testPackets() {
+			data, err := codec.Encode(packet)
+			require.NoError(t, err, codec.Name())
+
+			var decoded GossipPacket
+			require.NoError(t, codec.Decode(data, &decoded), codec.Name())
+			require.Equal(t, packet.Copy(), decoded.Copy(), codec.Name())
+
+			// Hashes must survive the round trip, otherwise the chains diverge
+			if packet.Rumor != nil && packet.Rumor.Extra != nil {
+				value := extraValue(packet.Rumor.Extra)
+				if value != nil && value.Block != nil {
+					require.Equal(t, value.Hash(), extraValue(decoded.Rumor.Extra).Hash(), codec.Name())
+				}
+			}
+		}
+	}
+}
+
+func TestCodec_BinaryIsSmaller(t *testing.T) {
+	for _, packet := range testPackets() {
+		jsonData, err := NewJSONCodec().Encode(packet)
+		require.NoError(t, err)
+		binaryData, err := NewBinaryCodec().Encode(packet)
+		require.NoError(t, err)
+		require.Less(t, len(binaryData), len(jsonData))
+	}
+}
+
+func TestCodec_BinaryRejectsTruncated(t *testing.T) {
+	for _, packet := range testPackets() {
+		data, err := NewBinaryCodec().Encode(packet)
+		require.NoError(t, err)
+
+		var decoded GossipPacket
+		require.Error(t, NewBinaryCodec().Decode(data[:len(data)-1], &decoded))
+	}
+}
+
+func extraValue(extra *extramessage.ExtraMessage) *blk.BlockContainer {
+	switch {
+	case extra.PaxosPromise != nil:
+		return extra.PaxosPromise.Value
+	case extra.PaxosPropose != nil:
+		return extra.PaxosPropose.Value
+	case extra.PaxosAccept != nil:
+		return extra.PaxosAccept.Value
+	case extra.PaxosTLC != nil:
+		return extra.PaxosTLC.Value
+	case extra.RaftAppendEntries != nil && len(extra.RaftAppendEntries.Entries) > 0:
+		return extra.RaftAppendEntries.Entries[0].Value
+	case extra.RaftForward != nil:
+		return extra.RaftForward.Value
+	case extra.SyncResponse != nil && len(extra.SyncResponse.Blocks) > 0:
+		return extra.SyncResponse.Blocks[0]
+	case extra.BFT != nil:
+		return extra.BFT.Block
+	default:
+		return nil
+	}
+}
+
+func TestCodec_MinimalTelemetry(t *testing.T) {
+	// Telemetry sent by a drone knowing only the location and the drone ID
+	data := []byte(`{"private":{"origin":"drone1","id":0,"data":{"location":{"X":1,"Y":2,"Z":3},"droneId":4},"destination":"GS","hoplimit":10}}`)
+
+	packet := GossipPacket{}
+	require.NoError(t, NewJSONCodec().Decode(data, &packet))
+	require.Equal(t, uint32(TelemetryMinimal), packet.Private.Data.Version)
+	require.Equal(t, r3.Vec{X: 1, Y: 2, Z: 3}, packet.Private.Data.Location)
+	require.Equal(t, uint32(4), packet.Private.Data.DroneID)
+
+	// The binary codec keeps the minimal form as small as before
+	minimal, err := NewBinaryCodec().Encode(packet)
+	require.NoError(t, err)
+	packet.Private.Data.Version = TelemetryV1
+	rich, err := NewBinaryCodec().Encode(packet)
+	require.NoError(t, err)
+	require.Less(t, len(minimal), len(rich))
+}
@@ -0,0 +1,198 @@
+package gossip
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
+)
+
+// DefaultMTU is the maximum size of a datagram sent on the network, larger
+// packets are fragmented.
+const DefaultMTU = 1400
+
+// FragmentTimeout is the time we wait for the missing fragments of a packet
+// before discarding the received ones.
+const FragmentTimeout = 5 * time.Second
+
+// maxFragmentSets bounds the number of packets being reassembled for a single
+// origin, so that a peer cannot exhaust our memory.
+const maxFragmentSets = 256
+
+// Every datagram starts with its kind
+const (
+	datagramWhole    = 0
+	datagramFragment = 1
+)
+
+// fragmentHeaderSize is the size of kind | fragment ID | index | total
+const fragmentHeaderSize = 1 + 4 + 2 + 2
+
+// minMTU leaves room for the header and at least one byte of payload
+const minMTU = fragmentHeaderSize + 1
+
+// fragmenter splits the packets into datagrams of at most mtu bytes
+type fragmenter struct {
+	mtu int
+
+	mutex  sync.Mutex
+	nextID uint32
+}
+
+func newFragmenter(mtu int) *fragmenter {
+	if mtu <= 0 {
+		mtu = DefaultMTU
+	}
+	if mtu < minMTU {
+		mtu = minMTU
+	}
+	return &fragmenter{
+		mtu:    mtu,
+		nextID: 1,
+	}
+}
+
+// split returns the datagrams to send for the given packet. Packets that fit
+// in a single datagram are only prefixed by their kind.
+func (f *fragmenter) split(data []byte) ([][]byte, error) {
+	if len(data)+1 <= f.mtu {
+		return [][]byte{append([]byte{datagramWhole}, data...)}, nil
+	}
+
+	payloadSize := f.mtu - fragmentHeaderSize
+	total := (len(data) + payloadSize - 1) / payloadSize
+	if total > 0xffff {
+		return nil, xerrors.Errorf("packet of %d bytes is too large", len(data))
+	}
+
+	f.mutex.Lock()
+	id := f.nextID
+	f.nextID++
+	f.mutex.Unlock()
+
+	datagrams := make([][]byte, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * payloadSize
+		if end > len(data) {
+			end = len(data)
+		}
+		datagram := make([]byte, fragmentHeaderSize, fragmentHeaderSize+end-i*payloadSize)
+		datagram[0] = datagramFragment
+		binary.BigEndian.PutUint32(datagram[1:5], id)
+		binary.BigEndian.PutUint16(datagram[5:7], uint16(i))
+		binary.BigEndian.PutUint16(datagram[7:9], uint16(total))
+		datagrams[i] = append(datagram, data[i*payloadSize:end]...)
+	}
+	return datagrams, nil
+}
+
+type fragmentSet struct {
+	parts    [][]byte
+	received int
+	size     int
+	deadline time.Time
+}
+
+// reassembler collects the fragments received from each origin and returns
+// the packets once all their fragments arrived
+type reassembler struct {
+	timeout time.Duration
+
+	// origin -> fragment ID -> fragments
+	sets map[string]map[uint32]*fragmentSet
+}
+
+func newReassembler(timeout time.Duration) *reassembler {
+	return &reassembler{
+		timeout: timeout,
+		sets:    make(map[string]map[uint32]*fragmentSet),
+	}
+}
+
+// add handles a received datagram. It returns the complete packet, or nil if
+// fragments are still missing.
+func (r *reassembler) add(origin string, datagram []byte, now time.Time) ([]byte, error) {
+	if len(datagram) == 0 {
+		return nil, xerrors.New("empty datagram")
+	}
+
+	switch datagram[0] {
+	case datagramWhole:
+		return datagram[1:], nil
+	case datagramFragment:
+	default:
+		return nil, xerrors.Errorf("unknown datagram kind %d", datagram[0])
+	}
+
+	if len(datagram) <= fragmentHeaderSize {
+		return nil, xerrors.New("truncated fragment")
+	}
+	id := binary.BigEndian.Uint32(datagram[1:5])
+	index := int(binary.BigEndian.Uint16(datagram[5:7]))
+	total := int(binary.BigEndian.Uint16(datagram[7:9]))
+	if total == 0 || index >= total {
+		return nil, xerrors.Errorf("invalid fragment %d/%d", index, total)
+	}
+
+	r.expire(now)
+
+	sets, ok := r.sets[origin]
+	if !ok {
+		sets = make(map[uint32]*fragmentSet)
+		r.sets[origin] = sets
+	}
+
+	set, ok := sets[id]
+	if !ok {
+		if len(sets) >= maxFragmentSets {
+			return nil, xerrors.Errorf("too many incomplete packets from %s", origin)
+		}
+		set = &fragmentSet{
+			parts:    make([][]byte, total),
+			deadline: now.Add(r.timeout),
+		}
+		sets[id] = set
+	}
+	if len(set.parts) != total {
+		return nil, xerrors.Errorf("fragment %d of %s has inconsistent total", id, origin)
+	}
+	if set.parts[index] != nil {
+		// Duplicated fragment
+		return nil, nil
+	}
+
+	set.parts[index] = append([]byte{}, datagram[fragmentHeaderSize:]...)
+	set.received++
+	set.size += len(set.parts[index])
+	if set.received < total {
+		return nil, nil
+	}
+
+	delete(sets, id)
+	if len(sets) == 0 {
+		delete(r.sets, origin)
+	}
+
+	packet := make([]byte, 0, set.size)
+	for _, part := range set.parts {
+		packet = append(packet, part...)
+	}
+	return packet, nil
+}
+
+// expire drops the fragment sets whose deadline is over
+func (r *reassembler) expire(now time.Time) {
+	for origin, sets := range r.sets {
+		for id, set := range sets {
+			if now.After(set.deadline) {
+				log.Printf("Discard incomplete packet %d from %s, %d/%d fragments received", id, origin, set.received, len(set.parts))
+				delete(sets, id)
+			}
+		}
+		if len(sets) == 0 {
+			delete(r.sets, origin)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package gossip
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFragment_SmallPacketIsNotFragmented(t *testing.T) {
+	f := newFragmenter(100)
+	r := newReassembler(FragmentTimeout)
+
+	data := []byte("small packet")
+	datagrams, err := f.split(data)
+	require.NoError(t, err)
+	require.Len(t, datagrams, 1)
+
+	packet, err := r.add("origin", datagrams[0], time.Now())
+	require.NoError(t, err)
+	require.Equal(t, data, packet)
+}
+
+func TestFragment_ReassembleOutOfOrder(t *testing.T) {
+	f := newFragmenter(64)
+	r := newReassembler(FragmentTimeout)
+
+	data := make([]byte, 1000)
+	rand.Read(data)
+	datagrams, err := f.split(data)
+	require.NoError(t, err)
+	require.Greater(t, len(datagrams), 1)
+	for _, datagram := range datagrams {
+		require.LessOrEqual(t, len(datagram), 64)
+	}
+
+	// Deliver in reverse order with a duplicate
+	now := time.Now()
+	datagrams = append(datagrams, datagrams[1])
+	var packet []byte
+	for i := len(datagrams) - 1; i >= 0; i-- {
+		res, err := r.add("origin", datagrams[i], now)
+		require.NoError(t, err)
+		if res != nil {
+			require.Nil(t, packet)
+			packet = res
+		}
+	}
+	require.Equal(t, data, packet)
+	require.Empty(t, r.sets)
+}
+
+func TestFragment_OriginsAreSeparated(t *testing.T) {
+	f1 := newFragmenter(32)
+	f2 := newFragmenter(32)
+	r := newReassembler(FragmentTimeout)
+
+	// Both fragmenters use the same fragment IDs
+	data1 := []byte("a first packet that needs to be fragmented")
+	data2 := []byte("a second packet that also needs to be fragmented")
+	datagrams1, err := f1.split(data1)
+	require.NoError(t, err)
+	datagrams2, err := f2.split(data2)
+	require.NoError(t, err)
+
+	now := time.Now()
+	var packet1, packet2 []byte
+	for i := 0; i < len(datagrams1) || i < len(datagrams2); i++ {
+		if i < len(datagrams1) {
+			packet1, err = r.add("origin1", datagrams1[i], now)
+			require.NoError(t, err)
+		}
+		if i < len(datagrams2) {
+			packet2, err = r.add("origin2", datagrams2[i], now)
+			require.NoError(t, err)
+		}
+	}
+	require.Equal(t, data1, packet1)
+	require.Equal(t, data2, packet2)
+}
+
+func TestFragment_IncompleteSetExpires(t *testing.T) {
+	f := newFragmenter(32)
+	r := newReassembler(time.Second)
+
+	datagrams, err := f.split(make([]byte, 100))
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, datagram := range datagrams[1:] {
+		packet, err := r.add("origin", datagram, now)
+		require.NoError(t, err)
+		require.Nil(t, packet)
+	}
+
+	r.expire(now.Add(2 * time.Second))
+	require.Empty(t, r.sets)
+
+	// The late first fragment alone does not complete the packet
+	packet, err := r.add("origin", datagrams[0], now.Add(2*time.Second))
+	require.NoError(t, err)
+	require.Nil(t, packet)
+}
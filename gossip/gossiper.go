@@ -3,16 +3,19 @@ package gossip
 // ========== CS-438 Project ===========
 
 import (
-	"encoding/json"
+	"crypto/ed25519"
 	"errors"
 	"math/rand"
 	"net"
 	"reflect"
 	"runtime"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
 
 	"sync"
 )
@@ -20,12 +23,21 @@ import (
 // BaseGossipFactory provides a factory to instantiate a Gossiper
 //
 // - implements gossip.GossipFactory
-type BaseGossipFactory struct{}
+type BaseGossipFactory struct {
+	codec Codec
+	mtu   int
+}
 
-// New implements gossip.GossipFactory. It creates a new gossiper.
+// New implements gossip.GossipFactory. It creates a new gossiper listening
+// on a UDP socket.
 func (f BaseGossipFactory) New(address, identifier string, antiEntropy int,
 	routeTimer int, numParticipant int) (*Gossiper, error) {
-	return NewGossiper(address, identifier, antiEntropy, routeTimer, numParticipant)
+	server, err := NewUDPServer(address, f.mtu)
+	if err != nil {
+		return nil, err
+	}
+	return NewGossiper(server, identifier, antiEntropy, routeTimer, numParticipant, f.codec,
+		rand.New(rand.NewSource(time.Now().UnixNano())))
 }
 
 type messageTracking struct {
@@ -39,11 +51,15 @@ type messageTracking struct {
 //
 // - implements gossip.BaseGossiper
 type Gossiper struct {
+	// number of packets rejected by the authentication, accessed atomically
+	rejected uint64
+
 	Handlers map[reflect.Type]interface{}
 
-	server  *UDPServer
+	server  Transport
 	handler *MessageHandler
 	sending chan<- UDPPacket
+	codec   Codec
 
 	identifier  string
 	address     string
@@ -51,6 +67,15 @@ type Gossiper struct {
 	routeTimer  int
 	callback    NewMessageCallback
 
+	// random decisions of the gossip protocol, such as the peers picked
+	random      *rand.Rand
+	mutexRandom sync.Mutex
+
+	// nil when the packets are not authenticated
+	keyring       *Keyring
+	signingKey    ed25519.PrivateKey
+	encryptionKey []byte
+
 	nodes      map[string]*net.UDPAddr
 	mutexNodes sync.RWMutex
 
@@ -66,40 +91,39 @@ type Gossiper struct {
 	timerAntiEntropy    *time.Ticker
 }
 
-// NewGossiper returns a Gossiper that is able to listen to the given address
-// and which has the given identifier. The address must be a valid IPv4 UDP
-// address. This method can panic if it is not possible to create a
-// listener on that address. To run the gossip protocol, call `Run` on the
-// gossiper.
-func NewGossiper(address, identifier string, antiEntropy int, routeTimer int, numParticipant int) (*Gossiper, error) {
+// NewGossiper returns a Gossiper that sends and receives its packets through
+// the given transport and which has the given identifier. Packets are encoded
+// with the given codec, JSON is used if it is nil. Its random decisions are
+// drawn from the given source, so that a seeded one replays them. To run the
+// gossip protocol, call `Run` on the gossiper.
+func NewGossiper(server Transport, identifier string, antiEntropy int, routeTimer int, numParticipant int, codec Codec, random *rand.Rand) (*Gossiper, error) {
 	// Configs
 	runtime.GOMAXPROCS(runtime.NumCPU())
-	rand.Seed(time.Now().UnixNano())
-
-	// Validate IP Address
-	server, err := NewUDPServer(address)
-	if err != nil {
-		return nil, err
-	}
 
 	// Default value for anti-entropie
 	if antiEntropy <= 0 {
 		antiEntropy = 10
 	}
 
+	if codec == nil {
+		codec = NewJSONCodec()
+	}
+
 	// Create gossiper
 	g := &Gossiper{
 		Handlers: make(map[reflect.Type]interface{}),
 		handler:  NewMessageHandler(),
 
 		identifier:  identifier,
-		address:     server.socket.LocalAddr().String(),
+		address:     server.LocalAddr().String(),
 		antiEntropy: antiEntropy,
 		routeTimer:  routeTimer,
 		callback:    nil,
+		random:      random,
 
 		server:  server,
 		sending: nil,
+		codec:   codec,
 
 		nextID:              1,
 		chanRouteRumorStop:  make(chan bool, 1),
@@ -109,7 +133,7 @@ func NewGossiper(address, identifier string, antiEntropy int, routeTimer int, nu
 	}
 
 	// Register handler
-	err = g.RegisterHandler(&RumorMessage{})
+	err := g.RegisterHandler(&RumorMessage{})
 	if err != nil {
 		return nil, err
 	}
@@ -132,7 +156,7 @@ func (g *Gossiper) decodePacket(chPacket <-chan UDPPacket) chan HandlingPacket {
 		defer close(ch)
 		for packet := range chPacket {
 			var decodedPacket GossipPacket
-			err := json.Unmarshal(packet.data, &decodedPacket)
+			err := g.codec.Decode(packet.data, &decodedPacket)
 			if err != nil {
 				log.Printf("Discard decoded packet, %s", err)
 			} else {
@@ -155,9 +179,6 @@ func (g *Gossiper) Run(ready chan struct{}) {
 	handlerClosed := g.handler.Run(g, g.decodePacket(listener))
 	g.sending = sender
 
-	// Ready to receive packets -> close ready channel
-	close(ready)
-
 	// Anti-entropy
 	if g.antiEntropy > 0 {
 		g.timerAntiEntropy = time.NewTicker(time.Second * time.Duration(g.antiEntropy))
@@ -184,23 +205,23 @@ func (g *Gossiper) Run(ready chan struct{}) {
 	if g.routeTimer > 0 {
 		g.timerRouteRumor = time.NewTicker(time.Second * time.Duration(g.routeTimer))
 
-		msg := GossipPacket{
-			Rumor: &RumorMessage{
-				Origin: g.identifier,
-				ID:     0,
-				Text:   "",
-			},
-		}
-
 		sendEmptyRouteRumor := func() {
 			g.mutexNextID.Lock()
 			id := g.nextID
 			g.nextID++
 			g.mutexNextID.Unlock()
 
-			msg.Rumor.ID = id
+			// Each route rumor is stored, so a new one is created every time
+			msg := GossipPacket{
+				Rumor: &RumorMessage{
+					Origin: g.identifier,
+					ID:     id,
+					Text:   "",
+				},
+			}
+			g.signRumor(msg.Rumor)
 			// To one address
-			g.handler.HandlePacket(g, HandlingPacket{data: &msg, addr: g.server.Address})
+			g.handler.HandlePacket(g, HandlingPacket{data: &msg, addr: g.server.LocalAddr()})
 		}
 
 		go func() {
@@ -216,6 +237,10 @@ func (g *Gossiper) Run(ready chan struct{}) {
 		}()
 	}
 
+	// Ready to receive packets, and to be stopped once the timers are set ->
+	// close ready channel
+	close(ready)
+
 	// Connect close handling to handler close event
 	handlingFinished <- <-handlerClosed
 }
@@ -306,10 +331,12 @@ func (g *Gossiper) AddPrivateMessage(data PrivateMessageData, dest, origin strin
 			HopLimit:    hoplimit,
 		},
 	}
+	g.sealPrivate(msg.Private)
+	g.signPrivate(msg.Private)
 
 	g.handler.HandlePacket(g, HandlingPacket{
 		data: msg,
-		addr: g.server.Address,
+		addr: g.server.LocalAddr(),
 	})
 }
 
@@ -331,10 +358,11 @@ func (g *Gossiper) AddMessage(text string) uint32 {
 			Text:   text,
 		},
 	}
+	g.signRumor(msg.Rumor)
 	// Simply dispatch message
 	g.handler.HandlePacket(g, HandlingPacket{
 		data: msg,
-		addr: g.server.Address,
+		addr: g.server.LocalAddr(),
 	})
 
 	return id
@@ -355,16 +383,176 @@ func (g *Gossiper) AddExtraMessage(paxosMsg *extramessage.ExtraMessage) uint32 {
 			Extra:  paxosMsg,
 		},
 	}
+	g.signRumor(msg.Rumor)
 
 	// Simply dispatch message
 	g.handler.HandlePacket(g, HandlingPacket{
 		data: msg,
-		addr: g.server.Address,
+		addr: g.server.LocalAddr(),
 	})
 
 	return id
 }
 
+// ResumeFrom restores the rumor state of a stopped gossiper having the same
+// identifier, as if it had been persisted. The new rumors of g continue the
+// sequence of the previous gossiper, so that the peers do not discard them as
+// already seen, and the old rumors are not delivered a second time. It must be
+// called before Run.
+func (g *Gossiper) ResumeFrom(previous *Gossiper) {
+	previous.mutexNextID.Lock()
+	nextID := previous.nextID
+	previous.mutexNextID.Unlock()
+
+	g.mutexNextID.Lock()
+	g.nextID = nextID
+	g.mutexNextID.Unlock()
+
+	previous.messages.Range(func(origin, track interface{}) bool {
+		g.messages.Store(origin, track)
+		return true
+	})
+	previous.routes.Range(func(destination, route interface{}) bool {
+		g.routes.Store(destination, route)
+		return true
+	})
+
+	g.keyring = previous.keyring
+	g.signingKey = previous.signingKey
+	g.encryptionKey = previous.encryptionKey
+}
+
+// SetSigningKey enables the authentication of the packets. The rumors and
+// private messages created by g are signed with key, and the ones received
+// are rejected unless they are signed with the key of their origin in the
+// keyring. It must be called before Run.
+func (g *Gossiper) SetSigningKey(keyring *Keyring, key ed25519.PrivateKey) {
+	g.keyring = keyring
+	g.signingKey = key
+}
+
+// SetEncryptionKey enables the encryption of the private messages. The data
+// of the private messages sent by g is encrypted for their destination when
+// its key is in the keyring given to SetSigningKey, and the private messages
+// addressed to g must be encrypted by origins whose key is in the keyring. It
+// must be called before Run.
+func (g *Gossiper) SetEncryptionKey(key []byte) {
+	g.encryptionKey = key
+}
+
+// RejectedCount returns the number of packets rejected because they were
+// unsigned or badly signed
+func (g *Gossiper) RejectedCount() uint64 {
+	return atomic.LoadUint64(&g.rejected)
+}
+
+func (g *Gossiper) signRumor(msg *RumorMessage) {
+	if g.signingKey == nil {
+		return
+	}
+	payload, err := rumorPayload(msg)
+	if err != nil {
+		log.Printf("Unable to sign rumor: %s", err)
+		return
+	}
+	msg.Signature = ed25519.Sign(g.signingKey, payload)
+}
+
+func (g *Gossiper) signPrivate(msg *PrivateMessage) {
+	if g.signingKey == nil {
+		return
+	}
+	payload, err := privatePayload(msg)
+	if err != nil {
+		log.Printf("Unable to sign private message: %s", err)
+		return
+	}
+	msg.Signature = ed25519.Sign(g.signingKey, payload)
+}
+
+func (g *Gossiper) sealPrivate(msg *PrivateMessage) {
+	if g.keyring == nil || g.encryptionKey == nil {
+		return
+	}
+	peer, ok := g.keyring.EncryptionKey(msg.Destination)
+	if !ok {
+		return
+	}
+	key, err := sealKey(g.encryptionKey, peer, msg.Origin, msg.Destination)
+	if err == nil {
+		err = seal(key, msg)
+	}
+	if err != nil {
+		log.Printf("Unable to seal private message: %s", err)
+	}
+}
+
+// openPrivate decrypts a private message addressed to g. Private messages
+// from an origin having an encryption key must be encrypted.
+func (g *Gossiper) openPrivate(msg *PrivateMessage) error {
+	if g.keyring == nil || g.encryptionKey == nil {
+		return nil
+	}
+	peer, ok := g.keyring.EncryptionKey(msg.Origin)
+	if !ok && msg.Sealed == nil {
+		return nil
+	}
+
+	err := ErrCannotOpen
+	if ok && msg.Sealed != nil {
+		var key []byte
+		key, err = sealKey(g.encryptionKey, peer, msg.Origin, msg.Destination)
+		if err == nil {
+			err = open(key, msg)
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&g.rejected, 1)
+		return xerrors.Errorf("private message from %s rejected: %v", msg.Origin, err)
+	}
+	return nil
+}
+
+// authenticateRumor checks the signature of a received rumor. Only the
+// trusted nodes may initialise or command the swarm.
+func (g *Gossiper) authenticateRumor(msg *RumorMessage) error {
+	if g.keyring == nil {
+		return nil
+	}
+	payload, err := rumorPayload(msg)
+	if err == nil {
+		err = g.keyring.verify(msg.Origin, payload, msg.Signature)
+	}
+	if err == nil && msg.Extra != nil && !g.keyring.IsTrusted(msg.Origin) {
+		if msg.Extra.SwarmInit != nil {
+			err = xerrors.Errorf("swarm init from untrusted %s", msg.Origin)
+		} else if msg.Extra.DroneCommand != nil {
+			err = xerrors.Errorf("drone command from untrusted %s", msg.Origin)
+		}
+	}
+	if err != nil {
+		atomic.AddUint64(&g.rejected, 1)
+		return xerrors.Errorf("rumor rejected: %v", err)
+	}
+	return nil
+}
+
+// authenticatePrivate checks the signature of a received private message
+func (g *Gossiper) authenticatePrivate(msg *PrivateMessage) error {
+	if g.keyring == nil {
+		return nil
+	}
+	payload, err := privatePayload(msg)
+	if err == nil {
+		err = g.keyring.verify(msg.Origin, payload, msg.Signature)
+	}
+	if err != nil {
+		atomic.AddUint64(&g.rejected, 1)
+		return xerrors.Errorf("private message rejected: %v", err)
+	}
+	return nil
+}
+
 // AddAddresses implements gossip.BaseGossiper. It takes any number of node
 // addresses that the gossiper can contact in the gossiping network.
 func (g *Gossiper) AddAddresses(addresses ...string) error {
@@ -408,10 +596,19 @@ NodeLoop:
 	if len(nodes) <= 0 {
 		return "", errors.New("No other known hosts")
 	}
-	node := nodes[rand.Intn(len(nodes))]
+	// The order of the map is random, the pick must not depend on it
+	sort.Strings(nodes)
+	node := nodes[g.randomInt(len(nodes))]
 	return node, nil
 }
 
+// randomInt returns a number in [0, n) drawn from the source of the gossiper
+func (g *Gossiper) randomInt(n int) int {
+	g.mutexRandom.Lock()
+	defer g.mutexRandom.Unlock()
+	return g.random.Intn(n)
+}
+
 // GetNodes implements gossip.BaseGossiper. It returns the list of nodes this
 // gossiper knows currently in the network.
 func (g *Gossiper) GetNodes() []string {
@@ -0,0 +1,153 @@
+package gossip
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"sync"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/xerrors"
+)
+
+// Domain separation prefixes of the signed payloads, so that the signature of
+// a rumor can never be replayed as the signature of a private message
+const (
+	rumorSignatureDomain   = "orbitalswarm-rumor"
+	privateSignatureDomain = "orbitalswarm-private"
+)
+
+// ErrUnknownSigner is returned when a message is signed by an identifier whose
+// public key is not in the keyring
+var ErrUnknownSigner = xerrors.New("unknown signer")
+
+// ErrBadSignature is returned when a message is unsigned or its signature does
+// not match its content
+var ErrBadSignature = xerrors.New("bad signature")
+
+// Keyring stores the public keys of the nodes of the swarm, by identifier, and
+// which of them are trusted to command the swarm. Signing keys are Ed25519 keys
+// and encryption keys are X25519 keys.
+type Keyring struct {
+	mutex          sync.RWMutex
+	keys           map[string]ed25519.PublicKey
+	encryptionKeys map[string][]byte
+	trusted        map[string]bool
+}
+
+// NewKeyring returns an empty keyring
+func NewKeyring() *Keyring {
+	return &Keyring{
+		keys:           make(map[string]ed25519.PublicKey),
+		encryptionKeys: make(map[string][]byte),
+		trusted:        make(map[string]bool),
+	}
+}
+
+// GenerateKey creates a new key pair for the given identifier and stores its
+// public key. The private key is returned to be given to the node.
+func (k *Keyring) GenerateKey(identifier string) (ed25519.PrivateKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	k.AddKey(identifier, public)
+	return private, nil
+}
+
+// AddKey stores the public key of the given identifier
+func (k *Keyring) AddKey(identifier string, key ed25519.PublicKey) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.keys[identifier] = key
+}
+
+// PublicKey returns the public key of the given identifier
+func (k *Keyring) PublicKey(identifier string) (ed25519.PublicKey, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	key, ok := k.keys[identifier]
+	return key, ok
+}
+
+// GenerateEncryptionKey creates a new X25519 key pair for the given identifier
+// and stores its public key. The private key is returned to be given to the
+// node.
+func (k *Keyring) GenerateEncryptionKey(identifier string) ([]byte, error) {
+	private := make([]byte, curve25519.ScalarSize)
+	_, err := rand.Read(private)
+	if err != nil {
+		return nil, err
+	}
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	k.AddEncryptionKey(identifier, public)
+	return private, nil
+}
+
+// AddEncryptionKey stores the public encryption key of the given identifier
+func (k *Keyring) AddEncryptionKey(identifier string, key []byte) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.encryptionKeys[identifier] = key
+}
+
+// EncryptionKey returns the public encryption key of the given identifier
+func (k *Keyring) EncryptionKey(identifier string) ([]byte, bool) {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	key, ok := k.encryptionKeys[identifier]
+	return key, ok
+}
+
+// Trust allows the given identifier to command the swarm, like the ground
+// station
+func (k *Keyring) Trust(identifier string) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	k.trusted[identifier] = true
+}
+
+// IsTrusted tells whether the given identifier may command the swarm
+func (k *Keyring) IsTrusted(identifier string) bool {
+	k.mutex.RLock()
+	defer k.mutex.RUnlock()
+	return k.trusted[identifier]
+}
+
+// verify checks that signature is a valid signature of payload by identifier
+func (k *Keyring) verify(identifier string, payload, signature []byte) error {
+	key, ok := k.PublicKey(identifier)
+	if !ok {
+		return xerrors.Errorf("%s: %w", identifier, ErrUnknownSigner)
+	}
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(key, payload, signature) {
+		return xerrors.Errorf("%s: %w", identifier, ErrBadSignature)
+	}
+	return nil
+}
+
+// rumorPayload returns the canonical encoding of the rumor covered by its
+// signature
+func rumorPayload(msg *RumorMessage) ([]byte, error) {
+	w := newBinaryWriter()
+	w.string(rumorSignatureDomain)
+	w.rumorContent(msg)
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// privatePayload returns the canonical encoding of the private message
+// covered by its signature
+func privatePayload(msg *PrivateMessage) ([]byte, error) {
+	w := newBinaryWriter()
+	w.string(privateSignatureDomain)
+	w.privateContent(msg)
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf.Bytes(), nil
+}
@@ -0,0 +1,172 @@
+package gossip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// createSignedGossipers creates and runs n gossipers knowing each other. The
+// ones whose index is in signed get a signing key of the keyring, and an
+// encryption key if encrypt is set.
+func createSignedGossipers(t *testing.T, keyring *Keyring, n int, encrypt bool, signed ...int) []*Gossiper {
+	fac := NewMemoryGossipFactory(NewMemoryNetwork(1), NewBinaryCodec())
+	gossipers := make([]*Gossiper, n)
+	for i := range gossipers {
+		g, err := fac.New("", string(rune('A'+i)), 1, 0, n)
+		require.NoError(t, err)
+		gossipers[i] = g
+	}
+	for _, i := range signed {
+		key, err := keyring.GenerateKey(gossipers[i].GetIdentifier())
+		require.NoError(t, err)
+		gossipers[i].SetSigningKey(keyring, key)
+
+		if encrypt {
+			key, err := keyring.GenerateEncryptionKey(gossipers[i].GetIdentifier())
+			require.NoError(t, err)
+			gossipers[i].SetEncryptionKey(key)
+		}
+	}
+	for _, g := range gossipers {
+		for _, other := range gossipers {
+			g.AddAddresses(other.GetLocalAddr())
+		}
+		ready := make(chan struct{})
+		go g.Run(ready)
+		<-ready
+	}
+	return gossipers
+}
+
+func TestKeyring_Payload(t *testing.T) {
+	keyring := NewKeyring()
+	key, err := keyring.GenerateKey("A")
+	require.NoError(t, err)
+
+	g := &Gossiper{keyring: keyring, signingKey: key}
+	rumor := &RumorMessage{Origin: "A", ID: 3, Text: "hello"}
+	g.signRumor(rumor)
+	require.NoError(t, g.authenticateRumor(rumor))
+
+	private := &PrivateMessage{Origin: "A", Destination: "B", HopLimit: 10}
+	g.signPrivate(private)
+	require.NoError(t, g.authenticatePrivate(private))
+
+	// Relays decrement the hop limit without breaking the signature
+	private.HopLimit--
+	require.NoError(t, g.authenticatePrivate(private))
+
+	tampered := *rumor
+	tampered.Text = "hijacked"
+	require.Error(t, g.authenticateRumor(&tampered))
+
+	// The signature of a rumor is not valid for another origin
+	keyring.AddKey("B", keyring.keys["A"])
+	tampered = *rumor
+	tampered.Origin = "B"
+	require.Error(t, g.authenticateRumor(&tampered))
+
+	unsigned := &RumorMessage{Origin: "A", ID: 4, Text: "unsigned"}
+	require.Error(t, g.authenticateRumor(unsigned))
+
+	unknown := &RumorMessage{Origin: "C", ID: 1}
+	require.Error(t, g.authenticateRumor(unknown))
+
+	swarmInit := &RumorMessage{Origin: "A", ID: 5, Extra: &extramessage.ExtraMessage{
+		SwarmInit: &extramessage.SwarmInit{PatternID: "pattern"},
+	}}
+	g.signRumor(swarmInit)
+	require.Error(t, g.authenticateRumor(swarmInit))
+	keyring.Trust("A")
+	require.NoError(t, g.authenticateRumor(swarmInit))
+
+	require.Equal(t, uint64(5), g.RejectedCount())
+}
+
+func TestKeyring_RejectUnsigned(t *testing.T) {
+	keyring := NewKeyring()
+	// C is not provisioned, like an attacker reaching the ports of the swarm
+	gossipers := createSignedGossipers(t, keyring, 3, false, 0, 1)
+	defer stopGossipers(gossipers)
+
+	received := &receivedTexts{}
+	gossipers[1].RegisterCallback(received.callback)
+
+	gossipers[2].AddMessage("forged")
+	gossipers[0].AddMessage("signed")
+
+	require.Eventually(t, func() bool {
+		return len(received.get()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return gossipers[1].RejectedCount() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, []string{"signed"}, received.get())
+}
+
+func TestKeyring_Seal(t *testing.T) {
+	keyring := NewKeyring()
+	privateA, err := keyring.GenerateEncryptionKey("A")
+	require.NoError(t, err)
+	privateB, err := keyring.GenerateEncryptionKey("B")
+	require.NoError(t, err)
+	publicA, _ := keyring.EncryptionKey("A")
+	publicB, _ := keyring.EncryptionKey("B")
+
+	keyA, err := sealKey(privateA, publicB, "A", "B")
+	require.NoError(t, err)
+	keyB, err := sealKey(privateB, publicA, "A", "B")
+	require.NoError(t, err)
+	require.Equal(t, keyA, keyB)
+
+	data := PrivateMessageData{Location: r3.Vec{X: 1.5, Y: 2, Z: -3}, DroneID: 4}
+	msg := &PrivateMessage{Origin: "A", ID: 1, Data: data, Destination: "B", HopLimit: 10}
+	require.NoError(t, seal(keyA, msg))
+	require.Equal(t, PrivateMessageData{}, msg.Data)
+
+	tampered := *msg
+	tampered.Sealed = append([]byte(nil), msg.Sealed...)
+	tampered.Sealed[len(tampered.Sealed)-1] ^= 1
+	require.Equal(t, ErrCannotOpen, open(keyB, &tampered))
+
+	moved := *msg
+	moved.ID = 2
+	require.Equal(t, ErrCannotOpen, open(keyB, &moved))
+
+	msg.HopLimit--
+	require.NoError(t, open(keyB, msg))
+	require.Equal(t, data, msg.Data)
+	require.Nil(t, msg.Sealed)
+}
+
+func TestKeyring_SealedPrivate(t *testing.T) {
+	keyring := NewKeyring()
+	gossipers := createSignedGossipers(t, keyring, 2, true, 0, 1)
+	defer stopGossipers(gossipers)
+
+	received := make(chan PrivateMessage, 1)
+	gossipers[1].RegisterCallback(func(origin string, msg GossipPacket) {
+		if msg.Private != nil {
+			received <- *msg.Private
+		}
+	})
+
+	gossipers[0].AddRoute("B", gossipers[1].GetLocalAddr())
+
+	data := PrivateMessageData{Location: r3.Vec{X: 1, Y: 2, Z: 3}, DroneID: 7}
+	gossipers[0].AddPrivateMessage(data, "B", "A", 10)
+
+	select {
+	case msg := <-received:
+		require.Equal(t, data, msg.Data)
+	case <-time.After(5 * time.Second):
+		t.Fatal("private message not received")
+	}
+	require.Equal(t, uint64(0), gossipers[1].RejectedCount())
+}
@@ -0,0 +1,344 @@
+package gossip
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// memoryBaseAddress is the IP used for the addresses allocated by the
+// MemoryNetwork. No socket is ever bound to them.
+const memoryBaseAddress = "127.0.0.1"
+
+// MemoryNetwork connects MemoryTransports inside the process. All its random
+// decisions come from the seed given at creation, so that a faulty network can
+// be replayed. By default, packets are delivered immediately and reliably.
+type MemoryNetwork struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+
+	endpoints map[string]*MemoryTransport
+	nextPort  int
+
+	minLatency  time.Duration
+	maxLatency  time.Duration
+	loss        float64
+	duplication float64
+	reordering  float64
+
+	// address -> partition group, nil when the network is not partitioned
+	groups map[string]int
+	// loss rate of the links between two addresses, on top of the global one
+	linkLoss map[memoryLink]float64
+}
+
+// memoryLink is an undirected link between two addresses
+type memoryLink struct {
+	a, b string
+}
+
+func newMemoryLink(a, b string) memoryLink {
+	if b < a {
+		a, b = b, a
+	}
+	return memoryLink{a: a, b: b}
+}
+
+// NewMemoryNetwork returns an empty network whose faults are drawn from the
+// given seed
+func NewMemoryNetwork(seed int64) *MemoryNetwork {
+	return &MemoryNetwork{
+		rand:      rand.New(rand.NewSource(seed)),
+		endpoints: make(map[string]*MemoryTransport),
+		nextPort:  1,
+		linkLoss:  make(map[memoryLink]float64),
+	}
+}
+
+// NewTransport creates the transport listening on the given address. An
+// address is allocated if it is empty.
+func (n *MemoryNetwork) NewTransport(address string) (*MemoryTransport, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if address == "" {
+		for {
+			address = fmt.Sprintf("%s:%d", memoryBaseAddress, n.nextPort)
+			n.nextPort++
+			if _, used := n.endpoints[address]; !used {
+				break
+			}
+		}
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	if _, used := n.endpoints[addr.String()]; used {
+		return nil, xerrors.Errorf("address %s already in use", addr)
+	}
+
+	t := &MemoryTransport{
+		network:          n,
+		address:          addr,
+		inbound:          make(chan UDPPacket, 1024),
+		handlingFinished: make(chan bool),
+	}
+	n.endpoints[addr.String()] = t
+	return t, nil
+}
+
+// newRandom returns a source drawn from the seed of the network, for the
+// random decisions of a gossiper
+func (n *MemoryNetwork) newRandom() *rand.Rand {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return rand.New(rand.NewSource(n.rand.Int63()))
+}
+
+// SetLatency makes every packet wait a random duration in [min, max] before
+// being delivered
+func (n *MemoryNetwork) SetLatency(min, max time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if max < min {
+		max = min
+	}
+	n.minLatency = min
+	n.maxLatency = max
+}
+
+// SetLoss drops the given ratio of packets
+func (n *MemoryNetwork) SetLoss(rate float64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.loss = rate
+}
+
+// SetDuplication delivers the given ratio of packets twice
+func (n *MemoryNetwork) SetDuplication(rate float64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.duplication = rate
+}
+
+// SetReordering delays the given ratio of packets past the maximum latency,
+// so that packets sent after them overtake them
+func (n *MemoryNetwork) SetReordering(rate float64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.reordering = rate
+}
+
+// SetLinkLoss drops the given ratio of the packets exchanged between the two
+// addresses, in both directions. A rate of 0 restores the link.
+func (n *MemoryNetwork) SetLinkLoss(a, b string, rate float64) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if rate <= 0 {
+		delete(n.linkLoss, newMemoryLink(a, b))
+	} else {
+		n.linkLoss[newMemoryLink(a, b)] = rate
+	}
+}
+
+// Partition splits the network in the given groups of addresses. Packets are
+// only delivered inside a group. The addresses that are not listed form one
+// more group.
+func (n *MemoryNetwork) Partition(groups ...[]string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, address := range group {
+			n.groups[address] = i + 1
+		}
+	}
+}
+
+// Heal removes the partitions and the link losses
+func (n *MemoryNetwork) Heal() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.groups = nil
+	n.linkLoss = make(map[memoryLink]float64)
+}
+
+// Addresses returns the addresses of the transports of the network
+func (n *MemoryNetwork) Addresses() []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	addresses := make([]string, 0, len(n.endpoints))
+	for address := range n.endpoints {
+		addresses = append(addresses, address)
+	}
+	return addresses
+}
+
+// delays returns when each copy of a packet sent from src to dst must be
+// delivered. No copy is delivered if the packet is lost.
+func (n *MemoryNetwork) delays(src, dst string) []time.Duration {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.groups != nil && n.groups[src] != n.groups[dst] {
+		return nil
+	}
+	if n.loss > 0 && n.rand.Float64() < n.loss {
+		return nil
+	}
+	if loss, ok := n.linkLoss[newMemoryLink(src, dst)]; ok && n.rand.Float64() < loss {
+		return nil
+	}
+
+	copies := 1
+	if n.duplication > 0 && n.rand.Float64() < n.duplication {
+		copies++
+	}
+
+	delays := make([]time.Duration, copies)
+	for i := range delays {
+		delay := n.minLatency
+		if n.maxLatency > n.minLatency {
+			delay += time.Duration(n.rand.Int63n(int64(n.maxLatency - n.minLatency)))
+		}
+		if n.reordering > 0 && n.rand.Float64() < n.reordering {
+			delay += n.maxLatency + time.Millisecond
+		}
+		delays[i] = delay
+	}
+	return delays
+}
+
+func (n *MemoryNetwork) send(src *MemoryTransport, packet UDPPacket) {
+	n.mutex.Lock()
+	dst, ok := n.endpoints[packet.addr.String()]
+	n.mutex.Unlock()
+	if !ok {
+		// Nobody listens on that address, the packet is lost
+		return
+	}
+
+	for _, delay := range n.delays(src.address.String(), dst.address.String()) {
+		delivered := UDPPacket{data: packet.data, addr: src.address}
+		if delay == 0 {
+			dst.deliver(delivered)
+		} else {
+			time.AfterFunc(delay, func() {
+				dst.deliver(delivered)
+			})
+		}
+	}
+}
+
+func (n *MemoryNetwork) remove(t *MemoryTransport) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.endpoints[t.address.String()] == t {
+		delete(n.endpoints, t.address.String())
+	}
+}
+
+// MemoryTransport is one end of a MemoryNetwork
+//
+// - implements gossip.Transport
+type MemoryTransport struct {
+	network *MemoryNetwork
+	address *net.UDPAddr
+
+	mutex   sync.RWMutex
+	closed  bool
+	inbound chan UDPPacket
+
+	sender           chan UDPPacket
+	senderClosed     chan bool
+	handlingFinished chan bool
+}
+
+// LocalAddr implements gossip.Transport
+func (t *MemoryTransport) LocalAddr() *net.UDPAddr {
+	return t.address
+}
+
+// Run implements gossip.Transport
+func (t *MemoryTransport) Run() (<-chan UDPPacket, chan<- UDPPacket, chan<- bool) {
+	t.sender = make(chan UDPPacket, 1024)
+	t.senderClosed = make(chan bool)
+
+	go func() {
+		for packet := range t.sender {
+			t.network.send(t, packet)
+		}
+		close(t.senderClosed)
+	}()
+
+	return t.inbound, t.sender, t.handlingFinished
+}
+
+// Stop implements gossip.Transport
+func (t *MemoryTransport) Stop() {
+	t.network.remove(t)
+
+	t.mutex.Lock()
+	t.closed = true
+	close(t.inbound)
+	t.mutex.Unlock()
+
+	<-t.handlingFinished
+	close(t.sender)
+	<-t.senderClosed
+}
+
+func (t *MemoryTransport) deliver(packet UDPPacket) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	if t.closed {
+		return
+	}
+	select {
+	case t.inbound <- packet:
+	default:
+		// Full buffer, the packet is lost as it would be on a socket
+	}
+}
+
+// MemoryGossipFactory creates gossipers connected to a MemoryNetwork
+//
+// - implements gossip.GossipFactory
+type MemoryGossipFactory struct {
+	network *MemoryNetwork
+	codec   Codec
+}
+
+// NewMemoryGossipFactory returns a factory whose gossipers are connected to
+// the given network and encode packets with the given codec
+func NewMemoryGossipFactory(network *MemoryNetwork, codec Codec) MemoryGossipFactory {
+	return MemoryGossipFactory{
+		network: network,
+		codec:   codec,
+	}
+}
+
+// New implements gossip.GossipFactory. It creates a new gossiper without
+// opening any socket.
+func (f MemoryGossipFactory) New(address, identifier string, antiEntropy int,
+	routeTimer int, numParticipant int) (*Gossiper, error) {
+	transport, err := f.network.NewTransport(address)
+	if err != nil {
+		return nil, err
+	}
+	return NewGossiper(transport, identifier, antiEntropy, routeTimer, numParticipant, f.codec, f.network.newRandom())
+}
+
+// Network returns the network the gossipers are connected to
+func (f MemoryGossipFactory) Network() *MemoryNetwork {
+	return f.network
+}
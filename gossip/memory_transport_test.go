@@ -0,0 +1,147 @@
+package gossip
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createMemoryGossipers creates and runs n gossipers knowing each other
+func createMemoryGossipers(t *testing.T, network *MemoryNetwork, n int) []*Gossiper {
+	fac := NewMemoryGossipFactory(network, NewBinaryCodec())
+	gossipers := make([]*Gossiper, n)
+	for i := range gossipers {
+		g, err := fac.New("", string(rune('A'+i)), 1, 0, n)
+		require.NoError(t, err)
+		gossipers[i] = g
+	}
+	for _, g := range gossipers {
+		for _, other := range gossipers {
+			g.AddAddresses(other.GetLocalAddr())
+		}
+		ready := make(chan struct{})
+		go g.Run(ready)
+		<-ready
+	}
+	return gossipers
+}
+
+func stopGossipers(gossipers []*Gossiper) {
+	for _, g := range gossipers {
+		g.Stop()
+	}
+}
+
+// receivedTexts records the texts delivered to a gossiper
+type receivedTexts struct {
+	sync.Mutex
+	texts []string
+}
+
+func (r *receivedTexts) callback(origin string, msg GossipPacket) {
+	r.Lock()
+	defer r.Unlock()
+	if msg.Rumor != nil && msg.Rumor.Text != "" {
+		r.texts = append(r.texts, msg.Rumor.Text)
+	}
+}
+
+func (r *receivedTexts) get() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string{}, r.texts...)
+}
+
+func TestMemoryTransport_Rumor(t *testing.T) {
+	network := NewMemoryNetwork(1)
+	network.SetLatency(time.Millisecond, 5*time.Millisecond)
+	network.SetDuplication(0.3)
+	network.SetReordering(0.3)
+
+	gossipers := createMemoryGossipers(t, network, 3)
+	defer stopGossipers(gossipers)
+
+	received := make([]*receivedTexts, len(gossipers))
+	for i, g := range gossipers {
+		received[i] = &receivedTexts{}
+		g.RegisterCallback(received[i].callback)
+	}
+
+	gossipers[0].AddMessage("hello")
+
+	require.Eventually(t, func() bool {
+		return len(received[1].get()) == 1 && len(received[2].get()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"hello"}, received[1].get())
+}
+
+func TestMemoryTransport_Partition(t *testing.T) {
+	network := NewMemoryNetwork(1)
+	gossipers := createMemoryGossipers(t, network, 3)
+	defer stopGossipers(gossipers)
+
+	received := make([]*receivedTexts, len(gossipers))
+	for i, g := range gossipers {
+		received[i] = &receivedTexts{}
+		g.RegisterCallback(received[i].callback)
+	}
+
+	network.Partition([]string{gossipers[0].GetLocalAddr(), gossipers[1].GetLocalAddr()})
+	gossipers[0].AddMessage("partitioned")
+
+	require.Eventually(t, func() bool {
+		return len(received[1].get()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	require.Empty(t, received[2].get())
+
+	// Anti-entropy spreads the rumor once the network is healed
+	network.Heal()
+	require.Eventually(t, func() bool {
+		return len(received[2].get()) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMemoryTransport_Loss(t *testing.T) {
+	network := NewMemoryNetwork(1)
+	network.SetLoss(1)
+	gossipers := createMemoryGossipers(t, network, 2)
+	defer stopGossipers(gossipers)
+
+	received := &receivedTexts{}
+	gossipers[1].RegisterCallback(received.callback)
+
+	gossipers[0].AddMessage("lost")
+	time.Sleep(200 * time.Millisecond)
+	require.Empty(t, received.get())
+}
+
+func TestMemoryTransport_Seed(t *testing.T) {
+	// The gossipers of networks with the same seed pick the same peers
+	picks := func(seed int64) []string {
+		fac := NewMemoryGossipFactory(NewMemoryNetwork(seed), NewBinaryCodec())
+		gossipers := make([]*Gossiper, 4)
+		for i := range gossipers {
+			g, err := fac.New("", string(rune('A'+i)), 1, 0, len(gossipers))
+			require.NoError(t, err)
+			gossipers[i] = g
+		}
+		addresses := make([]string, 0)
+		for _, g := range gossipers {
+			for _, other := range gossipers {
+				g.AddAddresses(other.GetLocalAddr())
+			}
+			for i := 0; i < 10; i++ {
+				address, err := g.RandomAddress(g.GetLocalAddr())
+				require.NoError(t, err)
+				addresses = append(addresses, address)
+			}
+		}
+		return addresses
+	}
+
+	require.Equal(t, picks(3), picks(3))
+	require.NotEqual(t, picks(3), picks(4))
+}
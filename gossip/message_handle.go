@@ -14,7 +14,7 @@ import (
 type MessageHandler struct {
 	chanPackets       chan HandlingPacket
 	chanReinvokeQueue chan *ReinvokeRumor
-	close             bool
+	stopped           chan struct{}
 
 	mutexReinvoke sync.Mutex
 	reinvokeMap   map[string]*ReinvokeAddr
@@ -45,7 +45,7 @@ func NewMessageHandler() *MessageHandler {
 	return &MessageHandler{
 		chanPackets:       make(chan HandlingPacket, 100),
 		chanReinvokeQueue: make(chan *ReinvokeRumor, 100),
-		close:             false,
+		stopped:           make(chan struct{}),
 		reinvokeMap:       make(map[string]*ReinvokeAddr),
 	}
 }
@@ -56,6 +56,7 @@ func (h *MessageHandler) Run(g *Gossiper, packets chan HandlingPacket) <-chan bo
 	packetHandler := func(done chan bool) {
 		defer close(done)
 		closePacket, closePackets, closeReinvoke := false, false, false
+		stopped := h.stopped
 		for {
 			select {
 			case packet, ok := <-packets:
@@ -68,25 +69,16 @@ func (h *MessageHandler) Run(g *Gossiper, packets chan HandlingPacket) <-chan bo
 						return
 					}
 				}
-			case packet, ok := <-h.chanPackets:
-				if ok {
-					h.handlePacket(g, packet)
-				} else {
-					closePacket = true
-					h.chanPackets = nil
-					if closePacket && closePackets && closeReinvoke {
-						return
-					}
-				}
-			case reinvoke, ok := <-h.chanReinvokeQueue:
-				if ok {
-					reinvoke.msg.PropagateRumor(g, reinvoke.addr, reinvoke.exceptNodes)
-				} else {
-					closeReinvoke = true
-					h.chanReinvokeQueue = nil
-					if closePacket && closePackets && closeReinvoke {
-						return
-					}
+			case packet := <-h.chanPackets:
+				h.handlePacket(g, packet)
+			case reinvoke := <-h.chanReinvokeQueue:
+				reinvoke.msg.PropagateRumor(g, reinvoke.addr, reinvoke.exceptNodes)
+			case <-stopped:
+				// The pending packets and rumors are dropped
+				closePacket, closeReinvoke = true, true
+				stopped = nil
+				if closePacket && closePackets && closeReinvoke {
+					return
 				}
 			}
 		}
@@ -100,14 +92,13 @@ func (h *MessageHandler) Run(g *Gossiper, packets chan HandlingPacket) <-chan bo
 
 // Stop gracefully the runing process
 func (h *MessageHandler) Stop() {
-	h.close = true
-	close(h.chanPackets)
-
 	// Stop all reinvoke timers
 	func() {
 		h.mutexReinvoke.Lock()
 		defer h.mutexReinvoke.Unlock()
 
+		close(h.stopped)
+
 		for _, address := range h.reinvokeMap {
 			//Switch to local lock
 			address.mutex.Lock()
@@ -118,10 +109,27 @@ func (h *MessageHandler) Stop() {
 			}
 			address.rumors = nil
 		}
-		close(h.chanReinvokeQueue)
 	}()
 }
 
+// closed tells whether the handler was stopped
+func (h *MessageHandler) closed() bool {
+	select {
+	case <-h.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// reinvoke queues the rumor to propagate again, unless the handler is stopped
+func (h *MessageHandler) reinvoke(rumor *ReinvokeRumor) {
+	select {
+	case h.chanReinvokeQueue <- rumor:
+	case <-h.stopped:
+	}
+}
+
 func (h *MessageHandler) extractMessage(packet GossipPacket) (interface{}, error) {
 	// Check wether the message decoded is valid
 	if packet.Status != nil && (packet.Private != nil || packet.Rumor != nil) ||
@@ -143,12 +151,15 @@ func (h *MessageHandler) extractMessage(packet GossipPacket) (interface{}, error
 
 // HandlePacket handle the packet
 func (h *MessageHandler) HandlePacket(g *Gossiper, packet HandlingPacket) error {
-	if h.close {
+	if h.closed() {
 		err := errors.New("Handler is closed")
 		return err
 	}
 
-	h.chanPackets <- packet
+	select {
+	case h.chanPackets <- packet:
+	case <-h.stopped:
+	}
 	return nil
 }
 
@@ -1,7 +1,6 @@
 package gossip
 
 import (
-	"encoding/json"
 	"errors"
 	"net"
 
@@ -9,7 +8,7 @@ import (
 )
 
 func (g *Gossiper) encodePacket(packet GossipPacket) ([]byte, error) {
-	encodedPacket, err := json.Marshal(packet)
+	encodedPacket, err := g.codec.Encode(packet)
 	if err != nil {
 		return make([]byte, 0), err
 	}
@@ -7,9 +7,18 @@ import (
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
-// GetFactory returns the Gossip factory
+// GetFactory returns the Gossip factory, using the default JSON codec and MTU
 func GetFactory() GossipFactory {
-	return BaseGossipFactory{}
+	return NewGossipFactory(NewJSONCodec(), DefaultMTU)
+}
+
+// NewGossipFactory returns a Gossip factory whose gossipers encode packets
+// with the given codec and fragment them above mtu bytes
+func NewGossipFactory(codec Codec, mtu int) GossipFactory {
+	return BaseGossipFactory{
+		codec: codec,
+		mtu:   mtu,
+	}
 }
 
 // GossipPacket defines the packet that gets encoded or deserialized from the
@@ -33,6 +42,7 @@ func (g GossipPacket) Copy() GossipPacket {
 		rumor.Origin = g.Rumor.Origin
 		rumor.ID = g.Rumor.ID
 		rumor.Text = g.Rumor.Text
+		rumor.Signature = append([]byte(nil), g.Rumor.Signature...)
 
 		if g.Rumor.Extra != nil {
 			rumor.Extra = g.Rumor.Extra.Copy()
@@ -50,10 +60,9 @@ func (g GossipPacket) Copy() GossipPacket {
 		private.HopLimit = g.Private.HopLimit
 		private.ID = g.Private.ID
 		private.Origin = g.Private.Origin
-		private.Data = PrivateMessageData{
-			Location: g.Private.Data.Location,
-			DroneID:  g.Private.Data.DroneID,
-		}
+		private.Sealed = append([]byte(nil), g.Private.Sealed...)
+		private.Signature = append([]byte(nil), g.Private.Signature...)
+		private.Data = g.Private.Data
 	}
 
 	return GossipPacket{
@@ -70,6 +79,8 @@ type RumorMessage struct {
 	Text   string `json:"text"`
 
 	Extra *extramessage.ExtraMessage `json:"extra"`
+
+	Signature []byte `json:"signature"`
 }
 
 // StatusPacket is sent as a status of the current local state of messages seen
@@ -94,10 +105,30 @@ type RouteStruct struct {
 	LastID uint32
 }
 
-// PrivateMessageData contains the location of a drone and the droneId
+// Versions of the telemetry carried by PrivateMessageData. Older drones send
+// the minimal telemetry, which only has a location and a drone ID.
+const (
+	TelemetryMinimal = 0
+	TelemetryV1      = 1
+)
+
+// PrivateMessageData contains the telemetry of a drone
 type PrivateMessageData struct {
+	Version  uint32 `json:"version,omitempty"`
 	Location r3.Vec `json:"location"`
 	DroneID  uint32 `json:"droneId"`
+
+	// Since TelemetryV1
+	Velocity r3.Vec `json:"velocity"`
+	// Heading in degrees in the horizontal plane, clockwise from the Z axis
+	Heading float64 `json:"heading"`
+	// Battery level in percent
+	Battery   float64 `json:"battery"`
+	State     string  `json:"state"`
+	PatternID string  `json:"patternId"`
+	PathStep  int     `json:"pathStep"`
+	// Milliseconds since the drone started, from a monotonic clock
+	Timestamp int64 `json:"timestamp"`
 }
 
 // PrivateMessage is sent privately to one peer
@@ -107,6 +138,10 @@ type PrivateMessage struct {
 	Data        PrivateMessageData `json:"data"`
 	Destination string             `json:"destination"`
 	HopLimit    int                `json:"hoplimit"`
+
+	// Data encrypted for the destination, in which case Data is empty
+	Sealed    []byte `json:"sealed"`
+	Signature []byte `json:"signature"`
 }
 
 // NewMessageCallback is the type of function that users of the library should
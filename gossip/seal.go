@@ -0,0 +1,93 @@
+package gossip
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/xerrors"
+)
+
+// sealDomain separates the keys derived for the private messages from any
+// other use of the X25519 keys
+const sealDomain = "orbitalswarm-seal"
+
+// ErrCannotOpen is returned when the sealed data of a private message cannot
+// be decrypted, or when it is not sealed while it should be
+var ErrCannotOpen = xerrors.New("unable to open sealed data")
+
+// sealKey derives the symmetric key shared by origin and destination. Both
+// ends derive the same key from their private key and the public key of the
+// other end.
+func sealKey(private, peerPublic []byte, origin, destination string) ([]byte, error) {
+	shared, err := curve25519.X25519(private, peerPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	w := newBinaryWriter()
+	w.string(sealDomain)
+	w.bytes(shared)
+	w.string(origin)
+	w.string(destination)
+	key := sha256.Sum256(w.buf.Bytes())
+	return key[:], nil
+}
+
+// sealAdditionalData binds the sealed data to the message carrying it, so
+// that it cannot be moved to another message. The hop limit is left out as
+// relays decrement it.
+func sealAdditionalData(msg *PrivateMessage) []byte {
+	w := newBinaryWriter()
+	w.string(msg.Origin)
+	w.uvarint(uint64(msg.ID))
+	w.string(msg.Destination)
+	return w.buf.Bytes()
+}
+
+// seal encrypts the data of msg with XChaCha20-Poly1305 and clears it. The
+// random nonce is prepended to the ciphertext.
+func seal(key []byte, msg *PrivateMessage) error {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+
+	w := newBinaryWriter()
+	w.privateData(msg.Data)
+	msg.Sealed = aead.Seal(nonce, nonce, w.buf.Bytes(), sealAdditionalData(msg))
+	msg.Data = PrivateMessageData{}
+	return nil
+}
+
+// open decrypts the sealed data of msg and restores its data
+func open(key []byte, msg *PrivateMessage) error {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return err
+	}
+	if len(msg.Sealed) < aead.NonceSize() {
+		return ErrCannotOpen
+	}
+
+	nonce, ciphertext := msg.Sealed[:aead.NonceSize()], msg.Sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, sealAdditionalData(msg))
+	if err != nil {
+		return ErrCannotOpen
+	}
+
+	r := newBinaryReader(plaintext)
+	data := r.privateData()
+	if r.err != nil || r.pos != len(r.data) {
+		return ErrCannotOpen
+	}
+	msg.Data = data
+	msg.Sealed = nil
+	return nil
+}
@@ -4,11 +4,8 @@
 package gossip
 
 import (
-	"math/rand"
 	"net"
 	"time"
-
-	"go.dedis.ch/onet/v3/log"
 )
 
 // TimeoutMongering time we wait for an ack before reinvoking the rumor
@@ -20,9 +17,14 @@ const ackSynchronised = 2
 
 // Exec is the function that the gossiper uses to execute the handler for a RumorMessage
 func (msg *RumorMessage) Exec(g *Gossiper, addr *net.UDPAddr) error {
+	if addr != g.server.LocalAddr() {
+		if err := g.authenticateRumor(msg); err != nil {
+			return err
+		}
+	}
 
 	// If we receive our own rumor
-	if msg.Origin == g.identifier && addr != g.server.Address {
+	if msg.Origin == g.identifier && addr != g.server.LocalAddr() {
 		g.SendMessageTo(*g.CreateStatusMessage(), addr.String())
 		return nil
 	}
@@ -46,14 +48,14 @@ func (msg *RumorMessage) Exec(g *Gossiper, addr *net.UDPAddr) error {
 			rumor := message.(*RumorMessage)
 
 			// Call the callback - Deliver rumor
-			if g.callback != nil && g.server.Address != addr && !isRouteRumor {
+			if g.callback != nil && g.server.LocalAddr() != addr && !isRouteRumor {
 				g.callback(msg.Origin, GossipPacket{Rumor: rumor}.Copy())
 			}
 		}
 	}
 
 	// Send a ack Status that we have receive a message
-	if g.server.Address != addr {
+	if g.server.LocalAddr() != addr {
 		g.SendMessageTo(*g.CreateStatusMessage(), addr.String())
 	}
 
@@ -85,7 +87,7 @@ func (msg *RumorMessage) PropagateRumor(g *Gossiper, addr *net.UDPAddr, exceptNo
 	g.handler.mutexReinvoke.Lock()
 	defer g.handler.mutexReinvoke.Unlock()
 
-	if !g.handler.close {
+	if !g.handler.closed() {
 		reinvoke, ok := g.handler.reinvokeMap[addr.String()]
 		if !ok {
 			reinvoke = &ReinvokeAddr{rumors: make([]*ReinvokeRumor, 0)}
@@ -105,7 +107,7 @@ func (msg *RumorMessage) PropagateRumor(g *Gossiper, addr *net.UDPAddr, exceptNo
 			func() {
 				reinvoke.mutex.Lock()
 				defer reinvoke.mutex.Unlock()
-				if g.handler.close {
+				if g.handler.closed() {
 					// Cancel wake up
 					return
 				}
@@ -121,10 +123,7 @@ func (msg *RumorMessage) PropagateRumor(g *Gossiper, addr *net.UDPAddr, exceptNo
 				reinvoke.rumors = reinvoke.rumors[:len(reinvoke.rumors)-1]
 			}()
 
-			defer func() {
-				recover()
-			}()
-			g.handler.chanReinvokeQueue <- reinvokeRumor
+			g.handler.reinvoke(reinvokeRumor)
 		})
 	}
 
@@ -185,7 +184,7 @@ func (msg *StatusPacket) Exec(g *Gossiper, addr *net.UDPAddr) error {
 		g.handler.mutexReinvoke.Lock()
 		defer g.handler.mutexReinvoke.Unlock()
 
-		if g.handler.close {
+		if g.handler.closed() {
 			return
 		}
 
@@ -201,22 +200,15 @@ func (msg *StatusPacket) Exec(g *Gossiper, addr *net.UDPAddr) error {
 			defer reinvoke.mutex.Unlock()
 
 			for _, rumor := range reinvoke.rumors {
+				rumor := rumor
 				rumor.timer.Stop()
 				if ackStatus == ackSynchronised {
 					// Flip a coin
-					coin := rand.Float32() < 0.5
+					coin := g.randomInt(2) == 0
 
 					if coin {
 						// Continue rumor mongering
-						go func() {
-							defer func() {
-								err := recover()
-								if err != nil {
-									log.Printf("recover %s", err)
-								}
-							}()
-							g.handler.chanReinvokeQueue <- rumor
-						}()
+						go g.handler.reinvoke(rumor)
 					}
 				}
 			}
@@ -251,12 +243,24 @@ func (msg *StatusPacket) Exec(g *Gossiper, addr *net.UDPAddr) error {
 
 // Exec is the function that the gossiper uses to execute the handler for a PrivateMessage
 func (msg *PrivateMessage) Exec(g *Gossiper, addr *net.UDPAddr) error {
+	if addr != g.server.LocalAddr() {
+		if err := g.authenticatePrivate(msg); err != nil {
+			return err
+		}
+	}
+
 	// Update route
 	g.updateRoute(msg.Origin, addr.String(), msg.ID, true)
 
 	if g.identifier == msg.Destination {
+		if g.server.LocalAddr() != addr {
+			if err := g.openPrivate(msg); err != nil {
+				return err
+			}
+		}
+
 		// Call the callback
-		if g.callback != nil && g.server.Address != addr {
+		if g.callback != nil && g.server.LocalAddr() != addr {
 			g.callback(msg.Origin, GossipPacket{Private: msg})
 		}
 
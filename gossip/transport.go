@@ -0,0 +1,20 @@
+package gossip
+
+import (
+	"net"
+)
+
+// Transport carries the encoded packets of a Gossiper. UDPServer sends them on
+// a real socket while MemoryTransport keeps them inside the process.
+type Transport interface {
+	// Run starts the transport. It returns the channel of received packets,
+	// the channel on which packets to send are pushed and a channel on which
+	// the gossiper signals that it handled every received packet.
+	Run() (<-chan UDPPacket, chan<- UDPPacket, chan<- bool)
+	// Stop closes the transport, it waits for the gossiper to handle the
+	// pending packets.
+	Stop()
+	// LocalAddr returns the address of this end of the transport. The same
+	// pointer is always returned, it is used to recognise local packets.
+	LocalAddr() *net.UDPAddr
+}
@@ -12,7 +12,12 @@ import (
 // connection, so that the listener knows it can stop listening.
 const stopMsg = "stop"
 
+// maxDatagramSize is the size of the largest UDP datagram we can receive
+const maxDatagramSize = 65535
+
 // UDPServer server
+//
+// - implements gossip.Transport
 type UDPServer struct {
 	Address *net.UDPAddr
 	socket  *net.UDPConn
@@ -24,6 +29,9 @@ type UDPServer struct {
 
 	close bool
 
+	fragmenter  *fragmenter
+	reassembler *reassembler
+
 	handlingFinished chan bool
 }
 
@@ -33,8 +41,9 @@ type UDPPacket struct {
 	addr *net.UDPAddr
 }
 
-// NewUDPServer create a new udp server
-func NewUDPServer(addr string) (*UDPServer, error) {
+// NewUDPServer create a new udp server. Packets larger than mtu bytes are
+// fragmented, DefaultMTU is used if mtu is not positive.
+func NewUDPServer(addr string, mtu int) (*UDPServer, error) {
 	// Validate IP Address
 	address, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
@@ -52,11 +61,19 @@ func NewUDPServer(addr string) (*UDPServer, error) {
 		Address:          udpAddress.(*net.UDPAddr),
 		handlingFinished: make(chan bool),
 		socket:           socket,
+
+		fragmenter:  newFragmenter(mtu),
+		reassembler: newReassembler(FragmentTimeout),
 	}
 
 	return server, nil
 }
 
+// LocalAddr implements gossip.Transport
+func (s *UDPServer) LocalAddr() *net.UDPAddr {
+	return s.Address
+}
+
 // Run Start the udp server
 func (s *UDPServer) Run() (<-chan UDPPacket, chan<- UDPPacket, chan<- bool) {
 
@@ -99,7 +116,7 @@ func (s *UDPServer) udpListener() (<-chan UDPPacket, <-chan bool) {
 			}
 		}()
 		for {
-			buffer := make([]byte, 20480)
+			buffer := make([]byte, maxDatagramSize)
 
 			s.socket.SetReadDeadline(time.Now().Add(2 * time.Second))
 
@@ -112,8 +129,14 @@ func (s *UDPServer) udpListener() (<-chan UDPPacket, <-chan bool) {
 				return
 			} else if length == 0 {
 				// Discard the message
+				s.reassembler.expire(time.Now())
 			} else {
-				listener <- UDPPacket{data: buffer[:length], addr: src}
+				data, err := s.reassembler.add(src.String(), buffer[:length], time.Now())
+				if err != nil {
+					log.Printf("Discard datagram from %s, %s", src, err)
+				} else if data != nil {
+					listener <- UDPPacket{data: data, addr: src}
+				}
 			}
 		}
 	}()
@@ -129,10 +152,18 @@ func (s *UDPServer) udpSender() (chan<- UDPPacket, <-chan bool) {
 		for {
 			packet, ok := <-sending
 			if ok {
-				_, err := s.socket.WriteTo(packet.data, packet.addr)
+				datagrams, err := s.fragmenter.split(packet.data)
 				if err != nil {
-					// Discard the message
-					log.Printf("Discarded message while sending on socket")
+					log.Printf("Discarded message while fragmenting, %s", err)
+					continue
+				}
+				for _, datagram := range datagrams {
+					_, err := s.socket.WriteTo(datagram, packet.addr)
+					if err != nil {
+						// Discard the message
+						log.Printf("Discarded message while sending on socket")
+						break
+					}
 				}
 			} else {
 				// Close sender
@@ -0,0 +1,50 @@
+package gs
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+	"go.dedis.ch/cs438/orbitalswarm/drone"
+)
+
+// FaultInjector runs fault scenarios on the swarm, it is exposed on the debug
+// endpoint of the ground station
+type FaultInjector interface {
+	RunScenario(steps []drone.FaultStep) error
+}
+
+// SetFaultInjector enables the fault injection debug endpoint
+func (g *GroundStation) SetFaultInjector(faults FaultInjector) {
+	g.faults = faults
+}
+
+// routeDebug adds the debug endpoints to the web interface
+func (g *GroundStation) routeDebug(r *mux.Router) {
+	r.Methods("POST").Path("/debug/faults").HandlerFunc(g.handleFaultScenario)
+}
+
+// handleFaultScenario runs the fault scenario given as a JSON list of
+// drone.FaultStep. It answers once the scenario is over.
+func (g *GroundStation) handleFaultScenario(w http.ResponseWriter, r *http.Request) {
+	if g.faults == nil {
+		http.Error(w, "fault injection is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var steps []drone.FaultStep
+	err := json.NewDecoder(r.Body).Decode(&steps)
+	if err != nil {
+		http.Error(w, "invalid scenario: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Run fault scenario of %d steps", len(steps))
+	err = g.faults.RunScenario(steps)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
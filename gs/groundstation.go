@@ -1,10 +1,8 @@
-// ========== CS-438 orbitalswarm Skeleton ===========
-// *** Do not change this file ***
-
 package gs
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -13,11 +11,16 @@ import (
 	"sync"
 	"time"
 
+	"go.dedis.ch/cs438/orbitalswarm/paxos"
 	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"golang.org/x/xerrors"
 
+	"go.dedis.ch/cs438/orbitalswarm/drone"
 	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
+	"go.dedis.ch/cs438/orbitalswarm/drone/mapping"
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/world"
 	"gonum.org/v1/gonum/spatial/r3"
 
 	"github.com/gorilla/mux"
@@ -27,6 +30,10 @@ import (
 
 type key int
 
+// beaconPeriod is the period at which the ground station tells the drones
+// that it is alive
+const beaconPeriod = time.Second
+
 const (
 	requestIDKey key = 0
 )
@@ -46,9 +53,23 @@ type GroundStation struct {
 	patternID    int
 	drones       []r3.Vec
 	nextPosition []r3.Vec
+	homes        []r3.Vec
+	// last battery level reported by each drone, nil until one is reported
+	batteries []float64
+	// battery level below which the drones are kept on the ground
+	threshold float64
 
 	running int
-	handler chan []byte
+	// drones which reached their target or died during the pattern
+	finished []bool
+	// drones kept on the ground during the pattern
+	grounded []uint32
+	degraded bool
+	liveness *FailureDetector
+	handler  chan []byte
+
+	faults FaultInjector
+	world  *world.World
 }
 
 // NewGroundStation returns the controller that sets up the gossiping state machine
@@ -66,13 +87,24 @@ func NewGroundStation(identifier, uiAddress, gossipAddress string, g *gossip.Gos
 		consensus: consensus,
 		patternID: 0,
 		drones:    drones,
+		homes:     append([]r3.Vec{}, drones...),
 		running:   0,
+		threshold: drone.DefaultEnergyModel().Threshold,
+		liveness:  NewFailureDetector(len(drones), suspectTimeout, deadTimeout, time.Now()),
 	}
 
 	g.RegisterCallback(gs.handleGossipMessage)
 	return gs
 }
 
+// SetWorld sets the obstacles the drones fly around, shared with them in every
+// pattern
+func (g *GroundStation) SetWorld(w *world.World) {
+	g.Lock()
+	defer g.Unlock()
+	g.world = w
+}
+
 // Run Launch the groundstation
 func (g *GroundStation) Run() {
 	// Logger
@@ -83,6 +115,9 @@ func (g *GroundStation) Run() {
 	go g.gossiper.Run(ready)
 	<-ready
 
+	go g.beacon()
+	go g.monitor()
+
 	// web sockets
 	g.hub = newHub(g.getInitialData, g.handleWebSocketMessage)
 	go g.hub.run()
@@ -92,6 +127,9 @@ func (g *GroundStation) Run() {
 	r.Methods("GET").Path("/ws").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		serveWs(g.hub, w, r)
 	})
+	g.routeDebug(r)
+	r.Methods("POST").Path("/drones/command").HandlerFunc(g.handleDroneCommand)
+	r.Methods("GET").Path("/chain/audit").HandlerFunc(g.handleChainAudit)
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./gs/static/")))
 	nextRequestID := func() string {
 		return fmt.Sprintf("%d", time.Now().UnixNano())
@@ -107,9 +145,20 @@ func (g *GroundStation) Run() {
 }
 
 func (g *GroundStation) getInitialData() []byte {
+	g.Lock()
+	drones := append([]r3.Vec(nil), g.drones...)
+	w := g.world
+	g.Unlock()
+
+	liveness := make([]Liveness, len(drones))
+	for i := range liveness {
+		liveness[i] = g.liveness.Status(uint32(i))
+	}
 	data, _ := json.Marshal(InitMessage{
 		Identifier: g.identifier,
-		Drones:     g.drones,
+		Drones:     drones,
+		Liveness:   liveness,
+		World:      w,
 	})
 	return data
 }
@@ -124,72 +173,355 @@ func (g *GroundStation) handleWebSocketMessage(message []byte) []byte {
 		return nil
 	}
 
+	// Dead drones are not waited for, nor the grounded ones
+	dead := g.liveness.Dead()
+	g.Lock()
+	grounded := g.lowBattery(dead)
+	energy := append([]float64(nil), g.batteries...)
+	drones := append([]r3.Vec(nil), g.drones...)
+	w := g.world
+	g.Unlock()
+	if len(dead)+len(grounded) == len(drones) {
+		log.Printf("No drone can fly, pattern dropped")
+		data, _ := json.Marshal(ReadyMessage{Ready: true, Degraded: true, Dead: dead, Grounded: grounded})
+		return data
+	}
+
+	if err := mapping.CheckTargets(w, drones, m.Targets); err != nil {
+		log.Printf("Pattern rejected: %s", err)
+		data, _ := json.Marshal(ReadyMessage{Ready: true, Rejected: err.Error()})
+		return data
+	}
+
+	g.Lock()
 	g.patternID++
+	patternID := g.patternID
+	g.nextPosition = m.Targets
+	g.running = len(drones) - len(dead) - len(grounded)
+	g.finished = make([]bool, len(drones))
+	g.grounded = grounded
+	g.degraded = len(dead) > 0 || len(grounded) > 0
+	for _, id := range dead {
+		g.finished[id] = true
+	}
+	for _, id := range grounded {
+		g.finished[id] = true
+	}
+	g.Unlock()
+
 	log.Printf("Send swarmInit")
 	g.gossiper.AddExtraMessage(&extramessage.ExtraMessage{
 		SwarmInit: &extramessage.SwarmInit{
-			PatternID:  strconv.Itoa(g.patternID),
-			InitialPos: g.drones,
+			PatternID:  strconv.Itoa(patternID),
+			InitialPos: drones,
 			TargetPos:  m.Targets,
+			Energy:     energy,
+			World:      w,
+			Grounded:   grounded,
 		},
 	})
-	g.nextPosition = m.Targets
-	g.running = len(g.drones)
 
 	// Nothing to send back
 	return nil
 }
 
+// handleChainAudit verifies the chain of the ground station and answers with
+// a ChainAudit listing its blocks in order
+func (g *GroundStation) handleChainAudit(w http.ResponseWriter, r *http.Request) {
+	tail, blocks := g.consensus.GetBlocks()
+	audit := ChainAudit{
+		Valid:  true,
+		Tail:   tail,
+		Blocks: make([]AuditedBlock, 0, len(blocks)),
+	}
+
+	it := paxos.NewBlockIterator(blocks, false)
+	for it.Next() {
+		block := it.Block()
+		audited := AuditedBlock{
+			Number:       block.BlockNumber(),
+			Type:         block.Type,
+			Hash:         hex.EncodeToString(block.Hash()),
+			PreviousHash: hex.EncodeToString(block.PreviousHash()),
+		}
+		switch content := block.GetContent().(type) {
+		case *blk.MappingBlockContent:
+			audited.PatternID = content.PatternID
+		case *blk.PathBlockContent:
+			audited.PatternID = content.PatternID
+		}
+		audit.Blocks = append(audit.Blocks, audited)
+	}
+
+	err := paxos.VerifyBlocks(tail, blocks)
+	if err != nil {
+		audit.Valid = false
+		audit.Error = &ChainAuditError{BlockNumber: -1, Message: err.Error()}
+		var chainErr *paxos.ChainError
+		if xerrors.As(err, &chainErr) {
+			audit.Error.BlockNumber = chainErr.BlockNumber
+			audit.Error.Fault = string(chainErr.Fault)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(audit)
+	if err != nil {
+		log.Printf("Unable to send the chain audit: %s", err)
+	}
+}
+
+// beacon lets the drones know that the ground station is alive
+func (g *GroundStation) beacon() {
+	ticker := time.NewTicker(beaconPeriod)
+	defer ticker.Stop()
+	for range ticker.C {
+		g.gossiper.AddExtraMessage(&extramessage.ExtraMessage{
+			DroneCommand: &extramessage.DroneCommand{
+				Command: extramessage.CommandBeacon,
+			},
+		})
+	}
+}
+
+// handleDroneCommand sends a return, land, resume or abort command to the
+// drones given as a JSON CommandRequest. The maneuvers are planned by the
+// ground station so that the drones do not collide.
+func (g *GroundStation) handleDroneCommand(w http.ResponseWriter, r *http.Request) {
+	var request CommandRequest
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, "invalid command: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	command := &extramessage.DroneCommand{
+		Command: request.Command,
+		Drones:  request.Drones,
+	}
+
+	g.Lock()
+	concerned := make([]bool, len(g.drones))
+	for i := range concerned {
+		concerned[i] = command.Concerns(uint32(i))
+	}
+	for _, id := range request.Drones {
+		if int(id) >= len(g.drones) {
+			g.Unlock()
+			http.Error(w, fmt.Sprintf("unknown drone %d", id), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	switch request.Command {
+	case extramessage.CommandReturn, extramessage.CommandLand:
+		positions := g.drones
+		if g.running > 0 {
+			positions = g.nextPosition
+		}
+		paths, final := drone.PlanRecovery(g.world, request.Command, positions, g.homes, concerned)
+		command.Paths = paths
+		g.drones = final
+		g.nextPosition = append([]r3.Vec{}, final...)
+	case extramessage.CommandAbort:
+		// The drones stay where they are, no completion will come
+		g.running = 0
+		g.nextPosition = append([]r3.Vec{}, g.drones...)
+	case extramessage.CommandResume:
+	default:
+		g.Unlock()
+		http.Error(w, "unknown command "+request.Command, http.StatusUnprocessableEntity)
+		return
+	}
+	g.Unlock()
+
+	log.Printf("Send %s command", request.Command)
+	g.gossiper.AddExtraMessage(&extramessage.ExtraMessage{DroneCommand: command})
+	w.WriteHeader(http.StatusOK)
+}
+
 // handleGossipMessage handle gossip messages
 func (g *GroundStation) handleGossipMessage(origin string, msg gossip.GossipPacket) {
 	// In case of other type of message
 	if msg.Rumor != nil {
 		if msg.Rumor.Extra != nil {
 			blockContainer := g.consensus.HandleExtraMessage(g.gossiper, msg.Rumor.Extra)
-			if blockContainer != nil && blockContainer.Type == blk.BlockPathStr {
-				block := blockContainer.GetContent().(*blk.PathBlockContent)
+			if block := blk.PathContent(blockContainer); block != nil {
 				paths := block.Paths
 				log.Printf("Detect simulation for UI")
 				message, _ := json.Marshal(SimulationMessage{
 					Paths: paths,
 				})
+				g.Lock()
 				for i, path := range paths {
+					if i >= len(g.nextPosition) || i >= len(g.drones) {
+						break
+					}
 					g.nextPosition[i] = g.drones[i]
 					for _, m := range path {
 						g.nextPosition[i] = g.nextPosition[i].Add(m)
 					}
 				}
+				g.Unlock()
 
 				g.hub.wsBroadcast <- message
 			}
 		}
 		if msg.Rumor.Text != "" {
 			log.Printf(msg.Rumor.Text)
-			g.running--
-			if g.running == 0 {
-				message, _ := json.Marshal(ReadyMessage{
-					Ready: true,
-				})
-				g.hub.wsBroadcast <- message
-				g.drones = g.nextPosition
+			droneID, err := strconv.Atoi(msg.Rumor.Text)
+			if err == nil {
+				g.complete(droneID, false)
 			}
 		}
 		// TODO: parse RUMOR and send appropriate message to the clients
 		// g.hub.wsBroadcast <- make([]byte, 10)
-	} else if msg.Private != nil && g.running > 0 {
+	} else if msg.Private != nil {
 		data := msg.Private.Data
-		message, err := json.Marshal(UpdateMessage{
+		g.Lock()
+		known := int(data.DroneID) < len(g.drones)
+		running := known && g.running > 0
+		if running {
+			g.drones[data.DroneID] = data.Location
+		}
+		g.Unlock()
+		if !known {
+			log.Printf("Telemetry of unknown drone %d dropped", data.DroneID)
+			return
+		}
+
+		g.heartbeat(data.DroneID)
+		if data.Version >= gossip.TelemetryV1 {
+			g.updateBattery(data.DroneID, data.Battery)
+		}
+		if !running {
+			return
+		}
+
+		update := UpdateMessage{
 			DroneId:  data.DroneID,
 			Location: data.Location,
-		})
+		}
+		if data.Version >= gossip.TelemetryV1 {
+			update.Telemetry = &TelemetryMessage{
+				Velocity:  data.Velocity,
+				Heading:   data.Heading,
+				Battery:   data.Battery,
+				State:     data.State,
+				PatternID: data.PatternID,
+				PathStep:  data.PathStep,
+				Timestamp: data.Timestamp,
+			}
+		}
+		message, err := json.Marshal(update)
 		if err != nil {
 			log.Printf("Error while marshaling message")
 		}
-		g.drones[data.DroneID] = data.Location
 		g.hub.wsBroadcast <- message
 	}
 }
 
+// heartbeat records that a drone is alive
+func (g *GroundStation) heartbeat(droneID uint32) {
+	if g.liveness.Heartbeat(droneID, time.Now()) {
+		log.Printf("drone%d is alive", droneID)
+		g.broadcastLiveness(droneID)
+	}
+}
+
+// monitor updates the liveness of the drones. The drones which die during a
+// pattern are not waited for, the pattern ends degraded.
+func (g *GroundStation) monitor() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		for _, droneID := range g.liveness.Check(now) {
+			status := g.liveness.Status(droneID)
+			log.Printf("drone%d is %s", droneID, status)
+			g.broadcastLiveness(droneID)
+			if status == Dead {
+				g.complete(int(droneID), true)
+			}
+		}
+	}
+}
+
+func (g *GroundStation) broadcastLiveness(droneID uint32) {
+	message, _ := json.Marshal(LivenessMessage{
+		DroneId:  droneID,
+		Liveness: g.liveness.Status(droneID),
+	})
+	g.hub.wsBroadcast <- message
+}
+
+// complete counts a drone out of the running pattern, because it reached its
+// target or because it died, and tells the clients when the pattern is over
+func (g *GroundStation) complete(droneID int, dead bool) {
+	g.Lock()
+	if g.running == 0 || droneID < 0 || droneID >= len(g.finished) || g.finished[droneID] {
+		g.Unlock()
+		return
+	}
+	g.finished[droneID] = true
+	g.degraded = g.degraded || dead
+	g.running--
+	if g.running > 0 {
+		g.Unlock()
+		return
+	}
+	ready := ReadyMessage{Ready: true}
+	next := append([]r3.Vec{}, g.nextPosition...)
+	if g.degraded {
+		ready.Degraded = true
+		ready.Dead = g.liveness.Dead()
+		ready.Grounded = g.grounded
+		log.Printf("Pattern over without drones %v, grounded %v", ready.Dead, ready.Grounded)
+		// Dead drones stay where they were last seen, grounded ones where
+		// they were
+		for _, id := range append(append([]uint32{}, ready.Dead...), ready.Grounded...) {
+			next[id] = g.drones[id]
+		}
+	}
+	g.drones = next
+	g.Unlock()
+
+	message, _ := json.Marshal(ready)
+	g.hub.wsBroadcast <- message
+}
+
+// updateBattery records the battery level reported by a drone. The drones that
+// did not report theirs yet are assumed to have a full battery.
+func (g *GroundStation) updateBattery(droneID uint32, battery float64) {
+	g.Lock()
+	defer g.Unlock()
+	if int(droneID) >= len(g.drones) {
+		return
+	}
+	if g.batteries == nil {
+		g.batteries = make([]float64, len(g.drones))
+		for i := range g.batteries {
+			g.batteries[i] = 100
+		}
+	}
+	g.batteries[droneID] = battery
+}
+
+// lowBattery returns the drones alive whose battery is below the threshold. It
+// must be called with the lock held.
+func (g *GroundStation) lowBattery(dead []uint32) []uint32 {
+	isDead := make(map[uint32]bool, len(dead))
+	for _, id := range dead {
+		isDead[id] = true
+	}
+	var grounded []uint32
+	for i, battery := range g.batteries {
+		if battery < g.threshold && !isDead[uint32(i)] {
+			grounded = append(grounded, uint32(i))
+		}
+	}
+	return grounded
+}
+
 // logging is a utility function that logs the http server events
 func logging(logger zerolog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -0,0 +1,33 @@
+package gs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestGroundStation_Telemetry(t *testing.T) {
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	g, err := fac.New("", "GS", 10, 0, 1)
+	require.NoError(t, err)
+	station := NewGroundStation("GS", "", "", g, []r3.Vec{{}, {X: 1}}, nil)
+
+	// A drone unknown to the ground station is ignored
+	require.NotPanics(t, func() {
+		station.handleGossipMessage("drone7", gossip.GossipPacket{Private: &gossip.PrivateMessage{
+			Data: gossip.PrivateMessageData{Version: gossip.TelemetryV1, DroneID: 7, Battery: 10},
+		}})
+	})
+	require.Nil(t, station.batteries)
+
+	// The battery of the others is recorded between the patterns
+	station.handleGossipMessage("drone1", gossip.GossipPacket{Private: &gossip.PrivateMessage{
+		Data: gossip.PrivateMessageData{Version: gossip.TelemetryV1, DroneID: 1, Battery: 10, Location: r3.Vec{X: 5}},
+	}})
+	require.Equal(t, []float64{100, 10}, station.batteries)
+	require.Equal(t, []uint32{1}, station.lowBattery(nil))
+	require.Empty(t, station.lowBattery([]uint32{1}))
+	require.Equal(t, r3.Vec{X: 1}, station.drones[1])
+}
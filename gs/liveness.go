@@ -0,0 +1,107 @@
+package gs
+
+import (
+	"sync"
+	"time"
+)
+
+// Liveness of a drone, as seen by the ground station
+type Liveness string
+
+const (
+	// Alive drones sent a heartbeat recently
+	Alive Liveness = "alive"
+	// Suspected drones missed a few heartbeats
+	Suspected Liveness = "suspected"
+	// Dead drones are considered crashed until they send a heartbeat again
+	Dead Liveness = "dead"
+)
+
+const (
+	suspectTimeout = 3 * time.Second
+	deadTimeout    = 10 * time.Second
+)
+
+// FailureDetector is a timeout based failure detector. A drone is suspected
+// when it sends no heartbeat for suspectAfter, and dead after deadAfter.
+type FailureDetector struct {
+	sync.Mutex
+	suspectAfter time.Duration
+	deadAfter    time.Duration
+
+	lastSeen []time.Time
+	status   []Liveness
+}
+
+// NewFailureDetector returns a failure detector for the given number of
+// drones, which are all alive at the given time
+func NewFailureDetector(numDrones int, suspectAfter, deadAfter time.Duration, now time.Time) *FailureDetector {
+	f := &FailureDetector{
+		suspectAfter: suspectAfter,
+		deadAfter:    deadAfter,
+		lastSeen:     make([]time.Time, numDrones),
+		status:       make([]Liveness, numDrones),
+	}
+	for i := range f.status {
+		f.lastSeen[i] = now
+		f.status[i] = Alive
+	}
+	return f
+}
+
+// Heartbeat records a heartbeat of a drone. It returns true when the drone
+// was not alive before.
+func (f *FailureDetector) Heartbeat(droneID uint32, now time.Time) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	if int(droneID) >= len(f.status) {
+		return false
+	}
+	f.lastSeen[droneID] = now
+	changed := f.status[droneID] != Alive
+	f.status[droneID] = Alive
+	return changed
+}
+
+// Check updates the liveness of the drones and returns the ones which changed
+func (f *FailureDetector) Check(now time.Time) []uint32 {
+	f.Lock()
+	defer f.Unlock()
+
+	changed := make([]uint32, 0)
+	for i, last := range f.lastSeen {
+		status := Alive
+		if now.Sub(last) >= f.deadAfter {
+			status = Dead
+		} else if now.Sub(last) >= f.suspectAfter {
+			status = Suspected
+		}
+		if status != f.status[i] {
+			f.status[i] = status
+			changed = append(changed, uint32(i))
+		}
+	}
+	return changed
+}
+
+// Status returns the liveness of a drone
+func (f *FailureDetector) Status(droneID uint32) Liveness {
+	f.Lock()
+	defer f.Unlock()
+	return f.status[droneID]
+}
+
+// Dead returns the drones considered dead
+func (f *FailureDetector) Dead() []uint32 {
+	f.Lock()
+	defer f.Unlock()
+
+	dead := make([]uint32, 0)
+	for i, status := range f.status {
+		if status == Dead {
+			dead = append(dead, uint32(i))
+		}
+	}
+	return dead
+}
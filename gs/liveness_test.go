@@ -0,0 +1,30 @@
+package gs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailureDetector(t *testing.T) {
+	start := time.Now()
+	f := NewFailureDetector(2, 3*time.Second, 10*time.Second, start)
+	require.Empty(t, f.Check(start.Add(time.Second)))
+
+	// Drone 0 keeps sending heartbeats, drone 1 is silent
+	require.False(t, f.Heartbeat(0, start.Add(2*time.Second)))
+	require.Equal(t, []uint32{1}, f.Check(start.Add(4*time.Second)))
+	require.Equal(t, Alive, f.Status(0))
+	require.Equal(t, Suspected, f.Status(1))
+
+	require.False(t, f.Heartbeat(0, start.Add(9*time.Second)))
+	require.Equal(t, []uint32{1}, f.Check(start.Add(11*time.Second)))
+	require.Equal(t, Dead, f.Status(1))
+	require.Equal(t, []uint32{1}, f.Dead())
+
+	// A dead drone comes back with its next heartbeat
+	require.True(t, f.Heartbeat(1, start.Add(12*time.Second)))
+	require.Empty(t, f.Dead())
+	require.Empty(t, f.Check(start.Add(11*time.Second+time.Millisecond)))
+}
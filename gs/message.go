@@ -1,6 +1,9 @@
 package gs
 
-import "gonum.org/v1/gonum/spatial/r3"
+import (
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
 
 type Message interface{}
 
@@ -15,13 +18,73 @@ type SimulationMessage struct {
 type InitMessage struct {
 	Identifier string
 	Drones     []r3.Vec
+	Liveness   []Liveness `json:",omitempty"`
+	// Obstacles to render, nil without a world
+	World *world.World `json:",omitempty"`
 }
 
 type UpdateMessage struct {
 	DroneId  uint32
 	Location r3.Vec
+	// nil when the drone only sends the minimal telemetry
+	Telemetry *TelemetryMessage `json:",omitempty"`
 }
 
+type TelemetryMessage struct {
+	Velocity  r3.Vec
+	Heading   float64
+	Battery   float64
+	State     string
+	PatternID string
+	PathStep  int
+	Timestamp int64
+}
+
+// ReadyMessage tells that a pattern is over. It is degraded when some drones
+// died before reaching their target, and rejected with the reason when it was
+// never sent to the drones.
 type ReadyMessage struct {
-	Ready bool
+	Ready    bool
+	Degraded bool     `json:",omitempty"`
+	Dead     []uint32 `json:",omitempty"`
+	Grounded []uint32 `json:",omitempty"`
+	Rejected string   `json:",omitempty"`
+}
+
+// LivenessMessage tells that the liveness of a drone changed
+type LivenessMessage struct {
+	DroneId  uint32
+	Liveness Liveness
+}
+
+// CommandRequest is the body of a drone command request. Every drone is
+// commanded when Drones is empty.
+type CommandRequest struct {
+	Command string   `json:"command"`
+	Drones  []uint32 `json:"drones"`
+}
+
+// ChainAudit is the answer to a chain audit request. Error is set when the
+// chain is broken.
+type ChainAudit struct {
+	Valid  bool
+	Tail   string
+	Blocks []AuditedBlock
+	Error  *ChainAuditError `json:",omitempty"`
+}
+
+// AuditedBlock describes a block of the audited chain
+type AuditedBlock struct {
+	Number       int
+	Type         string
+	Hash         string
+	PreviousHash string
+	PatternID    string `json:",omitempty"`
+}
+
+// ChainAuditError tells where and how the audited chain is broken
+type ChainAuditError struct {
+	BlockNumber int
+	Fault       string
+	Message     string
 }
@@ -48,12 +48,29 @@ const App = () => {
          App.state.createDrones(message.Drones);
       }
 
+      if (message.World != null) {
+         App.state.createWorld(message.World);
+      }
+
+      if (Array.isArray(message.Liveness)) {
+         message.Liveness.forEach((liveness, droneId) =>
+            App.state.updateLiveness(droneId, liveness)
+         );
+      }
+
+      if (message.DroneId != null && typeof message.Liveness === "string") {
+         App.state.updateLiveness(message.DroneId, message.Liveness);
+      }
+
       if (message.DroneId != null && message.Location != null) {
-         App.state.updateDrone(message.DroneId, message.Location);
+         App.state.updateDrone(message.DroneId, message.Location, message.Telemetry);
       }
 
       if (message.Ready === true) {
-         App.ui.updateStatus(message.Ready);
+         App.ui.updateStatus(message.Ready, message.Dead, message.Rejected, message.Grounded);
+         if (message.Rejected != null) {
+            App.state.runningSimulation = false;
+         }
          if (!App.state.runningSimulation) {
             App.state.synchWithSimulation();
          }
@@ -205,6 +222,8 @@ App.scene = {
 App.state = {
    drones: [],
    locations: [],
+   telemetry: [],
+   liveness: [],
    initialLocations: [],
    running: false,
    runningSimulation: false,
@@ -236,6 +255,52 @@ App.state = {
          return l;
       });
    },
+   createWorld: (world) => {
+      const materials = {
+         obstacle: new THREE.MeshLambertMaterial({ color: 0x888888 }),
+         noFly: new THREE.MeshLambertMaterial({
+            color: 0xff0000,
+            transparent: true,
+            opacity: 0.3,
+         }),
+         ceiling: new THREE.MeshBasicMaterial({
+            color: 0x00aaff,
+            transparent: true,
+            opacity: 0.1,
+            side: THREE.DoubleSide,
+         }),
+      };
+      const scenes = [App.scene.data.sceneReal, App.scene.data.sceneSimu];
+
+      const addBox = (box, material) => {
+         const geometry = new THREE.BoxGeometry(
+            box.Max.X - box.Min.X,
+            box.Max.Y - box.Min.Y,
+            box.Max.Z - box.Min.Z
+         );
+         scenes.forEach((scene) => {
+            const mesh = new THREE.Mesh(geometry, material);
+            mesh.position.set(
+               (box.Min.X + box.Max.X) / 2,
+               (box.Min.Y + box.Max.Y) / 2,
+               (box.Min.Z + box.Max.Z) / 2
+            );
+            scene.add(mesh);
+         });
+      };
+      (world.Obstacles || []).forEach((box) => addBox(box, materials.obstacle));
+      (world.NoFly || []).forEach((box) => addBox(box, materials.noFly));
+
+      if (world.Ceiling) {
+         const geometry = new THREE.PlaneGeometry(100, 100);
+         scenes.forEach((scene) => {
+            const plane = new THREE.Mesh(geometry, materials.ceiling);
+            plane.rotation.x = -Math.PI / 2;
+            plane.position.y = world.Ceiling;
+            scene.add(plane);
+         });
+      }
+   },
    startSimulation: (paths) => {
       // 30fps -> 1s par step
       const singleMoveTime = 1000;
@@ -301,11 +366,25 @@ App.state = {
          Z: Math.round(p.position.z),
       }));
    },
-   updateDrone: (droneId, location) => {
+   updateDrone: (droneId, location, telemetry) => {
       App.state.dronesReal[droneId].position.x = location.X;
       App.state.dronesReal[droneId].position.y = location.Y + 0.5;
       App.state.dronesReal[droneId].position.z = location.Z;
       App.state.locations[droneId] = location;
+      if (telemetry != null) {
+         App.state.telemetry[droneId] = telemetry;
+      }
+   },
+   updateLiveness: (droneId, liveness) => {
+      App.state.liveness[droneId] = liveness;
+      const drone = App.state.dronesReal[droneId];
+      if (drone == null) {
+         return;
+      }
+      const colors = { alive: 0xffff00, suspected: 0xff8800, dead: 0x555555 };
+      drone.material = new THREE.MeshLambertMaterial({
+         color: colors[liveness] || colors.alive,
+      });
    },
 };
 
@@ -419,11 +498,19 @@ App.ui = {
    updateNbDrones: (nbDrones) => {
       document.getElementById("nbDrone").innerHTML = nbDrones;
    },
-   updateStatus: (ready) => {
+   updateStatus: (ready, dead, rejected, grounded) => {
       App.state.running = !ready;
-      document.getElementById("status").innerHTML = ready
-         ? "Waiting for order"
-         : "Running ...";
+      let status = ready ? "Waiting for order" : "Running ...";
+      if (ready && dead != null && dead.length > 0) {
+         status += " (degraded, dead drones: " + dead.join(", ") + ")";
+      }
+      if (ready && grounded != null && grounded.length > 0) {
+         status += " (grounded drones: " + grounded.join(", ") + ")";
+      }
+      if (ready && rejected != null) {
+         status += " (pattern rejected: " + rejected + ")";
+      }
+      document.getElementById("status").innerHTML = status;
 
       document.getElementById("pattern-initial").disabled = !ready;
       document.getElementById("pattern-up").disabled = !ready;
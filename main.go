@@ -15,6 +15,7 @@ import (
 	"go.dedis.ch/cs438/orbitalswarm/drone/consensus"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
 	"go.dedis.ch/cs438/orbitalswarm/gs"
+	"go.dedis.ch/cs438/orbitalswarm/world"
 )
 
 const defaultGossipAddr = "127.0.0.1:33000" // IP address:port number for gossiping
@@ -22,6 +23,10 @@ const defaultPaxosRetry = 1
 const defaultUIPort = "12000" // Default port number
 const defaultNumDrones = 20
 const defaultNumPaxosProposerAcceptors = 5
+const defaultCodec = "json"
+const defaultTransport = "udp"
+const defaultConsensus = "paxos"
+const defaultPathGenerator = "simple"
 
 var (
 	// defaultLevel can be changed to set the desired level of the logger
@@ -47,23 +52,79 @@ func main() {
 
 	numDrones := flag.Int("numDrones", defaultNumDrones, "number of drones")
 	numPaxosProposerAcceptors := flag.Int("numProposer", defaultNumPaxosProposerAcceptors, "number of proposer/accpetor in the Paxos consensus box.")
+	codecName := flag.String("codec", defaultCodec, "wire encoding of the gossip packets, json or binary")
+	mtu := flag.Int("mtu", gossip.DefaultMTU, "maximum size in bytes of a datagram, larger packets are fragmented")
+	transport := flag.String("transport", defaultTransport, "udp, or memory to run the swarm in process with fault injection")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the faults of the in-memory network")
+	consensusName := flag.String("consensus", defaultConsensus, "paxos to agree on every block with both Paxos phases, multipaxos to keep a stable leader, raft, or bft to tolerate Byzantine drones")
+	dataDir := flag.String("dataDir", "", "directory where the Paxos participants keep their state across restarts, in memory if empty")
+	pathGeneratorName := flag.String("paths", defaultPathGenerator, "path generator of the drones: simple, cbs for makespan-optimal paths, ecbs for bounded-suboptimal paths found faster, or prioritized for large swarms")
+	contactTimeout := flag.Int("contactTimeout", 0, "seconds without news from the ground station after which a drone returns home, 0 to disable")
+	worldFile := flag.String("world", "", "JSON or YAML file of the obstacles, no-fly volumes and ceiling the drones fly around, none if empty")
 
 	flag.Parse()
 
+	codec := gossip.CodecByName(*codecName)
+	if codec == nil {
+		Logger.Fatal().Msgf("unknown codec %s", *codecName)
+	}
+	consensusFac, err := consensus.FactoryByName(*consensusName, *dataDir)
+	if err != nil {
+		Logger.Fatal().Err(err).Msg("")
+	}
+	var swarmWorld *world.World
+	if *worldFile != "" {
+		swarmWorld, err = world.Load(*worldFile)
+		if err != nil {
+			Logger.Fatal().Err(err).Msg("")
+		}
+	}
+
 	// Generate address for the groundStation
 	gossipAddress := ""
-	fac := gossip.GetFactory()
+	var fac gossip.GossipFactory
+	switch *transport {
+	case "udp":
+		fac = gossip.NewGossipFactory(codec, *mtu)
+	case "memory":
+		fac = gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(*seed), codec)
+	default:
+		Logger.Fatal().Msgf("unknown transport %s", *transport)
+	}
 	g, err := fac.New(gossipAddress, "GS", *antiEntropy, *routeTimer, *numDrones)
 	if err != nil {
 		panic(err)
 	}
 
-	swarm, locations := drone.NewSwarm(*numDrones, *numPaxosProposerAcceptors, 2222, 5000, *antiEntropy, *routeTimer, *paxosRetry, "127.0.0.1", "127.0.0.1")
+	// The ground station is the only node trusted to command the swarm
+	keyring := gossip.NewKeyring()
+	key, err := keyring.GenerateKey("GS")
+	if err != nil {
+		panic(err)
+	}
+	keyring.Trust("GS")
+	g.SetSigningKey(keyring, key)
+	encryptionKey, err := keyring.GenerateEncryptionKey("GS")
+	if err != nil {
+		panic(err)
+	}
+	g.SetEncryptionKey(encryptionKey)
+
+	swarm, locations := drone.NewSwarm(fac, keyring, *numDrones, *numPaxosProposerAcceptors, 2222, 5000, *antiEntropy, *routeTimer, *paxosRetry, consensusFac, "127.0.0.1", "127.0.0.1")
+
+	swarm.SetContactTimeout(time.Duration(*contactTimeout) * time.Second)
+	if err := swarm.SetPathGenerator(*pathGeneratorName); err != nil {
+		Logger.Fatal().Err(err).Msg("")
+	}
 
 	addresses := swarm.DronesAddresses()
 	g.AddAddresses(addresses...)
+	swarm.AddNode("GS", g.GetLocalAddr())
+
+	groundStation := gs.NewGroundStation("GS", "127.0.0.1:"+*UIPort, gossipAddress, g, locations, consensusFac.NewReader(*numPaxosProposerAcceptors, *numDrones+1, *paxosRetry))
 
-	groundStation := gs.NewGroundStation("GS", "127.0.0.1:"+*UIPort, gossipAddress, g, locations, consensus.NewConsensusReader(*numPaxosProposerAcceptors, *numDrones+1, *paxosRetry))
+	groundStation.SetFaultInjector(swarm)
+	groundStation.SetWorld(swarmWorld)
 
 	go swarm.Run()
 	groundStation.Run()
@@ -0,0 +1,612 @@
+package pathgenerator
+
+import (
+	"container/heap"
+	"log"
+	"math"
+
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"golang.org/x/xerrors"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// ErrNoPaths is returned when the search gave up before finding
+// collision-free paths
+var ErrNoPaths = xerrors.New("no collision-free paths found")
+
+// defaultMaxNodes bounds the number of nodes of the constraint tree expanded
+// before giving up
+const defaultMaxNodes = 4096
+
+// cell is a position of the grid the drones move on, one unit per step
+type cell struct {
+	X, Y, Z int
+}
+
+func toCell(v r3.Vec) cell {
+	return cell{X: int(math.Round(v.X)), Y: int(math.Round(v.Y)), Z: int(math.Round(v.Z))}
+}
+
+func (c cell) vec() r3.Vec {
+	return r3.Vec{X: float64(c.X), Y: float64(c.Y), Z: float64(c.Z)}
+}
+
+func (c cell) add(o cell) cell {
+	return cell{X: c.X + o.X, Y: c.Y + o.Y, Z: c.Z + o.Z}
+}
+
+func (c cell) distance(o cell) int {
+	return abs(c.X-o.X) + abs(c.Y-o.Y) + abs(c.Z-o.Z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// unit moves of a step, staying still included
+var steps = []cell{{}, {X: 1}, {X: -1}, {Y: 1}, {Y: -1}, {Z: 1}, {Z: -1}}
+
+// CBSPathGenerator plans the paths with Conflict-Based Search over the grid.
+// The paths pass the Validator: two drones are never in the same cell, and
+// a drone never enters the cell another one just left, which also forbids
+// swaps. The makespan is optimal, or at most weight times the optimal one
+// with ECBS. The search expands a bounded number of nodes, proving that a
+// makespan is infeasible on a dense pattern may need more, which ECBS avoids.
+//
+// - implements pathgenerator.PathGenerator
+type CBSPathGenerator struct {
+	weight   float64
+	maxNodes int
+}
+
+// NewCBSPathGenerator returns a generator of makespan-optimal paths
+func NewCBSPathGenerator() *CBSPathGenerator {
+	return NewECBSPathGenerator(1)
+}
+
+// NewECBSPathGenerator returns a generator of paths whose makespan is at most
+// weight times the optimal one, found with fewer expansions as the weight
+// grows. The weight must be at least 1.
+func NewECBSPathGenerator(weight float64) *CBSPathGenerator {
+	if weight < 1 {
+		panic("the suboptimality bound must be at least 1")
+	}
+	return &CBSPathGenerator{
+		weight:   weight,
+		maxNodes: defaultMaxNodes,
+	}
+}
+
+// GeneratePath sends the planned paths, or nil if there are none
+func (g *CBSPathGenerator) GeneratePath(from []r3.Vec, dest []r3.Vec) <-chan [][]r3.Vec {
+	return g.GeneratePathIn(nil, from, dest)
+}
+
+// GeneratePathIn sends the paths planned around the obstacles of the world,
+// or nil if there are none
+func (g *CBSPathGenerator) GeneratePathIn(w *world.World, from []r3.Vec, dest []r3.Vec) <-chan [][]r3.Vec {
+	done := make(chan [][]r3.Vec, 1)
+	go func() {
+		paths, err := g.PlanIn(w, from, dest)
+		if err != nil {
+			log.Printf("Unable to plan the paths: %s", err)
+		}
+		done <- paths
+	}()
+	return done
+}
+
+// Plan returns the moves of every drone from its position to its
+// destination, all paths having the same length. The positions are rounded
+// to the grid, with a first and a last step for the drones off the grid. It
+// returns ErrNoPaths when the search gives up.
+func (g *CBSPathGenerator) Plan(from []r3.Vec, dest []r3.Vec) ([][]r3.Vec, error) {
+	return g.PlanIn(nil, from, dest)
+}
+
+// PlanIn returns the moves of every drone as Plan does, around the obstacles
+// of the world
+func (g *CBSPathGenerator) PlanIn(w *world.World, from []r3.Vec, dest []r3.Vec) ([][]r3.Vec, error) {
+	if len(from) != len(dest) {
+		return nil, xerrors.Errorf("%d drones for %d destinations", len(from), len(dest))
+	}
+	p, err := newProblem(w, from, dest)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &ctNode{
+		constraints: make([][]constraint, len(from)),
+		paths:       make([][]cell, len(from)),
+		lbs:         make([]int, len(from)),
+	}
+	for i := range from {
+		path, lb, ok := p.search(i, newConstraintLimits(nil), root.paths, g.weight)
+		if !ok {
+			return nil, ErrNoPaths
+		}
+		root.paths[i] = path
+		root.lbs[i] = lb
+	}
+	root.evaluate()
+
+	open := []*ctNode{root}
+	for expanded := 0; len(open) > 0 && expanded < g.maxNodes; expanded++ {
+		i := g.selectNode(open)
+		node := open[i]
+		open = append(open[:i], open[i+1:]...)
+
+		conflict, found := node.firstConflict()
+		if !found {
+			return p.checked(p.moves(node.paths))
+		}
+		for _, c := range conflict {
+			child := node.child(c)
+			path, lb, ok := p.search(c.agent, newConstraintLimits(child.constraints[c.agent]), child.paths, g.weight)
+			if !ok {
+				continue
+			}
+			child.paths[c.agent] = path
+			child.lbs[c.agent] = lb
+			child.evaluate()
+			open = append(open, child)
+		}
+	}
+	return nil, ErrNoPaths
+}
+
+// selectNode returns the index of the next node to expand: among the nodes
+// whose makespan is within the bound of the lowest lower bound, the one with
+// the fewest conflicts
+func (g *CBSPathGenerator) selectNode(open []*ctNode) int {
+	best := 0
+	for i, node := range open {
+		if node.lb < open[best].lb {
+			best = i
+		}
+	}
+	// The node of the lowest lower bound is within the bound, as the length
+	// of each path is at most weight times its own lower bound
+	bound := g.weight * float64(open[best].lb)
+
+	for i, node := range open {
+		if float64(node.cost) > bound {
+			continue
+		}
+		if node.conflicts < open[best].conflicts ||
+			node.conflicts == open[best].conflicts && node.cost < open[best].cost {
+			best = i
+		}
+	}
+	return best
+}
+
+// problem is the grid version of the paths to plan
+type problem struct {
+	world  *world.World
+	from   []r3.Vec
+	dest   []r3.Vec
+	starts []cell
+	goals  []cell
+	// bounds of the grid, a margin around the positions to go around the
+	// other drones, and never under the ground
+	min cell
+	max cell
+}
+
+func newProblem(w *world.World, from []r3.Vec, dest []r3.Vec) (*problem, error) {
+	p := &problem{
+		world:  w,
+		from:   from,
+		dest:   dest,
+		starts: make([]cell, len(from)),
+		goals:  make([]cell, len(dest)),
+	}
+	startOf := make(map[cell]int)
+	goalOf := make(map[cell]int)
+	for i := range from {
+		p.starts[i] = toCell(from[i])
+		p.goals[i] = toCell(dest[i])
+		if p.starts[i].Y < 0 || p.goals[i].Y < 0 {
+			return nil, xerrors.Errorf("drone %d is under the ground", i)
+		}
+		if !w.SegmentFree(from[i], p.starts[i].vec()) || !w.SegmentFree(p.goals[i].vec(), dest[i]) {
+			return nil, xerrors.Errorf("drone %d starts or ends in an obstacle", i)
+		}
+		if j, ok := startOf[p.starts[i]]; ok {
+			return nil, xerrors.Errorf("drones %d and %d start in the same cell", j, i)
+		}
+		if j, ok := goalOf[p.goals[i]]; ok {
+			return nil, xerrors.Errorf("drones %d and %d go to the same cell", j, i)
+		}
+		startOf[p.starts[i]] = i
+		goalOf[p.goals[i]] = i
+	}
+
+	p.min, p.max = gridBounds(w, append(append([]cell{}, p.starts...), p.goals...))
+	return p, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (p *problem) inside(c cell) bool {
+	return c.X >= p.min.X && c.X <= p.max.X && c.Y >= p.min.Y && c.Y <= p.max.Y &&
+		c.Z >= p.min.Z && c.Z <= p.max.Z
+}
+
+// passable tells whether a drone may move between two cells of the grid
+func (p *problem) passable(from, to cell) bool {
+	return p.inside(to) && (from == to || p.world.SegmentFree(from.vec(), to.vec()))
+}
+
+// moves converts the cells visited into moves, adding the steps between the
+// grid and the positions off the grid
+func (p *problem) moves(paths [][]cell) [][]r3.Vec {
+	makespan := 0
+	for _, path := range paths {
+		makespan = max(makespan, len(path)-1)
+	}
+	alignFrom, alignDest := false, false
+	for i := range paths {
+		alignFrom = alignFrom || p.starts[i].vec() != p.from[i]
+		alignDest = alignDest || p.goals[i].vec() != p.dest[i]
+	}
+
+	moves := make([][]r3.Vec, len(paths))
+	for i, path := range paths {
+		moves[i] = make([]r3.Vec, 0, makespan+2)
+		if alignFrom {
+			moves[i] = append(moves[i], p.starts[i].vec().Sub(p.from[i]))
+		}
+		for t := 1; t <= makespan; t++ {
+			moves[i] = append(moves[i], at(path, t).vec().Sub(at(path, t-1).vec()))
+		}
+		if alignDest {
+			moves[i] = append(moves[i], p.dest[i].Sub(p.goals[i].vec()))
+		}
+	}
+	return moves
+}
+
+// checked returns the moves unless the Validator finds a conflict, which would
+// be a bug of the planner
+func (p *problem) checked(moves [][]r3.Vec) ([][]r3.Vec, error) {
+	if conflicts := NewValidator(p.world, 0).validate(p.from, p.dest, moves, 1); len(conflicts) > 0 {
+		return nil, xerrors.Errorf("planned paths in conflict: %s", conflicts[0])
+	}
+	return moves, nil
+}
+
+// at returns the cell of a drone at the given time, staying at its goal once
+// reached
+func at(path []cell, t int) cell {
+	if t >= len(path) {
+		return path[len(path)-1]
+	}
+	return path[t]
+}
+
+// constraint forbids a drone to be in a cell at a time, or with edge set, to
+// move from a cell to another arriving at that time
+type constraint struct {
+	agent int
+	cell  cell
+	from  cell
+	time  int
+	edge  bool
+}
+
+// ctNode is a node of the constraint tree
+type ctNode struct {
+	// constraints of each drone, shared with the parent but for the new one
+	constraints [][]constraint
+	paths       [][]cell
+	// lower bounds of the length of the path of each drone
+	lbs []int
+
+	cost      int
+	lb        int
+	conflicts int
+}
+
+func (n *ctNode) child(c constraint) *ctNode {
+	child := &ctNode{
+		constraints: append([][]constraint{}, n.constraints...),
+		paths:       append([][]cell{}, n.paths...),
+		lbs:         append([]int{}, n.lbs...),
+	}
+	constraints := make([]constraint, len(n.constraints[c.agent]), len(n.constraints[c.agent])+1)
+	copy(constraints, n.constraints[c.agent])
+	child.constraints[c.agent] = append(constraints, c)
+	return child
+}
+
+// evaluate computes the makespan of the paths, its lower bound and the
+// number of conflicts
+func (n *ctNode) evaluate() {
+	n.cost, n.lb = 0, 0
+	for i, path := range n.paths {
+		n.cost = max(n.cost, len(path)-1)
+		n.lb = max(n.lb, n.lbs[i])
+	}
+	n.conflicts = 0
+	n.forEachConflict(func([]constraint) bool {
+		n.conflicts++
+		return true
+	})
+}
+
+// firstConflict returns the constraints resolving the earliest conflict, one
+// per branch
+func (n *ctNode) firstConflict() ([]constraint, bool) {
+	var first []constraint
+	n.forEachConflict(func(branches []constraint) bool {
+		first = branches
+		return false
+	})
+	return first, first != nil
+}
+
+// forEachConflict calls f with the constraints resolving each conflict, in
+// the order of time, until it returns false
+func (n *ctNode) forEachConflict(f func(branches []constraint) bool) {
+	for t := 1; t <= n.cost; t++ {
+		for i := range n.paths {
+			for j := i + 1; j < len(n.paths); j++ {
+				ci, cj := at(n.paths[i], t), at(n.paths[j], t)
+				pi, pj := at(n.paths[i], t-1), at(n.paths[j], t-1)
+
+				var branches []constraint
+				switch {
+				case ci == cj:
+					branches = []constraint{
+						{agent: i, cell: ci, time: t},
+						{agent: j, cell: cj, time: t},
+					}
+				case ci == pj && cj == pi:
+					branches = []constraint{
+						{agent: i, cell: ci, from: pi, time: t, edge: true},
+						{agent: j, cell: cj, from: pj, time: t, edge: true},
+					}
+				case ci == pj:
+					// i follows j
+					branches = []constraint{
+						{agent: i, cell: ci, time: t},
+						{agent: j, cell: pj, time: t - 1},
+					}
+				case cj == pi:
+					branches = []constraint{
+						{agent: j, cell: cj, time: t},
+						{agent: i, cell: pi, time: t - 1},
+					}
+				default:
+					continue
+				}
+				if !f(branches) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// --- Low level ---
+
+type stateKey struct {
+	cell cell
+	time int
+}
+
+type edgeKey struct {
+	from cell
+	to   cell
+	time int
+}
+
+// limits tell where a drone may be over time
+type limits interface {
+	// allowed tells whether the drone may move from a cell to another,
+	// arriving there at the given time
+	allowed(from, to cell, t int) bool
+	// horizon returns the time after which the limits do not change
+	horizon() int
+	// settled returns the time from which the drone may stay in the cell
+	settled(c cell) int
+}
+
+// constraintLimits are the constraints of a drone in a node of the
+// constraint tree
+type constraintLimits struct {
+	vertices map[stateKey]bool
+	edges    map[edgeKey]bool
+	// last time of a vertex constraint on each cell
+	last   map[cell]int
+	latest int
+}
+
+func newConstraintLimits(constraints []constraint) *constraintLimits {
+	l := &constraintLimits{
+		vertices: make(map[stateKey]bool),
+		edges:    make(map[edgeKey]bool),
+		last:     make(map[cell]int),
+	}
+	for _, c := range constraints {
+		if c.edge {
+			l.edges[edgeKey{from: c.from, to: c.cell, time: c.time}] = true
+		} else {
+			l.vertices[stateKey{cell: c.cell, time: c.time}] = true
+			if last, ok := l.last[c.cell]; !ok || c.time > last {
+				l.last[c.cell] = c.time
+			}
+		}
+		l.latest = max(l.latest, c.time)
+	}
+	return l
+}
+
+func (l *constraintLimits) allowed(from, to cell, t int) bool {
+	return !l.vertices[stateKey{cell: to, time: t}] && !l.edges[edgeKey{from: from, to: to, time: t}]
+}
+
+func (l *constraintLimits) horizon() int {
+	return l.latest
+}
+
+func (l *constraintLimits) settled(c cell) int {
+	if last, ok := l.last[c]; ok {
+		return last + 1
+	}
+	return 0
+}
+
+type searchNode struct {
+	cell      cell
+	time      int
+	f         int
+	conflicts int
+	parent    *searchNode
+
+	closed  bool
+	inFocal bool
+}
+
+// search returns the path of the drone within its limits with the fewest
+// conflicts with the paths of the others, among those at most weight times
+// longer than the shortest one or not longer than the others. It also
+// returns the lower bound of the length of the shortest path.
+func (p *problem) search(agent int, rules limits, paths [][]cell, weight float64) ([]cell, int, bool) {
+	start, goal := p.starts[agent], p.goals[agent]
+	// a path as long as the others does not lengthen the makespan
+	budget := 0
+	for j, path := range paths {
+		if j != agent && path != nil {
+			budget = max(budget, len(path)-1)
+		}
+	}
+	if !rules.allowed(start, start, 0) {
+		return nil, 0, false
+	}
+	horizon, goalFree := rules.horizon(), rules.settled(goal)
+
+	// Past the last constraint, the time only matters for the conflicts
+	key := func(c cell, t int) stateKey {
+		return stateKey{cell: c, time: min(t, horizon+1)}
+	}
+	conflicts := func(prev, next cell, t int) int {
+		count := 0
+		for j, path := range paths {
+			if j == agent || path == nil {
+				continue
+			}
+			if next == at(path, t) || next == at(path, t-1) || prev == at(path, t) {
+				count++
+			}
+		}
+		return count
+	}
+
+	open := &searchHeap{less: func(a, b *searchNode) bool {
+		return a.f < b.f || a.f == b.f && a.conflicts < b.conflicts
+	}}
+	focal := &searchHeap{less: func(a, b *searchNode) bool {
+		return a.conflicts < b.conflicts || a.conflicts == b.conflicts && a.f < b.f
+	}}
+	seen := make(map[stateKey]bool)
+
+	root := &searchNode{cell: start, f: start.distance(goal)}
+	fmin := root.f
+	bound := func() float64 {
+		return math.Max(weight*float64(fmin), float64(budget))
+	}
+	push := func(n *searchNode) {
+		seen[key(n.cell, n.time)] = true
+		heap.Push(open, n)
+		if float64(n.f) <= bound() {
+			n.inFocal = true
+			heap.Push(focal, n)
+		}
+	}
+	push(root)
+
+	for {
+		for open.Len() > 0 && open.nodes[0].closed {
+			heap.Pop(open)
+		}
+		if open.Len() == 0 {
+			return nil, 0, false
+		}
+		if open.nodes[0].f > fmin {
+			fmin = open.nodes[0].f
+			for _, n := range open.nodes {
+				if !n.closed && !n.inFocal && float64(n.f) <= bound() {
+					n.inFocal = true
+					heap.Push(focal, n)
+				}
+			}
+		}
+
+		n := heap.Pop(focal).(*searchNode)
+		if n.closed {
+			continue
+		}
+		n.closed = true
+
+		if n.cell == goal && n.time >= goalFree {
+			path := make([]cell, n.time+1)
+			for ; n != nil; n = n.parent {
+				path[n.time] = n.cell
+			}
+			return path, fmin, true
+		}
+
+		t := n.time + 1
+		for _, step := range steps {
+			next := n.cell.add(step)
+			if !p.passable(n.cell, next) || !rules.allowed(n.cell, next, t) || seen[key(next, t)] {
+				continue
+			}
+			push(&searchNode{
+				cell:      next,
+				time:      t,
+				f:         t + next.distance(goal),
+				conflicts: n.conflicts + conflicts(n.cell, next, t),
+				parent:    n,
+			})
+		}
+	}
+}
+
+// searchHeap is a priority queue of search nodes
+type searchHeap struct {
+	nodes []*searchNode
+	less  func(a, b *searchNode) bool
+}
+
+func (h *searchHeap) Len() int           { return len(h.nodes) }
+func (h *searchHeap) Less(i, j int) bool { return h.less(h.nodes[i], h.nodes[j]) }
+func (h *searchHeap) Swap(i, j int)      { h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i] }
+
+func (h *searchHeap) Push(x interface{}) {
+	h.nodes = append(h.nodes, x.(*searchNode))
+}
+
+func (h *searchHeap) Pop() interface{} {
+	n := h.nodes[len(h.nodes)-1]
+	h.nodes = h.nodes[:len(h.nodes)-1]
+	return n
+}
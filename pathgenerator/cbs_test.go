@@ -0,0 +1,89 @@
+package pathgenerator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// grid returns the positions of a square of drones at the given height
+func grid(edge int, y float64) []r3.Vec {
+	positions := make([]r3.Vec, 0, edge*edge)
+	for x := 0; x < edge; x++ {
+		for z := 0; z < edge; z++ {
+			positions = append(positions, r3.Vec{X: float64(x), Y: y, Z: float64(z)})
+		}
+	}
+	return positions
+}
+
+func TestCBS_Conflicts(t *testing.T) {
+	// The swap and the cross which the basic paths cannot solve
+	for _, test := range []struct{ from, dest []r3.Vec }{
+		{[]r3.Vec{{X: 0}, {X: 1}}, []r3.Vec{{X: 1, Y: 1}, {Y: 1}}},
+		{[]r3.Vec{{X: 0}, {X: 2}}, []r3.Vec{{X: 2, Y: 1}, {Y: 1}}},
+		{[]r3.Vec{{X: 0}, {X: 1}}, []r3.Vec{{X: 1}, {X: 0}}},
+	} {
+		paths, err := NewCBSPathGenerator().Plan(test.from, test.dest)
+		require.NoError(t, err)
+		require.Empty(t, NewValidator(nil, 0).Validate(test.from, test.dest, paths))
+	}
+}
+
+func TestCBS_Makespan(t *testing.T) {
+	// Without conflicts, every drone flies straight
+	from := []r3.Vec{{X: 0}, {X: 3}}
+	dest := []r3.Vec{{X: 0, Y: 2}, {X: 3, Y: 4}}
+	paths, err := NewCBSPathGenerator().Plan(from, dest)
+	require.NoError(t, err)
+	require.Empty(t, NewValidator(nil, 0).Validate(from, dest, paths))
+	require.Len(t, paths[0], 4)
+
+	// Squares of drones rotating half a turn above the ground
+	reversed := func(positions []r3.Vec) []r3.Vec {
+		for i, j := 0, len(positions)-1; i < j; i, j = i+1, j-1 {
+			positions[i], positions[j] = positions[j], positions[i]
+		}
+		return positions
+	}
+	from = grid(2, 0)
+	dest = reversed(grid(2, 2))
+	optimal, err := NewCBSPathGenerator().Plan(from, dest)
+	require.NoError(t, err)
+	require.Empty(t, NewValidator(nil, 0).Validate(from, dest, optimal))
+	bounded, err := NewECBSPathGenerator(1.5).Plan(from, dest)
+	require.NoError(t, err)
+	require.Empty(t, NewValidator(nil, 0).Validate(from, dest, bounded))
+	require.LessOrEqual(t, float64(len(bounded[0])), 1.5*float64(len(optimal[0])))
+
+	// On a dense one, the makespan stays within the bound of the farthest
+	// destination
+	from = grid(3, 0)
+	dest = reversed(grid(3, 2))
+	bounded, err = NewECBSPathGenerator(1.5).Plan(from, dest)
+	require.NoError(t, err)
+	require.Empty(t, NewValidator(nil, 0).Validate(from, dest, bounded))
+	require.LessOrEqual(t, float64(len(bounded[0])), 1.5*6)
+}
+
+func TestCBS_OffGrid(t *testing.T) {
+	from := []r3.Vec{{X: 0.5}, {X: 2}}
+	dest := []r3.Vec{{X: 2, Y: 1}, {X: 3.25, Y: 1}}
+	paths := <-NewCBSPathGenerator().GeneratePath(from, dest)
+	require.Empty(t, NewValidator(nil, 0).Validate(from, dest, paths))
+	require.Equal(t, r3.Vec{X: 0.5}, paths[0][0])
+	require.Equal(t, r3.Vec{X: 0.25}, paths[1][len(paths[1])-1])
+}
+
+func TestCBS_Invalid(t *testing.T) {
+	_, err := NewCBSPathGenerator().Plan([]r3.Vec{{}, {X: 0.2}}, []r3.Vec{{Y: 1}, {Y: 2}})
+	require.Error(t, err)
+	_, err = NewCBSPathGenerator().Plan([]r3.Vec{{}, {X: 1}}, []r3.Vec{{Y: 1}, {Y: 1}})
+	require.Error(t, err)
+	_, err = NewCBSPathGenerator().Plan([]r3.Vec{{}}, []r3.Vec{{Y: -1}})
+	require.Error(t, err)
+
+	// The generator answers nil instead of blocking
+	require.Nil(t, <-NewCBSPathGenerator().GeneratePath([]r3.Vec{{}}, nil))
+}
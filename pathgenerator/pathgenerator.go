@@ -1,9 +1,43 @@
 package pathgenerator
 
 import (
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"golang.org/x/xerrors"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
 type PathGenerator interface {
 	GeneratePath(from []r3.Vec, dest []r3.Vec) <-chan [][]r3.Vec
 }
+
+// WorldAwareGenerator is a PathGenerator that routes the drones around the
+// obstacles of a world
+type WorldAwareGenerator interface {
+	PathGenerator
+	GeneratePathIn(w *world.World, from []r3.Vec, dest []r3.Vec) <-chan [][]r3.Vec
+}
+
+// ecbsWeight is the suboptimality bound of the ecbs generator
+const ecbsWeight = 1.5
+
+// prioritizedRestarts is the number of random orders the prioritized
+// generator tries after the order by distance
+const prioritizedRestarts = 10
+
+// NewByName returns a new path generator: simple, cbs for makespan-optimal
+// paths, ecbs for paths at most 1.5 times longer found faster, or prioritized
+// for large swarms
+func NewByName(name string) (PathGenerator, error) {
+	switch name {
+	case "simple":
+		return NewSimplePathGenerator(), nil
+	case "cbs":
+		return NewCBSPathGenerator(), nil
+	case "ecbs":
+		return NewECBSPathGenerator(ecbsWeight), nil
+	case "prioritized":
+		return NewPrioritizedPathGenerator(PriorityDistance, prioritizedRestarts), nil
+	default:
+		return nil, xerrors.Errorf("unknown path generator %s", name)
+	}
+}
@@ -0,0 +1,64 @@
+package pathgenerator
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestPrioritized_Conflicts(t *testing.T) {
+	// The swap and the cross which the basic paths cannot solve
+	for _, priority := range []Priority{PriorityDistance, PriorityID, PriorityRandom} {
+		for _, test := range []struct{ from, dest []r3.Vec }{
+			{[]r3.Vec{{X: 0}, {X: 1}}, []r3.Vec{{X: 1, Y: 1}, {Y: 1}}},
+			{[]r3.Vec{{X: 0}, {X: 2}}, []r3.Vec{{X: 2, Y: 1}, {Y: 1}}},
+			{[]r3.Vec{{X: 0}, {X: 1}}, []r3.Vec{{X: 1}, {X: 0}}},
+			{[]r3.Vec{{X: 0}, {X: 1}, {X: 2}}, []r3.Vec{{X: 1}, {X: 2}, {X: 0}}},
+		} {
+			paths, err := NewPrioritizedPathGenerator(priority, 10).Plan(test.from, test.dest)
+			require.NoError(t, err)
+			require.Empty(t, NewValidator(nil, 0).Validate(test.from, test.dest, paths))
+		}
+	}
+}
+
+func TestPrioritized_LargeSwarm(t *testing.T) {
+	// A square of 64 drones taking off into a shuffled square, off the grid
+	from := grid(8, 0)
+	dest := grid(8, 3)
+	random := rand.New(rand.NewSource(1))
+	random.Shuffle(len(dest), func(i, j int) {
+		dest[i], dest[j] = dest[j], dest[i]
+	})
+	for i := range dest {
+		dest[i] = dest[i].Add(r3.Vec{X: 0.25, Z: -0.5})
+	}
+
+	paths, err := NewPrioritizedPathGenerator(PriorityDistance, 10).Plan(from, dest)
+	require.NoError(t, err)
+	require.Empty(t, NewValidator(nil, 0).Validate(from, dest, paths))
+}
+
+func TestPrioritized_Order(t *testing.T) {
+	p, err := newProblem(nil, []r3.Vec{{X: 0}, {X: 1}, {X: 2}}, []r3.Vec{{X: 0, Y: 1}, {X: 1, Y: 3}, {X: 2, Y: 2}})
+	require.NoError(t, err)
+	random := rand.New(rand.NewSource(1))
+
+	require.Equal(t, []int{1, 2, 0}, p.order(PriorityDistance, random))
+	require.Equal(t, []int{0, 1, 2}, p.order(PriorityID, random))
+	require.ElementsMatch(t, []int{0, 1, 2}, p.order(PriorityRandom, random))
+}
+
+func TestPrioritized_Invalid(t *testing.T) {
+	g := NewPrioritizedPathGenerator(PriorityID, 0)
+
+	_, err := g.Plan([]r3.Vec{{X: 0}}, []r3.Vec{{X: 0, Y: -1}})
+	require.Error(t, err)
+	_, err = g.Plan([]r3.Vec{{X: 0}, {X: 1}}, []r3.Vec{{X: 0, Y: 1}})
+	require.Error(t, err)
+	require.Nil(t, <-g.GeneratePath([]r3.Vec{{X: 0}, {X: 0}}, []r3.Vec{{X: 0, Y: 1}, {X: 1, Y: 1}}))
+
+	require.Panics(t, func() { NewPrioritizedPathGenerator(PriorityID, -1) })
+}
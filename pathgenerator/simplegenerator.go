@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"time"
 
+	"go.dedis.ch/cs438/orbitalswarm/world"
 	"gonum.org/v1/gonum/spatial/r3"
 )
 
@@ -25,7 +26,7 @@ func (g *SimplePathGenerator) GeneratePath(from []r3.Vec, dest []r3.Vec) <-chan
 	go func() {
 		paths := generateBasicPath(from, dest)
 		for {
-			if validatePaths(from, dest, paths) {
+			if ValidatePaths(from, dest, paths) {
 				break
 			}
 			paths = g.mix(paths)
@@ -155,58 +156,21 @@ func (p *SimplePathGenerator) mix(paths [][]r3.Vec) [][]r3.Vec {
 	return paths
 }
 
-// validatePaths check that no path intersect at a time t
+// ValidatePaths check that no path intersect at a time t. Every drone must
+// have a path of the same length, staying still with null moves. It logs the
+// first conflict found by the Validator.
 // paths : [pathId][...steps]
-func validatePaths(from []r3.Vec, dest []r3.Vec, paths [][]r3.Vec) bool {
-	locations := make([][]r3.Vec, len(from))
-	for i := range locations {
-		locations[i] = make([]r3.Vec, len(paths[0])+1)
-	}
-	for i, location := range from {
-		locations[i][0] = location
-	}
-
-	if len(paths) == 0 {
-		return true
-	}
-
-	for round := 1; round <= len(paths[0]); round++ {
-		set := make(map[r3.Vec]bool)
-
-		// Detect position identical for 2 drones or underground
-		for i := 0; i < len(paths); i++ {
-			locations[i][round] = locations[i][round-1].Add(paths[i][round-1])
-			if locations[i][round].Y < 0 {
-				log.Printf("ERROR : drone under ground level")
-				return false
-			}
-			if set[locations[i][round]] == true {
-				log.Printf("ERROR : drone at same location at given round")
-				return false
-			}
-			set[locations[i][round]] = true
-		}
-
-		// Detect position exchange for 2 drones
-		for i := 0; i < len(locations); i++ {
-			for j := i + 1; j < len(locations); j++ {
-				if locations[i][round] == locations[j][round-1] &&
-					locations[j][round-1] == locations[i][round] {
-					log.Printf("ERROR : Drone switch location")
-					return false
-				}
-			}
-		}
-	}
+func ValidatePaths(from []r3.Vec, dest []r3.Vec, paths [][]r3.Vec) bool {
+	return ValidatePathsIn(nil, from, dest, paths)
+}
 
-	// Validate final location
-	for i := range locations {
-		final := locations[i][len(paths[0])].Sub(dest[i])
-		if final != (r3.Vec{X: 0, Y: 0, Z: 0}) {
-			println("ERROR : Destination not reached")
-			return false
-		}
+// ValidatePathsIn checks the paths as ValidatePaths does, and that no move
+// goes through the obstacles of the world
+func ValidatePathsIn(w *world.World, from []r3.Vec, dest []r3.Vec, paths [][]r3.Vec) bool {
+	conflicts := NewValidator(w, 0).validate(from, dest, paths, 1)
+	if len(conflicts) > 0 {
+		log.Printf("ERROR : %s", conflicts[0])
+		return false
 	}
-
 	return true
 }
@@ -72,7 +72,7 @@ func TestGenerateBasicPath_NoFloorAndNoPrecisionSteps(t *testing.T) {
 		}
 	}
 
-	require.Equal(t, true, validatePaths(from, dest, res))
+	require.Equal(t, true, ValidatePaths(from, dest, res))
 }
 
 func TestGenerateBasicPath_WithFloorStep(t *testing.T) {
@@ -126,7 +126,7 @@ func TestGenerateBasicPath_WithFloorStep(t *testing.T) {
 		}
 	}
 
-	require.Equal(t, true, validatePaths(from, dest, res))
+	require.Equal(t, true, ValidatePaths(from, dest, res))
 }
 
 func TestGenerateBasicPath_WithPrecisionStep(t *testing.T) {
@@ -180,7 +180,7 @@ func TestGenerateBasicPath_WithPrecisionStep(t *testing.T) {
 		}
 	}
 
-	require.Equal(t, true, validatePaths(from, dest, res))
+	require.Equal(t, true, ValidatePaths(from, dest, res))
 }
 func TestValidatePaths_exchange(t *testing.T) {
 	from := []r3.Vec{
@@ -195,7 +195,7 @@ func TestValidatePaths_exchange(t *testing.T) {
 
 	time.Sleep(time.Second * time.Duration(3))
 
-	require.Equal(t, false, validatePaths(from, dest, res))
+	require.Equal(t, false, ValidatePaths(from, dest, res))
 }
 
 func TestValidatePaths_cross(t *testing.T) {
@@ -211,5 +211,5 @@ func TestValidatePaths_cross(t *testing.T) {
 
 	time.Sleep(time.Second * time.Duration(3))
 
-	require.Equal(t, false, validatePaths(from, dest, res))
+	require.Equal(t, false, ValidatePaths(from, dest, res))
 }
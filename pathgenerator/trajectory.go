@@ -0,0 +1,206 @@
+package pathgenerator
+
+import (
+	"math"
+
+	"golang.org/x/xerrors"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// Planner returns the moves of the drones on the grid, one unit per step
+type Planner interface {
+	Plan(from []r3.Vec, dest []r3.Vec) ([][]r3.Vec, error)
+}
+
+// Limits are the dynamics of a drone, in units per second and per second
+// squared
+type Limits struct {
+	MaxSpeed        float64
+	MaxAcceleration float64
+}
+
+// Segment is a straight move starting and ending at rest. The drone
+// accelerates during the first Ramp fraction of the duration, cruises, then
+// brakes as long as it accelerated.
+type Segment struct {
+	// Start and Duration are in seconds
+	Start    float64
+	Duration float64
+	From     r3.Vec
+	Move     r3.Vec
+	Ramp     float64
+}
+
+// progress returns the fraction of the move done and the speed, in fraction
+// per second, after the given time in the segment
+func (s Segment) progress(t float64) (float64, float64) {
+	if s.Duration <= 0 || t >= s.Duration {
+		return 1, 0
+	}
+	if t <= 0 {
+		return 0, 0
+	}
+	u, r := t/s.Duration, s.Ramp
+	peak := 1 / (1 - r)
+	switch {
+	case u < r:
+		return peak * u * u / (2 * r), peak * u / r / s.Duration
+	case u <= 1-r:
+		return peak * (u - r/2), peak / s.Duration
+	default:
+		return 1 - peak*(1-u)*(1-u)/(2*r), peak * (1 - u) / r / s.Duration
+	}
+}
+
+// Trajectory is the time-parameterized path of a drone, one segment per
+// step of the path
+type Trajectory []Segment
+
+// Duration returns the time to follow the trajectory, in seconds
+func (tr Trajectory) Duration() float64 {
+	if len(tr) == 0 {
+		return 0
+	}
+	last := tr[len(tr)-1]
+	return last.Start + last.Duration
+}
+
+// At returns the location and the velocity of the drone at the given time,
+// in seconds, and the index of the segment being followed
+func (tr Trajectory) At(t float64) (r3.Vec, r3.Vec, int) {
+	if len(tr) == 0 {
+		return r3.Vec{}, r3.Vec{}, 0
+	}
+	i := 0
+	for i < len(tr)-1 && t >= tr[i].Start+tr[i].Duration {
+		i++
+	}
+	s := tr[i]
+	if t >= s.Start+s.Duration {
+		return s.From.Add(s.Move), r3.Vec{}, i
+	}
+	done, speed := s.progress(t - s.Start)
+	return s.From.Add(s.Move.Scale(done)), s.Move.Scale(speed), i
+}
+
+// TrajectoryPlanner turns the paths of a grid planner into trajectories
+// respecting the dynamics of every drone
+type TrajectoryPlanner struct {
+	planner    Planner
+	separation float64
+}
+
+// NewTrajectoryPlanner returns a planner keeping the drones at least
+// separation apart
+func NewTrajectoryPlanner(planner Planner, separation float64) *TrajectoryPlanner {
+	return &TrajectoryPlanner{
+		planner:    planner,
+		separation: separation,
+	}
+}
+
+// Plan returns the trajectory of every drone from its position to its
+// destination
+func (p *TrajectoryPlanner) Plan(from []r3.Vec, dest []r3.Vec, limits []Limits) ([]Trajectory, error) {
+	paths, err := p.planner.Plan(from, dest)
+	if err != nil {
+		return nil, err
+	}
+	return Parameterize(from, paths, limits, p.separation)
+}
+
+// Parameterize times the paths, all drones doing each step together as fast
+// as the slowest one allows. The drones stop between the steps, so that they
+// can change direction, and follow the same speed profile scaled to their
+// move: the distance between two drones during a step is then the one
+// between the points of a segment, checked against the separation.
+func Parameterize(from []r3.Vec, paths [][]r3.Vec, limits []Limits, separation float64) ([]Trajectory, error) {
+	if len(paths) != len(from) || len(limits) != len(from) {
+		return nil, xerrors.Errorf("%d drones for %d paths and %d limits", len(from), len(paths), len(limits))
+	}
+	for i, l := range limits {
+		if l.MaxSpeed <= 0 || l.MaxAcceleration <= 0 {
+			return nil, xerrors.Errorf("drone %d cannot move", i)
+		}
+	}
+	steps := 0
+	for i, path := range paths {
+		if i > 0 && len(path) != steps {
+			return nil, xerrors.Errorf("paths of %d and %d steps", steps, len(path))
+		}
+		steps = len(path)
+	}
+
+	trajectories := make([]Trajectory, len(from))
+	locations := append([]r3.Vec{}, from...)
+	start := 0.0
+	for step := 0; step < steps; step++ {
+		distances := make([]float64, len(paths))
+		for i, path := range paths {
+			distances[i] = r3.Norm(path[step])
+		}
+		duration, ramp := stepTiming(distances, limits)
+
+		for i, path := range paths {
+			trajectories[i] = append(trajectories[i], Segment{
+				Start:    start,
+				Duration: duration,
+				From:     locations[i],
+				Move:     path[step],
+				Ramp:     ramp,
+			})
+		}
+		for i := range locations {
+			for j := i + 1; j < len(locations); j++ {
+				if d := closest(trajectories[i][step], trajectories[j][step]); d < separation {
+					return nil, xerrors.Errorf("drones %d and %d come %.2f apart at step %d", i, j, d, step)
+				}
+			}
+		}
+		for i, path := range paths {
+			locations[i] = locations[i].Add(path[step])
+		}
+		start += duration
+	}
+	return trajectories, nil
+}
+
+// stepTiming returns the shortest duration of a step, and the fraction of it
+// spent accelerating, for which every drone stays within its limits
+func stepTiming(distances []float64, limits []Limits) (float64, float64) {
+	duration := 0.0
+	for i, d := range distances {
+		v, a := limits[i].MaxSpeed, limits[i].MaxAcceleration
+		if d >= v*v/a {
+			// the drone reaches its top speed
+			duration = math.Max(duration, d/v+v/a)
+		} else {
+			duration = math.Max(duration, 2*math.Sqrt(d/a))
+		}
+	}
+	if duration == 0 {
+		return 0, 0.5
+	}
+
+	// The drones may disagree on the profile, then the step takes longer
+	for {
+		ramp, feasible := 0.5, true
+		for i, d := range distances {
+			ramp = math.Min(ramp, 1-d/(duration*limits[i].MaxSpeed))
+		}
+		for i, d := range distances {
+			feasible = feasible && ramp > 0 &&
+				d <= ramp*(1-ramp)*duration*duration*limits[i].MaxAcceleration*(1+1e-9)
+		}
+		if feasible {
+			return duration, ramp
+		}
+		duration *= 1.05
+	}
+}
+
+// closest returns the smallest distance between two drones during segments
+// with the same timing
+func closest(a, b Segment) float64 {
+	return separation(a.From.Sub(b.From), a.Move.Sub(b.Move))
+}
@@ -0,0 +1,78 @@
+package pathgenerator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestTrajectory_Profile(t *testing.T) {
+	// Accelerating for 2 seconds, cruising at top speed, then braking
+	trajectories, err := Parameterize([]r3.Vec{{}}, [][]r3.Vec{{{X: 6}}}, []Limits{{MaxSpeed: 2, MaxAcceleration: 1}}, 0)
+	require.NoError(t, err)
+	trajectory := trajectories[0]
+	require.InDelta(t, 5, trajectory.Duration(), 1e-9)
+
+	location, velocity, segment := trajectory.At(1)
+	require.InDelta(t, 0.5, location.X, 1e-9)
+	require.InDelta(t, 1, velocity.X, 1e-9)
+	require.Equal(t, 0, segment)
+	location, velocity, _ = trajectory.At(2.5)
+	require.InDelta(t, 3, location.X, 1e-9)
+	require.InDelta(t, 2, velocity.X, 1e-9)
+	location, velocity, _ = trajectory.At(6)
+	require.Equal(t, r3.Vec{X: 6}, location)
+	require.Equal(t, r3.Vec{}, velocity)
+}
+
+func TestTrajectory_Limits(t *testing.T) {
+	from := []r3.Vec{{X: 0}, {X: 1}, {X: 2.5, Z: 0.5}}
+	dest := []r3.Vec{{X: 1}, {X: 0}, {X: 4, Y: 2}}
+	limits := []Limits{{MaxSpeed: 2, MaxAcceleration: 1}, {MaxSpeed: 0.5, MaxAcceleration: 4}, {MaxSpeed: 3, MaxAcceleration: 3}}
+	trajectories, err := NewTrajectoryPlanner(NewCBSPathGenerator(), 0.5).Plan(from, dest, limits)
+	require.NoError(t, err)
+
+	const dt = 0.001
+	duration := trajectories[0].Duration()
+	previous := make([]r3.Vec, len(trajectories))
+	for step := 0; float64(step)*dt <= duration+dt; step++ {
+		locations := make([]r3.Vec, len(trajectories))
+		for i, trajectory := range trajectories {
+			require.InDelta(t, duration, trajectory.Duration(), 1e-9)
+			location, velocity, _ := trajectory.At(float64(step) * dt)
+			require.LessOrEqual(t, r3.Norm(velocity), limits[i].MaxSpeed+1e-9)
+			require.LessOrEqual(t, r3.Norm(velocity.Sub(previous[i])), limits[i].MaxAcceleration*dt+1e-9)
+			require.GreaterOrEqual(t, location.Y, 0.0)
+			locations[i], previous[i] = location, velocity
+		}
+		for i := range locations {
+			for j := i + 1; j < len(locations); j++ {
+				require.GreaterOrEqual(t, r3.Norm(locations[i].Sub(locations[j])), 0.5-1e-9)
+			}
+		}
+	}
+	for i, trajectory := range trajectories {
+		location, velocity, _ := trajectory.At(duration)
+		require.InDelta(t, 0, r3.Norm(location.Sub(dest[i])), 1e-9)
+		require.Equal(t, r3.Vec{}, velocity)
+	}
+}
+
+func TestTrajectory_Invalid(t *testing.T) {
+	from := []r3.Vec{{X: 0}, {X: 1}}
+	paths := [][]r3.Vec{{{Y: 1}}, {{Y: 1}}}
+	limits := []Limits{{MaxSpeed: 1, MaxAcceleration: 1}, {MaxSpeed: 1, MaxAcceleration: 1}}
+
+	_, err := Parameterize(from, paths, limits, 1)
+	require.NoError(t, err)
+	_, err = Parameterize(from, paths, limits, 1.5)
+	require.Error(t, err)
+	_, err = Parameterize(from, paths, limits[:1], 1)
+	require.Error(t, err)
+	_, err = Parameterize(from, [][]r3.Vec{{{Y: 1}}, {}}, limits, 1)
+	require.Error(t, err)
+	_, err = Parameterize(from, paths, []Limits{{MaxSpeed: 1}, {MaxSpeed: 1}}, 1)
+	require.Error(t, err)
+	require.Zero(t, Trajectory(nil).Duration())
+}
@@ -0,0 +1,194 @@
+package pathgenerator
+
+import (
+	"fmt"
+	"math"
+
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// ConflictKind is the rule of the paths a conflict breaks
+type ConflictKind int
+
+const (
+	// InvalidPath is a missing path, or a path of another length than the
+	// others
+	InvalidPath ConflictKind = iota
+	// VertexCollision is two drones at the same location
+	VertexCollision
+	// EdgeSwap is two drones exchanging their locations during the same
+	// round. A drone may follow another one into the location it leaves.
+	EdgeSwap
+	// BelowGround is a drone under the ground
+	BelowGround
+	// ObstacleCrossing is a drone flying through an obstacle of the world
+	ObstacleCrossing
+	// DestinationNotReached is a drone away from its destination at the end
+	DestinationNotReached
+	// SeparationBreach is two drones closer than the minimum separation
+	// during a round, moving at the same pace
+	SeparationBreach
+)
+
+func (k ConflictKind) String() string {
+	switch k {
+	case InvalidPath:
+		return "invalid path"
+	case VertexCollision:
+		return "vertex collision"
+	case EdgeSwap:
+		return "edge swap"
+	case BelowGround:
+		return "below ground"
+	case ObstacleCrossing:
+		return "obstacle crossing"
+	case DestinationNotReached:
+		return "destination not reached"
+	case SeparationBreach:
+		return "separation breach"
+	default:
+		return fmt.Sprintf("conflict %d", int(k))
+	}
+}
+
+// Conflict is a rule broken by the paths
+type Conflict struct {
+	Kind ConflictKind
+	// Drones are the indices of the drones in conflict, one or two
+	Drones []int
+	// Round is the number of moves done by every drone, 0 for the start
+	Round int
+	// Locations of the drones at the end of the round
+	Locations []r3.Vec
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s of drones %v at %v after round %d", c.Kind, c.Drones, c.Locations, c.Round)
+}
+
+// Validator checks the paths of the drones, every drone doing its moves at
+// the same pace as the others
+type Validator struct {
+	world      *world.World
+	separation float64
+}
+
+// NewValidator returns a validator of the paths in the world, nil for only
+// the ground, keeping the drones at least separation apart, 0 for no minimum
+func NewValidator(w *world.World, separation float64) *Validator {
+	return &Validator{
+		world:      w,
+		separation: separation,
+	}
+}
+
+// Validate returns the conflicts of the paths from the given positions, in
+// the order of the rounds. Every drone must have a path of the same length,
+// staying still with null moves. The destinations are not checked when dest
+// is nil.
+func (v *Validator) Validate(from []r3.Vec, dest []r3.Vec, paths [][]r3.Vec) []Conflict {
+	return v.validate(from, dest, paths, 0)
+}
+
+// validate returns at most limit conflicts, all of them when limit is 0
+func (v *Validator) validate(from []r3.Vec, dest []r3.Vec, paths [][]r3.Vec, limit int) []Conflict {
+	if len(paths) == 0 {
+		return nil
+	}
+	conflicts := make([]Conflict, 0)
+	report := func(c Conflict) bool {
+		conflicts = append(conflicts, c)
+		return limit > 0 && len(conflicts) >= limit
+	}
+
+	for i := range from {
+		if i >= len(paths) || len(paths[i]) != len(paths[0]) || (dest != nil && i >= len(dest)) {
+			report(Conflict{Kind: InvalidPath, Drones: []int{i}, Locations: []r3.Vec{from[i]}})
+			return conflicts
+		}
+	}
+	if len(paths) != len(from) || (dest != nil && len(dest) != len(from)) {
+		report(Conflict{Kind: InvalidPath, Drones: []int{len(from)}})
+		return conflicts
+	}
+
+	previous := append([]r3.Vec{}, from...)
+	locations := make([]r3.Vec, len(from))
+	for round := 1; round <= len(paths[0]); round++ {
+		occupied := make(map[r3.Vec]int, len(paths))
+		left := make(map[r3.Vec]int, len(paths))
+		for i := range paths {
+			locations[i] = previous[i].Add(paths[i][round-1])
+			if paths[i][round-1] != (r3.Vec{}) {
+				left[previous[i]] = i
+			}
+		}
+
+		for i, location := range locations {
+			if location.Y < 0 {
+				if report(Conflict{Kind: BelowGround, Drones: []int{i}, Round: round, Locations: []r3.Vec{location}}) {
+					return conflicts
+				}
+			} else if v.world != nil && !v.world.SegmentFree(previous[i], location) {
+				if report(Conflict{Kind: ObstacleCrossing, Drones: []int{i}, Round: round, Locations: []r3.Vec{location}}) {
+					return conflicts
+				}
+			}
+			if j, ok := occupied[location]; ok {
+				if report(Conflict{Kind: VertexCollision, Drones: []int{j, i}, Round: round, Locations: []r3.Vec{location, location}}) {
+					return conflicts
+				}
+			}
+			occupied[location] = i
+			if j, ok := left[location]; ok && j > i && locations[j] == previous[i] {
+				if report(Conflict{Kind: EdgeSwap, Drones: []int{i, j}, Round: round, Locations: []r3.Vec{location, locations[j]}}) {
+					return conflicts
+				}
+			}
+		}
+
+		if v.separation > 0 {
+			for i := range locations {
+				for j := i + 1; j < len(locations); j++ {
+					if locations[i] == locations[j] {
+						continue
+					}
+					offset := previous[i].Sub(previous[j])
+					relative := paths[i][round-1].Sub(paths[j][round-1])
+					if separation(offset, relative) < v.separation {
+						if report(Conflict{Kind: SeparationBreach, Drones: []int{i, j}, Round: round, Locations: []r3.Vec{locations[i], locations[j]}}) {
+							return conflicts
+						}
+					}
+				}
+			}
+		}
+		copy(previous, locations)
+	}
+
+	if dest != nil {
+		for i := range previous {
+			if previous[i] != dest[i] {
+				if report(Conflict{Kind: DestinationNotReached, Drones: []int{i}, Round: len(paths[0]), Locations: []r3.Vec{previous[i]}}) {
+					return conflicts
+				}
+			}
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return conflicts
+}
+
+// separation returns the smallest distance between two drones moving in
+// straight lines at the same pace, given their offset at the start and the
+// difference of their moves
+func separation(offset, relative r3.Vec) float64 {
+	s := 0.0
+	if norm := r3.Norm2(relative); norm > 0 {
+		s = math.Max(0, math.Min(1, -offset.Dot(relative)/norm))
+	}
+	return r3.Norm(offset.Add(relative.Scale(s)))
+}
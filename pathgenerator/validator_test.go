@@ -0,0 +1,76 @@
+package pathgenerator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestValidator_Conflicts(t *testing.T) {
+	w := &world.World{Obstacles: []world.Box{{Min: r3.Vec{X: 5, Y: 0, Z: -1}, Max: r3.Vec{X: 6, Y: 1, Z: 1}}}}
+	for _, test := range []struct {
+		name     string
+		from     []r3.Vec
+		dest     []r3.Vec
+		paths    [][]r3.Vec
+		expected Conflict
+	}{
+		{"vertex", []r3.Vec{{X: 0}, {X: 2}}, nil, [][]r3.Vec{{{X: 1}}, {{X: -1}}},
+			Conflict{Kind: VertexCollision, Drones: []int{0, 1}, Round: 1, Locations: []r3.Vec{{X: 1}, {X: 1}}}},
+		{"swap", []r3.Vec{{X: 0}, {X: 1}}, nil, [][]r3.Vec{{{}, {X: 1}}, {{}, {X: -1}}},
+			Conflict{Kind: EdgeSwap, Drones: []int{0, 1}, Round: 2, Locations: []r3.Vec{{X: 1}, {X: 0}}}},
+		{"ground", []r3.Vec{{X: 0}}, nil, [][]r3.Vec{{{Y: -1}}},
+			Conflict{Kind: BelowGround, Drones: []int{0}, Round: 1, Locations: []r3.Vec{{Y: -1}}}},
+		{"obstacle", []r3.Vec{{X: 4}}, nil, [][]r3.Vec{{{X: 3}}},
+			Conflict{Kind: ObstacleCrossing, Drones: []int{0}, Round: 1, Locations: []r3.Vec{{X: 7}}}},
+		{"destination", []r3.Vec{{X: 0}}, []r3.Vec{{X: -1}}, [][]r3.Vec{{{Y: 1}}},
+			Conflict{Kind: DestinationNotReached, Drones: []int{0}, Round: 1, Locations: []r3.Vec{{Y: 1}}}},
+		{"separation", []r3.Vec{{X: 0}, {X: -1}}, nil, [][]r3.Vec{{{X: -1, Y: 1}}, {{X: 1, Y: 1}}},
+			Conflict{Kind: SeparationBreach, Drones: []int{0, 1}, Round: 1, Locations: []r3.Vec{{X: -1, Y: 1}, {Y: 1}}}},
+		{"length", []r3.Vec{{X: 0}, {X: 1}}, nil, [][]r3.Vec{{{Y: 1}}, {}},
+			Conflict{Kind: InvalidPath, Drones: []int{1}, Locations: []r3.Vec{{X: 1}}}},
+	} {
+		// A swap also breaches any separation
+		separation := 0.0
+		if test.expected.Kind == SeparationBreach {
+			separation = 0.5
+		}
+		conflicts := NewValidator(w, separation).Validate(test.from, test.dest, test.paths)
+		require.Equal(t, []Conflict{test.expected}, conflicts, test.name)
+	}
+}
+
+func TestValidator_Valid(t *testing.T) {
+	from := []r3.Vec{{X: 0}, {X: 1}}
+	dest := []r3.Vec{{X: 0, Y: 2}, {X: 1, Y: 1}}
+	paths := [][]r3.Vec{{{Y: 1}, {Y: 1}}, {{Y: 1}, {}}}
+
+	require.Empty(t, NewValidator(nil, 1).Validate(from, dest, paths))
+	require.Empty(t, NewValidator(nil, 0).Validate(nil, nil, nil))
+	// Drones one unit apart breach a larger separation
+	require.Len(t, NewValidator(nil, 1.5).Validate(from, dest, paths), 2)
+
+	// A drone follows the other one into the location it leaves
+	from = []r3.Vec{{X: 0}, {X: 1}}
+	paths = [][]r3.Vec{{{X: 1}}, {{X: 1}}}
+	require.Empty(t, NewValidator(nil, 0).Validate(from, nil, paths))
+}
+
+func TestValidator_Report(t *testing.T) {
+	// Three drones in the same cell, each conflict is reported in order
+	from := []r3.Vec{{X: 0}, {X: 1}, {X: 2}}
+	paths := [][]r3.Vec{{{X: 1}}, {{}}, {{X: -1}}}
+
+	// The drone staying still swaps with none of them
+	conflicts := NewValidator(nil, 0).Validate(from, nil, paths)
+	require.Len(t, conflicts, 2)
+	require.Equal(t, VertexCollision, conflicts[0].Kind)
+	require.Equal(t, VertexCollision, conflicts[1].Kind)
+	require.Equal(t, []int{1, 2}, conflicts[1].Drones)
+	require.Equal(t, "vertex collision of drones [0 1] at [{1 0 0} {1 0 0}] after round 1", conflicts[0].String())
+
+	require.Len(t, NewValidator(nil, 0).validate(from, nil, paths, 1), 1)
+	require.False(t, ValidatePaths(from, []r3.Vec{{X: 1}, {X: 1}, {X: 1}}, paths))
+}
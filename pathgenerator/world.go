@@ -0,0 +1,107 @@
+package pathgenerator
+
+import (
+	"math"
+
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// gridBounds returns the bounds of the grid around the cells, with a margin
+// to go around the other drones and around the obstacles in the way, never
+// under the ground nor over the ceiling
+func gridBounds(w *world.World, cells []cell) (cell, cell) {
+	var low, high cell
+	if len(cells) > 0 {
+		low, high = cells[0], cells[0]
+	}
+	extend := func(c cell) {
+		low = cell{X: min(low.X, c.X), Y: min(low.Y, c.Y), Z: min(low.Z, c.Z)}
+		high = cell{X: max(high.X, c.X), Y: max(high.Y, c.Y), Z: max(high.Z, c.Z)}
+	}
+	for _, c := range cells {
+		extend(c)
+	}
+	low = low.add(cell{X: -1, Y: -1, Z: -1})
+	high = high.add(cell{X: 1, Y: 1, Z: 1})
+
+	// An obstacle in the grid may need to be flown around entirely, which
+	// may bring other obstacles in
+	boxes := w.Boxes()
+	added := make([]bool, len(boxes))
+	for changed := true; changed; {
+		changed = false
+		for i, b := range boxes {
+			corner := cell{X: int(math.Floor(b.Min.X)) - 1, Y: int(math.Floor(b.Min.Y)) - 1, Z: int(math.Floor(b.Min.Z)) - 1}
+			opposite := cell{X: int(math.Ceil(b.Max.X)) + 1, Y: int(math.Ceil(b.Max.Y)) + 1, Z: int(math.Ceil(b.Max.Z)) + 1}
+			overlaps := corner.X <= high.X && opposite.X >= low.X && corner.Y <= high.Y && opposite.Y >= low.Y &&
+				corner.Z <= high.Z && opposite.Z >= low.Z
+			if !added[i] && overlaps {
+				added[i], changed = true, true
+				extend(corner)
+				extend(opposite)
+			}
+		}
+	}
+
+	low.Y = max(low.Y, 0)
+	if w != nil && w.Ceiling > 0 {
+		high.Y = min(high.Y, int(math.Floor(w.Ceiling)))
+	}
+	return low, high
+}
+
+// Reachable tells for each target whether a drone can fly there from one of
+// the positions, going around the obstacles of the world on the grid the
+// path generators use
+func Reachable(w *world.World, from []r3.Vec, targets []r3.Vec) []bool {
+	cells := make([]cell, 0, len(from)+len(targets))
+	for _, v := range append(append([]r3.Vec{}, from...), targets...) {
+		cells = append(cells, toCell(v))
+	}
+	p := &problem{world: w}
+	p.min, p.max = gridBounds(w, cells)
+
+	reached := make(map[cell]bool)
+	queue := make([]cell, 0)
+	for i, v := range from {
+		if c := cells[i]; !reached[c] && p.inside(c) && w.SegmentFree(v, c.vec()) {
+			reached[c] = true
+			queue = append(queue, c)
+		}
+	}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		for _, step := range steps {
+			next := c.add(step)
+			if !reached[next] && p.passable(c, next) {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	reachable := make([]bool, len(targets))
+	for i, v := range targets {
+		c := cells[len(from)+i]
+		reachable[i] = reached[c] && w.SegmentFree(c.vec(), v)
+	}
+	return reachable
+}
+
+// AroundStill returns the world in which the drones at the given positions
+// stay still, each one an obstacle the other drones fly around
+func AroundStill(w *world.World, positions []r3.Vec) *world.World {
+	if len(positions) == 0 {
+		return w
+	}
+	around := w.Copy()
+	if around == nil {
+		around = &world.World{}
+	}
+	for _, p := range positions {
+		around.Obstacles = append(around.Obstacles, world.Box{Min: p, Max: p})
+	}
+	return around
+}
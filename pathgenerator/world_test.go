@@ -0,0 +1,76 @@
+package pathgenerator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/world"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// wall returns a world with a wall across the X axis, too high to fly over
+// under the ceiling
+func wall() *world.World {
+	return &world.World{
+		Obstacles: []world.Box{{Min: r3.Vec{X: 1.5, Y: 0, Z: -2.5}, Max: r3.Vec{X: 2.5, Y: 2.5, Z: 2.5}}},
+		Ceiling:   2,
+	}
+}
+
+func TestWorld_Obstacles(t *testing.T) {
+	w := wall()
+	from := []r3.Vec{{X: 0}, {X: 0, Z: 1}, {X: 0, Y: 1}}
+	dest := []r3.Vec{{X: 4}, {X: 4, Z: 1}, {X: 4, Y: 1}}
+	require.False(t, ValidatePathsIn(w, from, dest, generateBasicPath(from, dest)))
+
+	for _, g := range []WorldAwareGenerator{
+		NewCBSPathGenerator(),
+		NewECBSPathGenerator(ecbsWeight),
+		NewPrioritizedPathGenerator(PriorityDistance, 10),
+	} {
+		paths := <-g.GeneratePathIn(w, from, dest)
+		require.NotNil(t, paths)
+		require.True(t, ValidatePathsIn(w, from, dest, paths))
+	}
+
+	// Starting in the wall
+	_, err := NewCBSPathGenerator().PlanIn(w, []r3.Vec{{X: 2}}, []r3.Vec{{X: 4}})
+	require.Error(t, err)
+}
+
+func TestWorld_Reachable(t *testing.T) {
+	w := wall()
+	// A cage around the cell (10, 5, 10)
+	w.Ceiling = 0
+	w.NoFly = []world.Box{
+		{Min: r3.Vec{X: 8.5, Y: 3.5, Z: 8.5}, Max: r3.Vec{X: 11.5, Y: 4.5, Z: 11.5}},
+		{Min: r3.Vec{X: 8.5, Y: 5.5, Z: 8.5}, Max: r3.Vec{X: 11.5, Y: 6.5, Z: 11.5}},
+		{Min: r3.Vec{X: 8.5, Y: 3.5, Z: 8.5}, Max: r3.Vec{X: 9.5, Y: 6.5, Z: 11.5}},
+		{Min: r3.Vec{X: 10.5, Y: 3.5, Z: 8.5}, Max: r3.Vec{X: 11.5, Y: 6.5, Z: 11.5}},
+		{Min: r3.Vec{X: 8.5, Y: 3.5, Z: 8.5}, Max: r3.Vec{X: 11.5, Y: 6.5, Z: 9.5}},
+		{Min: r3.Vec{X: 8.5, Y: 3.5, Z: 10.5}, Max: r3.Vec{X: 11.5, Y: 6.5, Z: 11.5}},
+	}
+
+	from := []r3.Vec{{X: 0}, {X: 0, Z: 1}, {X: 0, Z: 2}, {X: 0, Z: 3}}
+	targets := []r3.Vec{{X: 4, Y: 0.5}, {X: 10, Y: 5, Z: 10}, {X: 2, Y: 1}, {X: 10, Y: 7, Z: 10}}
+	require.Equal(t, []bool{true, false, false, true}, Reachable(w, from, targets))
+	require.Equal(t, []bool{true}, Reachable(nil, from[:1], targets[:1]))
+}
+
+func TestWorld_AroundStill(t *testing.T) {
+	// A grounded drone on the straight line is flown around
+	w := AroundStill(nil, []r3.Vec{{X: 1}})
+	from := []r3.Vec{{X: 0}}
+	dest := []r3.Vec{{X: 2}}
+	require.False(t, ValidatePathsIn(w, from, dest, generateBasicPath(from, dest)))
+
+	paths, err := NewCBSPathGenerator().PlanIn(w, from, dest)
+	require.NoError(t, err)
+	require.Empty(t, NewValidator(w, 0).Validate(from, dest, paths))
+
+	// The world given is left unchanged
+	walls := wall()
+	require.Len(t, AroundStill(walls, []r3.Vec{{X: 1}}).Obstacles, 2)
+	require.Len(t, walls.Obstacles, 1)
+	require.Equal(t, walls, AroundStill(walls, nil))
+}
@@ -0,0 +1,143 @@
+package blk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// BatchBlock commits several contents in a single consensus round
+type BatchBlock struct {
+	BlockNum int // not included in the hash
+	PrevHash []byte
+
+	Content BlockContent
+}
+
+// BatchBlockContent carries mappings and paths, possibly of several patterns.
+// The mappings come before the paths computed from them.
+type BatchBlockContent struct {
+	Mappings []*MappingBlockContent
+	Paths    []*PathBlockContent
+}
+
+func (c *BatchBlockContent) Hash() []byte {
+	h := sha256.New()
+
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(len(c.Mappings)))
+	h.Write(buf)
+	for _, mapping := range c.Mappings {
+		h.Write(mapping.Hash())
+	}
+	binary.BigEndian.PutUint64(buf, uint64(len(c.Paths)))
+	h.Write(buf)
+	for _, path := range c.Paths {
+		h.Write(path.Hash())
+	}
+
+	return h.Sum(nil)
+}
+
+func (c *BatchBlockContent) Copy() BlockContent {
+	content := &BatchBlockContent{}
+	for _, mapping := range c.Mappings {
+		content.Mappings = append(content.Mappings, mapping.Copy().(*MappingBlockContent))
+	}
+	for _, path := range c.Paths {
+		content.Paths = append(content.Paths, path.Copy().(*PathBlockContent))
+	}
+	return content
+}
+
+func (c *BatchBlockContent) BlockType() string {
+	return BlockBatchStr
+}
+
+// Entries returns the contents of the batch, the mappings first
+func (c *BatchBlockContent) Entries() []BlockContent {
+	entries := make([]BlockContent, 0, len(c.Mappings)+len(c.Paths))
+	for _, mapping := range c.Mappings {
+		entries = append(entries, mapping)
+	}
+	for _, path := range c.Paths {
+		entries = append(entries, path)
+	}
+	return entries
+}
+
+// Contents returns the contents committed by a block, which are several for
+// a batch
+func Contents(b *BlockContainer) []BlockContent {
+	if b == nil || b.IsContentNil() {
+		return nil
+	}
+	if batch, ok := b.GetContent().(*BatchBlockContent); ok {
+		return batch.Entries()
+	}
+	return []BlockContent{b.GetContent()}
+}
+
+// PathContent returns the last paths committed by a block, or nil if it
+// commits none
+func PathContent(b *BlockContainer) *PathBlockContent {
+	var paths *PathBlockContent
+	for _, content := range Contents(b) {
+		if c, ok := content.(*PathBlockContent); ok {
+			paths = c
+		}
+	}
+	return paths
+}
+
+func (b *BatchBlock) Hash() []byte {
+	h := sha256.New()
+
+	h.Write(b.PrevHash)
+	h.Write(b.Content.Hash())
+
+	return h.Sum(nil)
+}
+
+func (b *BatchBlock) Copy() Block {
+	if b.Content == nil {
+		return &BatchBlock{
+			BlockNum: b.BlockNum,
+			PrevHash: append([]byte{}, b.PrevHash...),
+		}
+	}
+	return &BatchBlock{
+		BlockNum: b.BlockNum,
+		PrevHash: append([]byte{}, b.PrevHash...),
+
+		Content: b.Content.Copy(),
+	}
+}
+
+func (b *BatchBlock) BlockNumber() int {
+	return b.BlockNum
+}
+
+func (b *BatchBlock) PreviousHash() []byte {
+	return b.PrevHash
+}
+
+func (b *BatchBlock) SetPreviousHash(prevHash []byte) {
+	b.PrevHash = prevHash
+}
+
+func (b *BatchBlock) GetContent() BlockContent {
+	return b.Content
+}
+
+func (b *BatchBlock) SetContent(blockContent BlockContent) {
+	batchContent, ok := blockContent.(*BatchBlockContent)
+
+	if ok {
+		b.Content = batchContent.Copy()
+	}
+}
+
+func (b *BatchBlock) IsContentNil() bool {
+	batchContent := b.Content.(*BatchBlockContent)
+	return batchContent.Mappings == nil && batchContent.Paths == nil
+}
@@ -4,6 +4,9 @@ const (
 	BlockNamingStr  = "NamingBlock"
 	BlockMappingStr = "MappingBlock"
 	BlockPathStr    = "PathBlock"
+
+	BlockMembershipStr = "MembershipBlock"
+	BlockBatchStr      = "BatchBlock"
 )
 
 // Block describes the content of a block in the blockchain.
@@ -29,3 +32,33 @@ type BlockFactory interface {
 	NewGenesisBlock(blockType string, blockNumber int, content BlockContent) *BlockContainer
 	NewBlock(blockType string, blockNumber int, previousHash []byte, content BlockContent) *BlockContainer
 }
+
+// ContentCheck returns an error for a content the node must not vote for
+type ContentCheck func(content BlockContent) error
+
+// Block returns the error of the first content of the block refused by the
+// check. A nil check refuses nothing.
+func (check ContentCheck) Block(b *BlockContainer) error {
+	if b == nil || b.IsContentNil() {
+		return nil
+	}
+	return check.Content(b.GetContent())
+}
+
+// Content returns the error of the first entry of the content refused by the
+// check, the content itself unless it is a batch
+func (check ContentCheck) Content(content BlockContent) error {
+	if check == nil {
+		return nil
+	}
+	entries := []BlockContent{content}
+	if batch, ok := content.(*BatchBlockContent); ok {
+		entries = batch.Entries()
+	}
+	for _, entry := range entries {
+		if err := check(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
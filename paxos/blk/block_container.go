@@ -18,11 +18,17 @@ func (b *BlockContainer) UnmarshalJSON(data []byte) error {
 		BlockNamingStr:  reflect.TypeOf(NamingBlock{}),
 		BlockMappingStr: reflect.TypeOf(MappingBlock{}),
 		BlockPathStr:    reflect.TypeOf(PathBlock{}),
+
+		BlockMembershipStr: reflect.TypeOf(MembershipBlock{}),
+		BlockBatchStr:      reflect.TypeOf(BatchBlock{}),
 	}
 	blockContentTypes := map[string]reflect.Type{
 		BlockNamingStr:  reflect.TypeOf(NamingBlockContent{}),
 		BlockMappingStr: reflect.TypeOf(MappingBlockContent{}),
 		BlockPathStr:    reflect.TypeOf(PathBlockContent{}),
+
+		BlockMembershipStr: reflect.TypeOf(MembershipBlockContent{}),
+		BlockBatchStr:      reflect.TypeOf(BatchBlockContent{}),
 	}
 
 	//Unmarshall in generic map[string]interface{}
@@ -43,6 +49,7 @@ func (b *BlockContainer) UnmarshalJSON(data []byte) error {
 		return xerrors.New("Not a valid BlockContainer, BlockType not valid")
 	}
 	if blockMapInterface == nil {
+		b.Type = blockType
 		return nil
 	}
 	blockMap, ok := blockMapInterface.(map[string]interface{})
@@ -42,6 +42,24 @@ func (f GenericBlockFactory) NewBlock(blockType string, blockNumber int, previou
 				Content:  content,
 			},
 		}
+	case BlockMembershipStr:
+		return &BlockContainer{
+			Type: BlockMembershipStr,
+			Block: &MembershipBlock{
+				BlockNum: blockNumber,
+				PrevHash: previousHash,
+				Content:  content,
+			},
+		}
+	case BlockBatchStr:
+		return &BlockContainer{
+			Type: BlockBatchStr,
+			Block: &BatchBlock{
+				BlockNum: blockNumber,
+				PrevHash: previousHash,
+				Content:  content,
+			},
+		}
 	default:
 		panic("Unknown type of blocks")
 	}
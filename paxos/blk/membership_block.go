@@ -0,0 +1,100 @@
+package blk
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// MembershipBlock changes the set of nodes taking part in the consensus
+type MembershipBlock struct {
+	BlockNum int // not included in the hash
+	PrevHash []byte
+
+	Content BlockContent
+}
+
+// MembershipBlockContent lists the indexes of the nodes agreeing on the blocks
+// from the Activation block on. The position of a node in Members is its
+// index in the consensus.
+type MembershipBlockContent struct {
+	Members    []int
+	Activation int
+}
+
+func (c *MembershipBlockContent) Hash() []byte {
+	h := sha256.New()
+
+	buf := make([]byte, 8)
+	for _, member := range c.Members {
+		binary.BigEndian.PutUint64(buf, uint64(member))
+		h.Write(buf)
+	}
+	binary.BigEndian.PutUint64(buf, uint64(c.Activation))
+	h.Write(buf)
+
+	return h.Sum(nil)
+}
+
+func (c *MembershipBlockContent) Copy() BlockContent {
+	return &MembershipBlockContent{
+		Members:    append([]int{}, c.Members...),
+		Activation: c.Activation,
+	}
+}
+
+func (c *MembershipBlockContent) BlockType() string {
+	return BlockMembershipStr
+}
+
+func (b *MembershipBlock) Hash() []byte {
+	h := sha256.New()
+
+	h.Write(b.PrevHash)
+	h.Write(b.Content.Hash())
+
+	return h.Sum(nil)
+}
+
+func (b *MembershipBlock) Copy() Block {
+	if b.Content == nil {
+		return &MembershipBlock{
+			BlockNum: b.BlockNum,
+			PrevHash: append([]byte{}, b.PrevHash...),
+		}
+	}
+	return &MembershipBlock{
+		BlockNum: b.BlockNum,
+		PrevHash: append([]byte{}, b.PrevHash...),
+
+		Content: b.Content.Copy(),
+	}
+}
+
+func (b *MembershipBlock) BlockNumber() int {
+	return b.BlockNum
+}
+
+func (b *MembershipBlock) PreviousHash() []byte {
+	return b.PrevHash
+}
+
+func (b *MembershipBlock) SetPreviousHash(prevHash []byte) {
+	b.PrevHash = prevHash
+}
+
+func (b *MembershipBlock) GetContent() BlockContent {
+	return b.Content
+}
+
+func (b *MembershipBlock) SetContent(blockContent BlockContent) {
+	membershipContent, ok := blockContent.(*MembershipBlockContent)
+
+	if ok {
+		b.Content = membershipContent.Copy()
+	}
+}
+
+func (b *MembershipBlock) IsContentNil() bool {
+	membershipContent := b.Content.(*MembershipBlockContent)
+	return membershipContent.Members == nil
+}
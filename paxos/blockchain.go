@@ -2,42 +2,136 @@ package paxos
 
 import (
 	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
 
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
 	"go.dedis.ch/cs438/orbitalswarm/gossip"
 	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
 	"go.dedis.ch/onet/v3/log"
+	"golang.org/x/xerrors"
 )
 
+// Mode selects how the blocks of the chain are agreed on
+type Mode int
+
+const (
+	// ModePaxos runs both phases of a new Paxos instance for every block
+	ModePaxos Mode = iota
+	// ModeMultiPaxos keeps a stable leader which skips phase 1 for the
+	// consecutive blocks
+	ModeMultiPaxos
+)
+
+var modeNames = map[Mode]string{
+	ModePaxos:      "paxos",
+	ModeMultiPaxos: "multipaxos",
+}
+
+func (m Mode) String() string {
+	return modeNames[m]
+}
+
+// ModeByName returns the mode with the given name, "paxos" or "multipaxos"
+func ModeByName(name string) (Mode, error) {
+	for mode, modeName := range modeNames {
+		if strings.EqualFold(name, modeName) {
+			return mode, nil
+		}
+	}
+	return ModePaxos, xerrors.Errorf("unknown consensus mode %s", name)
+}
+
 // BlockChain allow to handle HandlingPackets
 type BlockChain struct {
-	numParticipant int
-	nodeIndex      int
-	paxosRetry     int
+	mutex sync.Mutex
 
-	tail   *blk.BlockContainer
-	blocks map[string]*blk.BlockContainer
-	tlc    *TLC
+	nodeIndex  int
+	paxosRetry int
+	// ordered by activation, the first one is the initial membership
+	memberships []membership
+
+	tail       *blk.BlockContainer
+	blocks     map[string]*blk.BlockContainer
+	tlc        *TLC
+	multiPaxos *MultiPaxos
 
 	blockFactory blk.BlockFactory
+	store        Store
+	metrics      *VoteMetrics
+	// refuses the proposals we must not accept
+	check blk.ContentCheck
+
+	// last time the missing blocks were requested
+	lastSync time.Time
+	// blocks decided by the others while we miss the previous ones
+	ahead map[int]*blk.BlockContainer
+	// blocks sent by the others in their sync responses, by hash
+	synced map[string]*syncedBlock
 }
 
-func NewBlockchain(numParticipant int, nodeIndex int, paxosRetry int, blockFactory blk.BlockFactory) *BlockChain {
+// NewBlockchain creates a chain whose blocks are agreed on with the given
+// mode, by the first numParticipant nodes until a membership block changes
+// them. It reloads the blocks and the acceptor state kept in the store, and
+// resumes at the TLC round following the last block.
+func NewBlockchain(numParticipant int, nodeIndex int, paxosRetry int, blockFactory blk.BlockFactory, mode Mode, store Store) *BlockChain {
 	blocks := make(map[string]*blk.BlockContainer)
 
-	return &BlockChain{
-		numParticipant: numParticipant,
-		nodeIndex:      nodeIndex,
-		paxosRetry:     paxosRetry,
+	b := &BlockChain{
+		nodeIndex:   nodeIndex,
+		paxosRetry:  paxosRetry,
+		memberships: []membership{initialMembership(numParticipant)},
 
-		tlc:          NewTLC(numParticipant, nodeIndex, paxosRetry, 0, blockFactory),
 		tail:         nil,
 		blocks:       blocks,
+		ahead:        make(map[int]*blk.BlockContainer),
+		synced:       make(map[string]*syncedBlock),
 		blockFactory: blockFactory,
+		store:        store,
+		metrics:      &VoteMetrics{},
 	}
+	for _, block := range store.Blocks() {
+		b.blocks[hex.EncodeToString(block.Hash())] = block
+		b.tail = block
+		b.addMembership(block)
+	}
+
+	blockNumber := 0
+	if b.tail != nil {
+		blockNumber = b.tail.BlockNumber() + 1
+	}
+	if mode == ModeMultiPaxos {
+		m := b.membershipAt(blockNumber)
+		b.multiPaxos = NewMultiPaxos(blockNumber, len(m.members), m.index(nodeIndex), paxosRetry, blockFactory, store, b.metrics)
+	}
+	b.tlc = b.newTLC(blockNumber)
+	return b
+}
+
+// newTLC returns the TLC of the given block, agreed on by the members of
+// that block
+func (b *BlockChain) newTLC(blockNumber int) *TLC {
+	m := b.membershipAt(blockNumber)
+	if b.multiPaxos == nil {
+		return NewTLC(len(m.members), m.index(b.nodeIndex), b.paxosRetry, blockNumber, b.blockFactory, b.store, b.metrics)
+	}
+	if m.since == blockNumber {
+		b.multiPaxos.reconfigure(len(m.members), m.index(b.nodeIndex))
+	}
+	b.multiPaxos.advance(blockNumber)
+	return newTLC(len(m.members), m.index(b.nodeIndex), blockNumber, b.multiPaxos, b.metrics)
 }
 
 func (b *BlockChain) Propose(g *gossip.Gossiper, blockContent blk.BlockContent) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.membershipAt(b.tlc.blockNumber).index(b.nodeIndex) < 0 {
+		log.Printf("Node %d is not a member of block %d, proposal dropped", b.nodeIndex, b.tlc.blockNumber)
+		return
+	}
+
 	if b.tail == nil {
 		// First block
 		log.Printf("Block type of propose : %s", blockContent.BlockType())
@@ -51,19 +145,104 @@ func (b *BlockChain) Propose(g *gossip.Gossiper, blockContent blk.BlockContent)
 // representation of the block's hash. The first return is the hexadecimal
 // hash of the last block.
 func (b *BlockChain) GetBlocks() (string, map[string]*blk.BlockContainer) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	blocks := make(map[string]*blk.BlockContainer, len(b.blocks))
+	for hash, block := range b.blocks {
+		blocks[hash] = block
+	}
 	if b.tail == nil {
-		return hex.EncodeToString(make([]byte, 32)), b.blocks
+		return hex.EncodeToString(make([]byte, 32)), blocks
 	}
-	return hex.EncodeToString(b.tail.Hash()), b.blocks
+	return hex.EncodeToString(b.tail.Hash()), blocks
+}
+
+// Verify checks that the blocks form a single chain up to the tail. It
+// returns a *ChainError reporting the first broken link.
+func (b *BlockChain) Verify() error {
+	return VerifyBlocks(b.GetBlocks())
+}
+
+// Iterator returns an iterator over the blocks in the order of their numbers,
+// or in the reverse order if backward is set
+func (b *BlockChain) Iterator(backward bool) *BlockIterator {
+	_, blocks := b.GetBlocks()
+	return NewBlockIterator(blocks, backward)
 }
 
+// VoteMetrics returns the counters of the Paxos votes which did not count
+func (b *BlockChain) VoteMetrics() *VoteMetrics {
+	return b.metrics
+}
+
+// HandleExtraMessage handles the consensus and sync messages. It returns the
+// last block added to the chain, if any.
 func (b *BlockChain) HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch {
+	case msg.SyncRequest != nil:
+		b.uponSyncRequest(g, msg.SyncRequest)
+		return nil
+	case msg.SyncResponse != nil:
+		last := b.uponSyncResponse(msg.SyncResponse)
+		if block := b.appendAhead(); block != nil {
+			last = block
+		}
+		return last
+	}
+
+	// The others are working on a later block, we missed some
+	if blockNumberOf(msg) > b.tlc.blockNumber {
+		b.keepAhead(msg)
+		b.requestSync(g)
+	}
+
+	// The nodes which are not members learn the blocks from the TLC of the
+	// members
+	if msg.PaxosTLC == nil && b.membershipAt(b.tlc.blockNumber).index(b.nodeIndex) < 0 {
+		return nil
+	}
+	// Neither accept a proposal we refuse, nor adopt it from a promise
+	if msg.PaxosPropose != nil {
+		if err := b.check.Block(msg.PaxosPropose.Value); err != nil {
+			log.Printf("Node %d refuses the proposal %d: %s", b.nodeIndex, msg.PaxosPropose.ID, err)
+			return nil
+		}
+	}
+	if msg.PaxosPromise != nil {
+		if err := b.check.Block(msg.PaxosPromise.Value); err != nil {
+			log.Printf("Node %d refuses the value promised for %d: %s", b.nodeIndex, msg.PaxosPromise.IDp, err)
+			return nil
+		}
+	}
+
 	block := b.tlc.handleExtraMessage(g, msg)
 	if block != nil {
-		b.blocks[hex.EncodeToString(block.Hash())] = block
-		b.tail = block
-		b.tlc.stop()
-		b.tlc = NewTLC(b.numParticipant, b.nodeIndex, b.paxosRetry, b.tail.BlockNumber()+1, b.blockFactory)
+		b.appendBlock(block)
 	}
 	return block
 }
+
+// SetContentCheck makes the node accept only the proposals whose contents
+// pass the check, the others are ignored as if they were lost
+func (b *BlockChain) SetContentCheck(check blk.ContentCheck) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.check = check
+}
+
+// appendBlock adds the block at the end of the chain and moves to the next round
+func (b *BlockChain) appendBlock(block *blk.BlockContainer) {
+	// Persist the block before moving to the next round
+	if err := b.store.AppendBlock(block); err != nil {
+		log.Printf("Unable to persist block %d: %s", block.BlockNumber(), err)
+	}
+	b.blocks[hex.EncodeToString(block.Hash())] = block
+	b.tail = block
+	b.addMembership(block)
+	b.tlc.stop()
+	b.tlc = b.newTLC(b.tail.BlockNumber() + 1)
+}
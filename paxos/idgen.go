@@ -26,3 +26,10 @@ func (s *uniqIDGen) GetNext() int {
 
 	return res
 }
+
+// skip moves the generator past the given ID
+func (s *uniqIDGen) skip(id int) {
+	for s.currentID <= id {
+		s.currentID = s.currentID + s.total
+	}
+}
@@ -0,0 +1,109 @@
+package paxos
+
+import (
+	"sort"
+
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// membership is the set of nodes agreeing on the blocks from the since block
+// on. The index of a node in the consensus is its position in members, which
+// sets the quorums and the stride of the IDs it generates.
+type membership struct {
+	since   int
+	members []int
+}
+
+// initialMembership returns the membership of the first numParticipant nodes
+func initialMembership(numParticipant int) membership {
+	members := make([]int, numParticipant)
+	for i := range members {
+		members[i] = i
+	}
+	return membership{since: 0, members: members}
+}
+
+// index returns the index of the node in the consensus, or -1 if it is not a
+// member
+func (m membership) index(nodeIndex int) int {
+	for i, member := range m.members {
+		if member == nodeIndex {
+			return i
+		}
+	}
+	return -1
+}
+
+// validMembers tells whether the members are distinct node indexes
+func validMembers(members []int) bool {
+	if len(members) == 0 {
+		return false
+	}
+	seen := make(map[int]bool, len(members))
+	for _, member := range members {
+		if member < 0 || seen[member] {
+			return false
+		}
+		seen[member] = true
+	}
+	return true
+}
+
+// membershipAt returns the membership agreeing on the given block
+func (b *BlockChain) membershipAt(blockNumber int) membership {
+	current := b.memberships[0]
+	for _, m := range b.memberships[1:] {
+		if m.since > blockNumber {
+			break
+		}
+		current = m
+	}
+	return current
+}
+
+// addMembership records the membership changed by the block, if it is a
+// membership block. The change takes effect at its activation block, or at the
+// next block if the activation is not after it.
+func (b *BlockChain) addMembership(block *blk.BlockContainer) {
+	content, ok := block.GetContent().(*blk.MembershipBlockContent)
+	if !ok {
+		return
+	}
+	if !validMembers(content.Members) {
+		log.Printf("Ignore the invalid members %v of block %d", content.Members, block.BlockNumber())
+		return
+	}
+
+	m := membership{
+		since:   content.Activation,
+		members: append([]int{}, content.Members...),
+	}
+	if m.since <= block.BlockNumber() {
+		m.since = block.BlockNumber() + 1
+	}
+
+	// Keep the memberships ordered by activation, the last decided one wins
+	// for the same activation
+	i := sort.Search(len(b.memberships), func(i int) bool {
+		return b.memberships[i].since > m.since
+	})
+	b.memberships = append(b.memberships, membership{})
+	copy(b.memberships[i+1:], b.memberships[i:])
+	b.memberships[i] = m
+}
+
+// IsMember tells whether the node takes part in the agreement on the current
+// block. The others only learn the blocks.
+func (b *BlockChain) IsMember() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.membershipAt(b.tlc.blockNumber).index(b.nodeIndex) >= 0
+}
+
+// Members returns the indexes of the nodes agreeing on the current block
+func (b *BlockChain) Members() []int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]int{}, b.membershipAt(b.tlc.blockNumber).members...)
+}
@@ -0,0 +1,90 @@
+package paxos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestMembership_Activation(t *testing.T) {
+	factory := blk.NewGenericBlockFactory()
+	chain := NewBlockchain(3, 3, 1, factory, ModePaxos, NewMemoryStore())
+	defer chain.tlc.stop()
+	require.False(t, chain.IsMember())
+
+	genesis := factory.NewGenesisBlock(blk.BlockMembershipStr, 0, &blk.MembershipBlockContent{
+		Members:    []int{3, 0},
+		Activation: 2,
+	})
+	invalid := factory.NewBlock(blk.BlockMembershipStr, 1, genesis.Hash(), &blk.MembershipBlockContent{
+		Members: []int{1, 1},
+	})
+	chain.appendBlock(genesis)
+	chain.appendBlock(invalid)
+
+	// The change takes effect at its activation, the invalid one is ignored
+	require.Equal(t, []int{0, 1, 2}, chain.membershipAt(1).members)
+	require.Equal(t, []int{3, 0}, chain.membershipAt(2).members)
+	require.Equal(t, 2, chain.tlc.blockNumber)
+	require.True(t, chain.IsMember())
+	require.Equal(t, []int{3, 0}, chain.Members())
+	require.Equal(t, 2, chain.tlc.numParticipant)
+
+	// An activation which is not after the block means the next block
+	next := factory.NewBlock(blk.BlockMembershipStr, 2, invalid.Hash(), &blk.MembershipBlockContent{
+		Members:    []int{0},
+		Activation: 1,
+	})
+	chain.appendBlock(next)
+	require.Equal(t, []int{3, 0}, chain.membershipAt(2).members)
+	require.Equal(t, []int{0}, chain.membershipAt(3).members)
+	require.False(t, chain.IsMember())
+}
+
+func TestMembership_Reconfigure(t *testing.T) {
+	nodes := createChains(t, 4, ModeMultiPaxos, nil)
+	defer stopChains(nodes)
+
+	// The first node removes itself
+	nodes[0].Lock()
+	nodes[0].chain.Propose(nodes[0].gossiper, &blk.MembershipBlockContent{Members: []int{1, 2, 3}})
+	nodes[0].Unlock()
+	waitBlock(t, nodes, 0)
+
+	for i, node := range nodes {
+		node.Lock()
+		require.Equal(t, i != 0, node.chain.IsMember())
+		require.Equal(t, []int{1, 2, 3}, node.chain.Members())
+		node.Unlock()
+	}
+
+	// It learns the blocks agreed on by the others, which generate their IDs
+	// with the new stride
+	nodes[3].Lock()
+	nodes[3].chain.Propose(nodes[3].gossiper, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+	nodes[3].Unlock()
+	waitBlock(t, nodes, 1)
+	require.True(t, nodes[3].chain.multiPaxos.IsLeader())
+	require.Equal(t, 2, nodes[3].chain.multiPaxos.leadingID%3)
+
+	require.NoError(t, nodes[0].chain.Verify())
+	tail, _ := nodes[0].chain.GetBlocks()
+	otherTail, _ := nodes[3].chain.GetBlocks()
+	require.Equal(t, tail, otherTail)
+}
+
+func TestMembership_Reload(t *testing.T) {
+	factory := blk.NewGenericBlockFactory()
+	store := NewMemoryStore()
+	require.NoError(t, store.AppendBlock(factory.NewGenesisBlock(blk.BlockMembershipStr, 0, &blk.MembershipBlockContent{
+		Members: []int{4},
+	})))
+
+	chain := NewBlockchain(3, 4, 1, factory, ModeMultiPaxos, store)
+	defer chain.tlc.stop()
+	require.True(t, chain.IsMember())
+	require.Equal(t, 1, chain.multiPaxos.numParticipant)
+	require.Equal(t, 0, chain.multiPaxos.nodeIndex)
+}
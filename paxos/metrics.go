@@ -0,0 +1,59 @@
+package paxos
+
+import (
+	"sync/atomic"
+
+	"go.dedis.ch/onet/v3/log"
+)
+
+// VoteMetrics counts the promises and accepts which did not count towards a
+// quorum. A nil VoteMetrics counts nothing.
+type VoteMetrics struct {
+	duplicate uint64
+	stale     uint64
+}
+
+// DuplicateCount returns the number of votes received again from the same
+// acceptor, as when the gossip delivers a rumor twice
+func (m *VoteMetrics) DuplicateCount() uint64 {
+	return atomic.LoadUint64(&m.duplicate)
+}
+
+// StaleCount returns the number of votes about another block, or about a
+// proposal which is over
+func (m *VoteMetrics) StaleCount() uint64 {
+	return atomic.LoadUint64(&m.stale)
+}
+
+func (m *VoteMetrics) duplicateVote() {
+	if m != nil {
+		atomic.AddUint64(&m.duplicate, 1)
+	}
+}
+
+func (m *VoteMetrics) staleVote() {
+	if m != nil {
+		atomic.AddUint64(&m.stale, 1)
+	}
+}
+
+// validAcceptor tells whether the index of the acceptor of a vote is one of
+// the participants
+func validAcceptor(acceptorID int, numParticipant int) bool {
+	if acceptorID < 0 || acceptorID >= numParticipant {
+		log.Printf("Drop the vote of the unknown acceptor %d", acceptorID)
+		return false
+	}
+	return true
+}
+
+// vote records the acceptors which sent a vote. It returns false if the
+// acceptor already voted, counting the duplicate.
+func vote(voters map[int]bool, acceptorID int, metrics *VoteMetrics) bool {
+	if voters[acceptorID] {
+		metrics.duplicateVote()
+		return false
+	}
+	voters[acceptorID] = true
+	return true
+}
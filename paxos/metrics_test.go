@@ -0,0 +1,144 @@
+package paxos
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestVoteMetrics_Promises(t *testing.T) {
+	factory := blk.NewGenericBlockFactory()
+	metrics := &VoteMetrics{}
+	m := NewMultiPaxos(0, 5, 0, 1, factory, NewMemoryStore(), metrics)
+	defer m.stop()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.proposedID = 5
+	m.state = stateAwaitPromise
+	promise := func(acceptorID int, id int) {
+		m.uponPaxosPromiseLocked(&extramessage.PaxosPromise{
+			PaxosSeqID: 0,
+			IDp:        id,
+			AcceptorID: acceptorID,
+			IDa:        -1,
+			Value:      factory.NewEmptyBlock(),
+		})
+	}
+
+	// The same acceptor and an unknown one never make a majority
+	for i := 0; i < 3; i++ {
+		promise(1, 5)
+	}
+	promise(5, 5)
+	promise(2, 0)
+	require.Equal(t, stateAwaitPromise, m.state)
+	require.Equal(t, uint64(2), metrics.DuplicateCount())
+	require.Equal(t, uint64(1), metrics.StaleCount())
+
+	promise(2, 5)
+	promise(3, 5)
+	require.Equal(t, stateAwaitAccept, m.state)
+}
+
+func TestVoteMetrics_Accepts(t *testing.T) {
+	factory := blk.NewGenericBlockFactory()
+	metrics := &VoteMetrics{}
+	p := NewPaxos(1, 5, 0, 1, factory, NewMemoryStore(), metrics)
+	defer p.stop()
+
+	value := factory.NewGenesisBlock(blk.BlockPathStr, 1, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+	accept := func(acceptorID int, seqID int) *blk.BlockContainer {
+		return p.handle(nil, &extramessage.ExtraMessage{PaxosAccept: &extramessage.PaxosAccept{
+			PaxosSeqID: seqID,
+			ID:         6,
+			AcceptorID: acceptorID,
+			Value:      value,
+		}})
+	}
+
+	for i := 0; i < 3; i++ {
+		require.Nil(t, accept(1, 1))
+	}
+	require.Nil(t, accept(-1, 1))
+	require.Nil(t, accept(2, 0))
+	require.Nil(t, accept(2, 1))
+	require.Equal(t, uint64(2), metrics.DuplicateCount())
+	require.Equal(t, uint64(1), metrics.StaleCount())
+
+	// A majority of 3 distinct acceptors decides the value
+	require.Equal(t, value, accept(3, 1))
+}
+
+func TestVoteMetrics_Confirmations(t *testing.T) {
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	g, err := fac.New("", "node0", 10, 0, 1)
+	require.NoError(t, err)
+
+	factory := blk.NewGenericBlockFactory()
+	metrics := &VoteMetrics{}
+	tlc := newTLC(3, 0, 1, nil, metrics)
+
+	value := factory.NewGenesisBlock(blk.BlockPathStr, 1, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+	confirm := func(acceptorID int) *blk.BlockContainer {
+		return tlc.handleExtraMessage(g, &extramessage.ExtraMessage{PaxosTLC: &extramessage.PaxosTLC{
+			AcceptorID: acceptorID,
+			Value:      value,
+		}})
+	}
+
+	// A node confirming again does not make a majority
+	for i := 0; i < 3; i++ {
+		require.Nil(t, confirm(1))
+	}
+	require.Nil(t, confirm(3))
+	require.Equal(t, uint64(2), metrics.DuplicateCount())
+
+	require.Equal(t, value, confirm(2))
+}
+
+func TestPaxos_Replay(t *testing.T) {
+	nodes := createChains(t, 5, ModePaxos, nil)
+	defer stopChains(nodes)
+	for _, node := range nodes {
+		node.Lock()
+		node.replay = true
+		node.Unlock()
+	}
+
+	nodes[0].Lock()
+	nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+	nodes[0].Unlock()
+	waitBlock(t, nodes, 0)
+
+	// Every vote arrived twice, but counted once
+	duplicates := uint64(0)
+	tail, _ := nodes[0].chain.GetBlocks()
+	for _, node := range nodes {
+		duplicates += node.chain.VoteMetrics().DuplicateCount()
+		otherTail, _ := node.chain.GetBlocks()
+		require.Equal(t, tail, otherTail)
+	}
+	require.NotZero(t, duplicates)
+}
+
+func TestPaxos_ThreeNodes(t *testing.T) {
+	// The proposer votes for its own proposal, one more acceptor is a majority
+	nodes := createChains(t, 3, ModePaxos, nil)
+	defer stopChains(nodes)
+
+	nodes[1].Lock()
+	nodes[1].chain.Propose(nodes[1].gossiper, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+	nodes[1].Unlock()
+	waitBlock(t, nodes, 0)
+
+	tail, _ := nodes[0].chain.GetBlocks()
+	for _, node := range nodes[1:] {
+		otherTail, _ := node.chain.GetBlocks()
+		require.Equal(t, tail, otherTail)
+	}
+}
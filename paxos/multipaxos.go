@@ -0,0 +1,432 @@
+package paxos
+
+import (
+	"sync"
+	"time"
+
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// MultiPaxos agrees on the consecutive blocks of the chain with a stable
+// leader. The promises made in phase 1 hold for every following block, so the
+// leader only runs phase 2 as long as nobody prepared a higher ID. Acceptors
+// ignore the prepares of other nodes while the lease of the leader runs, which
+// is renewed every time the leader is heard of.
+//
+// The IDs are generated as in Paxos, the leader of an ID being ID modulo the
+// number of participants.
+type MultiPaxos struct {
+	mutex sync.Mutex
+
+	// base config
+	nodeIndex      int
+	numParticipant int
+	paxosRetry     int
+	lease          time.Duration
+	blockFactory   blk.BlockFactory
+	idGenerator    UniqueIDGenerator
+
+	// Acceptor, across blocks
+	promisedID int
+	leaderID   int
+	leaderSeen time.Time
+
+	// Proposer, across blocks. ID whose phase 1 succeeded, -1 if none
+	leadingID int
+
+	// Current block
+	paxosSequenceID int
+	proposedID      int
+	state           int
+	promisers       map[int]bool
+	value           *blk.BlockContainer
+	valueID         int
+	chanMajority    chan bool
+
+	latestAcceptedID    int
+	latestAcceptedValue *blk.BlockContainer
+
+	// ID -> acceptors which accepted it
+	learnerData map[int]map[int]bool
+	decided     bool
+
+	chanEnd chan bool
+	stopped bool
+
+	store   Store
+	metrics *VoteMetrics
+}
+
+// NewMultiPaxos creates a Multi-Paxos starting at the given block number. The
+// lease of a leader lasts twice the retry period. The promise saved in the
+// store holds for every block, the accepted value only for its own. The votes
+// which do not count are reported to metrics.
+func NewMultiPaxos(blockNumber int, numParticipant int, nodeIndex int, paxosRetry int, blockFactory blk.BlockFactory, store Store, metrics *VoteMetrics) *MultiPaxos {
+	seqGen := newSeqGen(nodeIndex, numParticipant)
+	m := &MultiPaxos{
+		nodeIndex:      nodeIndex,
+		numParticipant: numParticipant,
+		paxosRetry:     paxosRetry,
+		lease:          2 * time.Duration(paxosRetry) * time.Second,
+		blockFactory:   blockFactory,
+		idGenerator:    seqGen,
+
+		promisedID: -1,
+		leaderID:   -1,
+		leadingID:  -1,
+
+		store:   store,
+		metrics: metrics,
+	}
+	if state, ok := store.Acceptor(); ok {
+		seqGen.skip(state.ProposedID)
+		m.promisedID = state.PromisedID
+	}
+	m.advance(blockNumber)
+	return m
+}
+
+// persistLocked saves the acceptor state, the replies depending on it must
+// only be sent once it succeeded
+func (m *MultiPaxos) persistLocked() bool {
+	err := m.store.SaveAcceptor(AcceptorState{
+		PaxosSeqID:    m.paxosSequenceID,
+		ProposedID:    m.proposedID,
+		PromisedID:    m.promisedID,
+		AcceptedID:    m.latestAcceptedID,
+		AcceptedValue: m.latestAcceptedValue,
+	})
+	if err != nil {
+		log.Printf("Unable to persist the acceptor state: %s", err)
+		return false
+	}
+	return true
+}
+
+// reconfigure changes the members agreeing on the following blocks. The
+// leader of the previous members has to prepare again, as the IDs now belong
+// to other nodes.
+func (m *MultiPaxos) reconfigure(numParticipant int, nodeIndex int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	seqGen := newSeqGen(nodeIndex, numParticipant)
+	seqGen.skip(m.promisedID)
+	m.idGenerator = seqGen
+	m.numParticipant = numParticipant
+	m.nodeIndex = nodeIndex
+	m.leaderID = -1
+	m.leadingID = -1
+}
+
+// advance resets the state of the current block to work on the given one
+func (m *MultiPaxos) advance(blockNumber int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.stopLocked()
+	m.paxosSequenceID = blockNumber
+	m.proposedID = -1
+	m.state = stateNoProposal
+	m.promisers = make(map[int]bool)
+	m.value = nil
+	m.valueID = -1
+	m.chanMajority = make(chan bool, 1)
+
+	m.latestAcceptedID = -1
+	m.latestAcceptedValue = m.blockFactory.NewEmptyBlock()
+	if state, ok := m.store.Acceptor(); ok && state.PaxosSeqID == blockNumber {
+		m.latestAcceptedID = state.AcceptedID
+		if state.AcceptedValue != nil {
+			m.latestAcceptedValue = state.AcceptedValue
+		}
+	}
+
+	m.learnerData = make(map[int]map[int]bool)
+	m.decided = false
+
+	m.chanEnd = make(chan bool)
+	m.stopped = false
+}
+
+func (m *MultiPaxos) stop() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stopLocked()
+}
+
+func (m *MultiPaxos) stopLocked() {
+	if m.chanEnd != nil && !m.stopped {
+		close(m.chanEnd)
+		m.stopped = true
+	}
+}
+
+// IsLeader tells whether the node is the leader of the current block
+func (m *MultiPaxos) IsLeader() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.leadingID >= 0 && m.leadingID >= m.promisedID
+}
+
+// leaseHeld tells whether another node holds the lease
+func (m *MultiPaxos) leaseHeld(now time.Time) bool {
+	return m.leaderID >= 0 && m.leaderID%m.numParticipant != m.nodeIndex &&
+		now.Sub(m.leaderSeen) < m.lease
+}
+
+func (m *MultiPaxos) heardFrom(id int) {
+	if id >= m.leaderID {
+		m.leaderID = id
+		m.leaderSeen = time.Now()
+	}
+}
+
+// drainLocked drops the majority signal of a previous round
+func (m *MultiPaxos) drainLocked() {
+	select {
+	case <-m.chanMajority:
+	default:
+	}
+}
+
+func (m *MultiPaxos) signalMajority() {
+	select {
+	case m.chanMajority <- true:
+	default:
+	}
+}
+
+func (m *MultiPaxos) propose(g *gossip.Gossiper, block *blk.BlockContainer) {
+	m.mutex.Lock()
+	if m.value == nil {
+		m.value = block
+	}
+	chanMajority, chanEnd := m.chanMajority, m.chanEnd
+	m.mutex.Unlock()
+
+	retry := time.Duration(m.paxosRetry) * time.Second
+
+	go func() {
+		for {
+			m.mutex.Lock()
+			if m.chanEnd != chanEnd {
+				// The block was decided in the meantime
+				m.mutex.Unlock()
+				return
+			}
+			m.drainLocked()
+			now := time.Now()
+			prepare := m.leadingID < 0 || m.leadingID < m.promisedID
+			if prepare && m.leaseHeld(now) {
+				// Let the leader propose, and take over if its lease expires
+				wait := m.lease - now.Sub(m.leaderSeen)
+				m.mutex.Unlock()
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+					continue
+				case <-chanEnd:
+					timer.Stop()
+					return
+				}
+			}
+
+			if prepare {
+				// Phase 1
+				id := m.idGenerator.GetNext()
+				for id <= m.promisedID {
+					id = m.idGenerator.GetNext()
+				}
+				m.proposedID = id
+				m.state = stateAwaitPromise
+				m.promisers = make(map[int]bool)
+				msg := &extramessage.PaxosPrepare{PaxosSeqID: m.paxosSequenceID, ID: id}
+				if promise := m.promiseLocked(msg); promise != nil {
+					m.uponPaxosPromiseLocked(promise)
+				}
+				m.mutex.Unlock()
+
+				g.AddExtraMessage(&extramessage.ExtraMessage{PaxosPrepare: msg})
+
+				timer := time.NewTimer(retry)
+				select {
+				case <-timer.C:
+					continue
+				case <-chanMajority:
+					timer.Stop()
+				case <-chanEnd:
+					timer.Stop()
+					return
+				}
+
+				m.mutex.Lock()
+				if m.chanEnd != chanEnd {
+					m.mutex.Unlock()
+					return
+				}
+				m.leadingID = id
+			} else {
+				log.Printf("Leader %d skips phase 1 of block %d", m.nodeIndex, m.paxosSequenceID)
+				m.proposedID = m.leadingID
+				m.state = stateAwaitAccept
+			}
+
+			// Phase 2
+			propose := &extramessage.PaxosPropose{
+				PaxosSeqID: m.paxosSequenceID,
+				ID:         m.proposedID,
+				Value:      m.value,
+			}
+			accept := m.acceptLocked(propose)
+			if accept != nil {
+				m.uponPaxosAcceptLocked(accept)
+			}
+			m.mutex.Unlock()
+
+			g.AddExtraMessage(&extramessage.ExtraMessage{PaxosPropose: propose})
+			if accept != nil {
+				g.AddExtraMessage(&extramessage.ExtraMessage{PaxosAccept: accept})
+			}
+
+			timer := time.NewTimer(retry)
+			select {
+			case <-timer.C:
+				// Maybe somebody else took over, prepare again
+				m.mutex.Lock()
+				m.leadingID = -1
+				m.mutex.Unlock()
+				continue
+			case <-chanMajority:
+			case <-chanEnd:
+			}
+			timer.Stop()
+			return
+		}
+	}()
+}
+
+func (m *MultiPaxos) handle(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if msg.PaxosPrepare != nil {
+		promise := m.promiseLocked(msg.PaxosPrepare)
+		if promise != nil {
+			g.AddExtraMessage(&extramessage.ExtraMessage{PaxosPromise: promise})
+		}
+	} else if msg.PaxosPromise != nil {
+		m.uponPaxosPromiseLocked(msg.PaxosPromise)
+	} else if msg.PaxosPropose != nil {
+		accept := m.acceptLocked(msg.PaxosPropose)
+		if accept != nil {
+			g.AddExtraMessage(&extramessage.ExtraMessage{PaxosAccept: accept})
+		}
+	} else if msg.PaxosAccept != nil {
+		return m.uponPaxosAcceptLocked(msg.PaxosAccept)
+	}
+	return nil
+}
+
+// --- Phase 1 ---
+
+// promiseLocked returns the promise answering a prepare, or nil when the
+// prepare is ignored
+func (m *MultiPaxos) promiseLocked(msg *extramessage.PaxosPrepare) *extramessage.PaxosPromise {
+	if msg.PaxosSeqID != m.paxosSequenceID || msg.ID <= m.promisedID {
+		return nil
+	}
+	if msg.ID%m.numParticipant != m.leaderID%m.numParticipant && m.leaseHeld(time.Now()) {
+		return nil
+	}
+
+	m.promisedID = msg.ID
+	m.heardFrom(msg.ID)
+	if !m.persistLocked() {
+		return nil
+	}
+	return &extramessage.PaxosPromise{
+		PaxosSeqID: m.paxosSequenceID,
+		IDp:        msg.ID,
+		AcceptorID: m.nodeIndex,
+		IDa:        m.latestAcceptedID,
+		Value:      m.latestAcceptedValue,
+	}
+}
+
+func (m *MultiPaxos) uponPaxosPromiseLocked(msg *extramessage.PaxosPromise) {
+	if msg.PaxosSeqID != m.paxosSequenceID || msg.IDp != m.proposedID || m.state != stateAwaitPromise {
+		if msg.PaxosSeqID < m.paxosSequenceID ||
+			msg.PaxosSeqID == m.paxosSequenceID && msg.IDp%m.numParticipant == m.nodeIndex {
+			// A promise for a block or one of our proposals which is over
+			m.metrics.staleVote()
+		}
+		return
+	}
+	if !validAcceptor(msg.AcceptorID, m.numParticipant) || !vote(m.promisers, msg.AcceptorID, m.metrics) {
+		return
+	}
+
+	if !msg.Value.IsContentNil() && msg.IDa > m.valueID {
+		m.value = msg.Value
+		m.valueID = msg.IDa
+	}
+	if len(m.promisers) >= m.numParticipant/2+1 {
+		m.state = stateAwaitAccept
+		m.signalMajority()
+	}
+}
+
+// --- Phase 2 ---
+
+// acceptLocked returns the accept answering a propose, or nil when the
+// propose is refused
+func (m *MultiPaxos) acceptLocked(msg *extramessage.PaxosPropose) *extramessage.PaxosAccept {
+	if msg.PaxosSeqID != m.paxosSequenceID || msg.ID < m.promisedID {
+		return nil
+	}
+
+	m.promisedID = msg.ID
+	m.heardFrom(msg.ID)
+	m.latestAcceptedID = msg.ID
+	m.latestAcceptedValue = msg.Value
+	if !m.persistLocked() {
+		return nil
+	}
+	return &extramessage.PaxosAccept{
+		PaxosSeqID: msg.PaxosSeqID,
+		ID:         msg.ID,
+		AcceptorID: m.nodeIndex,
+		Value:      msg.Value,
+	}
+}
+
+func (m *MultiPaxos) uponPaxosAcceptLocked(msg *extramessage.PaxosAccept) *blk.BlockContainer {
+	if msg.PaxosSeqID < m.paxosSequenceID || msg.PaxosSeqID == m.paxosSequenceID && m.decided {
+		m.metrics.staleVote()
+		return nil
+	}
+	if msg.PaxosSeqID != m.paxosSequenceID || !validAcceptor(msg.AcceptorID, m.numParticipant) {
+		return nil
+	}
+
+	acceptors, ok := m.learnerData[msg.ID]
+	if !ok {
+		acceptors = make(map[int]bool)
+		m.learnerData[msg.ID] = acceptors
+	}
+	if !vote(acceptors, msg.AcceptorID, m.metrics) || len(acceptors) < m.numParticipant/2+1 {
+		return nil
+	}
+
+	m.decided = true
+	m.heardFrom(msg.ID)
+	if msg.ID == m.proposedID && m.state == stateAwaitAccept {
+		m.state = stateConsensus
+		m.signalMajority()
+	}
+	return msg.Value
+}
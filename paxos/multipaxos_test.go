@@ -0,0 +1,166 @@
+package paxos
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+type testNode struct {
+	sync.Mutex
+	gossiper *gossip.Gossiper
+	chain    *BlockChain
+	decided  chan *blk.BlockContainer
+	prepares map[int]int
+	// ignores the messages, as if it missed them
+	deaf bool
+	// handles every message twice, as if the gossip delivered it again
+	replay bool
+	// closed once the gossiper stopped handling the messages
+	stopped chan struct{}
+}
+
+// createChains creates n nodes, keeping their state in the given stores or in
+// memory if stores is nil
+func createChains(t *testing.T, n int, mode Mode, stores []Store) []*testNode {
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	nodes := make([]*testNode, n)
+	addresses := make([]string, n)
+	for i := range nodes {
+		g, err := fac.New("", fmt.Sprintf("node%d", i), 10, 0, n)
+		require.NoError(t, err)
+
+		var store Store = NewMemoryStore()
+		if stores != nil {
+			store = stores[i]
+		}
+
+		node := &testNode{
+			gossiper: g,
+			chain:    NewBlockchain(n, i, 1, blk.NewGenericBlockFactory(), mode, store),
+			decided:  make(chan *blk.BlockContainer, 10),
+			prepares: make(map[int]int),
+			stopped:  make(chan struct{}),
+		}
+		g.RegisterCallback(func(origin string, msg gossip.GossipPacket) {
+			if msg.Rumor == nil || msg.Rumor.Extra == nil {
+				return
+			}
+			node.Lock()
+			defer node.Unlock()
+			if node.deaf {
+				return
+			}
+			if msg.Rumor.Extra.PaxosPrepare != nil {
+				node.prepares[msg.Rumor.Extra.PaxosPrepare.PaxosSeqID]++
+			}
+			block := node.chain.HandleExtraMessage(node.gossiper, msg.Rumor.Extra)
+			if block != nil {
+				node.decided <- block
+			}
+			if node.replay {
+				block = node.chain.HandleExtraMessage(node.gossiper, msg.Rumor.Extra.Copy())
+				if block != nil {
+					node.decided <- block
+				}
+			}
+		})
+		nodes[i] = node
+		addresses[i] = g.GetLocalAddr()
+	}
+
+	for i, node := range nodes {
+		for j, address := range addresses {
+			if i != j {
+				node.gossiper.AddAddresses(address)
+			}
+		}
+		ready := make(chan struct{})
+		go func(node *testNode) {
+			node.gossiper.Run(ready)
+			close(node.stopped)
+		}(node)
+		<-ready
+	}
+	return nodes
+}
+
+// stopChains stops the gossipers and waits until no callback runs anymore
+func stopChains(nodes []*testNode) {
+	for _, node := range nodes {
+		node.gossiper.Stop()
+	}
+	for _, node := range nodes {
+		<-node.stopped
+	}
+}
+
+func waitBlock(t *testing.T, nodes []*testNode, blockNumber int) {
+	for _, node := range nodes {
+		select {
+		case block := <-node.decided:
+			require.Equal(t, blockNumber, block.BlockNumber())
+		case <-time.After(10 * time.Second):
+			t.Fatalf("block %d not decided", blockNumber)
+		}
+	}
+}
+
+func TestMultiPaxos_StableLeader(t *testing.T) {
+	nodes := createChains(t, 3, ModeMultiPaxos, nil)
+	defer stopChains(nodes)
+
+	for blockNumber := 0; blockNumber < 3; blockNumber++ {
+		nodes[0].Lock()
+		nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{
+			PatternID: "pattern",
+			Paths:     [][]r3.Vec{{{X: float64(blockNumber)}}},
+		})
+		nodes[0].Unlock()
+		waitBlock(t, nodes, blockNumber)
+	}
+
+	// Only the first block needed a phase 1
+	for _, node := range nodes[1:] {
+		node.Lock()
+		require.Equal(t, map[int]int{0: 1}, node.prepares)
+		node.Unlock()
+	}
+	require.True(t, nodes[0].chain.multiPaxos.IsLeader())
+
+	// The chains agree
+	tail, blocks := nodes[0].chain.GetBlocks()
+	for _, node := range nodes[1:] {
+		node.Lock()
+		otherTail, otherBlocks := node.chain.GetBlocks()
+		node.Unlock()
+		require.Equal(t, tail, otherTail)
+		require.Len(t, otherBlocks, len(blocks))
+	}
+}
+
+func TestMultiPaxos_Lease(t *testing.T) {
+	nodes := createChains(t, 3, ModeMultiPaxos, nil)
+	defer stopChains(nodes)
+
+	nodes[0].Lock()
+	nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "first"})
+	nodes[0].Unlock()
+	waitBlock(t, nodes, 0)
+
+	// Another node waits for the lease of the leader to expire before taking
+	// over
+	start := time.Now()
+	nodes[1].Lock()
+	nodes[1].chain.Propose(nodes[1].gossiper, &blk.PathBlockContent{PatternID: "second"})
+	nodes[1].Unlock()
+	waitBlock(t, nodes, 1)
+	require.True(t, nodes[1].chain.multiPaxos.IsLeader())
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Second))
+}
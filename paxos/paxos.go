@@ -1,6 +1,7 @@
 package paxos
 
 import (
+	"sync"
 	"time"
 
 	"go.dedis.ch/cs438/orbitalswarm/extramessage"
@@ -18,6 +19,9 @@ const (
 
 // Paxos data structure
 type Paxos struct {
+	// guards the state against the retries of the proposer
+	mutex sync.Mutex
+
 	// base config
 	paxosSequenceID int
 	nodeIndex       int
@@ -31,9 +35,11 @@ type Paxos struct {
 	// Proposal
 	proposedID   int
 	state        int
-	count        int
 	value        *blk.BlockContainer
 	chanMajority chan bool
+	// acceptors which promised to promisedFor
+	promisers   map[int]bool
+	promisedFor int
 
 	// chain BlockChain
 	blockFactory        blk.BlockFactory
@@ -43,17 +49,23 @@ type Paxos struct {
 	latestAcceptedValue *blk.BlockContainer
 
 	learnerCount int
-	learnerData  map[int]int
+	// ID -> acceptors which accepted it
+	learnerData map[int]map[int]bool
+
+	store   Store
+	metrics *VoteMetrics
 
 	// stop
 	chanEnd chan bool
 }
 
-// NewPaxos create a new paxos
-func NewPaxos(paxosSequenceID int, numParticipant int, nodeIndex int, paxosRetry int, blockFactory blk.BlockFactory) *Paxos {
+// NewPaxos create a new paxos. It resumes with the acceptor state saved in
+// the store if it is of the same instance. The votes which do not count are
+// reported to metrics.
+func NewPaxos(paxosSequenceID int, numParticipant int, nodeIndex int, paxosRetry int, blockFactory blk.BlockFactory, store Store, metrics *VoteMetrics) *Paxos {
 	seqGen := newSeqGen(nodeIndex, numParticipant)
 
-	return &Paxos{
+	p := &Paxos{
 		paxosSequenceID: paxosSequenceID,
 		nodeIndex:       nodeIndex,
 		numParticipant:  numParticipant,
@@ -64,9 +76,10 @@ func NewPaxos(paxosSequenceID int, numParticipant int, nodeIndex int, paxosRetry
 
 		proposedID:   -1,
 		state:        stateNoProposal,
-		count:        0,
 		value:        nil,
-		chanMajority: make(chan bool),
+		chanMajority: make(chan bool, 1),
+		promisers:    make(map[int]bool),
+		promisedFor:  -1,
 
 		blockFactory:        blockFactory,
 		latestPrepareID:     -1,
@@ -74,22 +87,64 @@ func NewPaxos(paxosSequenceID int, numParticipant int, nodeIndex int, paxosRetry
 		latestAcceptedValue: blockFactory.NewEmptyBlock(),
 
 		learnerCount: 0,
-		learnerData:  make(map[int]int),
+		learnerData:  make(map[int]map[int]bool),
+
+		store:   store,
+		metrics: metrics,
 
 		chanEnd: make(chan bool),
 	}
+
+	state, ok := store.Acceptor()
+	if ok && state.PaxosSeqID == paxosSequenceID {
+		seqGen.skip(state.ProposedID)
+		p.latestPrepareID = state.PromisedID
+		p.latestAcceptedID = state.AcceptedID
+		if state.AcceptedValue != nil {
+			p.latestAcceptedValue = state.AcceptedValue
+		}
+	}
+	return p
+}
+
+// persist saves the acceptor state, the replies depending on it must only be
+// sent once it succeeded
+func (p *Paxos) persist() bool {
+	err := p.store.SaveAcceptor(AcceptorState{
+		PaxosSeqID:    p.paxosSequenceID,
+		ProposedID:    p.proposedID,
+		PromisedID:    p.latestPrepareID,
+		AcceptedID:    p.latestAcceptedID,
+		AcceptedValue: p.latestAcceptedValue,
+	})
+	if err != nil {
+		log.Printf("Unable to persist the acceptor state: %s", err)
+		return false
+	}
+	return true
 }
 
 func (p *Paxos) propose(g *gossip.Gossiper, block *blk.BlockContainer) {
 	go func() {
 		// log.Printf("%s Call Propose value %s", g.identifier, block.Filename)
+		p.mutex.Lock()
 		if p.value == nil {
 			p.value = block
 		}
+		p.mutex.Unlock()
 		for {
+			p.mutex.Lock()
+			p.drainLocked()
 			id := p.idGenerator.GetNext()
 			p.proposedID = id
 			p.state = stateAwaitPromise
+			p.promiseSelf(id)
+			// A restarted node must not reuse the ID with another value
+			persisted := p.persist()
+			p.mutex.Unlock()
+			if !persisted {
+				return
+			}
 
 			// log.Printf("%s Propose value %s", g.identifier, p.value.Filename)
 
@@ -122,13 +177,14 @@ func (p *Paxos) propose(g *gossip.Gossiper, block *blk.BlockContainer) {
 
 			// Phase 2
 			log.Printf("Enter phase 2")
-			g.AddExtraMessage(&extramessage.ExtraMessage{
-				PaxosPropose: &extramessage.PaxosPropose{
-					PaxosSeqID: p.paxosSequenceID,
-					ID:         id,
-					Value:      p.value,
-				},
-			})
+			p.mutex.Lock()
+			propose := &extramessage.PaxosPropose{
+				PaxosSeqID: p.paxosSequenceID,
+				ID:         id,
+				Value:      p.value,
+			}
+			p.mutex.Unlock()
+			g.AddExtraMessage(&extramessage.ExtraMessage{PaxosPropose: propose})
 
 			// Create timer
 			timer = time.NewTimer(time.Duration(p.paxosRetry) * time.Second)
@@ -148,6 +204,55 @@ func (p *Paxos) propose(g *gossip.Gossiper, block *blk.BlockContainer) {
 	}()
 }
 
+// promiseSelf counts the promise of the proposer to its own prepare, as its
+// gossip does not deliver it back. It must be called before the prepare is
+// sent.
+func (p *Paxos) promiseSelf(id int) {
+	p.promisers = map[int]bool{p.nodeIndex: true}
+	p.promisedFor = id
+	if p.latestPrepareID < id && p.latestAcceptedID == -1 {
+		p.latestPrepareID = id
+	} else if !p.latestAcceptedValue.IsContentNil() {
+		p.value = p.latestAcceptedValue
+	}
+}
+
+// acceptSelf accepts the own proposal of the proposer once it has a majority
+// of promises, and returns the accept to send to the learners, or nil if a
+// higher prepare was promised meanwhile
+func (p *Paxos) acceptSelf(id int) *extramessage.PaxosAccept {
+	if id < p.latestPrepareID {
+		return nil
+	}
+	p.latestAcceptedID = id
+	p.latestAcceptedValue = p.value
+	if !p.persist() {
+		return nil
+	}
+	p.learnerData[id] = map[int]bool{p.nodeIndex: true}
+	return &extramessage.PaxosAccept{
+		PaxosSeqID: p.paxosSequenceID,
+		ID:         id,
+		AcceptorID: p.nodeIndex,
+		Value:      p.value,
+	}
+}
+
+// drainLocked drops the majority signalled for a previous round
+func (p *Paxos) drainLocked() {
+	select {
+	case <-p.chanMajority:
+	default:
+	}
+}
+
+func (p *Paxos) signalMajority() {
+	select {
+	case p.chanMajority <- true:
+	default:
+	}
+}
+
 func (p *Paxos) stop() {
 	defer func() {
 		recover()
@@ -156,6 +261,8 @@ func (p *Paxos) stop() {
 }
 
 func (p *Paxos) handle(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	// log.Printf("MANAGE handle")
 
 	// Upon promise
@@ -188,11 +295,15 @@ func (p *Paxos) uponPaxosPrepare(g *gossip.Gossiper, msg *extramessage.PaxosPrep
 		// send response back to the sender
 		// log.Printf("Accept prepare %d vs %d", msg.PaxosSeqID, p.paxosSequenceID)
 		p.latestPrepareID = msg.ID
+		if !p.persist() {
+			return
+		}
 		if p.proposedID != msg.ID {
 			g.AddExtraMessage(&extramessage.ExtraMessage{
 				PaxosPromise: &extramessage.PaxosPromise{
 					PaxosSeqID: p.paxosSequenceID,
 					IDp:        msg.ID,
+					AcceptorID: p.nodeIndex,
 					IDa:        -1,
 					Value:      p.blockFactory.NewEmptyBlock(),
 				},
@@ -204,6 +315,7 @@ func (p *Paxos) uponPaxosPrepare(g *gossip.Gossiper, msg *extramessage.PaxosPrep
 			PaxosPromise: &extramessage.PaxosPromise{
 				PaxosSeqID: p.paxosSequenceID,
 				IDp:        msg.ID,
+				AcceptorID: p.nodeIndex,
 				IDa:        p.latestAcceptedID,
 				Value:      p.latestAcceptedValue,
 			},
@@ -214,21 +326,38 @@ func (p *Paxos) uponPaxosPrepare(g *gossip.Gossiper, msg *extramessage.PaxosPrep
 func (p *Paxos) uponPaxosPromise(g *gossip.Gossiper, msg *extramessage.PaxosPromise) {
 	if msg.PaxosSeqID != p.paxosSequenceID {
 		// log.Printf("Discarded promise %d vs %d", msg.PaxosSeqID, p.paxosSequenceID)
+		if msg.PaxosSeqID < p.paxosSequenceID {
+			p.metrics.staleVote()
+		}
 		return // Discard
 	}
+	if !validAcceptor(msg.AcceptorID, p.numParticipant) {
+		return
+	}
 
 	if msg.IDp == p.proposedID && p.state == stateAwaitPromise {
-		p.count++
+		if msg.IDp != p.promisedFor {
+			p.promisers = make(map[int]bool)
+			p.promisedFor = msg.IDp
+		}
+		if !vote(p.promisers, msg.AcceptorID, p.metrics) {
+			return
+		}
 		if !msg.Value.IsContentNil() {
 			p.value = msg.Value
 		}
 
-		if p.count > p.numParticipant/2+1 {
+		if len(p.promisers) >= p.numParticipant/2+1 {
 			// next phase
-			p.count = 0
 			p.state = stateAwaitAccept
-			p.chanMajority <- true
+			if accept := p.acceptSelf(msg.IDp); accept != nil {
+				g.AddExtraMessage(&extramessage.ExtraMessage{PaxosAccept: accept})
+			}
+			p.signalMajority()
 		}
+	} else if msg.IDp%p.numParticipant == p.nodeIndex {
+		// A promise for one of our proposals which is over
+		p.metrics.staleVote()
 	}
 }
 
@@ -244,6 +373,9 @@ func (p *Paxos) uponPaxosPropose(g *gossip.Gossiper, msg *extramessage.PaxosProp
 	if msg.ID >= p.latestPrepareID {
 		p.latestAcceptedID = msg.ID
 		p.latestAcceptedValue = msg.Value
+		if !p.persist() {
+			return
+		}
 
 		if p.proposedID != msg.ID {
 			// Send to all an accept response
@@ -251,6 +383,7 @@ func (p *Paxos) uponPaxosPropose(g *gossip.Gossiper, msg *extramessage.PaxosProp
 				PaxosAccept: &extramessage.PaxosAccept{
 					PaxosSeqID: msg.PaxosSeqID,
 					ID:         msg.ID,
+					AcceptorID: p.nodeIndex,
 					Value:      msg.Value,
 				},
 			})
@@ -261,23 +394,30 @@ func (p *Paxos) uponPaxosPropose(g *gossip.Gossiper, msg *extramessage.PaxosProp
 func (p *Paxos) uponPaxosAccept(g *gossip.Gossiper, msg *extramessage.PaxosAccept) *blk.BlockContainer {
 	if msg.PaxosSeqID != p.paxosSequenceID {
 		//log.Printf("Discarded accept %d vs %d", msg.PaxosSeqID, p.paxosSequenceID)
+		if msg.PaxosSeqID < p.paxosSequenceID {
+			p.metrics.staleVote()
+		}
 		return nil // Discard
 	}
+	if !validAcceptor(msg.AcceptorID, p.numParticipant) {
+		return nil
+	}
 
-	count, ok := p.learnerData[msg.ID]
+	acceptors, ok := p.learnerData[msg.ID]
 	if !ok {
-		count = 1
-	} else {
-		count++
+		acceptors = make(map[int]bool)
+		p.learnerData[msg.ID] = acceptors
+	}
+	if !vote(acceptors, msg.AcceptorID, p.metrics) {
+		return nil
 	}
-	p.learnerData[msg.ID] = count
 
 	// > or >= ??
-	if count >= p.numParticipant/2+1 {
+	if len(acceptors) >= p.numParticipant/2+1 {
 		p.acceptedCount = 0
 		if msg.ID == p.proposedID && p.state == stateAwaitAccept {
 			p.state = stateConsensus
-			p.chanMajority <- true
+			p.signalMajority()
 			close(p.chanEnd)
 		}
 		return msg.Value
@@ -0,0 +1,283 @@
+package paxos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"golang.org/x/xerrors"
+)
+
+// AcceptorState is what a node promised and accepted in a Paxos instance. An
+// acceptor forgetting it on restart could break its promises.
+type AcceptorState struct {
+	PaxosSeqID int
+	// highest ID the node proposed, its next IDs are higher
+	ProposedID    int
+	PromisedID    int
+	AcceptedID    int
+	AcceptedValue *blk.BlockContainer
+}
+
+// Store keeps the state of a node across restarts. A write is durable once
+// the call returns.
+type Store interface {
+	// SaveAcceptor replaces the acceptor state
+	SaveAcceptor(state AcceptorState) error
+	// AppendBlock adds a decided block at the end of the chain
+	AppendBlock(block *blk.BlockContainer) error
+	// Acceptor returns the last saved acceptor state, if any
+	Acceptor() (AcceptorState, bool)
+	// Blocks returns the chain, from the genesis block to the tail
+	Blocks() []*blk.BlockContainer
+	Close() error
+}
+
+// MemoryStore keeps the state in memory, it survives the restart of a
+// blockchain but not of the process
+//
+// - implements paxos.Store
+type MemoryStore struct {
+	sync.Mutex
+	acceptor *AcceptorState
+	blocks   []*blk.BlockContainer
+}
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blocks: make([]*blk.BlockContainer, 0),
+	}
+}
+
+// SaveAcceptor implements paxos.Store
+func (s *MemoryStore) SaveAcceptor(state AcceptorState) error {
+	s.Lock()
+	defer s.Unlock()
+	s.acceptor = &state
+	return nil
+}
+
+// AppendBlock implements paxos.Store
+func (s *MemoryStore) AppendBlock(block *blk.BlockContainer) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := checkNext(s.blocks, block); err != nil {
+		return err
+	}
+	s.blocks = append(s.blocks, block)
+	return nil
+}
+
+// Acceptor implements paxos.Store
+func (s *MemoryStore) Acceptor() (AcceptorState, bool) {
+	s.Lock()
+	defer s.Unlock()
+	if s.acceptor == nil {
+		return AcceptorState{}, false
+	}
+	return *s.acceptor, true
+}
+
+// Blocks implements paxos.Store
+func (s *MemoryStore) Blocks() []*blk.BlockContainer {
+	s.Lock()
+	defer s.Unlock()
+	return append([]*blk.BlockContainer{}, s.blocks...)
+}
+
+// Close implements paxos.Store
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// record is a line of the write-ahead log of a FileStore
+type record struct {
+	Acceptor *AcceptorState      `json:",omitempty"`
+	Block    *blk.BlockContainer `json:",omitempty"`
+}
+
+// FileStore keeps the state in a write-ahead log, one JSON record per line.
+// Every record is synced to the disk before the write returns. The log is
+// compacted when the store is opened, and a record torn by a crash at the end
+// of the log is dropped.
+//
+// - implements paxos.Store
+type FileStore struct {
+	MemoryStore
+	path string
+	file *os.File
+}
+
+// NewFileStore opens the log at the given path, creating it if needed, and
+// loads the state it holds
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: MemoryStore{blocks: make([]*blk.BlockContainer, 0)},
+		path:        path,
+	}
+	if err := s.load(); err != nil {
+		return nil, xerrors.Errorf("failed to load %s: %v", path, err)
+	}
+	if err := s.compact(); err != nil {
+		return nil, xerrors.Errorf("failed to compact %s: %v", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	return s, nil
+}
+
+func (s *FileStore) load() error {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(data))
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Either the end of the log, or a record torn by a crash
+			return nil
+		}
+
+		var rec record
+		if json.Unmarshal(line, &rec) != nil {
+			if reader.Buffered() == 0 {
+				// Torn record at the end of the log
+				return nil
+			}
+			return xerrors.Errorf("corrupted record %q", line)
+		}
+		if rec.Acceptor != nil {
+			s.acceptor = rec.Acceptor
+		}
+		if rec.Block != nil {
+			if err := checkNext(s.blocks, rec.Block); err != nil {
+				return err
+			}
+			s.blocks = append(s.blocks, rec.Block)
+		}
+	}
+}
+
+// compact rewrites the log with only the current state, and replaces the old
+// one atomically
+func (s *FileStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	records := make([]record, 0, len(s.blocks)+1)
+	for _, block := range s.blocks {
+		records = append(records, record{Block: block})
+	}
+	if s.acceptor != nil {
+		records = append(records, record{Acceptor: s.acceptor})
+	}
+	for _, rec := range records {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(s.path))
+}
+
+// SaveAcceptor implements paxos.Store
+func (s *FileStore) SaveAcceptor(state AcceptorState) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.write(record{Acceptor: &state}); err != nil {
+		return err
+	}
+	s.acceptor = &state
+	return nil
+}
+
+// AppendBlock implements paxos.Store
+func (s *FileStore) AppendBlock(block *blk.BlockContainer) error {
+	s.Lock()
+	defer s.Unlock()
+	if err := checkNext(s.blocks, block); err != nil {
+		return err
+	}
+	if err := s.write(record{Block: block}); err != nil {
+		return err
+	}
+	s.blocks = append(s.blocks, block)
+	return nil
+}
+
+// Close implements paxos.Store
+func (s *FileStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileStore) write(rec record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+// checkNext checks that the block follows the given chain
+func checkNext(blocks []*blk.BlockContainer, block *blk.BlockContainer) error {
+	if block.Block == nil {
+		return xerrors.New("block without content")
+	}
+	if block.BlockNumber() != len(blocks) {
+		return xerrors.Errorf("block %d does not follow block %d", block.BlockNumber(), len(blocks)-1)
+	}
+	if len(blocks) > 0 && !bytes.Equal(block.PreviousHash(), blocks[len(blocks)-1].Hash()) {
+		return xerrors.Errorf("block %d does not link to the previous block", block.BlockNumber())
+	}
+	return nil
+}
+
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,138 @@
+package paxos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+)
+
+func TestFileStore_Reload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "node0.wal")
+
+	factory := blk.NewGenericBlockFactory()
+	genesis := factory.NewGenesisBlock(blk.BlockPathStr, 0, &blk.PathBlockContent{PatternID: "first"})
+	second := factory.NewBlock(blk.BlockPathStr, 1, genesis.Hash(), &blk.PathBlockContent{PatternID: "second"})
+
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, store.AppendBlock(genesis))
+	require.NoError(t, store.SaveAcceptor(AcceptorState{PaxosSeqID: 1, ProposedID: -1, PromisedID: 3, AcceptedID: -1}))
+	require.NoError(t, store.SaveAcceptor(AcceptorState{PaxosSeqID: 1, ProposedID: -1, PromisedID: 3, AcceptedID: 3, AcceptedValue: second}))
+	require.NoError(t, store.AppendBlock(second))
+	require.NoError(t, store.Close())
+
+	// A crash tore the last record
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"Acceptor":{"PaxosSeqID":2,"Prom`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	store, err = NewFileStore(path)
+	require.NoError(t, err)
+	defer store.Close()
+
+	blocks := store.Blocks()
+	require.Len(t, blocks, 2)
+	require.Equal(t, genesis.Hash(), blocks[0].Hash())
+	require.Equal(t, second.Hash(), blocks[1].Hash())
+
+	state, ok := store.Acceptor()
+	require.True(t, ok)
+	require.Equal(t, 3, state.PromisedID)
+	require.Equal(t, second.Hash(), state.AcceptedValue.Hash())
+
+	// The log was compacted to the blocks and the last acceptor state
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, 3, strings.Count(string(data), "\n"))
+}
+
+func TestFileStore_BrokenChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(filepath.Join(dir, "node0.wal"))
+	require.NoError(t, err)
+	defer store.Close()
+
+	factory := blk.NewGenericBlockFactory()
+	genesis := factory.NewGenesisBlock(blk.BlockPathStr, 0, &blk.PathBlockContent{PatternID: "first"})
+	require.Error(t, store.AppendBlock(factory.NewBlock(blk.BlockPathStr, 1, genesis.Hash(), &blk.PathBlockContent{})))
+	require.NoError(t, store.AppendBlock(genesis))
+	require.Error(t, store.AppendBlock(factory.NewBlock(blk.BlockPathStr, 1, make([]byte, 32), &blk.PathBlockContent{})))
+}
+
+func TestPaxos_KeepsPromise(t *testing.T) {
+	store := NewMemoryStore()
+	require.NoError(t, store.SaveAcceptor(AcceptorState{PaxosSeqID: 0, ProposedID: 4, PromisedID: 5, AcceptedID: -1}))
+
+	// The acceptor restarts with its promise, and the proposer with IDs it
+	// did not use yet
+	p := NewPaxos(0, 3, 1, 1, blk.NewGenericBlockFactory(), store, nil)
+	require.Equal(t, 5, p.latestPrepareID)
+	require.Equal(t, 7, p.idGenerator.GetNext())
+
+	// The state of another instance is ignored
+	p = NewPaxos(1, 3, 1, 1, blk.NewGenericBlockFactory(), store, nil)
+	require.Equal(t, -1, p.latestPrepareID)
+	require.Equal(t, 1, p.idGenerator.GetNext())
+}
+
+func TestBlockchain_Restart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	n := 3
+	openStores := func() []Store {
+		stores := make([]Store, n)
+		for i := range stores {
+			store, err := NewFileStore(filepath.Join(dir, fmt.Sprintf("node%d.wal", i)))
+			require.NoError(t, err)
+			stores[i] = store
+		}
+		return stores
+	}
+	stop := func(nodes []*testNode, stores []Store) {
+		// No handler may write to a store once it is closed
+		stopChains(nodes)
+		for _, store := range stores {
+			require.NoError(t, store.Close())
+		}
+	}
+
+	stores := openStores()
+	nodes := createChains(t, n, ModePaxos, stores)
+	nodes[0].Lock()
+	nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "first"})
+	nodes[0].Unlock()
+	waitBlock(t, nodes, 0)
+	tail, _ := nodes[0].chain.GetBlocks()
+	stop(nodes, stores)
+
+	// The nodes reload the chain and agree on the next block
+	stores = openStores()
+	nodes = createChains(t, n, ModePaxos, stores)
+	defer stop(nodes, stores)
+	for _, node := range nodes {
+		reloaded, blocks := node.chain.GetBlocks()
+		require.Equal(t, tail, reloaded)
+		require.Len(t, blocks, 1)
+	}
+
+	nodes[1].Lock()
+	nodes[1].chain.Propose(nodes[1].gossiper, &blk.PathBlockContent{PatternID: "second"})
+	nodes[1].Unlock()
+	waitBlock(t, nodes, 1)
+}
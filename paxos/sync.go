@@ -0,0 +1,200 @@
+package paxos
+
+import (
+	"bytes"
+	"encoding/hex"
+	"time"
+
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/onet/v3/log"
+)
+
+// maxSyncBlocks is the maximum number of blocks sent in a single SyncResponse
+const maxSyncBlocks = 16
+
+// blockNumberOf returns the number of the block a consensus message is about,
+// or -1
+func blockNumberOf(msg *extramessage.ExtraMessage) int {
+	switch {
+	case msg.PaxosPrepare != nil:
+		return msg.PaxosPrepare.PaxosSeqID
+	case msg.PaxosPromise != nil:
+		return msg.PaxosPromise.PaxosSeqID
+	case msg.PaxosPropose != nil:
+		return msg.PaxosPropose.PaxosSeqID
+	case msg.PaxosAccept != nil:
+		return msg.PaxosAccept.PaxosSeqID
+	case msg.PaxosTLC != nil && msg.PaxosTLC.Value != nil && msg.PaxosTLC.Value.Block != nil:
+		return msg.PaxosTLC.Value.BlockNumber()
+	}
+	return -1
+}
+
+// requestSync advertises the tail of the chain so that the others send the
+// following blocks. It is sent at most once per retry period.
+func (b *BlockChain) requestSync(g *gossip.Gossiper) {
+	now := time.Now()
+	if now.Sub(b.lastSync) < time.Duration(b.paxosRetry)*time.Second {
+		return
+	}
+	b.lastSync = now
+
+	req := &extramessage.SyncRequest{BlockNumber: 0}
+	if b.tail != nil {
+		req.BlockNumber = b.tail.BlockNumber() + 1
+		req.TailHash = b.tail.Hash()
+	}
+	log.Printf("%s requests the blocks from %d", g.GetIdentifier(), req.BlockNumber)
+	g.AddExtraMessage(&extramessage.ExtraMessage{SyncRequest: req})
+}
+
+// uponSyncRequest sends the blocks following the tail of the requester, if
+// its tail is in our chain
+func (b *BlockChain) uponSyncRequest(g *gossip.Gossiper, req *extramessage.SyncRequest) {
+	if b.tail == nil || req.BlockNumber < 0 || req.BlockNumber > b.tail.BlockNumber() {
+		return
+	}
+
+	// Walk the chain back to the first block the requester lacks
+	blocks := make([]*blk.BlockContainer, 0)
+	block := b.tail
+	for block != nil && block.BlockNumber() >= req.BlockNumber {
+		blocks = append(blocks, block)
+		block = b.blocks[hex.EncodeToString(block.PreviousHash())]
+	}
+	first := blocks[len(blocks)-1]
+	if first.BlockNumber() != req.BlockNumber ||
+		(req.BlockNumber > 0 && !bytes.Equal(first.PreviousHash(), req.TailHash)) {
+		return
+	}
+
+	resp := &extramessage.SyncResponse{NodeIndex: b.nodeIndex, Blocks: make([]*blk.BlockContainer, 0, maxSyncBlocks)}
+	for i := len(blocks) - 1; i >= 0 && len(resp.Blocks) < maxSyncBlocks; i-- {
+		resp.Blocks = append(resp.Blocks, blocks[i])
+	}
+	g.AddExtraMessage(&extramessage.ExtraMessage{SyncResponse: resp})
+}
+
+// syncedBlock is a block received in the sync responses, with the members
+// which sent it
+type syncedBlock struct {
+	block *blk.BlockContainer
+	from  map[int]bool
+}
+
+// syncQuorum returns the number of members which must send the same block
+// before it is appended, so that a single node cannot forge the chain
+func (b *BlockChain) syncQuorum(blockNumber int) int {
+	return (len(b.membershipAt(blockNumber).members)-1)/2 + 1
+}
+
+// uponSyncResponse keeps the blocks following the tail, and appends them once
+// enough members sent the same ones. It returns the last block appended, if
+// any.
+func (b *BlockChain) uponSyncResponse(resp *extramessage.SyncResponse) *blk.BlockContainer {
+	next := 0
+	if b.tail != nil {
+		next = b.tail.BlockNumber() + 1
+	}
+	for _, block := range resp.Blocks {
+		if block == nil || block.Block == nil || block.IsContentNil() {
+			break
+		}
+		if block.BlockNumber() < next {
+			// Already known
+			continue
+		}
+		if block.BlockNumber() >= next+maxSyncBlocks {
+			break
+		}
+		if b.membershipAt(block.BlockNumber()).index(resp.NodeIndex) < 0 {
+			log.Printf("Discard synced block %d, node %d is not a member", block.BlockNumber(), resp.NodeIndex)
+			break
+		}
+
+		hash := hex.EncodeToString(block.Hash())
+		synced, ok := b.synced[hash]
+		if !ok {
+			synced = &syncedBlock{block: block, from: make(map[int]bool)}
+			b.synced[hash] = synced
+		}
+		synced.from[resp.NodeIndex] = true
+	}
+
+	var last *blk.BlockContainer
+	for {
+		block := b.nextSynced()
+		if block == nil {
+			break
+		}
+		b.appendBlock(block)
+		last = block
+	}
+
+	// Forget the blocks we know by now
+	next = 0
+	if b.tail != nil {
+		next = b.tail.BlockNumber() + 1
+	}
+	for hash, synced := range b.synced {
+		if synced.block.BlockNumber() < next {
+			delete(b.synced, hash)
+		}
+	}
+	return last
+}
+
+// nextSynced returns the synced block which follows the tail and was sent by
+// enough members, if any
+func (b *BlockChain) nextSynced() *blk.BlockContainer {
+	next := 0
+	previousHash := make([]byte, 32)
+	if b.tail != nil {
+		next = b.tail.BlockNumber() + 1
+		previousHash = b.tail.Hash()
+	}
+	for _, synced := range b.synced {
+		if synced.block.BlockNumber() == next && bytes.Equal(synced.block.PreviousHash(), previousHash) &&
+			len(synced.from) >= b.syncQuorum(next) {
+			return synced.block
+		}
+	}
+	return nil
+}
+
+// keepAhead keeps the block decided by a TLC message for a later block, to
+// append it once the missing blocks are synced
+func (b *BlockChain) keepAhead(msg *extramessage.ExtraMessage) {
+	number := blockNumberOf(msg)
+	if msg.PaxosTLC == nil || number > b.tlc.blockNumber+maxSyncBlocks {
+		return
+	}
+	b.ahead[number] = msg.PaxosTLC.Value.Copy()
+}
+
+// appendAhead appends the blocks kept which follow the tail. It returns the
+// last block appended, if any.
+func (b *BlockChain) appendAhead() *blk.BlockContainer {
+	var last *blk.BlockContainer
+	for {
+		next := b.tlc.blockNumber
+		for number := range b.ahead {
+			if number < next {
+				delete(b.ahead, number)
+			}
+		}
+		block, ok := b.ahead[next]
+		if !ok {
+			return last
+		}
+		delete(b.ahead, next)
+		if b.tail == nil || !bytes.Equal(block.PreviousHash(), b.tail.Hash()) {
+			log.Printf("Discard block %d decided ahead, it does not follow the chain", next)
+			return last
+		}
+		b.appendBlock(block)
+		last = block
+	}
+}
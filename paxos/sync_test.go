@@ -0,0 +1,79 @@
+package paxos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestSync_CatchUp(t *testing.T) {
+	nodes := createChains(t, 5, ModeMultiPaxos, nil)
+	defer stopChains(nodes)
+
+	// The last node misses the first blocks
+	lagging := nodes[4]
+	lagging.Lock()
+	lagging.deaf = true
+	lagging.Unlock()
+	for blockNumber := 0; blockNumber < 2; blockNumber++ {
+		nodes[0].Lock()
+		nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+		nodes[0].Unlock()
+		waitBlock(t, nodes[:4], blockNumber)
+	}
+
+	// It fetches them once it sees the others work on a later block
+	lagging.Lock()
+	lagging.deaf = false
+	lagging.Unlock()
+	nodes[0].Lock()
+	nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+	nodes[0].Unlock()
+	waitBlock(t, nodes[:4], 2)
+
+	tail, _ := nodes[0].chain.GetBlocks()
+	require.Eventually(t, func() bool {
+		lagging.Lock()
+		defer lagging.Unlock()
+		laggingTail, blocks := lagging.chain.GetBlocks()
+		return laggingTail == tail && len(blocks) == 3
+	}, 10*time.Second, 100*time.Millisecond)
+}
+
+func TestSync_Linkage(t *testing.T) {
+	factory := blk.NewGenericBlockFactory()
+	genesis := factory.NewGenesisBlock(blk.BlockPathStr, 0, &blk.PathBlockContent{PatternID: "first", Paths: [][]r3.Vec{}})
+	second := factory.NewBlock(blk.BlockPathStr, 1, genesis.Hash(), &blk.PathBlockContent{PatternID: "second", Paths: [][]r3.Vec{}})
+	forged := factory.NewBlock(blk.BlockPathStr, 1, make([]byte, 32), &blk.PathBlockContent{PatternID: "forged", Paths: [][]r3.Vec{}})
+
+	chain := NewBlockchain(3, 0, 1, factory, ModePaxos, NewMemoryStore())
+	defer chain.tlc.stop()
+
+	respond := func(nodeIndex int, blocks ...*blk.BlockContainer) *blk.BlockContainer {
+		return chain.HandleExtraMessage(nil, &extramessage.ExtraMessage{
+			SyncResponse: &extramessage.SyncResponse{NodeIndex: nodeIndex, Blocks: blocks},
+		})
+	}
+
+	// A block which does not follow the tail is discarded
+	require.Nil(t, respond(1, second))
+
+	// A block needs the same answer from a majority of the members
+	require.Nil(t, respond(1, genesis, forged))
+	require.Nil(t, respond(1, genesis, forged))
+	require.Nil(t, respond(5, genesis, forged))
+	require.Equal(t, genesis.Hash(), respond(2, genesis).Hash())
+	_, blocks := chain.GetBlocks()
+	require.Len(t, blocks, 1)
+
+	// Known blocks are skipped, the votes for the next ones are kept
+	require.Equal(t, second.Hash(), respond(2, genesis, second).Hash())
+	_, blocks = chain.GetBlocks()
+	require.Len(t, blocks, 2)
+	require.Equal(t, 2, chain.tlc.blockNumber)
+	require.Empty(t, chain.synced)
+}
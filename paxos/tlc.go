@@ -7,22 +7,38 @@ import (
 	"go.dedis.ch/onet/v3/log"
 )
 
+// instance agrees on the value of a single block
+type instance interface {
+	propose(g *gossip.Gossiper, block *blk.BlockContainer)
+	handle(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer
+	stop()
+}
+
 type TLC struct {
-	paxos          *Paxos
+	paxos          instance
 	numParticipant int
+	nodeIndex      int
 	blockNumber    int
 
-	tlcConfirmed int
-	block        *blk.BlockContainer
+	// nodes which confirmed the block
+	confirmed map[int]bool
+	block     *blk.BlockContainer
+	metrics   *VoteMetrics
 }
 
-func NewTLC(numParticipant int, nodeIndex int, paxosRetry int, blockNumber int, blockFactory blk.BlockFactory) *TLC {
+func NewTLC(numParticipant int, nodeIndex int, paxosRetry int, blockNumber int, blockFactory blk.BlockFactory, store Store, metrics *VoteMetrics) *TLC {
+	return newTLC(numParticipant, nodeIndex, blockNumber, NewPaxos(blockNumber, numParticipant, nodeIndex, paxosRetry, blockFactory, store, metrics), metrics)
+}
+
+func newTLC(numParticipant int, nodeIndex int, blockNumber int, paxos instance, metrics *VoteMetrics) *TLC {
 	return &TLC{
-		paxos:          NewPaxos(blockNumber, numParticipant, nodeIndex, paxosRetry, blockFactory),
+		paxos:          paxos,
 		numParticipant: numParticipant,
+		nodeIndex:      nodeIndex,
 		blockNumber:    blockNumber,
 
-		tlcConfirmed: 0,
+		confirmed: make(map[int]bool),
+		metrics:   metrics,
 	}
 }
 
@@ -39,11 +55,7 @@ func (t *TLC) handleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMess
 	if msg.PaxosTLC != nil {
 		if msg.PaxosTLC.Value.BlockNumber() == t.blockNumber {
 			// log.Printf("%s Consensus call ! %d", g.GetIdentifier(), t.block.BlockNumber())
-			t.tlcConfirmed++
-			if t.tlcConfirmed >= t.numParticipant/2+1 {
-				log.Printf("%s Consensus of consensus !", g.GetIdentifier())
-				return msg.PaxosTLC.Value
-			}
+			return t.confirm(g, msg.PaxosTLC)
 		}
 	} else {
 		block := t.paxos.handle(g, msg)
@@ -51,10 +63,27 @@ func (t *TLC) handleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMess
 		if block != nil {
 			g.AddExtraMessage(&extramessage.ExtraMessage{
 				PaxosTLC: &extramessage.PaxosTLC{
-					Value: block,
+					AcceptorID: t.nodeIndex,
+					Value:      block,
 				},
 			})
 		}
 	}
 	return nil
 }
+
+// confirm counts the confirmation of a node once, and returns the block when
+// a majority confirmed it
+func (t *TLC) confirm(g *gossip.Gossiper, msg *extramessage.PaxosTLC) *blk.BlockContainer {
+	if !validAcceptor(msg.AcceptorID, t.numParticipant) {
+		return nil
+	}
+	if !vote(t.confirmed, msg.AcceptorID, t.metrics) {
+		return nil
+	}
+	if len(t.confirmed) >= t.numParticipant/2+1 {
+		log.Printf("%s Consensus of consensus !", g.GetIdentifier())
+		return msg.Value
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package paxos
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+)
+
+// ChainFault tells how a chain is broken
+type ChainFault string
+
+const (
+	// FaultHashMismatch is a block stored under another hash than its own
+	FaultHashMismatch ChainFault = "hash mismatch"
+	// FaultMissingBlock is a gap in the block numbers
+	FaultMissingBlock ChainFault = "missing block"
+	// FaultDuplicateBlock is a second block with the same number
+	FaultDuplicateBlock ChainFault = "duplicate block"
+	// FaultBrokenLink is a block whose previous hash is not the hash of the
+	// previous block
+	FaultBrokenLink ChainFault = "broken link"
+	// FaultWrongTail is a tail which is not the last block
+	FaultWrongTail ChainFault = "wrong tail"
+)
+
+// ChainError reports the first broken link of a chain
+type ChainError struct {
+	BlockNumber int
+	Fault       ChainFault
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("block %d: %s", e.BlockNumber, e.Fault)
+}
+
+// VerifyBlocks checks that the blocks, as returned by GetBlocks, form a single
+// chain from the genesis block to the tail. It returns a *ChainError
+// reporting the first broken link in the order of the block numbers.
+func VerifyBlocks(tail string, blocks map[string]*blk.BlockContainer) error {
+	ordered := sortBlocks(blocks)
+
+	previousHash := make([]byte, 32)
+	for i, entry := range ordered {
+		block := entry.block
+		if hex.EncodeToString(block.Hash()) != entry.key {
+			return &ChainError{BlockNumber: block.BlockNumber(), Fault: FaultHashMismatch}
+		}
+		if block.BlockNumber() < i {
+			return &ChainError{BlockNumber: block.BlockNumber(), Fault: FaultDuplicateBlock}
+		}
+		if block.BlockNumber() > i {
+			return &ChainError{BlockNumber: i, Fault: FaultMissingBlock}
+		}
+		if !bytes.Equal(block.PreviousHash(), previousHash) {
+			return &ChainError{BlockNumber: i, Fault: FaultBrokenLink}
+		}
+		previousHash = block.Hash()
+	}
+
+	if tail != hex.EncodeToString(previousHash) {
+		return &ChainError{BlockNumber: len(ordered) - 1, Fault: FaultWrongTail}
+	}
+	return nil
+}
+
+// chainEntry is a block and the key it is stored under
+type chainEntry struct {
+	key   string
+	block *blk.BlockContainer
+}
+
+// sortBlocks orders the blocks by number, and by key for the same number
+func sortBlocks(blocks map[string]*blk.BlockContainer) []chainEntry {
+	ordered := make([]chainEntry, 0, len(blocks))
+	for key, block := range blocks {
+		ordered = append(ordered, chainEntry{key: key, block: block})
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		if ordered[i].block.BlockNumber() != ordered[j].block.BlockNumber() {
+			return ordered[i].block.BlockNumber() < ordered[j].block.BlockNumber()
+		}
+		return ordered[i].key < ordered[j].key
+	})
+	return ordered
+}
+
+// BlockIterator walks blocks in the order of their numbers, forward or
+// backward
+type BlockIterator struct {
+	blocks []chainEntry
+	pos    int
+	step   int
+}
+
+// NewBlockIterator returns an iterator over the blocks, as returned by
+// GetBlocks. Call Next before reading the first block.
+func NewBlockIterator(blocks map[string]*blk.BlockContainer, backward bool) *BlockIterator {
+	it := &BlockIterator{
+		blocks: sortBlocks(blocks),
+		pos:    -1,
+		step:   1,
+	}
+	if backward {
+		it.pos = len(it.blocks)
+		it.step = -1
+	}
+	return it
+}
+
+// Next moves to the next block, it returns false once all the blocks were
+// read
+func (it *BlockIterator) Next() bool {
+	it.pos += it.step
+	return it.pos >= 0 && it.pos < len(it.blocks)
+}
+
+// Block returns the current block
+func (it *BlockIterator) Block() *blk.BlockContainer {
+	return it.blocks[it.pos].block
+}
@@ -0,0 +1,143 @@
+package paxos
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"golang.org/x/xerrors"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+// createBlocks returns a valid chain of n blocks, in order
+func createBlocks(n int) []*blk.BlockContainer {
+	factory := blk.NewGenericBlockFactory()
+	blocks := make([]*blk.BlockContainer, n)
+	previousHash := make([]byte, 32)
+	for i := range blocks {
+		content := &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: float64(i)}}}}
+		if i == 0 {
+			blocks[i] = factory.NewGenesisBlock(blk.BlockPathStr, 0, content)
+		} else {
+			blocks[i] = factory.NewBlock(blk.BlockPathStr, i, previousHash, content)
+		}
+		previousHash = blocks[i].Hash()
+	}
+	return blocks
+}
+
+func toMap(blocks ...*blk.BlockContainer) map[string]*blk.BlockContainer {
+	m := make(map[string]*blk.BlockContainer)
+	for _, block := range blocks {
+		m[hex.EncodeToString(block.Hash())] = block
+	}
+	return m
+}
+
+func requireFault(t *testing.T, err error, blockNumber int, fault ChainFault) {
+	var chainErr *ChainError
+	require.True(t, xerrors.As(err, &chainErr), "unexpected error %v", err)
+	require.Equal(t, blockNumber, chainErr.BlockNumber)
+	require.Equal(t, fault, chainErr.Fault)
+}
+
+func TestVerifyBlocks(t *testing.T) {
+	blocks := createBlocks(4)
+	tail := hex.EncodeToString(blocks[3].Hash())
+
+	require.NoError(t, VerifyBlocks(tail, toMap(blocks...)))
+	require.NoError(t, VerifyBlocks(hex.EncodeToString(make([]byte, 32)), toMap()))
+
+	// A gap in the numbers
+	requireFault(t, VerifyBlocks(tail, toMap(blocks[0], blocks[1], blocks[3])), 2, FaultMissingBlock)
+
+	// A tail which is not the last block
+	requireFault(t, VerifyBlocks(hex.EncodeToString(blocks[2].Hash()), toMap(blocks...)), 3, FaultWrongTail)
+
+	// A block stored under another hash
+	wrongKey := toMap(blocks...)
+	wrongKey[hex.EncodeToString(blocks[2].Hash())] = blocks[1]
+	requireFault(t, VerifyBlocks(tail, wrongKey), 1, FaultHashMismatch)
+
+	// A second block with the same number
+	factory := blk.NewGenericBlockFactory()
+	fork := factory.NewBlock(blk.BlockPathStr, 2, blocks[1].Hash(), &blk.PathBlockContent{PatternID: "fork", Paths: [][]r3.Vec{}})
+	requireFault(t, VerifyBlocks(tail, toMap(append(blocks, fork)...)), 2, FaultDuplicateBlock)
+
+	// A block which does not follow the previous one
+	forged := factory.NewBlock(blk.BlockPathStr, 2, make([]byte, 32), &blk.PathBlockContent{PatternID: "forged", Paths: [][]r3.Vec{}})
+	requireFault(t, VerifyBlocks(tail, toMap(blocks[0], blocks[1], forged, blocks[3])), 2, FaultBrokenLink)
+}
+
+func TestBlockIterator(t *testing.T) {
+	blocks := createBlocks(5)
+
+	it := NewBlockIterator(toMap(blocks...), false)
+	for _, block := range blocks {
+		require.True(t, it.Next())
+		require.Equal(t, block.Hash(), it.Block().Hash())
+	}
+	require.False(t, it.Next())
+
+	it = NewBlockIterator(toMap(blocks...), true)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		require.True(t, it.Next())
+		require.Equal(t, blocks[i].Hash(), it.Block().Hash())
+	}
+	require.False(t, it.Next())
+
+	require.False(t, NewBlockIterator(toMap(), true).Next())
+}
+
+func TestBlockChain_Verify(t *testing.T) {
+	nodes := createChains(t, 3, ModeMultiPaxos, nil)
+	defer stopChains(nodes)
+
+	for blockNumber := 0; blockNumber < 2; blockNumber++ {
+		nodes[0].Lock()
+		nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "pattern", Paths: [][]r3.Vec{{{X: 1}}}})
+		nodes[0].Unlock()
+		waitBlock(t, nodes, blockNumber)
+	}
+
+	for _, node := range nodes {
+		require.NoError(t, node.chain.Verify())
+		it := node.chain.Iterator(true)
+		require.True(t, it.Next())
+		require.Equal(t, 1, it.Block().BlockNumber())
+	}
+}
+
+// refuseBad refuses the paths of the pattern "bad"
+func refuseBad(content blk.BlockContent) error {
+	if paths, ok := content.(*blk.PathBlockContent); ok && paths.PatternID == "bad" {
+		return xerrors.New("bad paths")
+	}
+	return nil
+}
+
+func TestBlockChain_ContentCheck(t *testing.T) {
+	for _, mode := range []Mode{ModePaxos, ModeMultiPaxos} {
+		// The acceptors never vote for the content they refuse, the proposer
+		// alone is no majority
+		nodes := createChains(t, 3, mode, nil)
+		for _, node := range nodes[1:] {
+			node.chain.SetContentCheck(refuseBad)
+		}
+
+		nodes[0].Lock()
+		nodes[0].chain.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "bad", Paths: [][]r3.Vec{{{X: 1}}}})
+		nodes[0].Unlock()
+		time.Sleep(2 * time.Second)
+		for i, node := range nodes {
+			select {
+			case <-node.decided:
+				t.Fatalf("node %d decided refused content in mode %v", i, mode)
+			default:
+			}
+		}
+		stopChains(nodes)
+	}
+}
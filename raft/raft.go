@@ -0,0 +1,694 @@
+package raft
+
+import (
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.dedis.ch/cs438/orbitalswarm/extramessage"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"go.dedis.ch/onet/v3/log"
+)
+
+const (
+	roleFollower  = 1
+	roleCandidate = 2
+	roleLeader    = 3
+)
+
+// maxEntries is the maximum number of entries sent in a single
+// RaftAppendEntries
+const maxEntries = 16
+
+// proposal is a block content waiting to be committed. It is dropped once a
+// block of the same type is committed after commitIndex, as a Paxos proposal
+// is dropped when another value is decided.
+type proposal struct {
+	content     blk.BlockContent
+	commitIndex int
+}
+
+// Raft replicates a chain of blocks with the Raft protocol, over the rumors of
+// the gossiper. The participants have the indexes 0 to numParticipant-1; the
+// readers follow the log of the leader without taking part in the elections.
+//
+// Nobody needs a leader while there is nothing to commit, so the elections
+// only start when a participant has a proposal, and the leader only sends
+// heartbeats while some entries are not committed everywhere.
+type Raft struct {
+	mutex sync.Mutex
+
+	// base config
+	nodeIndex       int
+	numParticipant  int
+	voter           bool
+	electionTimeout time.Duration
+	heartbeat       time.Duration
+	blockFactory    blk.BlockFactory
+
+	// election
+	role     int
+	term     int
+	votedFor int
+	leaderID int
+	votes    map[int]bool
+	deadline time.Time
+
+	// log, indexes start at 0
+	log             []extramessage.RaftEntry
+	commitIndex     int
+	nextIndex       []int
+	matchIndex      []int
+	lastResponse    []time.Time
+	broadcastCommit int
+	// term of the match indexes learnt from the responses to the leader
+	learnTerm int
+
+	pending []*proposal
+	// refuses the entries we must not append
+	check blk.ContentCheck
+
+	// chain of the committed blocks
+	applied int
+	tail    *blk.BlockContainer
+	blocks  map[string]*blk.BlockContainer
+
+	gossiper *gossip.Gossiper
+	// messages sent once the mutex is released
+	outbox []*extramessage.ExtraMessage
+
+	// closed to stop the timers
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewRaft creates a participant. The election timeout is between one and two
+// retry periods.
+func NewRaft(numParticipant int, nodeIndex int, retry int, blockFactory blk.BlockFactory) *Raft {
+	electionTimeout := time.Duration(retry) * time.Second
+	return &Raft{
+		nodeIndex:       nodeIndex,
+		numParticipant:  numParticipant,
+		voter:           nodeIndex < numParticipant,
+		electionTimeout: electionTimeout,
+		heartbeat:       electionTimeout / 4,
+		blockFactory:    blockFactory,
+
+		role:     roleFollower,
+		votedFor: -1,
+		leaderID: -1,
+
+		log:             make([]extramessage.RaftEntry, 0),
+		commitIndex:     -1,
+		nextIndex:       make([]int, numParticipant),
+		matchIndex:      make([]int, numParticipant),
+		lastResponse:    make([]time.Time, numParticipant),
+		broadcastCommit: -1,
+		learnTerm:       -1,
+
+		pending: make([]*proposal, 0),
+
+		applied: -1,
+		blocks:  make(map[string]*blk.BlockContainer),
+
+		stop: make(chan struct{}),
+	}
+}
+
+// NewRaftReader creates a node which only follows the log of the leader
+func NewRaftReader(numParticipant int, nodeIndex int, retry int, blockFactory blk.BlockFactory) *Raft {
+	r := NewRaft(numParticipant, nodeIndex, retry, blockFactory)
+	r.voter = false
+	return r
+}
+
+// SetContentCheck makes the voters append only the entries whose contents
+// pass the check. An entry refused stays uncommitted until a majority accepts
+// it.
+func (r *Raft) SetContentCheck(check blk.ContentCheck) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.check = check
+}
+
+// IsLeader tells whether the node is the leader of the current term
+func (r *Raft) IsLeader() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.role == roleLeader
+}
+
+// Term returns the current term
+func (r *Raft) Term() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.term
+}
+
+// Propose a block content. The leader appends it to its log right away, the
+// followers forward it to the leader and try again, or start an election, if
+// no block of the same type is committed in time.
+func (r *Raft) Propose(g *gossip.Gossiper, blockContent blk.BlockContent) {
+	r.mutex.Lock()
+	defer r.unlock()
+	r.start(g)
+
+	if !r.voter {
+		return
+	}
+	if err := r.check.Content(blockContent); err != nil {
+		log.Printf("Raft node %d refuses its own proposal: %s", r.nodeIndex, err)
+		return
+	}
+	log.Printf("Block type of propose : %s", blockContent.BlockType())
+	if r.role == roleLeader {
+		r.appendLocked(blockContent)
+		r.sendAppendEntriesLocked()
+		return
+	}
+	p := &proposal{
+		content:     blockContent,
+		commitIndex: r.commitIndex,
+	}
+	r.pending = append(r.pending, p)
+	if r.leaderID >= 0 {
+		r.forwardLocked(p)
+		r.resetDeadlineLocked()
+	} else if r.deadline.IsZero() {
+		// No leader to wait for, only spread the candidates apart
+		r.deadline = time.Now().Add(time.Duration(rand.Int63n(int64(r.electionTimeout / 2))))
+	}
+}
+
+// GetBlocks returns all the committed blocks. Key is the hexadecimal
+// representation of the block's hash. The first return is the hexadecimal
+// hash of the last block.
+func (r *Raft) GetBlocks() (string, map[string]*blk.BlockContainer) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	blocks := make(map[string]*blk.BlockContainer, len(r.blocks))
+	for hash, block := range r.blocks {
+		blocks[hash] = block
+	}
+	if r.tail == nil {
+		return hex.EncodeToString(make([]byte, 32)), blocks
+	}
+	return hex.EncodeToString(r.tail.Hash()), blocks
+}
+
+// HandleExtraMessage handles the Raft messages. It returns the last block it
+// committed, if any.
+func (r *Raft) HandleExtraMessage(g *gossip.Gossiper, msg *extramessage.ExtraMessage) *blk.BlockContainer {
+	r.mutex.Lock()
+	defer r.unlock()
+	r.start(g)
+
+	switch {
+	case msg.RaftRequestVote != nil:
+		r.uponRequestVote(msg.RaftRequestVote)
+	case msg.RaftVote != nil:
+		r.uponVote(msg.RaftVote)
+	case msg.RaftAppendEntries != nil:
+		return r.uponAppendEntries(msg.RaftAppendEntries)
+	case msg.RaftAppendResponse != nil:
+		return r.uponAppendResponse(msg.RaftAppendResponse)
+	case msg.RaftForward != nil:
+		r.uponForward(msg.RaftForward)
+	}
+	return nil
+}
+
+// start the timers of the node, once the gossiper is known
+func (r *Raft) start(g *gossip.Gossiper) {
+	if r.gossiper != nil {
+		r.gossiper = g
+		return
+	}
+	r.gossiper = g
+	if r.voter {
+		go r.run()
+	}
+}
+
+func (r *Raft) run() {
+	ticker := time.NewTicker(r.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.tick(now)
+		}
+	}
+}
+
+// Stop stops the timers of the node, which then neither sends heartbeats nor
+// starts elections
+func (r *Raft) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+}
+
+func (r *Raft) tick(now time.Time) {
+	r.mutex.Lock()
+	defer r.unlock()
+
+	switch r.role {
+	case roleLeader:
+		if r.commitIndex < r.lastIndex() || r.broadcastCommit < r.commitIndex {
+			r.sendAppendEntriesLocked()
+		}
+	case roleCandidate:
+		if now.After(r.deadline) {
+			r.startElectionLocked()
+		}
+	case roleFollower:
+		if len(r.pending) == 0 || now.Before(r.deadline) {
+			return
+		}
+		if r.leaderID < 0 {
+			r.startElectionLocked()
+			return
+		}
+		// The leader did not commit anything of the type, give it the
+		// proposals again
+		for _, p := range r.pending {
+			r.forwardLocked(p)
+		}
+		// Assume the leader is dead if it does not answer
+		r.leaderID = -1
+		r.resetDeadlineLocked()
+	}
+}
+
+func (r *Raft) forwardLocked(p *proposal) {
+	r.send(&extramessage.ExtraMessage{RaftForward: &extramessage.RaftForward{
+		Term:        r.term,
+		LeaderID:    r.leaderID,
+		CommitIndex: p.commitIndex,
+		Value:       r.blockFactory.NewGenesisBlock(p.content.BlockType(), 0, p.content),
+	}})
+}
+
+// send queues a message, it is sent by unlock
+func (r *Raft) send(msg *extramessage.ExtraMessage) {
+	r.outbox = append(r.outbox, msg)
+}
+
+// unlock releases the mutex and sends the queued messages, so that the
+// handler of the gossiper never waits for the mutex while we wait for it
+func (r *Raft) unlock() {
+	outbox := r.outbox
+	g := r.gossiper
+	r.outbox = nil
+	r.mutex.Unlock()
+
+	for _, msg := range outbox {
+		if g != nil {
+			g.AddExtraMessage(msg)
+		}
+	}
+}
+
+func (r *Raft) resetDeadlineLocked() {
+	timeout := r.electionTimeout + time.Duration(rand.Int63n(int64(r.electionTimeout)+1))
+	r.deadline = time.Now().Add(timeout)
+}
+
+func (r *Raft) lastIndex() int {
+	return len(r.log) - 1
+}
+
+func (r *Raft) lastTerm() int {
+	if len(r.log) == 0 {
+		return -1
+	}
+	return r.log[len(r.log)-1].Term
+}
+
+func (r *Raft) majority() int {
+	return r.numParticipant/2 + 1
+}
+
+// stepDownLocked makes the node a follower of a newer term
+func (r *Raft) stepDownLocked(term int) {
+	if term > r.term {
+		r.term = term
+		r.votedFor = -1
+		r.leaderID = -1
+	}
+	r.role = roleFollower
+}
+
+// --- Election ---
+
+func (r *Raft) startElectionLocked() {
+	r.term++
+	r.role = roleCandidate
+	r.votedFor = r.nodeIndex
+	r.leaderID = -1
+	r.votes = map[int]bool{r.nodeIndex: true}
+	r.resetDeadlineLocked()
+
+	log.Printf("Raft node %d candidate for term %d", r.nodeIndex, r.term)
+	if len(r.votes) >= r.majority() {
+		r.becomeLeaderLocked()
+		return
+	}
+	r.send(&extramessage.ExtraMessage{RaftRequestVote: &extramessage.RaftRequestVote{
+		Term:         r.term,
+		CandidateID:  r.nodeIndex,
+		LastLogIndex: r.lastIndex(),
+		LastLogTerm:  r.lastTerm(),
+	}})
+}
+
+func (r *Raft) uponRequestVote(msg *extramessage.RaftRequestVote) {
+	if !r.voter {
+		return
+	}
+	if msg.Term > r.term {
+		r.stepDownLocked(msg.Term)
+	}
+
+	upToDate := msg.LastLogTerm > r.lastTerm() ||
+		(msg.LastLogTerm == r.lastTerm() && msg.LastLogIndex >= r.lastIndex())
+	granted := msg.Term == r.term && upToDate &&
+		(r.votedFor == -1 || r.votedFor == msg.CandidateID)
+	if granted {
+		r.votedFor = msg.CandidateID
+		r.resetDeadlineLocked()
+	}
+	r.send(&extramessage.ExtraMessage{RaftVote: &extramessage.RaftVote{
+		Term:        r.term,
+		VoterID:     r.nodeIndex,
+		CandidateID: msg.CandidateID,
+		Granted:     granted,
+	}})
+}
+
+func (r *Raft) uponVote(msg *extramessage.RaftVote) {
+	if !r.voter {
+		return
+	}
+	if msg.Term > r.term {
+		r.stepDownLocked(msg.Term)
+		return
+	}
+	if r.role != roleCandidate || msg.Term != r.term || msg.CandidateID != r.nodeIndex || !msg.Granted {
+		return
+	}
+	r.votes[msg.VoterID] = true
+	if len(r.votes) >= r.majority() {
+		r.becomeLeaderLocked()
+	}
+}
+
+func (r *Raft) becomeLeaderLocked() {
+	log.Printf("Raft node %d leader of term %d", r.nodeIndex, r.term)
+	r.role = roleLeader
+	r.leaderID = r.nodeIndex
+	now := time.Now()
+	for i := range r.nextIndex {
+		r.nextIndex[i] = len(r.log)
+		r.matchIndex[i] = -1
+		r.lastResponse[i] = now
+	}
+	r.matchIndex[r.nodeIndex] = r.lastIndex()
+
+	for _, p := range r.pending {
+		r.appendLocked(p.content)
+	}
+	r.pending = r.pending[:0]
+	r.sendAppendEntriesLocked()
+}
+
+// --- Replication ---
+
+// appendLocked appends a block with the given content to the log of the
+// leader
+func (r *Raft) appendLocked(content blk.BlockContent) {
+	index := len(r.log)
+	var block *blk.BlockContainer
+	if index == 0 {
+		block = r.blockFactory.NewGenesisBlock(content.BlockType(), 0, content)
+	} else {
+		block = r.blockFactory.NewBlock(content.BlockType(), index, r.log[index-1].Value.Hash(), content)
+	}
+	r.log = append(r.log, extramessage.RaftEntry{Term: r.term, Value: block})
+	r.matchIndex[r.nodeIndex] = r.lastIndex()
+	r.advanceCommitLocked()
+}
+
+// sendAppendEntriesLocked broadcasts the entries the followers which answer
+// lack
+func (r *Raft) sendAppendEntriesLocked() {
+	now := time.Now()
+	next := len(r.log)
+	for i := range r.nextIndex {
+		if i != r.nodeIndex && now.Sub(r.lastResponse[i]) < 2*r.electionTimeout && r.nextIndex[i] < next {
+			next = r.nextIndex[i]
+		}
+	}
+	end := len(r.log)
+	if end-next > maxEntries {
+		end = next + maxEntries
+	}
+
+	msg := &extramessage.RaftAppendEntries{
+		Term:         r.term,
+		LeaderID:     r.nodeIndex,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  -1,
+		Entries:      append([]extramessage.RaftEntry{}, r.log[next:end]...),
+		LeaderCommit: r.commitIndex,
+	}
+	if next > 0 {
+		msg.PrevLogTerm = r.log[next-1].Term
+	}
+	r.broadcastCommit = r.commitIndex
+	r.send(&extramessage.ExtraMessage{RaftAppendEntries: msg})
+}
+
+func (r *Raft) uponAppendEntries(msg *extramessage.RaftAppendEntries) *blk.BlockContainer {
+	if msg.Term < r.term {
+		if r.voter {
+			r.sendAppendResponseLocked(msg.LeaderID, false, -1)
+		}
+		return nil
+	}
+	if msg.Term > r.term || r.role != roleFollower {
+		r.stepDownLocked(msg.Term)
+	}
+	r.leaderID = msg.LeaderID
+	r.resetDeadlineLocked()
+
+	// Check that the log matches the one of the leader up to PrevLogIndex
+	if msg.PrevLogIndex > r.lastIndex() ||
+		(msg.PrevLogIndex >= 0 && r.log[msg.PrevLogIndex].Term != msg.PrevLogTerm) {
+		if r.voter {
+			match := r.lastIndex()
+			if match >= msg.PrevLogIndex {
+				match = msg.PrevLogIndex - 1
+			}
+			r.sendAppendResponseLocked(msg.LeaderID, false, match)
+		}
+		return nil
+	}
+
+	match := msg.PrevLogIndex
+	for i, entry := range msg.Entries {
+		index := msg.PrevLogIndex + 1 + i
+		if index <= r.lastIndex() && r.log[index].Term == entry.Term {
+			match = index
+			continue
+		}
+		if r.voter {
+			if err := r.check.Block(entry.Value); err != nil {
+				log.Printf("Raft node %d refuses entry %d: %s", r.nodeIndex, index, err)
+				break
+			}
+		}
+		if index <= r.lastIndex() {
+			r.log = r.log[:index]
+		}
+		r.log = append(r.log, entry)
+		match = index
+	}
+
+	if msg.LeaderCommit > r.commitIndex {
+		r.commitIndex = msg.LeaderCommit
+		if r.commitIndex > match {
+			r.commitIndex = match
+		}
+	}
+	// The responses of the other followers may have come first
+	r.commitLearntLocked()
+	if r.voter && len(msg.Entries) > 0 {
+		r.sendAppendResponseLocked(msg.LeaderID, true, match)
+	}
+	return r.applyLocked()
+}
+
+func (r *Raft) sendAppendResponseLocked(leaderID int, success bool, match int) {
+	r.send(&extramessage.ExtraMessage{RaftAppendResponse: &extramessage.RaftAppendResponse{
+		Term:       r.term,
+		FollowerID: r.nodeIndex,
+		LeaderID:   leaderID,
+		Success:    success,
+		MatchIndex: match,
+	}})
+}
+
+func (r *Raft) uponAppendResponse(msg *extramessage.RaftAppendResponse) *blk.BlockContainer {
+	if msg.FollowerID < 0 || msg.FollowerID >= r.numParticipant || msg.Term < r.term {
+		return nil
+	}
+	if msg.Success && (msg.Term > r.term || (r.leaderID < 0 && r.role != roleLeader)) {
+		// The follower accepted the entries of the leader of its term
+		r.stepDownLocked(msg.Term)
+		r.leaderID = msg.LeaderID
+		r.resetDeadlineLocked()
+	} else if msg.Term > r.term {
+		if r.voter {
+			r.stepDownLocked(msg.Term)
+		}
+		return nil
+	}
+	if msg.LeaderID != r.leaderID {
+		return nil
+	}
+
+	f := msg.FollowerID
+	if r.role != roleLeader {
+		// The responses are broadcast, so every node learns what is committed
+		// without waiting for the next message of the leader
+		if msg.Success {
+			r.learnLocked(f, msg.MatchIndex)
+		}
+		return r.applyLocked()
+	}
+
+	r.lastResponse[f] = time.Now()
+	if msg.Success {
+		if msg.MatchIndex > r.matchIndex[f] {
+			r.matchIndex[f] = msg.MatchIndex
+		}
+		r.nextIndex[f] = r.matchIndex[f] + 1
+		r.advanceCommitLocked()
+		return r.applyLocked()
+	}
+
+	next := msg.MatchIndex + 1
+	if next >= r.nextIndex[f] {
+		next = r.nextIndex[f] - 1
+	}
+	if next < 0 {
+		next = 0
+	}
+	r.nextIndex[f] = next
+	return nil
+}
+
+// learnLocked records the match index of a follower of the current leader,
+// and commits the entries a majority stores
+func (r *Raft) learnLocked(follower, match int) {
+	if r.learnTerm != r.term {
+		r.learnTerm = r.term
+		for i := range r.matchIndex {
+			r.matchIndex[i] = -1
+		}
+	}
+	if match > r.matchIndex[follower] {
+		r.matchIndex[follower] = match
+	}
+	r.commitLearntLocked()
+}
+
+// commitLearntLocked commits the entries of the current term the learnt
+// match indexes show on a majority. The leader stores every entry it sent.
+func (r *Raft) commitLearntLocked() {
+	if r.learnTerm != r.term {
+		return
+	}
+	for index := r.lastIndex(); index > r.commitIndex; index-- {
+		if r.log[index].Term != r.term {
+			return
+		}
+		count := 0
+		for i, m := range r.matchIndex {
+			if m >= index || i == r.leaderID {
+				count++
+			}
+		}
+		if count >= r.majority() {
+			r.commitIndex = index
+			return
+		}
+	}
+}
+
+// advanceCommitLocked commits the entries of the current term stored by a
+// majority
+func (r *Raft) advanceCommitLocked() {
+	for index := r.lastIndex(); index > r.commitIndex; index-- {
+		if r.log[index].Term != r.term {
+			return
+		}
+		count := 0
+		for _, match := range r.matchIndex {
+			if match >= index {
+				count++
+			}
+		}
+		if count >= r.majority() {
+			r.commitIndex = index
+			return
+		}
+	}
+}
+
+func (r *Raft) uponForward(msg *extramessage.RaftForward) {
+	if r.role != roleLeader || msg.LeaderID != r.nodeIndex || msg.Value == nil || msg.Value.IsContentNil() {
+		return
+	}
+	// Drop the proposal when a block of the same type was appended since
+	for index := msg.CommitIndex + 1; index <= r.lastIndex(); index++ {
+		if index >= 0 && r.log[index].Value.Type == msg.Value.Type {
+			return
+		}
+	}
+	if err := r.check.Block(msg.Value); err != nil {
+		log.Printf("Raft leader %d refuses a forwarded proposal: %s", r.nodeIndex, err)
+		return
+	}
+	r.appendLocked(msg.Value.GetContent())
+	r.sendAppendEntriesLocked()
+}
+
+// applyLocked adds the newly committed entries to the chain and returns the
+// last one
+func (r *Raft) applyLocked() *blk.BlockContainer {
+	var block *blk.BlockContainer
+	for r.applied < r.commitIndex {
+		r.applied++
+		block = r.log[r.applied].Value
+		r.blocks[hex.EncodeToString(block.Hash())] = block
+		r.tail = block
+
+		// Drop the proposals this block supersedes
+		pending := r.pending[:0]
+		for _, p := range r.pending {
+			if p.content.BlockType() != block.Type || p.commitIndex >= r.applied {
+				pending = append(pending, p)
+			}
+		}
+		r.pending = pending
+	}
+	return block
+}
@@ -0,0 +1,199 @@
+package raft
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.dedis.ch/cs438/orbitalswarm/gossip"
+	"go.dedis.ch/cs438/orbitalswarm/paxos/blk"
+	"golang.org/x/xerrors"
+)
+
+type testNode struct {
+	sync.Mutex
+	gossiper *gossip.Gossiper
+	raft     *Raft
+	decided  chan *blk.BlockContainer
+}
+
+// createNodes creates numParticipant participants followed by the given
+// number of readers
+func createNodes(t *testing.T, numParticipant, numReader int) []*testNode {
+	fac := gossip.NewMemoryGossipFactory(gossip.NewMemoryNetwork(1), gossip.NewJSONCodec())
+	nodes := make([]*testNode, numParticipant+numReader)
+	addresses := make([]string, len(nodes))
+	for i := range nodes {
+		g, err := fac.New("", fmt.Sprintf("node%d", i), 10, 0, len(nodes))
+		require.NoError(t, err)
+
+		node := &testNode{
+			gossiper: g,
+			decided:  make(chan *blk.BlockContainer, 10),
+		}
+		if i < numParticipant {
+			node.raft = NewRaft(numParticipant, i, 1, blk.NewGenericBlockFactory())
+		} else {
+			node.raft = NewRaftReader(numParticipant, i, 1, blk.NewGenericBlockFactory())
+		}
+		g.RegisterCallback(func(origin string, msg gossip.GossipPacket) {
+			if msg.Rumor == nil || msg.Rumor.Extra == nil {
+				return
+			}
+			block := node.raft.HandleExtraMessage(node.gossiper, msg.Rumor.Extra)
+			if block != nil {
+				node.decided <- block
+			}
+		})
+		nodes[i] = node
+		addresses[i] = g.GetLocalAddr()
+	}
+
+	for i, node := range nodes {
+		for j, address := range addresses {
+			if i != j {
+				node.gossiper.AddAddresses(address)
+			}
+		}
+		ready := make(chan struct{})
+		go node.gossiper.Run(ready)
+		<-ready
+	}
+	return nodes
+}
+
+func waitBlock(t *testing.T, nodes []*testNode, patternID string) {
+	for _, node := range nodes {
+		select {
+		case block := <-node.decided:
+			require.Equal(t, patternID, block.GetContent().(*blk.PathBlockContent).PatternID)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%s not committed", patternID)
+		}
+	}
+}
+
+func leader(nodes []*testNode) int {
+	for i, node := range nodes {
+		if node.raft.IsLeader() {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRaft_Replication(t *testing.T) {
+	nodes := createNodes(t, 3, 1)
+	defer func() {
+		for _, node := range nodes {
+			node.raft.Stop()
+			node.gossiper.Stop()
+		}
+	}()
+
+	// Nobody is leader until there is something to commit
+	time.Sleep(100 * time.Millisecond)
+	require.Equal(t, -1, leader(nodes))
+
+	nodes[1].raft.Propose(nodes[1].gossiper, &blk.PathBlockContent{PatternID: "first"})
+	waitBlock(t, nodes, "first")
+	first := leader(nodes)
+	require.NotEqual(t, -1, first)
+
+	// A follower forwards its proposal to the leader
+	follower := (first + 1) % 3
+	nodes[follower].raft.Propose(nodes[follower].gossiper, &blk.PathBlockContent{PatternID: "second"})
+	waitBlock(t, nodes, "second")
+	require.Equal(t, first, leader(nodes))
+
+	// Every node, readers included, has the same chain
+	tail, blocks := nodes[0].raft.GetBlocks()
+	require.Len(t, blocks, 2)
+	for _, node := range nodes[1:] {
+		otherTail, otherBlocks := node.raft.GetBlocks()
+		require.Equal(t, tail, otherTail)
+		require.Len(t, otherBlocks, 2)
+	}
+}
+
+func TestRaft_LeaderCrash(t *testing.T) {
+	nodes := createNodes(t, 3, 0)
+	defer func() {
+		for _, node := range nodes {
+			node.raft.Stop()
+			node.gossiper.Stop()
+		}
+	}()
+
+	nodes[0].raft.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "first"})
+	waitBlock(t, nodes, "first")
+	first := leader(nodes)
+	term := nodes[first].raft.Term()
+
+	nodes[first].raft.Stop()
+	nodes[first].gossiper.Stop()
+	alive := make([]*testNode, 0, 2)
+	for i, node := range nodes {
+		if i != first {
+			alive = append(alive, node)
+		}
+	}
+	nodes = alive
+
+	alive[0].raft.Propose(alive[0].gossiper, &blk.PathBlockContent{PatternID: "second"})
+	waitBlock(t, alive, "second")
+	second := leader(alive)
+	require.NotEqual(t, -1, second)
+	require.Greater(t, alive[second].raft.Term(), term)
+}
+
+func TestRaft_ContentCheck(t *testing.T) {
+	nodes := createNodes(t, 3, 0)
+	defer func() {
+		for _, node := range nodes {
+			node.raft.Stop()
+			node.gossiper.Stop()
+		}
+	}()
+	for _, node := range nodes[1:] {
+		node.raft.SetContentCheck(func(content blk.BlockContent) error {
+			if content.(*blk.PathBlockContent).PatternID == "bad" {
+				return xerrors.New("bad paths")
+			}
+			return nil
+		})
+	}
+
+	nodes[0].raft.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "first"})
+	waitBlock(t, nodes, "first")
+
+	// Whether node 0 leads or forwards it, the others never vote for it
+	nodes[0].raft.Propose(nodes[0].gossiper, &blk.PathBlockContent{PatternID: "bad"})
+	time.Sleep(2 * time.Second)
+	for i, node := range nodes {
+		select {
+		case <-node.decided:
+			t.Fatalf("node %d committed refused content", i)
+		default:
+		}
+	}
+}
+
+func TestRaft_Stop(t *testing.T) {
+	r := NewRaft(1, 0, 1, blk.NewGenericBlockFactory())
+	done := make(chan struct{})
+	go func() {
+		r.run()
+		close(done)
+	}()
+
+	r.Stop()
+	r.Stop()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timers not stopped")
+	}
+}
@@ -0,0 +1,146 @@
+package world
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+
+	"golang.org/x/xerrors"
+	"gonum.org/v1/gonum/spatial/r3"
+	"gopkg.in/yaml.v2"
+)
+
+// Box is an axis-aligned box between two opposite corners, its faces
+// included
+type Box struct {
+	Min r3.Vec `yaml:"min"`
+	Max r3.Vec `yaml:"max"`
+}
+
+// Contains tells whether the point is in the box
+func (b Box) Contains(p r3.Vec) bool {
+	return p.X >= b.Min.X && p.X <= b.Max.X && p.Y >= b.Min.Y && p.Y <= b.Max.Y &&
+		p.Z >= b.Min.Z && p.Z <= b.Max.Z
+}
+
+// Crosses tells whether the segment between two points goes through the box
+func (b Box) Crosses(from, to r3.Vec) bool {
+	// Clip the segment by the slab of each axis
+	low, high := 0.0, 1.0
+	for _, axis := range [][4]float64{
+		{from.X, to.X, b.Min.X, b.Max.X},
+		{from.Y, to.Y, b.Min.Y, b.Max.Y},
+		{from.Z, to.Z, b.Min.Z, b.Max.Z},
+	} {
+		start, delta, min, max := axis[0], axis[1]-axis[0], axis[2], axis[3]
+		if delta == 0 {
+			if start < min || start > max {
+				return false
+			}
+			continue
+		}
+		t1, t2 := (min-start)/delta, (max-start)/delta
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		low, high = math.Max(low, t1), math.Min(high, t2)
+		if low > high {
+			return false
+		}
+	}
+	return true
+}
+
+// World is the static map the drones fly in. Besides the ground, the drones
+// must stay out of the obstacles and of the no-fly volumes, and under the
+// ceiling. A nil World only has the ground.
+type World struct {
+	// Obstacles are solid boxes, such as buildings
+	Obstacles []Box `json:",omitempty" yaml:"obstacles"`
+	// NoFly are the volumes where the drones are not allowed
+	NoFly []Box `json:",omitempty" yaml:"nofly"`
+	// Ceiling is the highest altitude allowed, none when zero
+	Ceiling float64 `json:",omitempty" yaml:"ceiling"`
+}
+
+// Load reads a world from a YAML file, or a JSON one for other extensions
+func Load(path string) (*World, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, xerrors.Errorf("unable to read the world: %v", err)
+	}
+
+	w := &World{}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, w)
+	default:
+		err = json.Unmarshal(data, w)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("unable to parse the world: %v", err)
+	}
+
+	if w.Ceiling < 0 {
+		return nil, xerrors.Errorf("ceiling %g under the ground", w.Ceiling)
+	}
+	for i, b := range w.Boxes() {
+		if b.Min.X > b.Max.X || b.Min.Y > b.Max.Y || b.Min.Z > b.Max.Z {
+			return nil, xerrors.Errorf("box %d has its corners swapped", i)
+		}
+	}
+	return w, nil
+}
+
+// Boxes returns the obstacles and the no-fly volumes
+func (w *World) Boxes() []Box {
+	if w == nil {
+		return nil
+	}
+	return append(append([]Box{}, w.Obstacles...), w.NoFly...)
+}
+
+// Free tells whether a drone may be at the given point
+func (w *World) Free(p r3.Vec) bool {
+	if p.Y < 0 {
+		return false
+	}
+	if w == nil {
+		return true
+	}
+	if w.Ceiling > 0 && p.Y > w.Ceiling {
+		return false
+	}
+	for _, b := range w.Boxes() {
+		if b.Contains(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// SegmentFree tells whether a drone may fly straight between two points
+func (w *World) SegmentFree(from, to r3.Vec) bool {
+	if !w.Free(from) || !w.Free(to) {
+		return false
+	}
+	for _, b := range w.Boxes() {
+		if b.Crosses(from, to) {
+			return false
+		}
+	}
+	return true
+}
+
+// Copy returns a deep copy of the world
+func (w *World) Copy() *World {
+	if w == nil {
+		return nil
+	}
+	return &World{
+		Obstacles: append([]Box(nil), w.Obstacles...),
+		NoFly:     append([]Box(nil), w.NoFly...),
+		Ceiling:   w.Ceiling,
+	}
+}
@@ -0,0 +1,76 @@
+package world
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/spatial/r3"
+)
+
+func TestWorld_Free(t *testing.T) {
+	var empty *World
+	require.True(t, empty.Free(r3.Vec{Y: 100}))
+	require.False(t, empty.Free(r3.Vec{Y: -0.5}))
+
+	w := &World{
+		Obstacles: []Box{{Min: r3.Vec{X: 1, Y: 0, Z: -1}, Max: r3.Vec{X: 2, Y: 5, Z: 1}}},
+		NoFly:     []Box{{Min: r3.Vec{X: -3, Y: 2, Z: -3}, Max: r3.Vec{X: -1, Y: 4, Z: -1}}},
+		Ceiling:   10,
+	}
+	require.True(t, w.Free(r3.Vec{Y: 10}))
+	require.False(t, w.Free(r3.Vec{Y: 10.5}))
+	require.False(t, w.Free(r3.Vec{X: 1, Y: 5, Z: 0}))
+	require.False(t, w.Free(r3.Vec{X: -2, Y: 3, Z: -2}))
+	require.True(t, w.Free(r3.Vec{X: -2, Y: 1, Z: -2}))
+}
+
+func TestWorld_SegmentFree(t *testing.T) {
+	w := &World{Obstacles: []Box{{Min: r3.Vec{X: 1, Y: 0, Z: -1}, Max: r3.Vec{X: 2, Y: 5, Z: 1}}}}
+
+	// Through the wall, over it, beside it, and along its face
+	require.False(t, w.SegmentFree(r3.Vec{X: 0, Y: 1}, r3.Vec{X: 3, Y: 1}))
+	require.True(t, w.SegmentFree(r3.Vec{X: 0, Y: 6}, r3.Vec{X: 3, Y: 6}))
+	require.True(t, w.SegmentFree(r3.Vec{X: 0, Y: 1, Z: 2}, r3.Vec{X: 3, Y: 1, Z: 2}))
+	require.False(t, w.SegmentFree(r3.Vec{X: 0, Y: 1, Z: 1}, r3.Vec{X: 3, Y: 1, Z: 1}))
+	// Clipping a corner
+	require.False(t, w.SegmentFree(r3.Vec{X: 0, Y: 1, Z: 1.5}, r3.Vec{X: 1.5, Y: 1, Z: 0}))
+	require.True(t, w.SegmentFree(r3.Vec{X: 0, Y: 1, Z: 1.5}, r3.Vec{X: 0.5, Y: 1, Z: 1}))
+}
+
+func TestWorld_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "world")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	expected := &World{
+		Obstacles: []Box{{Min: r3.Vec{X: 1, Y: 0, Z: -1}, Max: r3.Vec{X: 2, Y: 5, Z: 1}}},
+		Ceiling:   12.5,
+	}
+	files := map[string]string{
+		"world.yaml": "obstacles:\n  - min: {x: 1, y: 0, z: -1}\n    max: {x: 2, y: 5, z: 1}\nceiling: 12.5\n",
+		"world.json": `{"Obstacles": [{"Min": {"X": 1, "Y": 0, "Z": -1}, "Max": {"X": 2, "Y": 5, "Z": 1}}], "Ceiling": 12.5}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		w, err := Load(path)
+		require.NoError(t, err, name)
+		require.Equal(t, expected, w, name)
+	}
+
+	for name, content := range map[string]string{
+		"swapped.json": `{"NoFly": [{"Min": {"X": 2}, "Max": {"X": 1}}]}`,
+		"ceiling.json": `{"Ceiling": -1}`,
+		"unknown.yaml": "walls: []\n",
+	} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+		_, err := Load(path)
+		require.Error(t, err, name)
+	}
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	require.Error(t, err)
+}